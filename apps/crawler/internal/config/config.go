@@ -2,14 +2,71 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"net/textproto"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// Rate limit preflight modes
+const (
+	PreflightOff      = "off"      // never check the quota before a crawl
+	PreflightRefuse   = "refuse"   // fail crawls that would exceed the remaining quota
+	PreflightThrottle = "throttle" // slow requests down so the quota lasts until reset
+)
+
+// Result overflow strategies
+const (
+	ResultOverflowBlock = "block" // workers stop fetching until the collector catches up
+	ResultOverflowSpill = "spill" // overflow results are buffered on disk
+)
+
+// GitHub authentication methods, see GITHUB_AUTH_ORDER
+const (
+	AuthMethodToken = "token" // the personal access token in GITHUB_TOKEN
+	AuthMethodApp   = "app"   // a GitHub App installation token
 )
 
+// Content transforms, see CONTENT_TRANSFORMS
+const (
+	TransformStripBOM               = "strip_bom"                // drop a leading UTF-8 byte order mark
+	TransformNormalizeEOL           = "normalize_eol"            // CRLF and lone CR line endings become LF
+	TransformTrimTrailingWhitespace = "trim_trailing_whitespace" // spaces and tabs at the end of lines are dropped
+)
+
+// Retry strategies
+const (
+	RetryExponential    = "exponential"     // every retry waits, growing by the multiplier
+	RetryImmediateFirst = "immediate-first" // the first retry goes out at once, later ones back off
+)
+
+// DefaultGitHubAPIVersion is the REST API version requested unless
+// GITHUB_API_VERSION overrides it
+const DefaultGitHubAPIVersion = "2022-11-28"
+
+// DefaultSpecialFiles are extensionless or manifest filenames crawled
+// regardless of ALLOWED_EXTENSIONS, matched case-insensitively
+var DefaultSpecialFiles = []string{
+	"dockerfile", "makefile", "rakefile", "gemfile", "guardfile",
+	"capfile", "berksfile", "cheffile", "vagrantfile", "fastfile",
+	"appfile", "deliverfile", "matchfile", "gymfile", "scanfile",
+	"snapfile", "podfile", "cartfile", "brewfile", "requirements.txt",
+	"setup.py", "setup.cfg", "pyproject.toml", "pipfile", "poetry.lock",
+	"package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml",
+	"composer.json", "composer.lock", "go.mod", "go.sum", "cargo.toml",
+	"cargo.lock", "build.gradle", "pom.xml", "build.sbt", "mix.exs",
+	"deps.edn", "project.clj", "stack.yaml", "cabal.project",
+}
+
 // Config holds all configuration for the crawler service
 type Config struct {
 	// Server settings
@@ -23,28 +80,194 @@ type Config struct {
 	GitHubAppKey    string // GitHub App private key
 	GitHubInstallID string // GitHub App installation ID
 
+	// GitHubAuthOrder lists the authentication methods to try, most preferred
+	// first. Methods without credentials are skipped; when several are set up,
+	// a request the first is refused for is retried with the next.
+	GitHubAuthOrder []string
+
+	// GitHubAPIVersion pins the REST API version sent as X-GitHub-Api-Version,
+	// so a new GitHub default can't change responses under us
+	GitHubAPIVersion string
+
+	// GitHubExtraHeaders are sent on every GitHub request, such as headers an
+	// enterprise proxy requires. Names are canonicalized, and a header with a
+	// default value, like Accept, replaces the default.
+	GitHubExtraHeaders map[string]string
+
+	// RawMirrorBaseURL is a raw content mirror laid out like
+	// raw.githubusercontent.com, tried before GitHub for every file; misses
+	// and errors fall back to GitHub. Empty disables it.
+	RawMirrorBaseURL string
+
 	// Worker pool settings
-	MaxWorkers int
+	MaxWorkers          int
+	WorkerIdleTimeoutMS int // idle workers exit after this long and are re-spawned on demand, 0 disables
+	ShutdownTimeoutMS   int // Stop waits this long for workers before abandoning stuck ones, 0 waits forever
+
+	// RampUpMS spreads the start of fetching on an idle pool from
+	// RampUpInitialWorkers concurrent fetches to MaxWorkers over this long,
+	// 0 starts at full concurrency
+	RampUpMS             int
+	RampUpInitialWorkers int
+
+	// ResultBatchSize has each worker gather up to this many results for a
+	// crawl before handing them over in one channel send, so thousands of
+	// workers don't contend on a crawl's result channel. 1 sends each result
+	// on its own.
+	ResultBatchSize int
 
 	// Rate limiting
 	APIRateLimitThreshold int
+	TreeRequestCost       int    // limiter tokens reserved per tree fetch
+	ContentRequestCost    int    // limiter tokens reserved per content fetch
+	RateLimitPreflight    string // off, refuse or throttle when a crawl would exceed the remaining quota
+	RateLimitReserve      int    // GitHub quota never consumed; requests pause until reset below it
+	WarmRateLimiter       bool   // seed the limiter from GET /rate_limit at startup
+	AllowDegradedStartup  bool   // start unauthenticated and report unhealthy when every auth method fails
+
+	// RawRateLimitThreshold gives raw content requests their own limiter at
+	// this many requests per second, 0 shares the API limiter; the concurrency
+	// caps bound in-flight requests on each path, 0 leaves them unbounded
+	RawRateLimitThreshold int
+	RawMaxConcurrency     int
+	APIMaxConcurrency     int
+
+	// AdaptiveRateLimit steers the limiter towards the rate that spends the
+	// remaining quota evenly until it resets, closing AdaptiveRateSmoothing
+	// (0-1] of the gap on each response
+	AdaptiveRateLimit     bool
+	AdaptiveRateSmoothing float64
+	AdaptiveRateMin       float64 // requests per second the adaptive limiter never goes below
+	AdaptiveRateMax       float64 // requests per second it never exceeds, 0 uses APIRateLimitThreshold
+
+	// Caching
+	TreeCacheSize int // trees kept for If-None-Match revalidation, 0 disables
+
+	// HTTP transport
+	ProbeHTTPProtocol     bool     // log the protocol negotiated with GitHub at startup
+	WarmConnections       int      // connections opened to each GitHub host at startup, 0 disables
+	HTTPSProxy            string   // proxy for GitHub requests, defaults to none
+	NoProxy               []string // hosts that bypass HTTPSProxy
+	CABundlePath          string   // PEM bundle added to the system roots
+	TLSInsecureSkipVerify bool     // skip TLS verification, for testing only
 
 	// Timeouts and retries
-	FetchTimeoutMS     int
-	RetryMaxAttempts   int
-	RetryBackoffBaseMS int
+	CrawlDeadlineMS         int // bound on a whole crawl including retries, 0 disables
+	FetchTimeoutMS          int
+	PerFileTimeoutMS        int // bound on fetching one file including retries, 0 uses FetchTimeoutMS
+	PerFileTimeoutPerMBMS   int // extra per-file time for each MB of the file's size
+	ResponseHeaderTimeoutMS int // abort a request whose response headers take longer than this, 0 disables
+	ReadIdleTimeoutMS       int // abort a response body that delivers nothing for this long, 0 disables
+	RetryMaxAttempts        int
+	RetryBackoffBaseMS      int
+	RetryStrategy           string  // exponential or immediate-first
+	RetryInitialBackoffMS   int     // wait before the first backed-off retry, 0 uses RetryBackoffBaseMS
+	RetryBackoffMultiplier  float64 // growth per retry, 0 uses 2
+	RetryBackoffMaxMS       int     // cap on a single wait, 0 disables
 
 	// Resource limits
+	MinFileSize          int64 // in bytes, smaller files are skipped before fetching
 	MaxFileSize          int64 // in bytes
 	MaxConcurrentFetches int
+	TaskQueueSize        int // tasks waiting for a worker, 0 uses MaxConcurrentFetches
+
+	// PerExtensionMaxSize overrides MaxFileSize for files with these
+	// extensions, which are lowercase with a leading dot like AllowedExtensions
+	PerExtensionMaxSize map[string]int64
+
+	// GzipContentMinSize asks for raw content of files at least this large,
+	// by their tree size, to be gzipped on the wire. 0 disables.
+	GzipContentMinSize int64
+
+	// TruncateOversizeBytes keeps the first bytes of files over MaxFileSize
+	// instead of skipping them; the result is marked truncated. 0 disables.
+	TruncateOversizeBytes int64
+
+	// MaxInMemoryContentBytes bounds the file content a single crawl holds in
+	// memory; later files are returned without content. 0 disables the cap.
+	MaxInMemoryContentBytes int64
+
+	// MaxTreeEntries refuses tree crawls with more files than this left after
+	// filtering, unless the request allows large crawls. 0 disables the guard.
+	MaxTreeEntries int
+
+	// TreeFetchConcurrency bounds how many repository trees are fetched at
+	// once, across concurrent crawls and the repositories of a batch crawl,
+	// and how many directories a tree too large to list recursively has
+	// listed at once
+	TreeFetchConcurrency int
+
+	// BatchConcurrency bounds how many repositories of a batch crawl are
+	// crawled at once, from tree fetch to the last file
+	BatchConcurrency int
+
+	// Result channel overflow, for tasks submitted through SubmitTask; crawls
+	// collect through channels of their own that never overflow
+	ResultOverflow      string // block or spill when the result channel is full
+	ResultSpillDir      string // directory for the spill file, defaults to the system temp dir
+	ResultSpillMaxBytes int64  // maximum size of the spill file in bytes
+
+	// Crawl checkpoints
+	CheckpointDir           string // directory crawl checkpoints are written to, empty disables them
+	CheckpointIntervalFiles int    // completed files between checkpoint writes
+
+	// GraphQL content fetching
+	EnableGraphQL        bool  // inline small-file content via batched GraphQL queries
+	GraphQLInlineMaxSize int64 // files at or below this size (bytes) are fetched via GraphQL
+	GraphQLBatchSize     int   // number of blobs requested per GraphQL query
+
+	// Archive crawling
+	EnableArchiveCrawl bool // crawl whole repositories from their tarball instead of per-file fetches
+
+	// Git Data API blob batching
+	EnableBlobBatching   bool  // fetch small files through the blobs API in batches
+	BlobBatchMaxFileSize int64 // files at or below this size (bytes) are batched
+	BlobBatchSize        int   // number of blobs fetched per batch
+	BlobBatchConcurrency int   // concurrent blob requests within a batch
+
+	// Content verification
+	VerifyContentSHA   bool // check per-file content against the tree's blob SHA
+	RefetchSHAMismatch bool // fetch mismatched content again by SHA through the blobs API
+
+	// ClassifyFiles tags each fetched file with a category from its path and
+	// content, such as test, doc or vendored, and counts them per crawl
+	ClassifyFiles bool
 
 	// File filtering
 	AllowedExtensions     []string // allowed file extensions
+	SpecialFiles          []string // lowercase filenames allowed regardless of extension
+	MaxPathDepth          int      // skip files nested deeper than this many directories, 0 disables
 	EnableBinaryDetection bool     // enable binary file detection
+	HonorIgnoreFile       bool     // apply the repository's .autodocs/ignore or .autodocsignore
+
+	// Path regexes; files must match IncludeRegex when set and are skipped if
+	// they match ExcludeRegex. The patterns are compiled once by Load.
+	IncludeRegex   string
+	ExcludeRegex   string
+	IncludePattern *regexp.Regexp
+	ExcludePattern *regexp.Regexp
+
+	// RedactPatterns are extra secret regexes masked in logged bodies and
+	// errors on top of the built-in token and key formats; compiled by Load
+	RedactPatterns []string
+	RedactRegexps  []*regexp.Regexp
+
+	// Output
+	OutputMode              string   // default content output mode: inline, base64-explicit or reference
+	OrderedBufferMaxResults int      // results an ordered crawl may hold back before releasing out of order
+	ContentTransforms       []string // transforms applied in order to every file's content, see TransformStripBOM
+
+	// Idempotency; a crawl's key is remembered for IdempotencyTTLMS after it
+	// succeeds, 0 disables, and at most IdempotencyMaxKeys keys are held
+	IdempotencyTTLMS   int
+	IdempotencyMaxKeys int
 
 	// Observability
-	LogLevel    string
-	MetricsPath string
+	LogLevel              string
+	MetricsPath           string
+	HealthCheckCacheTTLMS int  // how long a deep GitHub health check result is reused
+	DebugCaptureFailures  bool // log URL, status, rate limit headers and a body sample for failed GitHub requests
+	DebugCaptureBodyBytes int  // bytes of the response body included in a failure capture
 
 	// Development
 	Environment string
@@ -57,20 +280,90 @@ func Load() (*Config, error) {
 
 	cfg := &Config{
 		// Default values
-		Port:                  getEnvOrDefault("PORT", "8080"),
-		Host:                  getEnvOrDefault("HOST", "0.0.0.0"),
-		GitHubBaseURL:         getEnvOrDefault("GITHUB_BASE_URL", "https://api.github.com"),
-		MaxWorkers:            getEnvAsIntOrDefault("MAX_WORKERS", 50),
-		APIRateLimitThreshold: getEnvAsIntOrDefault("API_RATE_LIMIT_THRESHOLD", 100),
-		FetchTimeoutMS:        getEnvAsIntOrDefault("FETCH_TIMEOUT_MS", 30000),
-		RetryMaxAttempts:      getEnvAsIntOrDefault("RETRY_MAX_ATTEMPTS", 3),
-		RetryBackoffBaseMS:    getEnvAsIntOrDefault("RETRY_BACKOFF_MS_BASE", 1000),
-		MaxFileSize:           getEnvAsInt64OrDefault("MAX_FILE_SIZE", 10*1024*1024), // 10MB
-		MaxConcurrentFetches:  getEnvAsIntOrDefault("MAX_CONCURRENT_FETCHES", 100),
-		LogLevel:              getEnvOrDefault("LOG_LEVEL", "info"),
-		MetricsPath:           getEnvOrDefault("METRICS_PATH", "/metrics"),
-		Environment:           getEnvOrDefault("ENVIRONMENT", "development"),
-		EnableBinaryDetection: getEnvAsBoolOrDefault("ENABLE_BINARY_DETECTION", true),
+		Port:                    getEnvOrDefault("PORT", "8080"),
+		Host:                    getEnvOrDefault("HOST", "0.0.0.0"),
+		GitHubBaseURL:           getEnvOrDefault("GITHUB_BASE_URL", "https://api.github.com"),
+		GitHubAPIVersion:        getEnvOrDefault("GITHUB_API_VERSION", DefaultGitHubAPIVersion),
+		RawMirrorBaseURL:        strings.TrimSuffix(getEnvOrDefault("RAW_MIRROR_BASE_URL", ""), "/"),
+		MaxWorkers:              getEnvAsIntOrDefault("MAX_WORKERS", 50),
+		WorkerIdleTimeoutMS:     getEnvAsIntOrDefault("WORKER_IDLE_TIMEOUT_MS", 0),
+		RampUpMS:                getEnvAsIntOrDefault("RAMP_UP_MS", 0),
+		RampUpInitialWorkers:    getEnvAsIntOrDefault("RAMP_UP_INITIAL_WORKERS", 1),
+		ResultBatchSize:         getEnvAsIntOrDefault("RESULT_BATCH_SIZE", 1),
+		ShutdownTimeoutMS:       getEnvAsIntOrDefault("SHUTDOWN_TIMEOUT_MS", 30000),
+		APIRateLimitThreshold:   getEnvAsIntOrDefault("API_RATE_LIMIT_THRESHOLD", 100),
+		TreeRequestCost:         getEnvAsIntOrDefault("TREE_REQUEST_COST", 2),
+		ContentRequestCost:      getEnvAsIntOrDefault("CONTENT_REQUEST_COST", 1),
+		RateLimitPreflight:      getEnvOrDefault("RATE_LIMIT_PREFLIGHT", PreflightRefuse),
+		RateLimitReserve:        getEnvAsIntOrDefault("RATE_LIMIT_RESERVE", 0),
+		ProbeHTTPProtocol:       getEnvAsBoolOrDefault("PROBE_HTTP_PROTOCOL", true),
+		WarmRateLimiter:         getEnvAsBoolOrDefault("WARM_RATE_LIMITER", true),
+		WarmConnections:         getEnvAsIntOrDefault("WARM_CONNECTIONS", 0),
+		RawRateLimitThreshold:   getEnvAsIntOrDefault("RAW_RATE_LIMIT_THRESHOLD", 0),
+		RawMaxConcurrency:       getEnvAsIntOrDefault("RAW_MAX_CONCURRENCY", 0),
+		APIMaxConcurrency:       getEnvAsIntOrDefault("API_MAX_CONCURRENCY", 0),
+		AllowDegradedStartup:    getEnvAsBoolOrDefault("ALLOW_DEGRADED_STARTUP", false),
+		AdaptiveRateLimit:       getEnvAsBoolOrDefault("ADAPTIVE_RATE_LIMIT", false),
+		AdaptiveRateSmoothing:   getEnvAsFloat64OrDefault("ADAPTIVE_RATE_SMOOTHING", 0.2),
+		AdaptiveRateMin:         getEnvAsFloat64OrDefault("ADAPTIVE_RATE_MIN", 0.1),
+		AdaptiveRateMax:         getEnvAsFloat64OrDefault("ADAPTIVE_RATE_MAX", 0),
+		HTTPSProxy:              getEnvOrDefault("HTTPS_PROXY", os.Getenv("https_proxy")),
+		CABundlePath:            getEnvOrDefault("GITHUB_CA_BUNDLE", ""),
+		TLSInsecureSkipVerify:   getEnvAsBoolOrDefault("GITHUB_TLS_INSECURE_SKIP_VERIFY", false),
+		TreeCacheSize:           getEnvAsIntOrDefault("TREE_CACHE_SIZE", 100),
+		CrawlDeadlineMS:         getEnvAsIntOrDefault("CRAWL_DEADLINE_MS", 540000), // 9 minutes
+		FetchTimeoutMS:          getEnvAsIntOrDefault("FETCH_TIMEOUT_MS", 30000),
+		PerFileTimeoutMS:        getEnvAsIntOrDefault("PER_FILE_TIMEOUT_MS", 0),
+		PerFileTimeoutPerMBMS:   getEnvAsIntOrDefault("PER_FILE_TIMEOUT_PER_MB_MS", 0),
+		ResponseHeaderTimeoutMS: getEnvAsIntOrDefault("RESPONSE_HEADER_TIMEOUT_MS", 10000),
+		ReadIdleTimeoutMS:       getEnvAsIntOrDefault("READ_IDLE_TIMEOUT_MS", 10000),
+		RetryMaxAttempts:        getEnvAsIntOrDefault("RETRY_MAX_ATTEMPTS", 3),
+		RetryBackoffBaseMS:      getEnvAsIntOrDefault("RETRY_BACKOFF_MS_BASE", 1000),
+		RetryStrategy:           getEnvOrDefault("RETRY_STRATEGY", RetryExponential),
+		RetryInitialBackoffMS:   getEnvAsIntOrDefault("RETRY_INITIAL_BACKOFF_MS", 0),
+		RetryBackoffMultiplier:  getEnvAsFloat64OrDefault("RETRY_BACKOFF_MULTIPLIER", 2),
+		RetryBackoffMaxMS:       getEnvAsIntOrDefault("RETRY_BACKOFF_MAX_MS", 0),
+		MinFileSize:             getEnvAsInt64OrDefault("MIN_FILE_SIZE", 0),
+		MaxFileSize:             getEnvAsInt64OrDefault("MAX_FILE_SIZE", 10*1024*1024), // 10MB
+		TruncateOversizeBytes:   getEnvAsInt64OrDefault("TRUNCATE_OVERSIZE_BYTES", 0),
+		GzipContentMinSize:      getEnvAsInt64OrDefault("GZIP_CONTENT_MIN_SIZE", 0),
+		MaxConcurrentFetches:    getEnvAsIntOrDefault("MAX_CONCURRENT_FETCHES", 100),
+		TaskQueueSize:           getEnvAsIntOrDefault("TASK_QUEUE_SIZE", 10000),
+		MaxInMemoryContentBytes: getEnvAsInt64OrDefault("MAX_IN_MEMORY_CONTENT_BYTES", 512*1024*1024), // 512MB
+		MaxTreeEntries:          getEnvAsIntOrDefault("MAX_TREE_ENTRIES", 20000),
+		TreeFetchConcurrency:    getEnvAsIntOrDefault("TREE_FETCH_CONCURRENCY", 4),
+		BatchConcurrency:        getEnvAsIntOrDefault("BATCH_CONCURRENCY", 4),
+		ResultOverflow:          getEnvOrDefault("RESULT_OVERFLOW", ResultOverflowBlock),
+		ResultSpillDir:          getEnvOrDefault("RESULT_SPILL_DIR", ""),
+		ResultSpillMaxBytes:     getEnvAsInt64OrDefault("RESULT_SPILL_MAX_BYTES", 256*1024*1024), // 256MB
+		CheckpointDir:           getEnvOrDefault("CHECKPOINT_DIR", ""),
+		CheckpointIntervalFiles: getEnvAsIntOrDefault("CHECKPOINT_INTERVAL_FILES", 100),
+		EnableGraphQL:           getEnvAsBoolOrDefault("ENABLE_GRAPHQL", false),
+		GraphQLInlineMaxSize:    getEnvAsInt64OrDefault("GRAPHQL_INLINE_MAX_SIZE", 100*1024), // 100KB
+		GraphQLBatchSize:        getEnvAsIntOrDefault("GRAPHQL_BATCH_SIZE", 50),
+		EnableArchiveCrawl:      getEnvAsBoolOrDefault("ENABLE_ARCHIVE_CRAWL", false),
+		EnableBlobBatching:      getEnvAsBoolOrDefault("ENABLE_BLOB_BATCHING", false),
+		BlobBatchMaxFileSize:    getEnvAsInt64OrDefault("BLOB_BATCH_MAX_FILE_SIZE", 16*1024), // 16KB
+		BlobBatchSize:           getEnvAsIntOrDefault("BLOB_BATCH_SIZE", 20),
+		BlobBatchConcurrency:    getEnvAsIntOrDefault("BLOB_BATCH_CONCURRENCY", 4),
+		VerifyContentSHA:        getEnvAsBoolOrDefault("VERIFY_CONTENT_SHA", false),
+		RefetchSHAMismatch:      getEnvAsBoolOrDefault("REFETCH_SHA_MISMATCH", true),
+		ClassifyFiles:           getEnvAsBoolOrDefault("CLASSIFY_FILES", false),
+		OutputMode:              getEnvOrDefault("OUTPUT_MODE", model.OutputModeInline),
+		OrderedBufferMaxResults: getEnvAsIntOrDefault("ORDERED_BUFFER_MAX_RESULTS", 1000),
+		LogLevel:                getEnvOrDefault("LOG_LEVEL", "info"),
+		MetricsPath:             getEnvOrDefault("METRICS_PATH", "/metrics"),
+		HealthCheckCacheTTLMS:   getEnvAsIntOrDefault("HEALTH_CHECK_CACHE_TTL_MS", 30000),
+		IdempotencyTTLMS:        getEnvAsIntOrDefault("IDEMPOTENCY_TTL_MS", 600000), // 10 minutes
+		IdempotencyMaxKeys:      getEnvAsIntOrDefault("IDEMPOTENCY_MAX_KEYS", 1000),
+		DebugCaptureFailures:    getEnvAsBoolOrDefault("DEBUG_CAPTURE_FAILURES", false),
+		DebugCaptureBodyBytes:   getEnvAsIntOrDefault("DEBUG_CAPTURE_BODY_BYTES", 1024),
+		Environment:             getEnvOrDefault("ENVIRONMENT", "development"),
+		EnableBinaryDetection:   getEnvAsBoolOrDefault("ENABLE_BINARY_DETECTION", true),
+		MaxPathDepth:            getEnvAsIntOrDefault("MAX_PATH_DEPTH", 0),
+		HonorIgnoreFile:         getEnvAsBoolOrDefault("HONOR_IGNORE_FILE", false),
+		IncludeRegex:            getEnvOrDefault("INCLUDE_REGEX", ""),
+		ExcludeRegex:            getEnvOrDefault("EXCLUDE_REGEX", ""),
 	}
 
 	// Load allowed extensions
@@ -78,17 +371,53 @@ func Load() (*Config, error) {
 		".go,.js,.ts,.jsx,.tsx,.py,.java,.cpp,.c,.h,.hpp,.cs,.rb,.php,.rs,.swift,.kt,.scala,.sh,.bash,.zsh,.fish,.ps1,.bat,.cmd,.yaml,.yml,.json,.xml,.toml,.ini,.cfg,.conf,.md,.rst,.txt,.sql,.r,.m,.pl,.lua,.vim,.el,.clj,.hs,.fs,.ml,.pas,.ada,.cob,.f90,.pro,.asm,.s,.lisp,.scm,.tcl,.awk,.sed,.dockerfile,.makefile,.cmake,.gradle,.maven,.sbt,.cabal,.stack,.cargo,.gemfile,.requirements,.setup,.pipfile,.poetry,.pom,.build,.project,.solution")
 
 	if allowedExtensionsStr != "" {
-		extensions := strings.Split(allowedExtensionsStr, ",")
-		for i, ext := range extensions {
-			extensions[i] = strings.TrimSpace(strings.ToLower(ext))
-			// Ensure extensions start with dot
-			if !strings.HasPrefix(extensions[i], ".") {
-				extensions[i] = "." + extensions[i]
-			}
+		cfg.AllowedExtensions = NormalizeExtensions(strings.Split(allowedExtensionsStr, ","))
+	}
+
+	// Load special filenames, appending any extras to the defaults
+	cfg.SpecialFiles = append([]string(nil), DefaultSpecialFiles...)
+	// Regexes may contain commas, so the list is whitespace-separated
+	cfg.RedactPatterns = strings.Fields(getEnvOrDefault("REDACT_PATTERNS", ""))
+
+	for _, name := range strings.Split(getEnvOrDefault("EXTRA_SPECIAL_FILES", ""), ",") {
+		if name = strings.TrimSpace(strings.ToLower(name)); name != "" {
+			cfg.SpecialFiles = append(cfg.SpecialFiles, name)
 		}
-		cfg.AllowedExtensions = extensions
 	}
 
+	for _, name := range strings.Split(getEnvOrDefault("CONTENT_TRANSFORMS", ""), ",") {
+		if name = strings.TrimSpace(strings.ToLower(name)); name != "" {
+			cfg.ContentTransforms = append(cfg.ContentTransforms, name)
+		}
+	}
+
+	// Load the authentication preference
+	for _, method := range strings.Split(getEnvOrDefault("GITHUB_AUTH_ORDER", AuthMethodToken+","+AuthMethodApp), ",") {
+		if method = strings.TrimSpace(strings.ToLower(method)); method != "" {
+			cfg.GitHubAuthOrder = append(cfg.GitHubAuthOrder, method)
+		}
+	}
+
+	// Load proxy bypass hosts
+	noProxyStr := getEnvOrDefault("NO_PROXY", os.Getenv("no_proxy"))
+	for _, host := range strings.Split(noProxyStr, ",") {
+		if host = strings.TrimSpace(strings.ToLower(host)); host != "" {
+			cfg.NoProxy = append(cfg.NoProxy, host)
+		}
+	}
+
+	perExtensionMaxSize, err := parseExtensionSizes(getEnvOrDefault("PER_EXTENSION_MAX_SIZE", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PER_EXTENSION_MAX_SIZE: %w", err)
+	}
+	cfg.PerExtensionMaxSize = perExtensionMaxSize
+
+	extraHeaders, err := parseHeaders(getEnvOrDefault("GITHUB_EXTRA_HEADERS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_EXTRA_HEADERS: %w", err)
+	}
+	cfg.GitHubExtraHeaders = extraHeaders
+
 	// Required environment variables
 	cfg.GitHubToken = os.Getenv("GITHUB_TOKEN")
 	cfg.GitHubAppID = os.Getenv("GITHUB_APP_ID")
@@ -100,6 +429,17 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
+	// Validate has already checked the patterns compile
+	if cfg.IncludeRegex != "" {
+		cfg.IncludePattern = regexp.MustCompile(cfg.IncludeRegex)
+	}
+	if cfg.ExcludeRegex != "" {
+		cfg.ExcludePattern = regexp.MustCompile(cfg.ExcludeRegex)
+	}
+	for _, pattern := range cfg.RedactPatterns {
+		cfg.RedactRegexps = append(cfg.RedactRegexps, regexp.MustCompile(pattern))
+	}
+
 	return cfg, nil
 }
 
@@ -110,6 +450,17 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("either GITHUB_TOKEN or GitHub App credentials (GITHUB_APP_ID, GITHUB_APP_KEY, GITHUB_INSTALL_ID) must be provided")
 	}
 
+	seenMethods := make(map[string]bool, len(c.GitHubAuthOrder))
+	for _, method := range c.GitHubAuthOrder {
+		if method != AuthMethodToken && method != AuthMethodApp {
+			return fmt.Errorf("GITHUB_AUTH_ORDER entries must be %s or %s, got %q", AuthMethodToken, AuthMethodApp, method)
+		}
+		if seenMethods[method] {
+			return fmt.Errorf("GITHUB_AUTH_ORDER lists %s more than once", method)
+		}
+		seenMethods[method] = true
+	}
+
 	// Validate worker pool settings
 	if c.MaxWorkers <= 0 {
 		return fmt.Errorf("MAX_WORKERS must be greater than 0")
@@ -119,11 +470,92 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("MAX_WORKERS should not exceed 1000 for resource efficiency")
 	}
 
+	if c.WorkerIdleTimeoutMS < 0 {
+		return fmt.Errorf("WORKER_IDLE_TIMEOUT_MS must be non-negative")
+	}
+
+	if c.RampUpMS < 0 || (c.RampUpMS > 0 && (c.RampUpInitialWorkers <= 0 || c.RampUpInitialWorkers > c.MaxWorkers)) {
+		return fmt.Errorf("RAMP_UP_MS must be non-negative and RAMP_UP_INITIAL_WORKERS between 1 and MAX_WORKERS when it is set")
+	}
+
+	if c.ResultBatchSize <= 0 {
+		return fmt.Errorf("RESULT_BATCH_SIZE must be greater than 0")
+	}
+
+	if c.ShutdownTimeoutMS < 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT_MS must be non-negative")
+	}
+
+	// Validate rate limiter request costs
+	if c.TreeRequestCost <= 0 || c.ContentRequestCost <= 0 {
+		return fmt.Errorf("TREE_REQUEST_COST and CONTENT_REQUEST_COST must be greater than 0")
+	}
+
+	if c.TreeRequestCost > c.APIRateLimitThreshold || c.ContentRequestCost > c.APIRateLimitThreshold {
+		return fmt.Errorf("request costs must not exceed API_RATE_LIMIT_THRESHOLD")
+	}
+
+	// Validate rate limit preflight mode
+	switch c.RateLimitPreflight {
+	case PreflightOff, PreflightRefuse, PreflightThrottle:
+	default:
+		return fmt.Errorf("RATE_LIMIT_PREFLIGHT must be one of %s, %s or %s", PreflightOff, PreflightRefuse, PreflightThrottle)
+	}
+
+	if c.RateLimitReserve < 0 {
+		return fmt.Errorf("RATE_LIMIT_RESERVE must be non-negative")
+	}
+
+	if c.RawRateLimitThreshold < 0 || c.RawMaxConcurrency < 0 || c.APIMaxConcurrency < 0 {
+		return fmt.Errorf("RAW_RATE_LIMIT_THRESHOLD, RAW_MAX_CONCURRENCY and API_MAX_CONCURRENCY must be non-negative")
+	}
+
+	if c.AdaptiveRateLimit && (c.AdaptiveRateSmoothing <= 0 || c.AdaptiveRateSmoothing > 1) {
+		return fmt.Errorf("ADAPTIVE_RATE_SMOOTHING must be greater than 0 and at most 1")
+	}
+
+	if c.AdaptiveRateLimit && (c.AdaptiveRateMin <= 0 || c.AdaptiveRateMin > c.GetAdaptiveRateMax()) {
+		return fmt.Errorf("ADAPTIVE_RATE_MIN must be greater than 0 and at most ADAPTIVE_RATE_MAX")
+	}
+
+	// Validate proxy URL
+	if c.HTTPSProxy != "" {
+		proxyURL, err := url.Parse(c.HTTPSProxy)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("HTTPS_PROXY must be a URL with a scheme and host")
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("HTTPS_PROXY scheme must be http, https or socks5")
+		}
+	}
+
+	// Validate raw content mirror
+	if c.RawMirrorBaseURL != "" {
+		mirrorURL, err := url.Parse(c.RawMirrorBaseURL)
+		if err != nil || mirrorURL.Host == "" || (mirrorURL.Scheme != "http" && mirrorURL.Scheme != "https") {
+			return fmt.Errorf("RAW_MIRROR_BASE_URL must be an http or https URL with a host")
+		}
+	}
+
 	// Validate timeouts
 	if c.FetchTimeoutMS <= 0 {
 		return fmt.Errorf("FETCH_TIMEOUT_MS must be greater than 0")
 	}
 
+	if c.PerFileTimeoutMS < 0 || c.PerFileTimeoutPerMBMS < 0 {
+		return fmt.Errorf("PER_FILE_TIMEOUT_MS and PER_FILE_TIMEOUT_PER_MB_MS must be non-negative")
+	}
+
+	if c.CrawlDeadlineMS < 0 {
+		return fmt.Errorf("CRAWL_DEADLINE_MS must be non-negative")
+	}
+
+	if c.ResponseHeaderTimeoutMS < 0 || c.ReadIdleTimeoutMS < 0 {
+		return fmt.Errorf("RESPONSE_HEADER_TIMEOUT_MS and READ_IDLE_TIMEOUT_MS must be non-negative")
+	}
+
 	// Validate retry settings
 	if c.RetryMaxAttempts < 0 {
 		return fmt.Errorf("RETRY_MAX_ATTEMPTS must be non-negative")
@@ -133,29 +565,307 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("RETRY_BACKOFF_MS_BASE must be greater than 0")
 	}
 
+	switch c.RetryStrategy {
+	case RetryExponential, RetryImmediateFirst:
+	default:
+		return fmt.Errorf("RETRY_STRATEGY must be one of %s or %s", RetryExponential, RetryImmediateFirst)
+	}
+
+	if c.RetryInitialBackoffMS < 0 {
+		return fmt.Errorf("RETRY_INITIAL_BACKOFF_MS must be non-negative")
+	}
+
+	if c.RetryBackoffMultiplier != 0 && c.RetryBackoffMultiplier < 1 {
+		return fmt.Errorf("RETRY_BACKOFF_MULTIPLIER must be 0 or at least 1")
+	}
+
+	if c.RetryBackoffMaxMS < 0 {
+		return fmt.Errorf("RETRY_BACKOFF_MAX_MS must be non-negative")
+	}
+
 	// Validate file size limits
 	if c.MaxFileSize <= 0 {
 		return fmt.Errorf("MAX_FILE_SIZE must be greater than 0")
 	}
 
+	if c.MinFileSize < 0 || c.MinFileSize > c.MaxFileSize {
+		return fmt.Errorf("MIN_FILE_SIZE must be between 0 and MAX_FILE_SIZE")
+	}
+
+	if c.TruncateOversizeBytes < 0 || c.TruncateOversizeBytes > c.MaxFileSize {
+		return fmt.Errorf("TRUNCATE_OVERSIZE_BYTES must be between 0 and MAX_FILE_SIZE")
+	}
+
+	if c.GzipContentMinSize < 0 {
+		return fmt.Errorf("GZIP_CONTENT_MIN_SIZE must be non-negative")
+	}
+
+	for ext, size := range c.PerExtensionMaxSize {
+		if size <= 0 {
+			return fmt.Errorf("PER_EXTENSION_MAX_SIZE limit for %s must be greater than 0", ext)
+		}
+	}
+
 	// Validate concurrent fetches
 	if c.MaxConcurrentFetches <= 0 {
 		return fmt.Errorf("MAX_CONCURRENT_FETCHES must be greater than 0")
 	}
 
+	if c.TaskQueueSize < 0 {
+		return fmt.Errorf("TASK_QUEUE_SIZE must be non-negative")
+	}
+
+	// Warmed connections beyond the idle pool would just be closed again
+	if c.WarmConnections < 0 || c.WarmConnections > c.MaxConcurrentFetches {
+		return fmt.Errorf("WARM_CONNECTIONS must be between 0 and MAX_CONCURRENT_FETCHES")
+	}
+
+	// Validate in-memory content cap
+	if c.MaxInMemoryContentBytes < 0 {
+		return fmt.Errorf("MAX_IN_MEMORY_CONTENT_BYTES must be non-negative")
+	}
+
+	if c.MaxTreeEntries < 0 {
+		return fmt.Errorf("MAX_TREE_ENTRIES must be non-negative")
+	}
+
+	if c.TreeFetchConcurrency <= 0 {
+		return fmt.Errorf("TREE_FETCH_CONCURRENCY must be greater than 0")
+	}
+
+	if c.BatchConcurrency <= 0 {
+		return fmt.Errorf("BATCH_CONCURRENCY must be greater than 0")
+	}
+
+	// Validate path depth
+	if c.MaxPathDepth < 0 {
+		return fmt.Errorf("MAX_PATH_DEPTH must be non-negative")
+	}
+
+	// Validate path regexes
+	if _, err := regexp.Compile(c.IncludeRegex); err != nil {
+		return fmt.Errorf("INCLUDE_REGEX is not a valid regular expression: %w", err)
+	}
+	if _, err := regexp.Compile(c.ExcludeRegex); err != nil {
+		return fmt.Errorf("EXCLUDE_REGEX is not a valid regular expression: %w", err)
+	}
+	for _, pattern := range c.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("REDACT_PATTERNS entry %q is not a valid regular expression: %w", pattern, err)
+		}
+	}
+
+	// Validate tree cache size
+	if c.TreeCacheSize < 0 {
+		return fmt.Errorf("TREE_CACHE_SIZE must be non-negative")
+	}
+
+	// Validate result overflow strategy
+	switch c.ResultOverflow {
+	case ResultOverflowBlock:
+	case ResultOverflowSpill:
+		if c.ResultSpillMaxBytes <= 0 {
+			return fmt.Errorf("RESULT_SPILL_MAX_BYTES must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("RESULT_OVERFLOW must be one of %s or %s", ResultOverflowBlock, ResultOverflowSpill)
+	}
+
+	if c.CheckpointDir != "" && c.CheckpointIntervalFiles <= 0 {
+		return fmt.Errorf("CHECKPOINT_INTERVAL_FILES must be greater than 0")
+	}
+
+	// Validate GraphQL settings
+	if c.EnableGraphQL {
+		if c.GraphQLInlineMaxSize <= 0 {
+			return fmt.Errorf("GRAPHQL_INLINE_MAX_SIZE must be greater than 0")
+		}
+		if c.GraphQLBatchSize <= 0 || c.GraphQLBatchSize > 100 {
+			return fmt.Errorf("GRAPHQL_BATCH_SIZE must be between 1 and 100")
+		}
+	}
+
+	// Validate blob batching settings
+	if c.EnableBlobBatching {
+		if c.BlobBatchMaxFileSize <= 0 || c.BlobBatchSize <= 0 || c.BlobBatchConcurrency <= 0 {
+			return fmt.Errorf("BLOB_BATCH_MAX_FILE_SIZE, BLOB_BATCH_SIZE and BLOB_BATCH_CONCURRENCY must be greater than 0")
+		}
+	}
+
+	// Validate health check cache
+	if c.HealthCheckCacheTTLMS < 0 {
+		return fmt.Errorf("HEALTH_CHECK_CACHE_TTL_MS must be non-negative")
+	}
+
+	if c.IdempotencyTTLMS < 0 || (c.IdempotencyTTLMS > 0 && c.IdempotencyMaxKeys <= 0) {
+		return fmt.Errorf("IDEMPOTENCY_TTL_MS must be non-negative and IDEMPOTENCY_MAX_KEYS greater than 0 when it is set")
+	}
+
+	if c.DebugCaptureBodyBytes < 0 {
+		return fmt.Errorf("DEBUG_CAPTURE_BODY_BYTES must be non-negative")
+	}
+
+	// Validate output mode
+	if !IsValidOutputMode(c.OutputMode) {
+		return fmt.Errorf("OUTPUT_MODE must be one of %s, %s or %s",
+			model.OutputModeInline, model.OutputModeBase64Explicit, model.OutputModeReference)
+	}
+
+	if c.OrderedBufferMaxResults <= 0 {
+		return fmt.Errorf("ORDERED_BUFFER_MAX_RESULTS must be greater than 0")
+	}
+
+	seenTransforms := make(map[string]bool, len(c.ContentTransforms))
+	for _, name := range c.ContentTransforms {
+		switch name {
+		case TransformStripBOM, TransformNormalizeEOL, TransformTrimTrailingWhitespace:
+		default:
+			return fmt.Errorf("CONTENT_TRANSFORMS entries must be %s, %s or %s, got %q",
+				TransformStripBOM, TransformNormalizeEOL, TransformTrimTrailingWhitespace, name)
+		}
+		if seenTransforms[name] {
+			return fmt.Errorf("CONTENT_TRANSFORMS lists %s more than once", name)
+		}
+		seenTransforms[name] = true
+	}
+
 	return nil
 }
 
+// IsValidOutputMode reports whether mode is a supported content output mode
+func IsValidOutputMode(mode string) bool {
+	switch mode {
+	case model.OutputModeInline, model.OutputModeBase64Explicit, model.OutputModeReference:
+		return true
+	}
+	return false
+}
+
 // GetFetchTimeout returns the fetch timeout as a duration
 func (c *Config) GetFetchTimeout() time.Duration {
 	return time.Duration(c.FetchTimeoutMS) * time.Millisecond
 }
 
+// GetResponseHeaderTimeout returns the response header timeout as a duration
+func (c *Config) GetResponseHeaderTimeout() time.Duration {
+	return time.Duration(c.ResponseHeaderTimeoutMS) * time.Millisecond
+}
+
+// GetReadIdleTimeout returns the response body idle timeout as a duration
+func (c *Config) GetReadIdleTimeout() time.Duration {
+	return time.Duration(c.ReadIdleTimeoutMS) * time.Millisecond
+}
+
+// GetPerFileTimeout returns the time allowed to fetch a file of size bytes:
+// PerFileTimeoutMS plus PerFileTimeoutPerMBMS for each MB, or the fetch timeout
+// when no per-file timeout is configured
+func (c *Config) GetPerFileTimeout(size int) time.Duration {
+	if c.PerFileTimeoutMS <= 0 {
+		return c.GetFetchTimeout()
+	}
+
+	perMB := time.Duration(c.PerFileTimeoutPerMBMS) * time.Millisecond
+	return time.Duration(c.PerFileTimeoutMS)*time.Millisecond + perMB*time.Duration(size)/(1<<20)
+}
+
+// GetAdaptiveRateMax returns the adaptive limiter's ceiling in requests per
+// second, APIRateLimitThreshold unless AdaptiveRateMax is set
+func (c *Config) GetAdaptiveRateMax() float64 {
+	if c.AdaptiveRateMax > 0 {
+		return c.AdaptiveRateMax
+	}
+	return float64(c.APIRateLimitThreshold)
+}
+
+// MaxFileSizeFor returns the size limit for a file: its extension's entry in
+// PerExtensionMaxSize, or MaxFileSize
+func (c *Config) MaxFileSizeFor(filePath string) int64 {
+	if limit, ok := c.PerExtensionMaxSize[strings.ToLower(path.Ext(filePath))]; ok {
+		return limit
+	}
+	return c.MaxFileSize
+}
+
+// GetTaskQueueSize returns how many tasks the pool queues for its workers
+func (c *Config) GetTaskQueueSize() int {
+	if c.TaskQueueSize <= 0 {
+		return c.MaxConcurrentFetches
+	}
+	return c.TaskQueueSize
+}
+
+// GetCrawlDeadline returns the crawl-wide deadline as a duration
+func (c *Config) GetCrawlDeadline() time.Duration {
+	return time.Duration(c.CrawlDeadlineMS) * time.Millisecond
+}
+
+// GetWorkerIdleTimeout returns the worker idle timeout as a duration
+func (c *Config) GetWorkerIdleTimeout() time.Duration {
+	return time.Duration(c.WorkerIdleTimeoutMS) * time.Millisecond
+}
+
+// GetShutdownTimeout returns how long Stop waits for workers as a duration
+func (c *Config) GetShutdownTimeout() time.Duration {
+	return time.Duration(c.ShutdownTimeoutMS) * time.Millisecond
+}
+
+// GetRampUp returns the worker ramp-up period as a duration
+func (c *Config) GetRampUp() time.Duration {
+	return time.Duration(c.RampUpMS) * time.Millisecond
+}
+
+// GetIdempotencyTTL returns how long a finished crawl's idempotency key is kept
+func (c *Config) GetIdempotencyTTL() time.Duration {
+	return time.Duration(c.IdempotencyTTLMS) * time.Millisecond
+}
+
+// GetHealthCheckCacheTTL returns the deep health check cache TTL as a duration
+func (c *Config) GetHealthCheckCacheTTL() time.Duration {
+	return time.Duration(c.HealthCheckCacheTTLMS) * time.Millisecond
+}
+
 // GetRetryBackoffBase returns the retry backoff base as a duration
 func (c *Config) GetRetryBackoffBase() time.Duration {
 	return time.Duration(c.RetryBackoffBaseMS) * time.Millisecond
 }
 
+// GetRetryBackoff returns how long to wait before the given retry, counting
+// from 1. The first retry waits the initial backoff and later ones grow from
+// the base by the multiplier, up to the cap; immediate-first sends the first
+// retry at once and shifts the rest of the schedule back by one.
+func (c *Config) GetRetryBackoff(retry int) time.Duration {
+	if c.RetryStrategy == RetryImmediateFirst {
+		if retry <= 1 {
+			return 0
+		}
+		retry--
+	}
+
+	var backoff time.Duration
+	if retry <= 1 && c.RetryInitialBackoffMS > 0 {
+		backoff = time.Duration(c.RetryInitialBackoffMS) * time.Millisecond
+	} else {
+		multiplier := c.RetryBackoffMultiplier
+		if multiplier == 0 {
+			multiplier = 2
+		}
+		// Clamp before converting so a long schedule can't overflow. MaxInt64
+		// rounds up to 2^63 as a float, which converts to a negative duration,
+		// so anything that large saturates instead.
+		scaled := float64(c.GetRetryBackoffBase()) * math.Pow(multiplier, float64(retry-1))
+		if scaled >= float64(math.MaxInt64) {
+			backoff = time.Duration(math.MaxInt64)
+		} else {
+			backoff = time.Duration(scaled)
+		}
+	}
+
+	if c.RetryBackoffMaxMS > 0 {
+		backoff = min(backoff, time.Duration(c.RetryBackoffMaxMS)*time.Millisecond)
+	}
+	return backoff
+}
+
 // IsProduction returns true if running in production environment
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
@@ -166,6 +876,72 @@ func (c *Config) HasGitHubApp() bool {
 	return c.GitHubAppID != "" && c.GitHubAppKey != "" && c.GitHubInstallID != ""
 }
 
+// NormalizeExtensions lowercases extensions and ensures they start with a dot
+func NormalizeExtensions(extensions []string) []string {
+	normalized := make([]string, len(extensions))
+	for i, ext := range extensions {
+		normalized[i] = strings.TrimSpace(strings.ToLower(ext))
+		// Ensure extensions start with dot
+		if !strings.HasPrefix(normalized[i], ".") {
+			normalized[i] = "." + normalized[i]
+		}
+	}
+	return normalized
+}
+
+// parseExtensionSizes parses a comma-separated list of ext=bytes pairs, such
+// as ".json=52428800,md=1048576"; extensions are normalized
+func parseExtensionSizes(spec string) (map[string]int64, error) {
+	var sizes map[string]int64
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		ext, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(ext) == "" {
+			return nil, fmt.Errorf("entry %q must be ext=bytes", entry)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("entry %q must have a size in bytes", entry)
+		}
+
+		if sizes == nil {
+			sizes = make(map[string]int64)
+		}
+		sizes[NormalizeExtensions([]string{ext})[0]] = size
+	}
+	return sizes, nil
+}
+
+// parseHeaders parses a comma-separated list of "Name: value" pairs, such as
+// "X-Proxy-Auth: abc,X-Team: docs"; names are canonicalized
+func parseHeaders(spec string) (map[string]string, error) {
+	var headers map[string]string
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("entry %q must be Name: value", entry)
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if name == "Authorization" {
+			return nil, fmt.Errorf("entry %q can't set Authorization, which comes from the GitHub credentials", entry)
+		}
+
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
 // Helper functions
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -193,6 +969,15 @@ func getEnvAsInt64OrDefault(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+func getEnvAsFloat64OrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBoolOrDefault(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"math"
 	"os"
 	"testing"
 	"time"
@@ -75,6 +76,425 @@ func TestLoad(t *testing.T) {
 			wantErr: true,
 			errMsg:  "MAX_WORKERS must be greater than 0",
 		},
+		{
+			name: "request cost exceeds rate limit threshold",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":             "test-token",
+				"API_RATE_LIMIT_THRESHOLD": "5",
+				"TREE_REQUEST_COST":        "10",
+			},
+			wantErr: true,
+			errMsg:  "request costs must not exceed API_RATE_LIMIT_THRESHOLD",
+		},
+		{
+			name: "invalid rate limit preflight",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":         "test-token",
+				"RATE_LIMIT_PREFLIGHT": "sometimes",
+			},
+			wantErr: true,
+			errMsg:  "RATE_LIMIT_PREFLIGHT must be one of",
+		},
+		{
+			name: "truncate limit above max file size",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":            "test-token",
+				"MAX_FILE_SIZE":           "1000",
+				"TRUNCATE_OVERSIZE_BYTES": "2000",
+			},
+			wantErr: true,
+			errMsg:  "TRUNCATE_OVERSIZE_BYTES must be between 0 and MAX_FILE_SIZE",
+		},
+		{
+			name: "zero result batch size",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":      "test-token",
+				"RESULT_BATCH_SIZE": "0",
+			},
+			wantErr: true,
+			errMsg:  "RESULT_BATCH_SIZE must be greater than 0",
+		},
+		{
+			name: "ramp up starting above max workers",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":            "test-token",
+				"MAX_WORKERS":             "4",
+				"RAMP_UP_MS":              "5000",
+				"RAMP_UP_INITIAL_WORKERS": "8",
+			},
+			wantErr: true,
+			errMsg:  "RAMP_UP_INITIAL_WORKERS between 1 and MAX_WORKERS",
+		},
+		{
+			name: "idempotency without keys",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":         "test-token",
+				"IDEMPOTENCY_MAX_KEYS": "0",
+			},
+			wantErr: true,
+			errMsg:  "IDEMPOTENCY_MAX_KEYS greater than 0",
+		},
+		{
+			name: "negative gzip threshold",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":          "test-token",
+				"GZIP_CONTENT_MIN_SIZE": "-1",
+			},
+			wantErr: true,
+			errMsg:  "GZIP_CONTENT_MIN_SIZE must be non-negative",
+		},
+		{
+			name: "invalid retry strategy",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":   "test-token",
+				"RETRY_STRATEGY": "linear",
+			},
+			wantErr: true,
+			errMsg:  "RETRY_STRATEGY must be one of",
+		},
+		{
+			name: "retry multiplier below 1",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":             "test-token",
+				"RETRY_BACKOFF_MULTIPLIER": "0.5",
+			},
+			wantErr: true,
+			errMsg:  "RETRY_BACKOFF_MULTIPLIER must be 0 or at least 1",
+		},
+		{
+			name: "negative read idle timeout",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":         "test-token",
+				"READ_IDLE_TIMEOUT_MS": "-1",
+			},
+			wantErr: true,
+			errMsg:  "RESPONSE_HEADER_TIMEOUT_MS and READ_IDLE_TIMEOUT_MS must be non-negative",
+		},
+		{
+			name: "negative max tree entries",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":     "test-token",
+				"MAX_TREE_ENTRIES": "-1",
+			},
+			wantErr: true,
+			errMsg:  "MAX_TREE_ENTRIES must be non-negative",
+		},
+		{
+			name: "zero tree fetch concurrency",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":           "test-token",
+				"TREE_FETCH_CONCURRENCY": "0",
+			},
+			wantErr: true,
+			errMsg:  "TREE_FETCH_CONCURRENCY must be greater than 0",
+		},
+		{
+			name: "zero batch concurrency",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":      "test-token",
+				"BATCH_CONCURRENCY": "0",
+			},
+			wantErr: true,
+			errMsg:  "BATCH_CONCURRENCY must be greater than 0",
+		},
+		{
+			name: "negative warm connections",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":     "test-token",
+				"WARM_CONNECTIONS": "-1",
+			},
+			wantErr: true,
+			errMsg:  "WARM_CONNECTIONS must be between 0 and MAX_CONCURRENT_FETCHES",
+		},
+		{
+			name: "more warm connections than fetches",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":           "test-token",
+				"MAX_CONCURRENT_FETCHES": "4",
+				"WARM_CONNECTIONS":       "8",
+			},
+			wantErr: true,
+			errMsg:  "WARM_CONNECTIONS must be between 0 and MAX_CONCURRENT_FETCHES",
+		},
+		{
+			name: "unknown auth method",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":      "test-token",
+				"GITHUB_AUTH_ORDER": "app,oauth",
+			},
+			wantErr: true,
+			errMsg:  `GITHUB_AUTH_ORDER entries must be token or app, got "oauth"`,
+		},
+		{
+			name: "repeated auth method",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":      "test-token",
+				"GITHUB_AUTH_ORDER": "token,app,token",
+			},
+			wantErr: true,
+			errMsg:  "GITHUB_AUTH_ORDER lists token more than once",
+		},
+		{
+			name: "per extension size limits",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":           "test-token",
+				"PER_EXTENSION_MAX_SIZE": ".json=52428800, MD=1048576",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, map[string]int64{".json": 52428800, ".md": 1048576}, cfg.PerExtensionMaxSize)
+			},
+		},
+		{
+			name: "malformed per extension size limit",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":           "test-token",
+				"PER_EXTENSION_MAX_SIZE": ".json=50MB",
+			},
+			wantErr: true,
+			errMsg:  `invalid PER_EXTENSION_MAX_SIZE: entry ".json=50MB" must have a size in bytes`,
+		},
+		{
+			name: "zero per extension size limit",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":           "test-token",
+				"PER_EXTENSION_MAX_SIZE": ".md=0",
+			},
+			wantErr: true,
+			errMsg:  "PER_EXTENSION_MAX_SIZE limit for .md must be greater than 0",
+		},
+		{
+			name: "extra github headers",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":         "test-token",
+				"GITHUB_EXTRA_HEADERS": "x-proxy-auth: Basic abc==, X-Team:docs",
+				"GITHUB_API_VERSION":   "2026-03-10",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, map[string]string{"X-Proxy-Auth": "Basic abc==", "X-Team": "docs"}, cfg.GitHubExtraHeaders)
+				assert.Equal(t, "2026-03-10", cfg.GitHubAPIVersion)
+			},
+		},
+		{
+			name: "malformed extra github header",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":         "test-token",
+				"GITHUB_EXTRA_HEADERS": "X-Team=docs",
+			},
+			wantErr: true,
+			errMsg:  `invalid GITHUB_EXTRA_HEADERS: entry "X-Team=docs" must be Name: value`,
+		},
+		{
+			name: "extra github header setting authorization",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":         "test-token",
+				"GITHUB_EXTRA_HEADERS": "authorization: token other",
+			},
+			wantErr: true,
+			errMsg:  "can't set Authorization",
+		},
+		{
+			name: "adaptive rate smoothing out of range",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":            "test-token",
+				"ADAPTIVE_RATE_LIMIT":     "true",
+				"ADAPTIVE_RATE_SMOOTHING": "1.5",
+			},
+			wantErr: true,
+			errMsg:  "ADAPTIVE_RATE_SMOOTHING must be greater than 0 and at most 1",
+		},
+		{
+			name: "adaptive rate floor above the ceiling",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":        "test-token",
+				"ADAPTIVE_RATE_LIMIT": "true",
+				"ADAPTIVE_RATE_MIN":   "5",
+				"ADAPTIVE_RATE_MAX":   "2",
+			},
+			wantErr: true,
+			errMsg:  "ADAPTIVE_RATE_MIN must be greater than 0 and at most ADAPTIVE_RATE_MAX",
+		},
+		{
+			name: "unknown content transform",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":       "test-token",
+				"CONTENT_TRANSFORMS": "strip_bom,rot13",
+			},
+			wantErr: true,
+			errMsg:  `CONTENT_TRANSFORMS entries must be strip_bom, normalize_eol or trim_trailing_whitespace, got "rot13"`,
+		},
+		{
+			name: "duplicate content transform",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":       "test-token",
+				"CONTENT_TRANSFORMS": "normalize_eol, Normalize_EOL",
+			},
+			wantErr: true,
+			errMsg:  "CONTENT_TRANSFORMS lists normalize_eol more than once",
+		},
+		{
+			name: "negative raw concurrency",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":        "test-token",
+				"RAW_MAX_CONCURRENCY": "-1",
+			},
+			wantErr: true,
+			errMsg:  "RAW_RATE_LIMIT_THRESHOLD, RAW_MAX_CONCURRENCY and API_MAX_CONCURRENCY must be non-negative",
+		},
+		{
+			name: "negative shutdown timeout",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":        "test-token",
+				"SHUTDOWN_TIMEOUT_MS": "-1",
+			},
+			wantErr: true,
+			errMsg:  "SHUTDOWN_TIMEOUT_MS must be non-negative",
+		},
+		{
+			name: "negative task queue size",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":    "test-token",
+				"TASK_QUEUE_SIZE": "-1",
+			},
+			wantErr: true,
+			errMsg:  "TASK_QUEUE_SIZE must be non-negative",
+		},
+		{
+			name: "invalid raw mirror URL",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":        "test-token",
+				"RAW_MIRROR_BASE_URL": "mirror.internal/raw",
+			},
+			wantErr: true,
+			errMsg:  "RAW_MIRROR_BASE_URL must be an http or https URL with a host",
+		},
+		{
+			name: "invalid redact pattern",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":    "test-token",
+				"REDACT_PATTERNS": `corp-[0-9]+ (unclosed`,
+			},
+			wantErr: true,
+			errMsg:  `REDACT_PATTERNS entry "(unclosed" is not a valid regular expression`,
+		},
+		{
+			name: "invalid include regex",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":  "test-token",
+				"INCLUDE_REGEX": "(unclosed",
+			},
+			wantErr: true,
+			errMsg:  "INCLUDE_REGEX is not a valid regular expression",
+		},
+		{
+			name: "invalid exclude regex",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":  "test-token",
+				"EXCLUDE_REGEX": "[a-",
+			},
+			wantErr: true,
+			errMsg:  "EXCLUDE_REGEX is not a valid regular expression",
+		},
+		{
+			name: "negative rate limit reserve",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":       "test-token",
+				"RATE_LIMIT_RESERVE": "-1",
+			},
+			wantErr: true,
+			errMsg:  "RATE_LIMIT_RESERVE must be non-negative",
+		},
+		{
+			name: "min file size above max",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":  "test-token",
+				"MIN_FILE_SIZE": "2048",
+				"MAX_FILE_SIZE": "1024",
+			},
+			wantErr: true,
+			errMsg:  "MIN_FILE_SIZE must be between 0 and MAX_FILE_SIZE",
+		},
+		{
+			name: "invalid result overflow strategy",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":    "test-token",
+				"RESULT_OVERFLOW": "drop",
+			},
+			wantErr: true,
+			errMsg:  "RESULT_OVERFLOW must be one of",
+		},
+		{
+			name: "spill without a size bound",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":           "test-token",
+				"RESULT_OVERFLOW":        "spill",
+				"RESULT_SPILL_MAX_BYTES": "0",
+			},
+			wantErr: true,
+			errMsg:  "RESULT_SPILL_MAX_BYTES must be greater than 0",
+		},
+		{
+			name: "checkpoints without an interval",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":              "test-token",
+				"CHECKPOINT_DIR":            "/var/lib/crawler",
+				"CHECKPOINT_INTERVAL_FILES": "0",
+			},
+			wantErr: true,
+			errMsg:  "CHECKPOINT_INTERVAL_FILES must be greater than 0",
+		},
+		{
+			name: "graphql batch size too large",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":       "test-token",
+				"ENABLE_GRAPHQL":     "true",
+				"GRAPHQL_BATCH_SIZE": "500",
+			},
+			wantErr: true,
+			errMsg:  "GRAPHQL_BATCH_SIZE must be between 1 and 100",
+		},
+		{
+			name: "extra special files",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":        "test-token",
+				"EXTRA_SPECIAL_FILES": "CMakeLists.txt, BUILD.bazel,WORKSPACE,.gitlab-ci.yml",
+			},
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Subset(t, cfg.SpecialFiles, DefaultSpecialFiles)
+				assert.Equal(t, []string{"cmakelists.txt", "build.bazel", "workspace", ".gitlab-ci.yml"}, cfg.SpecialFiles[len(DefaultSpecialFiles):])
+			},
+		},
+		{
+			name: "proxy settings",
+			envVars: map[string]string{
+				"GITHUB_TOKEN": "test-token",
+				"HTTPS_PROXY":  "http://proxy.internal:3128",
+				"NO_PROXY":     "localhost, .corp.example.com,",
+			},
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "http://proxy.internal:3128", cfg.HTTPSProxy)
+				assert.Equal(t, []string{"localhost", ".corp.example.com"}, cfg.NoProxy)
+			},
+		},
+		{
+			name: "invalid proxy url",
+			envVars: map[string]string{
+				"GITHUB_TOKEN": "test-token",
+				"HTTPS_PROXY":  "proxy.internal:3128",
+			},
+			wantErr: true,
+			errMsg:  "HTTPS_PROXY",
+		},
+		{
+			name: "invalid output mode",
+			envVars: map[string]string{
+				"GITHUB_TOKEN": "test-token",
+				"OUTPUT_MODE":  "yaml",
+			},
+			wantErr: true,
+			errMsg:  "OUTPUT_MODE must be one of",
+		},
 	}
 
 	for _, tt := range tests {
@@ -109,9 +529,24 @@ func clearEnv() {
 	envVars := []string{
 		"PORT", "HOST", "GITHUB_BASE_URL", "GITHUB_TOKEN", "GITHUB_APP_ID",
 		"GITHUB_APP_KEY", "GITHUB_INSTALL_ID", "MAX_WORKERS", "API_RATE_LIMIT_THRESHOLD",
+		"TREE_REQUEST_COST", "CONTENT_REQUEST_COST", "RATE_LIMIT_PREFLIGHT", "ENABLE_GRAPHQL", "GRAPHQL_INLINE_MAX_SIZE",
+		"GRAPHQL_BATCH_SIZE", "ENABLE_BLOB_BATCHING", "BLOB_BATCH_MAX_FILE_SIZE", "BLOB_BATCH_SIZE",
+		"BLOB_BATCH_CONCURRENCY", "PROBE_HTTP_PROTOCOL", "OUTPUT_MODE",
+		"RESULT_OVERFLOW", "RESULT_SPILL_DIR", "RESULT_SPILL_MAX_BYTES", "TREE_CACHE_SIZE", "MAX_PATH_DEPTH", "MIN_FILE_SIZE", "WORKER_IDLE_TIMEOUT_MS", "HEALTH_CHECK_CACHE_TTL_MS", "MAX_IN_MEMORY_CONTENT_BYTES", "CRAWL_DEADLINE_MS",
+		"HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy", "GITHUB_CA_BUNDLE", "GITHUB_TLS_INSECURE_SKIP_VERIFY",
+		"EXTRA_SPECIAL_FILES", "ENABLE_ARCHIVE_CRAWL", "ORDERED_BUFFER_MAX_RESULTS",
+		"DEBUG_CAPTURE_FAILURES", "DEBUG_CAPTURE_BODY_BYTES", "RATE_LIMIT_RESERVE",
+		"PER_FILE_TIMEOUT_MS", "PER_FILE_TIMEOUT_PER_MB_MS", "INCLUDE_REGEX", "EXCLUDE_REGEX",
+		"TRUNCATE_OVERSIZE_BYTES",
+		"RETRY_STRATEGY", "RETRY_INITIAL_BACKOFF_MS", "RETRY_BACKOFF_MULTIPLIER", "RETRY_BACKOFF_MAX_MS",
+		"TASK_QUEUE_SIZE", "REDACT_PATTERNS", "RAW_MIRROR_BASE_URL", "WARM_RATE_LIMITER", "WARM_CONNECTIONS", "SHUTDOWN_TIMEOUT_MS", "CHECKPOINT_DIR", "CHECKPOINT_INTERVAL_FILES", "RESPONSE_HEADER_TIMEOUT_MS", "READ_IDLE_TIMEOUT_MS", "MAX_TREE_ENTRIES", "TREE_FETCH_CONCURRENCY", "BATCH_CONCURRENCY", "GITHUB_AUTH_ORDER", "GITHUB_API_VERSION", "GITHUB_EXTRA_HEADERS", "PER_EXTENSION_MAX_SIZE", "ADAPTIVE_RATE_LIMIT", "ADAPTIVE_RATE_SMOOTHING", "ADAPTIVE_RATE_MIN", "ADAPTIVE_RATE_MAX",
+		"ALLOW_DEGRADED_STARTUP", "CONTENT_TRANSFORMS",
+		"VERIFY_CONTENT_SHA", "REFETCH_SHA_MISMATCH", "CLASSIFY_FILES",
+		"RAW_RATE_LIMIT_THRESHOLD", "RAW_MAX_CONCURRENCY", "API_MAX_CONCURRENCY", "GZIP_CONTENT_MIN_SIZE",
+		"IDEMPOTENCY_TTL_MS", "IDEMPOTENCY_MAX_KEYS", "RAMP_UP_MS", "RAMP_UP_INITIAL_WORKERS", "RESULT_BATCH_SIZE",
 		"FETCH_TIMEOUT_MS", "RETRY_MAX_ATTEMPTS", "RETRY_BACKOFF_MS_BASE",
 		"MAX_FILE_SIZE", "MAX_CONCURRENT_FETCHES", "ALLOWED_EXTENSIONS",
-		"ENABLE_BINARY_DETECTION", "LOG_LEVEL", "METRICS_PATH", "ENVIRONMENT",
+		"ENABLE_BINARY_DETECTION", "HONOR_IGNORE_FILE", "LOG_LEVEL", "METRICS_PATH", "ENVIRONMENT",
 	}
 
 	for _, env := range envVars {
@@ -130,17 +565,93 @@ func TestConfigDefaults(t *testing.T) {
 	assert.Equal(t, "8080", cfg.Port)
 	assert.Equal(t, "0.0.0.0", cfg.Host)
 	assert.Equal(t, "https://api.github.com", cfg.GitHubBaseURL)
+	assert.Equal(t, "", cfg.RawMirrorBaseURL)
 	assert.Equal(t, 50, cfg.MaxWorkers)
+	assert.Equal(t, 0, cfg.WorkerIdleTimeoutMS)
+	assert.Equal(t, 0, cfg.RampUpMS)
+	assert.Equal(t, 1, cfg.RampUpInitialWorkers)
+	assert.Equal(t, 30000, cfg.ShutdownTimeoutMS)
 	assert.Equal(t, 100, cfg.APIRateLimitThreshold)
+	assert.Equal(t, 2, cfg.TreeRequestCost)
+	assert.Equal(t, 1, cfg.ContentRequestCost)
+	assert.Equal(t, PreflightRefuse, cfg.RateLimitPreflight)
+	assert.Equal(t, 0, cfg.RateLimitReserve)
+	assert.True(t, cfg.ProbeHTTPProtocol)
+	assert.True(t, cfg.WarmRateLimiter)
+	assert.Equal(t, 0, cfg.WarmConnections)
+	assert.Equal(t, "", cfg.HTTPSProxy)
+	assert.Empty(t, cfg.NoProxy)
+	assert.Equal(t, "", cfg.CABundlePath)
+	assert.False(t, cfg.TLSInsecureSkipVerify)
+	assert.Equal(t, 100, cfg.TreeCacheSize)
+	assert.Equal(t, 540000, cfg.CrawlDeadlineMS)
 	assert.Equal(t, 30000, cfg.FetchTimeoutMS)
+	assert.Equal(t, 10000, cfg.ResponseHeaderTimeoutMS)
+	assert.Equal(t, 10000, cfg.ReadIdleTimeoutMS)
+	assert.Equal(t, 0, cfg.PerFileTimeoutMS)
+	assert.Equal(t, 0, cfg.PerFileTimeoutPerMBMS)
 	assert.Equal(t, 3, cfg.RetryMaxAttempts)
 	assert.Equal(t, 1000, cfg.RetryBackoffBaseMS)
+	assert.Equal(t, RetryExponential, cfg.RetryStrategy)
+	assert.Equal(t, 0, cfg.RetryInitialBackoffMS)
+	assert.Equal(t, 2.0, cfg.RetryBackoffMultiplier)
+	assert.Equal(t, 0, cfg.RetryBackoffMaxMS)
+	assert.Equal(t, 10000, cfg.TaskQueueSize)
+	assert.Equal(t, int64(0), cfg.MinFileSize)
 	assert.Equal(t, int64(10*1024*1024), cfg.MaxFileSize)
+	assert.Equal(t, int64(0), cfg.TruncateOversizeBytes)
+	assert.Equal(t, int64(0), cfg.GzipContentMinSize)
 	assert.Equal(t, 100, cfg.MaxConcurrentFetches)
+	assert.Equal(t, int64(512*1024*1024), cfg.MaxInMemoryContentBytes)
+	assert.Equal(t, 20000, cfg.MaxTreeEntries)
+	assert.Equal(t, 4, cfg.TreeFetchConcurrency)
+	assert.Equal(t, 4, cfg.BatchConcurrency)
+	assert.Equal(t, []string{AuthMethodToken, AuthMethodApp}, cfg.GitHubAuthOrder)
+	assert.Nil(t, cfg.PerExtensionMaxSize)
+	assert.Equal(t, "2022-11-28", cfg.GitHubAPIVersion)
+	assert.Nil(t, cfg.GitHubExtraHeaders)
+	assert.False(t, cfg.AdaptiveRateLimit)
+	assert.Equal(t, 0.2, cfg.AdaptiveRateSmoothing)
+	assert.Equal(t, 0.1, cfg.AdaptiveRateMin)
+	assert.Equal(t, float64(100), cfg.GetAdaptiveRateMax())
+	assert.False(t, cfg.AllowDegradedStartup)
+	assert.Empty(t, cfg.ContentTransforms)
+	assert.False(t, cfg.VerifyContentSHA)
+	assert.True(t, cfg.RefetchSHAMismatch)
+	assert.False(t, cfg.ClassifyFiles)
+	assert.Equal(t, 0, cfg.RawRateLimitThreshold)
+	assert.Equal(t, 0, cfg.RawMaxConcurrency)
+	assert.Equal(t, 0, cfg.APIMaxConcurrency)
+	assert.Equal(t, ResultOverflowBlock, cfg.ResultOverflow)
+	assert.Equal(t, "", cfg.ResultSpillDir)
+	assert.Equal(t, int64(256*1024*1024), cfg.ResultSpillMaxBytes)
+	assert.Equal(t, "", cfg.CheckpointDir)
+	assert.Equal(t, 100, cfg.CheckpointIntervalFiles)
+	assert.False(t, cfg.EnableGraphQL)
+	assert.Equal(t, int64(100*1024), cfg.GraphQLInlineMaxSize)
+	assert.Equal(t, 50, cfg.GraphQLBatchSize)
+	assert.False(t, cfg.EnableArchiveCrawl)
+	assert.False(t, cfg.EnableBlobBatching)
+	assert.Equal(t, int64(16*1024), cfg.BlobBatchMaxFileSize)
+	assert.Equal(t, 20, cfg.BlobBatchSize)
+	assert.Equal(t, 4, cfg.BlobBatchConcurrency)
+	assert.Equal(t, "inline", cfg.OutputMode)
+	assert.Equal(t, 1000, cfg.OrderedBufferMaxResults)
 	assert.Equal(t, "info", cfg.LogLevel)
 	assert.Equal(t, "/metrics", cfg.MetricsPath)
+	assert.Equal(t, 30000, cfg.HealthCheckCacheTTLMS)
+	assert.Equal(t, 1, cfg.ResultBatchSize)
+	assert.Equal(t, 600000, cfg.IdempotencyTTLMS)
+	assert.Equal(t, 1000, cfg.IdempotencyMaxKeys)
+	assert.False(t, cfg.DebugCaptureFailures)
+	assert.Equal(t, 1024, cfg.DebugCaptureBodyBytes)
 	assert.Equal(t, "development", cfg.Environment)
 	assert.True(t, cfg.EnableBinaryDetection)
+	assert.Equal(t, 0, cfg.MaxPathDepth)
+	assert.False(t, cfg.HonorIgnoreFile)
+	assert.Nil(t, cfg.IncludePattern)
+	assert.Nil(t, cfg.ExcludePattern)
+	assert.Equal(t, DefaultSpecialFiles, cfg.SpecialFiles)
 	assert.NotEmpty(t, cfg.AllowedExtensions)
 }
 
@@ -149,6 +660,11 @@ func TestConfigHelperMethods(t *testing.T) {
 	os.Setenv("GITHUB_TOKEN", "test-token")
 	os.Setenv("FETCH_TIMEOUT_MS", "5000")
 	os.Setenv("RETRY_BACKOFF_MS_BASE", "2000")
+	os.Setenv("WORKER_IDLE_TIMEOUT_MS", "30000")
+	os.Setenv("SHUTDOWN_TIMEOUT_MS", "5000")
+	os.Setenv("RESPONSE_HEADER_TIMEOUT_MS", "2000")
+	os.Setenv("READ_IDLE_TIMEOUT_MS", "3000")
+	os.Setenv("CRAWL_DEADLINE_MS", "60000")
 	os.Setenv("ENVIRONMENT", "production")
 
 	cfg, err := Load()
@@ -162,6 +678,19 @@ func TestConfigHelperMethods(t *testing.T) {
 	expectedBackoff := 2 * time.Second
 	assert.Equal(t, expectedBackoff, cfg.GetRetryBackoffBase())
 
+	// Test GetWorkerIdleTimeout
+	assert.Equal(t, 30*time.Second, cfg.GetWorkerIdleTimeout())
+
+	// Test GetShutdownTimeout
+	assert.Equal(t, 5*time.Second, cfg.GetShutdownTimeout())
+
+	// Test GetResponseHeaderTimeout and GetReadIdleTimeout
+	assert.Equal(t, 2*time.Second, cfg.GetResponseHeaderTimeout())
+	assert.Equal(t, 3*time.Second, cfg.GetReadIdleTimeout())
+
+	// Test GetCrawlDeadline
+	assert.Equal(t, time.Minute, cfg.GetCrawlDeadline())
+
 	// Test IsProduction
 	assert.True(t, cfg.IsProduction())
 
@@ -169,6 +698,126 @@ func TestConfigHelperMethods(t *testing.T) {
 	assert.False(t, cfg.HasGitHubApp())
 }
 
+func TestGetPerFileTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     int
+		perMB    int
+		size     int
+		expected time.Duration
+	}{
+		{name: "falls back to fetch timeout", size: 1 << 20, expected: 30 * time.Second},
+		{name: "fixed", base: 2000, size: 1 << 20, expected: 2 * time.Second},
+		{name: "scaled by size", base: 2000, perMB: 1000, size: 3 << 20, expected: 5 * time.Second},
+		{name: "partial MB", base: 2000, perMB: 1000, size: 1 << 19, expected: 2500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{FetchTimeoutMS: 30000, PerFileTimeoutMS: tt.base, PerFileTimeoutPerMBMS: tt.perMB}
+			assert.Equal(t, tt.expected, cfg.GetPerFileTimeout(tt.size))
+		})
+	}
+}
+
+func TestGetTaskQueueSize(t *testing.T) {
+	assert.Equal(t, 100, (&Config{MaxConcurrentFetches: 100}).GetTaskQueueSize())
+	assert.Equal(t, 10000, (&Config{MaxConcurrentFetches: 100, TaskQueueSize: 10000}).GetTaskQueueSize())
+}
+
+func TestMaxFileSizeFor(t *testing.T) {
+	cfg := &Config{MaxFileSize: 1000, PerExtensionMaxSize: map[string]int64{".json": 5000, ".md": 100}}
+
+	assert.Equal(t, int64(5000), cfg.MaxFileSizeFor("data/big.json"))
+	assert.Equal(t, int64(100), cfg.MaxFileSizeFor("docs/README.MD"))
+	assert.Equal(t, int64(1000), cfg.MaxFileSizeFor("main.go"))
+	assert.Equal(t, int64(1000), cfg.MaxFileSizeFor("Makefile"))
+}
+
+func TestGetRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected []time.Duration
+	}{
+		{
+			name:     "doubles from the base by default",
+			cfg:      Config{RetryBackoffBaseMS: 1000},
+			expected: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:     "separate initial backoff",
+			cfg:      Config{RetryBackoffBaseMS: 1000, RetryInitialBackoffMS: 100},
+			expected: []time.Duration{100 * time.Millisecond, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:     "immediate first retry",
+			cfg:      Config{RetryBackoffBaseMS: 1000, RetryStrategy: RetryImmediateFirst},
+			expected: []time.Duration{0, time.Second, 2 * time.Second},
+		},
+		{
+			name:     "multiplier and cap",
+			cfg:      Config{RetryBackoffBaseMS: 1000, RetryBackoffMultiplier: 3, RetryBackoffMaxMS: 5000},
+			expected: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second},
+		},
+		{
+			name:     "constant",
+			cfg:      Config{RetryBackoffBaseMS: 500, RetryBackoffMultiplier: 1},
+			expected: []time.Duration{500 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, expected := range tt.expected {
+				assert.Equal(t, expected, tt.cfg.GetRetryBackoff(i+1), "retry %d", i+1)
+			}
+		})
+	}
+
+	// A long schedule saturates rather than overflowing to a negative wait
+	uncapped := Config{RetryBackoffBaseMS: 1000}
+	assert.Equal(t, time.Duration(math.MaxInt64), uncapped.GetRetryBackoff(41))
+	assert.Equal(t, time.Duration(math.MaxInt64), uncapped.GetRetryBackoff(1000))
+	capped := Config{RetryBackoffBaseMS: 1000, RetryBackoffMaxMS: 30000}
+	assert.Equal(t, 30*time.Second, capped.GetRetryBackoff(41))
+	assert.Equal(t, 30*time.Second, capped.GetRetryBackoff(1000))
+}
+
+func TestLoadCompilesRedactPatterns(t *testing.T) {
+	clearEnv()
+	os.Setenv("GITHUB_TOKEN", "test-token")
+	os.Setenv("REDACT_PATTERNS", `corp-[0-9]{2,6}  internal_key_\w+`)
+	defer clearEnv()
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`corp-[0-9]{2,6}`, `internal_key_\w+`}, cfg.RedactPatterns)
+	require.Len(t, cfg.RedactRegexps, 2)
+	assert.True(t, cfg.RedactRegexps[0].MatchString("corp-1234"))
+}
+
+func TestLoadCompilesPathRegexes(t *testing.T) {
+	clearEnv()
+	os.Setenv("GITHUB_TOKEN", "test-token")
+	os.Setenv("INCLUDE_REGEX", `.*_test\.go$`)
+	os.Setenv("EXCLUDE_REGEX", `(^|/)generated/`)
+	defer clearEnv()
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	require.NotNil(t, cfg.IncludePattern)
+	require.NotNil(t, cfg.ExcludePattern)
+	assert.True(t, cfg.IncludePattern.MatchString("pkg/api/handler_test.go"))
+	assert.True(t, cfg.ExcludePattern.MatchString("api/generated/types.go"))
+}
+
+func TestNormalizeExtensions(t *testing.T) {
+	assert.Equal(t, []string{".md", ".go", ".rst"}, NormalizeExtensions([]string{"MD", " .go", ".RST "}))
+	assert.Empty(t, NormalizeExtensions(nil))
+}
+
 func TestHasGitHubApp(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,101 @@
+package github
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// adaptiveRate steers the request rate towards the one that spends the
+// remaining quota evenly until it resets. Each response gives that target
+// exactly, remaining / seconds until reset; the current rate moves towards it
+// by the smoothing weight, so it doesn't swing between fast and slow as the
+// remaining count bounces around.
+//
+// The weight grows as the window closes, so whatever quota is left still gets
+// spent before the reset, and a new window starts from its own target rather
+// than being averaged with the last one.
+type adaptiveRate struct {
+	mu        sync.Mutex
+	smoothing float64 // weight of each new target, in (0, 1]
+	floor     float64 // requests per second never gone below
+	ceiling   float64 // requests per second never exceeded
+	current   float64 // requests per second, 0 until the first response
+	reset     time.Time
+	observed  time.Time
+
+	// throttled lowers the ceiling until throttledUntil, see Client.ThrottleUntil
+	throttled      float64
+	throttledUntil time.Time
+}
+
+// throttle caps the rate at limit until until, on top of the ceiling
+func (a *adaptiveRate) throttle(limit float64, until time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.throttled, a.throttledUntil = limit, until
+	if a.current > limit {
+		a.current = limit
+	}
+}
+
+// observe folds in a response reporting remaining requests until reset and
+// returns the exact target rate along with the rate the limiter should use
+func (a *adaptiveRate) observe(remaining int, reset, now time.Time) (target, current float64) {
+	window := reset.Sub(now).Seconds()
+	if window <= 0 {
+		// The window is over; the next response reports the fresh quota
+		window = 1
+	}
+	target = float64(max(remaining, 0)) / window
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.current == 0 || !reset.Equal(a.reset) {
+		a.current = target
+	} else {
+		// Time since the last response as a share of the time left; once
+		// that share exceeds the smoothing weight, the rate lands on target
+		// quickly enough not to strand quota at the reset
+		weight := min(max(a.smoothing, now.Sub(a.observed).Seconds()/window), 1)
+		a.current += weight * (target - a.current)
+	}
+	ceiling := a.ceiling
+	if now.Before(a.throttledUntil) {
+		ceiling = min(ceiling, a.throttled)
+	}
+	a.current = min(max(a.current, a.floor), ceiling)
+	a.reset, a.observed = reset, now
+	return target, a.current
+}
+
+// adaptRate moves the rate limiter towards the target rate from the response's
+// rate limit headers. Quota held back by RateLimitReserve isn't counted, and
+// the rate stays between ADAPTIVE_RATE_MIN and ADAPTIVE_RATE_MAX.
+func (c *Client) adaptRate(resp *http.Response) {
+	if c.adaptive == nil {
+		return
+	}
+
+	// Only the core quota paces the limiter; raw content responses carry no
+	// headers, and other resources such as search have their own quotas
+	if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" && resource != "core" {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	target, current := c.adaptive.observe(remaining-c.config.RateLimitReserve, time.Unix(reset, 0), time.Now())
+	c.rateLimiter.SetLimit(rate.Limit(current))
+	c.metrics.SetAdaptiveRate(target, current)
+}
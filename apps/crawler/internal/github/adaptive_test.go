@@ -0,0 +1,214 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func TestAdaptiveRateDampsOscillation(t *testing.T) {
+	a := &adaptiveRate{smoothing: 0.2, floor: 0.1, ceiling: 100}
+	now := time.Now()
+	reset := now.Add(1000 * time.Second)
+
+	// Remaining bounces between 4000 and 1000, so the raw sustainable rate
+	// swings fourfold between 4/s and 1/s on every response
+	var rates []float64
+	for i := range 40 {
+		remaining := 4000
+		if i%2 == 1 {
+			remaining = 1000
+		}
+		_, current := a.observe(remaining, reset, now)
+		rates = append(rates, current)
+	}
+
+	settled := rates[20:]
+	lowest, highest := settled[0], settled[0]
+	for i, r := range settled {
+		lowest, highest = min(lowest, r), max(highest, r)
+		if i > 0 {
+			assert.InDelta(t, settled[i-1], r, 0.2*settled[i-1], "step %d moves the rate too far", i)
+		}
+	}
+	assert.Less(t, highest/lowest, 1.25, "the smoothed rate swings far less than the raw samples")
+	assert.InDelta(t, 2.5, (highest+lowest)/2, 0.2, "it settles around the average sustainable rate")
+}
+
+func TestAdaptiveRateConverges(t *testing.T) {
+	a := &adaptiveRate{smoothing: 0.2, floor: 0.1, ceiling: 100}
+	now := time.Now()
+	reset := now.Add(3600 * time.Second)
+
+	// A burst left little quota; afterwards 2 requests a second are sustainable
+	a.observe(360, reset, now)
+	previous := 0.1
+	for range 30 {
+		now = now.Add(10 * time.Second)
+		remaining := int(2 * reset.Sub(now).Seconds())
+		target, r := a.observe(remaining, reset, now)
+		assert.InDelta(t, 2.0, target, 0.01, "the target is exact on every response")
+		assert.Greater(t, r, previous, "the rate rises steadily rather than overshooting")
+		assert.LessOrEqual(t, r, 2.0)
+		previous = r
+	}
+	assert.InDelta(t, 2.0, previous, 0.01)
+}
+
+func TestAdaptiveRateSpendsQuotaBeforeReset(t *testing.T) {
+	a := &adaptiveRate{smoothing: 0.2, floor: 0.1, ceiling: 100}
+	now := time.Now()
+	reset := now.Add(time.Hour)
+
+	// The rate settles at 1/s, then another client stops sharing the quota
+	// and 600 requests are left for the last two minutes
+	a.observe(3600, reset, now)
+	now = reset.Add(-2 * time.Minute)
+	target, current := a.observe(600, reset, now)
+	assert.Equal(t, 5.0, target)
+	assert.Greater(t, current, 0.2*target, "time passed since the last response outweighs the smoothing")
+
+	for range 5 {
+		now = now.Add(20 * time.Second)
+		_, current = a.observe(int(5*reset.Sub(now).Seconds()), reset, now)
+	}
+	assert.InDelta(t, 5.0, current, 0.01, "the rate reaches the target before the window closes")
+}
+
+func TestAdaptiveRateStartsNewWindowAtItsTarget(t *testing.T) {
+	a := &adaptiveRate{smoothing: 0.2, floor: 0.1, ceiling: 100}
+	now := time.Now()
+
+	_, current := a.observe(360, now.Add(time.Hour), now)
+	assert.Equal(t, 0.1, current)
+
+	// The quota resets: the new window isn't averaged with the spent one
+	later := now.Add(time.Minute)
+	target, current := a.observe(3600, later.Add(time.Hour), later)
+	assert.Equal(t, 1.0, target)
+	assert.Equal(t, 1.0, current)
+}
+
+func TestAdaptiveRateClamps(t *testing.T) {
+	a := &adaptiveRate{smoothing: 1, floor: 0.5, ceiling: 2}
+	now := time.Now()
+
+	target, current := a.observe(36000, now.Add(time.Hour), now)
+	assert.Equal(t, 10.0, target, "the target isn't clamped")
+	assert.Equal(t, 2.0, current)
+
+	_, current = a.observe(0, now.Add(time.Hour), now)
+	assert.Equal(t, 0.5, current)
+}
+
+func TestAdaptRateSetsLimiterFromHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  string
+		remaining int
+		window    time.Duration
+		adaptive  bool
+		want      rate.Limit
+	}{
+		{name: "sustainable rate", resource: "core", remaining: 3700, window: time.Hour, adaptive: true, want: 1},
+		{name: "capped at the threshold", remaining: 1_000_000, window: time.Minute, adaptive: true, want: 100},
+		{name: "floor when nearly spent", remaining: 100, window: time.Hour, adaptive: true, want: 0.1},
+		{name: "other quotas are ignored", resource: "search", remaining: 3700, window: time.Hour, adaptive: true, want: 100},
+		{name: "disabled", remaining: 3700, window: time.Hour, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset := time.Now().Add(tt.window)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.resource != "" {
+					w.Header().Set("X-RateLimit-Resource", tt.resource)
+				}
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(tt.remaining))
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+				_, _ = w.Write([]byte(`{"sha": "tree"}`))
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{
+				GitHubToken:           "test-token",
+				GitHubBaseURL:         server.URL,
+				APIRateLimitThreshold: 100,
+				FetchTimeoutMS:        5000,
+				RateLimitReserve:      100,
+				AdaptiveRateLimit:     tt.adaptive,
+				AdaptiveRateSmoothing: 0.2,
+				AdaptiveRateMin:       0.1,
+			}
+			m := metrics.NewForTesting()
+			client, err := NewClient(cfg, m)
+			require.NoError(t, err)
+
+			_, err = client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+			require.NoError(t, err)
+
+			// The reserve is left out: 3600 spendable over an hour is 1/s
+			assert.InDelta(t, float64(tt.want), float64(client.rateLimiter.Limit()), 0.01)
+			if tt.want != 100 {
+				assert.InDelta(t, float64(tt.want), testutil.ToFloat64(m.GitHubRateLimit), 0.01)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRateHonorsThrottle(t *testing.T) {
+	a := &adaptiveRate{smoothing: 1, floor: 0.01, ceiling: 100}
+	now := time.Now()
+	reset := now.Add(time.Hour)
+
+	a.throttle(0.5, reset)
+	_, current := a.observe(36000, reset, now)
+	assert.Equal(t, 0.5, current, "the throttle caps the rate until it ends")
+
+	// Once the throttled window is over, the ceiling applies again
+	later := reset.Add(time.Second)
+	_, current = a.observe(36000, later.Add(time.Hour), later)
+	assert.Equal(t, 10.0, current)
+}
+
+func TestThrottleUntilWithAdaptiveRate(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "1000000")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		_, _ = w.Write([]byte(`{"sha": "tree"}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 100,
+		FetchTimeoutMS:        5000,
+		AdaptiveRateLimit:     true,
+		AdaptiveRateSmoothing: 0.2,
+		AdaptiveRateMin:       0.01,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+
+	// 360 requests spread over an hour is 0.1 requests per second
+	client.ThrottleUntil(reset, 360)
+	assert.InDelta(t, 0.1, float64(client.rateLimiter.Limit()), 0.01)
+
+	// A response reporting plenty of quota doesn't undo the throttle
+	_, err = client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.1, float64(client.rateLimiter.Limit()), 0.01)
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GetTarball downloads the gzipped tarball of a repository at ref and passes
+// the response body to fn, which must consume it before returning. The whole
+// repository costs a single API call. The download is not retried: fn may
+// already have acted on part of the archive when a read fails.
+func (c *Client) GetTarball(ctx context.Context, owner, repo, ref string, fn func(io.Reader) error) (err error) {
+	tenantToken := tokenFromContext(ctx)
+	if tenantToken != "" {
+		defer func() { err = scrubToken(err, tenantToken) }()
+	} else if err := c.AuthError(); err != nil {
+		return err
+	}
+	if err := c.waitForRateLimit(ctx, c.config.TreeRequestCost); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	// GitHub redirects to codeload with a short-lived token in the URL, so the
+	// Authorization header can safely be dropped on the cross-host redirect
+	url := fmt.Sprintf("%s/repos/%s/%s/tarball/%s", c.baseURL, owner, repo, ref)
+
+	// The archive client has no overall timeout, so a stalled download is
+	// only caught by the read idle timeout
+	reqCtx, guard := c.newStallGuard(ctx)
+	req, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
+	if err != nil {
+		guard.stop()
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+	c.authorize(req, c.startingCredential(url))
+
+	if err := acquireSlot(reqCtx, c.apiSlots); err != nil {
+		guard.stop()
+		return err
+	}
+	defer releaseSlot(c.apiSlots)
+
+	countRequest(ctx)
+	start := time.Now()
+	resp, err := c.archiveClient.Do(req)
+	c.metrics.RecordGitHubRequestDuration("get_tarball", time.Since(start).Seconds())
+	if err != nil {
+		guard.stop()
+		if isHeaderTimeout(err) {
+			c.metrics.RecordStalledTransfer("headers")
+		}
+		return fmt.Errorf("failed to download tarball: %w", err)
+	}
+	guard.watch(resp)
+	defer resp.Body.Close()
+
+	if tenantToken == "" {
+		c.trackQuota(resp)
+	}
+	c.metrics.RecordGitHubAPICall("get_tarball", strconv.Itoa(resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		c.metrics.RecordError("api_error", owner, repo)
+		return fmt.Errorf("failed to download tarball: %w", newAPIError(resp))
+	}
+
+	return fn(resp.Body)
+}
@@ -0,0 +1,59 @@
+package github
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func TestGetTarball(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/tarball/main":
+			// GitHub answers with a redirect to codeload
+			http.Redirect(w, r, "/codeload/owner/repo/main", http.StatusFound)
+		case "/codeload/owner/repo/main":
+			_, _ = w.Write([]byte("archive bytes"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 100,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        30000,
+	}
+	m := metrics.NewForTesting()
+	client, err := NewClient(cfg, m)
+	require.NoError(t, err)
+
+	var body []byte
+	err = client.GetTarball(context.Background(), "owner", "repo", "main", func(r io.Reader) error {
+		body, err = io.ReadAll(r)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "archive bytes", string(body))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubAPICallsTotal.WithLabelValues("get_tarball", "200")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.GitHubRequestDuration))
+
+	err = client.GetTarball(context.Background(), "owner", "missing", "main", func(io.Reader) error {
+		t.Error("fn should not be called for a failed download")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,159 @@
+package github
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+)
+
+// Installation tokens are refreshed this long before they expire, so a
+// request never goes out with a token that lapses in flight
+const tokenRefreshMargin = 5 * time.Minute
+
+// tokenRefreshRetry is how long a failed refresh waits before it is tried
+// again; the old token is used meanwhile
+const tokenRefreshRetry = 30 * time.Second
+
+// credential is one set-up authentication method
+type credential struct {
+	method string // config.AuthMethodToken or config.AuthMethodApp
+	token  string
+
+	// expiresAt is when an installation token lapses, zero for a PAT;
+	// retryAt holds back the next refresh after one fails
+	expiresAt time.Time
+	retryAt   time.Time
+}
+
+// authOrder returns the configured authentication preference, token first
+// when none is set
+func (c *Client) authOrder() []string {
+	if len(c.config.GitHubAuthOrder) > 0 {
+		return c.config.GitHubAuthOrder
+	}
+	return []string{config.AuthMethodToken, config.AuthMethodApp}
+}
+
+// authorize sets the Authorization header for the credential at index i, or
+// for the request context's tenant token, see WithToken
+func (c *Client) authorize(req *http.Request, i int) {
+	if token := tokenFromContext(req.Context()); token != "" {
+		req.Header.Set("Authorization", "token "+token)
+		return
+	}
+	req.Header.Set("Authorization", "token "+c.credentialToken(i))
+}
+
+// credentialToken returns the token of the credential at index i, first
+// refreshing an installation token that is about to expire
+func (c *Client) credentialToken(i int) string {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	cred := &c.credentials[i]
+	if cred.expiresAt.IsZero() {
+		return cred.token
+	}
+
+	now := time.Now()
+	if cred.expiresAt.Sub(now) < tokenRefreshMargin && now.After(cred.retryAt) {
+		token, expiresAt, err := c.generateInstallationToken()
+		if err != nil {
+			log.Printf("Failed to refresh GitHub App installation token, expiring at %s: %v", cred.expiresAt.Format(time.RFC3339), err)
+			c.metrics.RecordTokenRefresh("failure")
+			cred.retryAt = now.Add(tokenRefreshRetry)
+		} else {
+			c.metrics.RecordTokenRefresh("success")
+			cred.token, cred.expiresAt = token, expiresAt
+		}
+	}
+
+	c.metrics.SetTokenExpiry(time.Until(cred.expiresAt).Seconds())
+	return cred.token
+}
+
+// AuthError returns the error wrapping ErrAuthNotConfigured while a client
+// started with AllowDegradedStartup has no working credential, or nil
+func (c *Client) AuthError() error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	return c.authErr
+}
+
+// retryAuth tries again to set up authentication for a client that started
+// degraded, so fixing the credentials or an App outage ending recovers the
+// client without a restart. It returns the remaining AuthError.
+func (c *Client) retryAuth() error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.authErr == nil {
+		return nil
+	}
+
+	if err := c.setupAuth(); err != nil {
+		c.authErr = fmt.Errorf("%w: %w", ErrAuthNotConfigured, err)
+		return c.authErr
+	}
+	log.Printf("GitHub authentication recovered")
+	c.authErr = nil
+	return nil
+}
+
+// startingCredential returns the credential to try first for url: the one
+// that last served the URL's owner, or the most preferred
+func (c *Client) startingCredential(url string) int {
+	owner := ownerFromURL(url)
+	if owner == "" {
+		return 0
+	}
+
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	return c.ownerCredentials[owner]
+}
+
+// rememberCredential makes later requests for url's owner start with the
+// credential at index i, which just served it after a refusal, so an org the
+// preferred credential can't reach costs one refused request, not one per file
+func (c *Client) rememberCredential(url string, i int) {
+	owner := ownerFromURL(url)
+	if owner == "" {
+		return
+	}
+
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.ownerCredentials == nil {
+		c.ownerCredentials = make(map[string]int)
+	}
+	c.ownerCredentials[owner] = i
+}
+
+// refusedCredential reports whether resp means the credential can't access
+// the resource, so another credential might. GitHub answers 404 rather than
+// 403 for private repositories a credential can't see, such as an org the
+// App isn't installed on. Rate limits aren't refusals.
+func refusedCredential(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("X-RateLimit-Remaining") != "0" && resp.Header.Get("Retry-After") == ""
+	}
+	return false
+}
+
+// ownerFromURL returns the lowercased owner of a /repos/{owner}/... API URL,
+// or "" for URLs that aren't about a repository
+func ownerFromURL(url string) string {
+	_, rest, ok := strings.Cut(url, "/repos/")
+	if !ok {
+		return ""
+	}
+	owner, _, _ := strings.Cut(rest, "/")
+	return strings.ToLower(owner)
+}
@@ -0,0 +1,301 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// generatePrivateKey returns a fresh PEM-encoded RSA key for signing App JWTs
+func generatePrivateKey(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+// authServer issues the installation token "app-token" and serves trees only
+// to the token allowed for each owner, answering others with 404 like GitHub
+type authServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string // "<owner> <token>" for each tree request
+}
+
+func newAuthServer(t *testing.T, installStatus int, allowed map[string]string) *authServer {
+	s := &authServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app/installations/789012/access_tokens" {
+			w.WriteHeader(installStatus)
+			_, _ = w.Write([]byte(`{"token": "app-token"}`))
+			return
+		}
+
+		owner := strings.Split(r.URL.Path, "/")[2]
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "token ")
+		s.mu.Lock()
+		s.requests = append(s.requests, owner+" "+token)
+		s.mu.Unlock()
+
+		if allowed[owner] != token {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{SHA: owner + "-tree"})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newAuthTestClient(t *testing.T, server *authServer, order []string) (*Client, error) {
+	cfg := &config.Config{
+		GitHubToken:           "pat-token",
+		GitHubAppID:           "123456",
+		GitHubAppKey:          generatePrivateKey(t),
+		GitHubInstallID:       "789012",
+		GitHubAuthOrder:       order,
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        5000,
+		RetryMaxAttempts:      1,
+		RetryBackoffBaseMS:    1,
+	}
+	return NewClient(cfg, metrics.NewForTesting())
+}
+
+func TestAuthFallsBackToNextCredential(t *testing.T) {
+	// The App isn't installed on "personal", which only the PAT can read
+	server := newAuthServer(t, http.StatusCreated, map[string]string{"org": "app-token", "personal": "pat-token"})
+	client, err := newAuthTestClient(t, server, []string{config.AuthMethodApp, config.AuthMethodToken})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	tree, err := client.GetRepositoryTree(ctx, "org", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "org-tree", tree.SHA)
+
+	tree, err = client.GetRepositoryTree(ctx, "personal", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "personal-tree", tree.SHA)
+
+	// The PAT is remembered for the owner, so it isn't refused again
+	_, err = client.GetRepositoryTree(ctx, "personal", "other", "main")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"org app-token", "personal app-token", "personal pat-token", "personal pat-token"}, server.requests)
+}
+
+func TestAuthFallbackExhausted(t *testing.T) {
+	server := newAuthServer(t, http.StatusCreated, map[string]string{})
+	client, err := newAuthTestClient(t, server, nil)
+	require.NoError(t, err)
+
+	_, err = client.GetRepositoryTree(context.Background(), "missing", "repo", "main")
+	require.Error(t, err)
+	assert.Equal(t, []string{"missing pat-token", "missing app-token"}, server.requests, "token is preferred by default")
+
+	// Refusals by every credential aren't remembered
+	assert.Equal(t, 0, client.startingCredential(server.URL+"/repos/missing/repo/git/trees/main"))
+}
+
+func TestSetupAuthSkipsFailingApp(t *testing.T) {
+	server := newAuthServer(t, http.StatusNotFound, map[string]string{"org": "pat-token"})
+
+	client, err := newAuthTestClient(t, server, []string{config.AuthMethodApp, config.AuthMethodToken})
+	require.NoError(t, err)
+	require.Len(t, client.credentials, 1)
+	assert.Equal(t, config.AuthMethodToken, client.credentials[0].method)
+
+	tree, err := client.GetRepositoryTree(context.Background(), "org", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "org-tree", tree.SHA)
+
+	// With the App as the only method, its failure is fatal
+	_, err = newAuthTestClient(t, server, []string{config.AuthMethodApp})
+	assert.ErrorContains(t, err, "failed to generate installation token")
+}
+
+func TestInstallationTokenRefresh(t *testing.T) {
+	// The first token is close to expiry, the first refresh fails and the
+	// second succeeds
+	issued := []struct {
+		status    int
+		token     string
+		expiresIn time.Duration
+	}{
+		{status: http.StatusCreated, token: "app-1", expiresIn: time.Minute},
+		{status: http.StatusInternalServerError},
+		{status: http.StatusCreated, token: "app-2", expiresIn: time.Hour},
+	}
+	var (
+		mu     sync.Mutex
+		used   []string
+		issues int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/app/installations/789012/access_tokens" {
+			next := issued[issues]
+			issues++
+			w.WriteHeader(next.status)
+			_ = json.NewEncoder(w).Encode(map[string]any{"token": next.token, "expires_at": time.Now().Add(next.expiresIn)})
+			return
+		}
+		used = append(used, r.Header.Get("Authorization"))
+		_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{SHA: "tree"})
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubAppID:           "123456",
+		GitHubAppKey:          generatePrivateKey(t),
+		GitHubInstallID:       "789012",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        5000,
+		RetryMaxAttempts:      1,
+		RetryBackoffBaseMS:    1,
+	}
+	m := metrics.NewForTesting()
+	client, err := NewClient(cfg, m)
+	require.NoError(t, err)
+	assert.InDelta(t, 60, testutil.ToFloat64(m.GitHubTokenExpirySeconds), 5)
+
+	ctx := context.Background()
+
+	// The failed refresh keeps the old token and isn't retried straight away
+	for range 2 {
+		_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubTokenRefreshTotal.WithLabelValues("failure")))
+
+	client.credentials[0].retryAt = time.Time{}
+	_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"token app-1", "token app-1", "token app-2"}, used)
+	assert.Equal(t, 3, issues)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubTokenRefreshTotal.WithLabelValues("success")))
+	assert.InDelta(t, 3600, testutil.ToFloat64(m.GitHubTokenExpirySeconds), 5)
+}
+
+func TestRefusedCredential(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		want    bool
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, want: true},
+		{name: "not found", status: http.StatusNotFound, want: true},
+		{name: "forbidden", status: http.StatusForbidden, want: true},
+		{name: "primary rate limit", status: http.StatusForbidden, headers: map[string]string{"X-RateLimit-Remaining": "0"}},
+		{name: "secondary rate limit", status: http.StatusForbidden, headers: map[string]string{"Retry-After": "60"}},
+		{name: "server error", status: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for key, value := range tt.headers {
+				resp.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.want, refusedCredential(resp))
+		})
+	}
+}
+
+func TestOwnerFromURL(t *testing.T) {
+	assert.Equal(t, "owner", ownerFromURL("https://api.github.com/repos/Owner/repo/git/trees/main"))
+	assert.Equal(t, "", ownerFromURL("https://api.github.com/rate_limit"))
+	assert.Equal(t, "", ownerFromURL("https://api.github.com/graphql"))
+}
+
+func TestDegradedStartup(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		installStatus = http.StatusNotFound
+		trees         int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/app/installations/789012/access_tokens":
+			w.WriteHeader(installStatus)
+			_, _ = w.Write([]byte(`{"token": "app-token"}`))
+		case "/rate_limit":
+			_, _ = w.Write([]byte(`{"resources": {"core": {"limit": 5000, "remaining": 5000}}}`))
+		default:
+			trees++
+			_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{SHA: "tree"})
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubAppID:           "123456",
+		GitHubAppKey:          generatePrivateKey(t),
+		GitHubInstallID:       "789012",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        5000,
+		RetryMaxAttempts:      1,
+		RetryBackoffBaseMS:    1,
+		ProbeHTTPProtocol:     true,
+		WarmRateLimiter:       true,
+	}
+	_, err := NewClient(cfg, metrics.NewForTesting())
+	require.ErrorContains(t, err, "failed to setup authentication")
+
+	cfg.AllowDegradedStartup = true
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	assert.ErrorIs(t, client.AuthError(), ErrAuthNotConfigured)
+
+	ctx := context.Background()
+	_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+	assert.ErrorIs(t, err, ErrAuthNotConfigured)
+	assert.ErrorIs(t, client.GetTarball(ctx, "owner", "repo", "main", nil), ErrAuthNotConfigured)
+	assert.Zero(t, trees, "nothing is requested without a credential")
+
+	health := client.CheckHealth(ctx)
+	assert.False(t, health.Healthy)
+	assert.Contains(t, health.Error, ErrAuthNotConfigured.Error())
+
+	// Once the App can be authenticated, the next health check recovers
+	mu.Lock()
+	installStatus = http.StatusCreated
+	mu.Unlock()
+	client.lastHealth = nil
+
+	health = client.CheckHealth(ctx)
+	assert.True(t, health.Healthy, health.Error)
+	assert.NoError(t, client.AuthError())
+
+	tree, err := client.GetRepositoryTree(ctx, "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "tree", tree.SHA)
+}
@@ -0,0 +1,76 @@
+package github
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// bodyBufferClasses are the capacities of pooled body buffers. Bodies larger
+// than the biggest class read into a fresh buffer that isn't kept.
+var bodyBufferClasses = []int{4 << 10, 64 << 10, 1 << 20}
+
+// bodyBuffers pools buffers for reading response bodies, one pool per size class
+var bodyBuffers = newBufferPool(bodyBufferClasses)
+
+// bufferPool hands out reusable buffers sized for the body being read, so that
+// reading tens of thousands of files doesn't allocate and grow a buffer each time
+type bufferPool struct {
+	classes []int
+	pools   []sync.Pool
+}
+
+// newBufferPool creates a pool with the given ascending size classes
+func newBufferPool(classes []int) *bufferPool {
+	p := &bufferPool{classes: classes, pools: make([]sync.Pool, len(classes))}
+	for i, size := range classes {
+		p.pools[i].New = func() any {
+			return bytes.NewBuffer(make([]byte, 0, size))
+		}
+	}
+	return p
+}
+
+// get returns an empty buffer from the smallest class that fits sizeHint;
+// a negative hint means the size is unknown
+func (p *bufferPool) get(sizeHint int) *bytes.Buffer {
+	for i, size := range p.classes {
+		if sizeHint <= size {
+			return p.pools[i].Get().(*bytes.Buffer)
+		}
+	}
+	return bytes.NewBuffer(make([]byte, 0, sizeHint))
+}
+
+// put returns a buffer to the largest class its capacity covers. Buffers that
+// grew well past the biggest class are dropped rather than pinned in memory.
+func (p *bufferPool) put(buf *bytes.Buffer) {
+	capacity := buf.Cap()
+	if capacity > 2*p.classes[len(p.classes)-1] {
+		return
+	}
+
+	for i := len(p.classes) - 1; i >= 0; i-- {
+		if capacity >= p.classes[i] {
+			buf.Reset()
+			p.pools[i].Put(buf)
+			return
+		}
+	}
+}
+
+// readBody reads r into a pooled buffer and returns an exactly sized copy, so
+// the buffer can be reused as soon as the content is handed to the caller.
+// sizeHint is the expected length, or -1 if unknown.
+func readBody(r io.Reader, sizeHint int) ([]byte, error) {
+	buf := bodyBuffers.get(sizeHint)
+	defer bodyBuffers.put(buf)
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, buf.Len())
+	copy(content, buf.Bytes())
+	return content, nil
+}
@@ -0,0 +1,91 @@
+package github
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPoolSizeClasses(t *testing.T) {
+	p := newBufferPool([]int{16, 256})
+
+	tests := []struct {
+		name        string
+		sizeHint    int
+		minCapacity int
+	}{
+		{name: "unknown size", sizeHint: -1, minCapacity: 16},
+		{name: "small", sizeHint: 10, minCapacity: 16},
+		{name: "medium", sizeHint: 100, minCapacity: 256},
+		{name: "larger than every class", sizeHint: 1000, minCapacity: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := p.get(tt.sizeHint)
+			assert.Equal(t, 0, buf.Len())
+			assert.GreaterOrEqual(t, buf.Cap(), tt.minCapacity)
+			p.put(buf)
+		})
+	}
+}
+
+func TestBufferPoolReturnsResetBuffers(t *testing.T) {
+	p := newBufferPool([]int{16})
+
+	buf := p.get(8)
+	buf.WriteString("leftover")
+	p.put(buf)
+
+	assert.Equal(t, 0, p.get(8).Len())
+}
+
+func TestReadBody(t *testing.T) {
+	data := bytes.Repeat([]byte("package main\n"), 1000)
+
+	for _, sizeHint := range []int{-1, len(data)} {
+		content, err := readBody(bytes.NewReader(data), sizeHint)
+		require.NoError(t, err)
+		assert.Equal(t, data, content)
+		assert.Equal(t, len(data), cap(content)) // exactly sized, not the pooled buffer
+	}
+
+	// The returned content doesn't alias a buffer that a later read reuses
+	first, err := readBody(bytes.NewReader([]byte("first")), -1)
+	require.NoError(t, err)
+	_, err = readBody(bytes.NewReader([]byte("second")), -1)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(first))
+}
+
+func TestReadBodyAllocatesLessThanReadAll(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 100<<10)
+
+	readAll := testing.AllocsPerRun(100, func() {
+		_, _ = io.ReadAll(bytes.NewReader(data))
+	})
+	pooled := testing.AllocsPerRun(100, func() {
+		_, _ = readBody(bytes.NewReader(data), len(data))
+	})
+
+	assert.Less(t, pooled, readAll)
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 100<<10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = io.ReadAll(bytes.NewReader(data))
+	}
+}
+
+func BenchmarkReadBody(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 100<<10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = readBody(bytes.NewReader(data), len(data))
+	}
+}
@@ -1,15 +1,19 @@
 package github
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -18,6 +22,7 @@ import (
 	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
 	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
 	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/redact"
 )
 
 // Client represents a GitHub API client
@@ -27,85 +32,336 @@ type Client struct {
 	rateLimiter *rate.Limiter
 	metrics     *metrics.Metrics
 	config      *config.Config
-	token       string
+	rawBaseURL  string
+	treeCache   *treeCache // nil when tree ETag caching is disabled
+
+	// credentials are the set-up authentication methods in preference order;
+	// ownerCredentials remembers which one last served each owner
+	credentials      []credential
+	authMu           sync.Mutex
+	ownerCredentials map[string]int
+
+	// authErr is why no credential could be set up when the client started
+	// degraded, see AllowDegradedStartup; nil once authenticated
+	authErr error
+
+	// archiveClient downloads tarballs; it has no overall timeout since a large
+	// archive can take longer than FetchTimeoutMS, and is bounded by the crawl context
+	archiveClient *http.Client
+
+	// rawLimiter paces raw content requests when RawRateLimitThreshold is set,
+	// nil when they share rateLimiter. rawSlots and apiSlots cap in-flight
+	// requests on each path, nil when unbounded.
+	rawLimiter *rate.Limiter
+	rawSlots   chan struct{}
+	apiSlots   chan struct{}
+
+	// adaptive paces the limiter from response headers, nil unless AdaptiveRateLimit
+	adaptive *adaptiveRate
+
+	// pausedUntil is when requests held back by RateLimitReserve may resume;
+	// exhaustedUntil is when a used-up quota resets, zero while it isn't
+	reserveMu      sync.Mutex
+	pausedUntil    time.Time
+	exhaustedUntil time.Time
+
+	// Cached deep health result, see CheckHealth
+	healthMu   sync.Mutex
+	lastHealth *model.GitHubHealth
 }
 
 // NewClient creates a new GitHub API client
 func NewClient(cfg *config.Config, m *metrics.Metrics) (*Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure transport: %w", err)
+	}
+
 	client := &Client{
-		baseURL:     cfg.GitHubBaseURL,
-		httpClient:  &http.Client{Timeout: cfg.GetFetchTimeout()},
-		rateLimiter: rate.NewLimiter(rate.Limit(cfg.APIRateLimitThreshold), cfg.APIRateLimitThreshold),
-		metrics:     m,
-		config:      cfg,
+		baseURL:       cfg.GitHubBaseURL,
+		httpClient:    &http.Client{Timeout: cfg.GetFetchTimeout(), Transport: transport},
+		archiveClient: &http.Client{Transport: transport},
+		rateLimiter:   rate.NewLimiter(rate.Limit(cfg.APIRateLimitThreshold), cfg.APIRateLimitThreshold),
+		metrics:       m,
+		config:        cfg,
+		rawBaseURL:    "https://raw.githubusercontent.com",
+	}
+
+	client.httpClient.CheckRedirect = client.checkRedirect
+
+	redact.SetExtraPatterns(cfg.RedactRegexps)
+
+	if cfg.TreeCacheSize > 0 {
+		client.treeCache = newTreeCache(cfg.TreeCacheSize)
+	}
+
+	if cfg.RawRateLimitThreshold > 0 {
+		client.rawLimiter = rate.NewLimiter(rate.Limit(cfg.RawRateLimitThreshold), cfg.RawRateLimitThreshold)
+	}
+	if cfg.RawMaxConcurrency > 0 {
+		client.rawSlots = make(chan struct{}, cfg.RawMaxConcurrency)
+	}
+	if cfg.APIMaxConcurrency > 0 {
+		client.apiSlots = make(chan struct{}, cfg.APIMaxConcurrency)
+	}
+
+	if cfg.AdaptiveRateLimit {
+		client.adaptive = &adaptiveRate{
+			smoothing: cfg.AdaptiveRateSmoothing,
+			floor:     cfg.AdaptiveRateMin,
+			ceiling:   cfg.GetAdaptiveRateMax(),
+		}
 	}
 
 	// Set up authentication
 	if err := client.setupAuth(); err != nil {
-		return nil, fmt.Errorf("failed to setup authentication: %w", err)
+		if !cfg.AllowDegradedStartup {
+			return nil, fmt.Errorf("failed to setup authentication: %w", err)
+		}
+		log.Printf("Starting without GitHub authentication, crawls are refused until it succeeds: %v", err)
+		client.authErr = fmt.Errorf("%w: %w", ErrAuthNotConfigured, err)
+		return client, nil
+	}
+
+	if cfg.ProbeHTTPProtocol {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.GetFetchTimeout())
+		if _, err := client.ProbeProtocol(ctx); err != nil {
+			log.Printf("GitHub protocol probe failed: %v", err)
+		}
+		cancel()
+	}
+
+	// Best-effort; without it the limiter starts from the configured rate
+	if cfg.WarmRateLimiter {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.GetFetchTimeout())
+		if err := client.warmRateLimiter(ctx); err != nil {
+			log.Printf("Rate limiter warm-up failed, starting from the configured rate: %v", err)
+		}
+		cancel()
+	}
+
+	// Best-effort; a cold pool only slows the first crawl's requests
+	if cfg.WarmConnections > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.GetFetchTimeout())
+		if err := client.warmConnections(ctx, cfg.WarmConnections); err != nil {
+			log.Printf("Connection warm-up failed: %v", err)
+		}
+		cancel()
 	}
 
 	return client, nil
 }
 
-// setupAuth configures authentication for the GitHub client
+// GetRateLimit fetches the current core API quota. Requests to rate_limit
+// don't count against the quota themselves.
+func (c *Client) GetRateLimit(ctx context.Context) (*model.RateLimitInfo, error) {
+	url := fmt.Sprintf("%s/rate_limit", c.baseURL)
+
+	var rateResp model.GitHubRateLimitResponse
+	err := c.makeRequestWithRetry(ctx, "get_rate_limit", "GET", url, nil, func(resp *http.Response) error {
+		c.metrics.RecordGitHubAPICall("get_rate_limit", strconv.Itoa(resp.StatusCode))
+
+		if resp.StatusCode != http.StatusOK {
+			return newAPIError(resp)
+		}
+
+		return json.NewDecoder(resp.Body).Decode(&rateResp)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rate limit: %w", err)
+	}
+
+	core := rateResp.Resources.Core
+	return &model.RateLimitInfo{
+		Limit:     core.Limit,
+		Remaining: core.Remaining,
+		Reset:     time.Unix(core.Reset, 0),
+	}, nil
+}
+
+// CheckHealth confirms GitHub is reachable and the token is accepted by calling
+// rate_limit. Results are cached for HealthCheckCacheTTL, and concurrent checks
+// share a single request, so frequent health probes don't add load. While the
+// quota is exhausted the result is unhealthy until the reset, cached or not.
+func (c *Client) CheckHealth(ctx context.Context) model.GitHubHealth {
+	health := c.cachedHealth(ctx)
+	if until, ok := c.QuotaExhausted(); ok {
+		health.Healthy = false
+		health.Error = fmt.Sprintf("GitHub quota exhausted until %s", until.Format(time.RFC3339))
+		health.QuotaExhaustedUntil = &until
+	}
+	return health
+}
+
+// cachedHealth returns the last health check result if it's recent enough,
+// or checks again
+func (c *Client) cachedHealth(ctx context.Context) model.GitHubHealth {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+
+	if c.lastHealth != nil && time.Since(c.lastHealth.CheckedAt) < c.config.GetHealthCheckCacheTTL() {
+		return *c.lastHealth
+	}
+
+	health := model.GitHubHealth{CheckedAt: time.Now()}
+	if err := c.retryAuth(); err != nil {
+		health.Error = err.Error()
+	} else if info, err := c.GetRateLimit(ctx); err != nil {
+		health.Error = err.Error()
+	} else {
+		health.Healthy = true
+		health.RateLimit = info
+	}
+
+	c.lastHealth = &health
+	return health
+}
+
+// ThrottleUntil slows the rate limiter so that budget requests are spread
+// evenly until reset, then restores the configured rate. With the adaptive
+// limiter, which sets the rate on every response, the throttled rate caps its
+// ceiling until reset instead, and the next response after that restores it.
+func (c *Client) ThrottleUntil(reset time.Time, budget int) {
+	window := time.Until(reset)
+	if window <= 0 || budget <= 0 {
+		return
+	}
+
+	throttled := rate.Limit(float64(budget) / window.Seconds())
+	if c.adaptive != nil {
+		c.adaptive.throttle(float64(throttled), reset)
+		if throttled < c.rateLimiter.Limit() {
+			log.Printf("Throttling GitHub requests to %.2f/s until %s", float64(throttled), reset.Format(time.RFC3339))
+			c.rateLimiter.SetLimit(throttled)
+		}
+		return
+	}
+
+	if throttled >= c.rateLimiter.Limit() {
+		return
+	}
+
+	log.Printf("Throttling GitHub requests to %.2f/s until %s", float64(throttled), reset.Format(time.RFC3339))
+	c.rateLimiter.SetLimit(throttled)
+	time.AfterFunc(window, func() {
+		c.rateLimiter.SetLimit(rate.Limit(c.config.APIRateLimitThreshold))
+	})
+}
+
+// ProbeProtocol issues a cheap request to the GitHub API and reports the
+// negotiated HTTP protocol (e.g. "HTTP/2.0")
+func (c *Client) ProbeProtocol(ctx context.Context) (string, error) {
+	if err := c.AuthError(); err != nil {
+		return "", err
+	}
+
+	// rate_limit requests don't count against the quota
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/rate_limit", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("probe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	c.metrics.SetGitHubHTTPProtocol(resp.Proto)
+	if resp.ProtoMajor < 2 {
+		log.Printf("GitHub API negotiated %s; connections are not multiplexed", resp.Proto)
+	} else {
+		log.Printf("GitHub API negotiated %s", resp.Proto)
+	}
+
+	return resp.Proto, nil
+}
+
+// setupAuth sets up every configured authentication method in
+// GITHUB_AUTH_ORDER. A method that fails to set up is skipped when another
+// one works.
 func (c *Client) setupAuth() error {
-	if c.config.GitHubToken != "" {
-		// Use Personal Access Token
-		c.token = c.config.GitHubToken
-		return nil
+	var errs []error
+	for _, method := range c.authOrder() {
+		switch method {
+		case config.AuthMethodToken:
+			if c.config.GitHubToken != "" {
+				c.credentials = append(c.credentials, credential{method: method, token: c.config.GitHubToken})
+			}
+		case config.AuthMethodApp:
+			if !c.config.HasGitHubApp() {
+				continue
+			}
+			token, expiresAt, err := c.generateInstallationToken()
+			if err != nil {
+				log.Printf("GitHub App authentication unavailable: %v", err)
+				errs = append(errs, fmt.Errorf("failed to generate installation token: %w", err))
+				continue
+			}
+			c.credentials = append(c.credentials, credential{method: method, token: token, expiresAt: expiresAt})
+			if !expiresAt.IsZero() {
+				c.metrics.SetTokenExpiry(time.Until(expiresAt).Seconds())
+			}
+		}
 	}
 
-	if c.config.HasGitHubApp() {
-		// Use GitHub App authentication
-		token, err := c.generateInstallationToken()
-		if err != nil {
-			return fmt.Errorf("failed to generate installation token: %w", err)
+	if len(c.credentials) == 0 {
+		if len(errs) > 0 {
+			return errors.Join(errs...)
 		}
-		c.token = token
-		return nil
+		return fmt.Errorf("no authentication method configured")
 	}
 
-	return fmt.Errorf("no authentication method configured")
+	methods := make([]string, len(c.credentials))
+	for i, cred := range c.credentials {
+		methods[i] = cred.method
+	}
+	log.Printf("Authenticating to GitHub with %s", strings.Join(methods, ", falling back to "))
+	return nil
 }
 
-// generateInstallationToken generates a GitHub App installation token
-func (c *Client) generateInstallationToken() (string, error) {
+// generateInstallationToken generates a GitHub App installation token and
+// returns it with its expiry, zero if GitHub didn't report one
+func (c *Client) generateInstallationToken() (string, time.Time, error) {
 	// Generate JWT for GitHub App
 	jwtToken, err := c.generateAppJWT()
 	if err != nil {
-		return "", fmt.Errorf("failed to generate app JWT: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to generate app JWT: %w", err)
 	}
 
 	// Get installation token
 	url := fmt.Sprintf("%s/app/installations/%s/access_tokens", c.baseURL, c.config.GitHubInstallID)
 	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	c.setAPIHeaders(req)
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to get installation token: %s", string(body))
+		return "", time.Time{}, fmt.Errorf("failed to get installation token: %s", redact.String(string(body)))
 	}
 
 	var tokenResp struct {
-		Token string `json:"token"`
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", fmt.Errorf("failed to decode token response: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to decode token response: %w", err)
 	}
 
-	return tokenResp.Token, nil
+	return tokenResp.Token, tokenResp.ExpiresAt, nil
 }
 
 // generateAppJWT generates a JWT for GitHub App authentication
@@ -128,88 +384,296 @@ func (c *Client) generateAppJWT() (string, error) {
 	return token.SignedString(key)
 }
 
-// GetRepositoryTree fetches the Git tree for a repository
+// GetRepositoryTree fetches the Git tree for a repository. A recursive listing
+// GitHub rejects as too large falls back to walking it a directory at a time.
 func (c *Client) GetRepositoryTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error) {
 	// Wait for rate limit
-	if err := c.rateLimiter.Wait(ctx); err != nil {
+	if err := c.waitForRateLimit(ctx, c.config.TreeRequestCost); err != nil {
 		return nil, fmt.Errorf("rate limit wait failed: %w", err)
 	}
 
 	url := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", c.baseURL, owner, repo, ref)
 
+	// Revalidate a previously seen tree; a 304 doesn't count against the quota
+	cacheKey := owner + "/" + repo + "/" + ref
+	var (
+		cached    cachedTree
+		hasCached bool
+		headers   map[string]string
+	)
+	if c.treeCache != nil {
+		if cached, hasCached = c.treeCache.get(cacheKey); hasCached {
+			headers = map[string]string{"If-None-Match": cached.etag}
+		}
+	}
+
 	var treeResp *model.GitHubTreeResponse
-	err := c.makeRequestWithRetry(ctx, "GET", url, nil, func(resp *http.Response) error {
+	err := c.makeRequestWithHeaders(ctx, "get_tree", "GET", url, nil, headers, func(resp *http.Response) error {
 		c.metrics.RecordGitHubAPICall("get_tree", strconv.Itoa(resp.StatusCode))
 
+		if resp.StatusCode == http.StatusNotModified && hasCached {
+			c.metrics.RecordNotModified("get_tree")
+			treeResp = cached.tree
+			return nil
+		}
+
 		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+			return newAPIError(resp)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&treeResp); err != nil {
+			return err
 		}
 
-		return json.NewDecoder(resp.Body).Decode(&treeResp)
+		if etag := resp.Header.Get("ETag"); etag != "" && c.treeCache != nil {
+			c.treeCache.put(cacheKey, etag, treeResp)
+		}
+		return nil
 	})
 
+	if err != nil && treeTooLarge(err) {
+		log.Printf("Recursive tree of %s/%s at %s failed, listing it a directory at a time: %v", owner, repo, ref, err)
+		walked, walkErr := c.walkRepositoryTree(ctx, owner, repo, ref)
+		if walkErr == nil {
+			return walked, nil
+		}
+		log.Printf("Listing the tree of %s/%s at %s a directory at a time failed: %v", owner, repo, ref, walkErr)
+	}
+
 	if err != nil {
 		c.metrics.RecordError("api_error", owner, repo)
+
+		// A valid token that gets a 404 may just lack access to a private repo
+		if errors.Is(err, ErrNotFound) {
+			if _, authErr := c.GetRateLimit(ctx); authErr == nil {
+				return nil, &RepoAccessError{Owner: owner, Repo: repo, Ref: ref, Err: err}
+			}
+		}
+
 		return nil, fmt.Errorf("failed to get repository tree: %w", err)
 	}
 
 	return treeResp, nil
 }
 
-// GetFileContent fetches the content of a specific file
+// GetPullRequest fetches a pull request
+func (c *Client) GetPullRequest(ctx context.Context, owner, repo string, number int) (*model.GitHubPullRequestResponse, error) {
+	if err := c.waitForRateLimit(ctx, c.config.ContentRequestCost); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", c.baseURL, owner, repo, number)
+
+	var prResp *model.GitHubPullRequestResponse
+	err := c.makeRequestWithRetry(ctx, "get_pull_request", "GET", url, nil, func(resp *http.Response) error {
+		c.metrics.RecordGitHubAPICall("get_pull_request", strconv.Itoa(resp.StatusCode))
+
+		if resp.StatusCode != http.StatusOK {
+			return newAPIError(resp)
+		}
+
+		return json.NewDecoder(resp.Body).Decode(&prResp)
+	})
+
+	if err != nil {
+		c.metrics.RecordError("api_error", owner, repo)
+		return nil, fmt.Errorf("failed to get pull request %d: %w", number, err)
+	}
+
+	return prResp, nil
+}
+
+// ListPullRequestFiles lists the files changed in a pull request, following pagination.
+// GitHub returns at most 3000 files for a pull request.
+func (c *Client) ListPullRequestFiles(ctx context.Context, owner, repo string, number int) ([]model.GitHubPullRequestFile, error) {
+	const perPage = 100
+
+	var files []model.GitHubPullRequestFile
+	for page := 1; ; page++ {
+		if err := c.waitForRateLimit(ctx, c.config.ContentRequestCost); err != nil {
+			return nil, fmt.Errorf("rate limit wait failed: %w", err)
+		}
+
+		url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/files?per_page=%d&page=%d", c.baseURL, owner, repo, number, perPage, page)
+
+		var pageFiles []model.GitHubPullRequestFile
+		err := c.makeRequestWithRetry(ctx, "list_pull_request_files", "GET", url, nil, func(resp *http.Response) error {
+			c.metrics.RecordGitHubAPICall("list_pull_request_files", strconv.Itoa(resp.StatusCode))
+
+			if resp.StatusCode != http.StatusOK {
+				return newAPIError(resp)
+			}
+
+			return json.NewDecoder(resp.Body).Decode(&pageFiles)
+		})
+
+		if err != nil {
+			c.metrics.RecordError("api_error", owner, repo)
+			return nil, fmt.Errorf("failed to list files for pull request %d: %w", number, err)
+		}
+
+		files = append(files, pageFiles...)
+		if len(pageFiles) < perPage {
+			return files, nil
+		}
+	}
+}
+
+// GetFileContent fetches the content of a specific file. At most MaxFileSize
+// bytes are read; a longer file returns an error wrapping ErrFileTooLarge.
 func (c *Client) GetFileContent(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	content, truncated, err := c.getFileContent(ctx, owner, repo, path, ref, c.config.MaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrFileTooLarge, path, c.config.MaxFileSize)
+	}
+	return content, nil
+}
+
+// GetFileContentPrefix fetches at most limit bytes of a file and reports
+// whether the file was longer and had to be cut
+func (c *Client) GetFileContentPrefix(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, error) {
+	return c.getFileContent(ctx, owner, repo, path, ref, limit)
+}
+
+// getFileContent fetches a file, reading no more than limit bytes when limit
+// is positive. The raw CDN is asked for just that range; the read is capped
+// too, so a server that ignores the range or a file larger than its tree size
+// can't exceed the limit.
+func (c *Client) getFileContent(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, error) {
+	// The mirror doesn't spend GitHub quota, so it goes first and skips the limiter
+	if c.config.RawMirrorBaseURL != "" {
+		if content, truncated, ok := c.getFileFromMirror(ctx, owner, repo, path, ref, limit); ok {
+			return content, truncated, nil
+		}
+	}
+
 	// Wait for rate limit
-	if err := c.rateLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	if err := c.waitForRawRateLimit(ctx); err != nil {
+		return nil, false, fmt.Errorf("rate limit wait failed: %w", err)
 	}
 
 	// Try raw content first (more efficient)
-	rawURL := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s", owner, repo, ref, path)
+	rawURL := fmt.Sprintf("%s/%s/%s/%s/%s", c.rawBaseURL, owner, repo, ref, path)
+
+	// One byte past the limit tells a cut file from one that fits exactly. A
+	// range would count compressed bytes, so gzip relies on capping the read.
+	var headers map[string]string
+	if c.wantsGzip(ctx) {
+		headers = map[string]string{"Accept-Encoding": "gzip"}
+	} else if limit > 0 {
+		headers = map[string]string{"Range": fmt.Sprintf("bytes=0-%d", limit)}
+	}
 
-	var content []byte
-	err := c.makeRequestWithRetry(ctx, "GET", rawURL, nil, func(resp *http.Response) error {
+	var (
+		content  []byte
+		requests int
+	)
+	err := c.makeRequestWithHeaders(ctx, "get_raw_content", "GET", rawURL, nil, headers, func(resp *http.Response) error {
+		requests++
 		c.metrics.RecordGitHubAPICall("get_raw_content", strconv.Itoa(resp.StatusCode))
 
-		if resp.StatusCode == http.StatusOK {
-			var err error
-			content, err = io.ReadAll(resp.Body)
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusPartialContent:
+			body, wire, err := decodeBody(resp)
+			if err != nil {
+				return err
+			}
+
+			// The content length is of the compressed body when gzipped
+			sizeHint := int(resp.ContentLength)
+			if resp.Header.Get("Content-Encoding") == "gzip" {
+				sizeHint = -1
+			}
+			if limit > 0 {
+				body = io.LimitReader(body, limit+1)
+				if sizeHint < 0 || int64(sizeHint) > limit+1 {
+					sizeHint = int(limit + 1)
+				}
+			}
+
+			content, err = readBody(body, sizeHint)
+			c.metrics.RecordContentBytes(wire.n, len(content))
 			return err
+		case http.StatusRequestedRangeNotSatisfiable:
+			// Only an empty file has no byte 0
+			content = []byte{}
+			return nil
 		}
 
 		// If raw content fails, try API endpoint
-		return c.getFileContentViaAPI(ctx, owner, repo, path, ref, &content)
+		return c.getFileContentViaAPI(ctx, owner, repo, path, ref, limit, &content, &requests)
 	})
 
 	if err != nil {
+		c.metrics.RecordContentFetch("per_file", requests, 0)
 		c.metrics.RecordError("api_error", owner, repo)
-		return nil, fmt.Errorf("failed to get file content for %s: %w", path, err)
+		return nil, false, fmt.Errorf("failed to get file content for %s: %w", path, err)
 	}
 
-	return content, nil
+	c.metrics.RecordContentFetch("per_file", requests, 1)
+
+	// The contents API fallback always returns the whole file
+	if limit > 0 && int64(len(content)) > limit {
+		c.metrics.RecordContentRead("truncated")
+		return content[:limit], true, nil
+	}
+	c.metrics.RecordContentRead("full")
+	return content, false, nil
 }
 
-// getFileContentViaAPI fetches file content via the GitHub API
-func (c *Client) getFileContentViaAPI(ctx context.Context, owner, repo, path, ref string, content *[]byte) error {
+// getFileContentViaAPI fetches file content via the GitHub API. The API
+// always returns the whole file, so its response is capped at what a file at
+// the path's size limit encodes to, or at limit when that's larger, and a
+// longer response fails with ErrFileTooLarge rather than being read into
+// memory. A read limit below the size limit, such as a truncation prefix, is
+// left to the caller to cut the decoded content to.
+func (c *Client) getFileContentViaAPI(ctx context.Context, owner, repo, path, ref string, limit int64, content *[]byte, requests *int) error {
+	// The contents API is a separate request against the budget
+	if err := c.waitForRateLimit(ctx, c.config.ContentRequestCost); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
 	url := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", c.baseURL, owner, repo, path, ref)
 
-	return c.makeRequestWithRetry(ctx, "GET", url, nil, func(resp *http.Response) error {
+	return c.makeRequestWithRetry(ctx, "get_content", "GET", url, nil, func(resp *http.Response) error {
+		*requests++
 		c.metrics.RecordGitHubAPICall("get_content", strconv.Itoa(resp.StatusCode))
 
 		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+			return newAPIError(resp)
+		}
+
+		// The tree's size can't be trusted to bound the response, so cap the
+		// read at what a file of the size limit takes to encode
+		sizeLimit := c.config.MaxFileSizeFor(path)
+		if sizeLimit > 0 && limit > sizeLimit {
+			sizeLimit = limit
+		}
+		body := io.Reader(resp.Body)
+		responseLimit := contentsAPIResponseLimit(sizeLimit)
+		if responseLimit > 0 {
+			body = io.LimitReader(resp.Body, responseLimit+1)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return fmt.Errorf("failed to read content response: %w", err)
+		}
+		if responseLimit > 0 && int64(len(data)) > responseLimit {
+			return fmt.Errorf("%w: contents API response for %s exceeds limit of %d bytes", ErrFileTooLarge, path, responseLimit)
 		}
 
 		var contentResp model.GitHubContentResponse
-		if err := json.NewDecoder(resp.Body).Decode(&contentResp); err != nil {
+		if err := json.Unmarshal(data, &contentResp); err != nil {
 			return fmt.Errorf("failed to decode content response: %w", err)
 		}
 
 		if contentResp.Encoding == "base64" {
 			decoded, err := base64.StdEncoding.DecodeString(contentResp.Content)
 			if err != nil {
-				return fmt.Errorf("failed to decode base64 content: %w", err)
+				return fmt.Errorf("%w: failed to decode base64 content: %w", ErrCorruptResponse, err)
 			}
 			*content = decoded
 		} else {
@@ -220,46 +684,388 @@ func (c *Client) getFileContentViaAPI(ctx context.Context, owner, repo, path, re
 	})
 }
 
-// makeRequestWithRetry makes an HTTP request with retry logic
-func (c *Client) makeRequestWithRetry(ctx context.Context, method, url string, body io.Reader, handler func(*http.Response) error) error {
-	var lastErr error
-	backoff := c.config.GetRetryBackoffBase()
+// contentsAPIOverhead allows for the metadata around a file's content in a
+// contents API response: its name, path, SHA and links
+const contentsAPIOverhead = 16 * 1024
+
+// contentsAPIResponseLimit returns the largest contents API response a file of
+// size bytes can produce: its base64 encoding, which GitHub wraps every 60
+// characters, plus the metadata. 0 leaves responses uncapped.
+func contentsAPIResponseLimit(size int64) int64 {
+	if size <= 0 {
+		return 0
+	}
+	encoded := int64(base64.StdEncoding.EncodedLen(int(size)))
+	return encoded + encoded/60 + contentsAPIOverhead
+}
+
+// GetFileContentsGraphQL fetches the text of several files in a single GraphQL query.
+// Files GitHub reports as binary, truncated or missing are left out of the result
+// so the caller can fall back to the REST content path for them.
+func (c *Client) GetFileContentsGraphQL(ctx context.Context, owner, repo, ref string, paths []string) (map[string][]byte, error) {
+	if len(paths) == 0 {
+		return map[string][]byte{}, nil
+	}
+
+	// A batched query is charged like a tree fetch
+	if err := c.waitForRateLimit(ctx, c.config.TreeRequestCost); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	// Expressions are passed as variables so paths never need escaping
+	var params, fields strings.Builder
+	variables := map[string]any{"owner": owner, "name": repo}
+	params.WriteString("$owner: String!, $name: String!")
+	for i, path := range paths {
+		fmt.Fprintf(&params, ", $e%d: String!", i)
+		fmt.Fprintf(&fields, " f%d: object(expression: $e%d) { ... on Blob { text isBinary isTruncated byteSize } }", i, i)
+		variables[fmt.Sprintf("e%d", i)] = ref + ":" + path
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"query":     fmt.Sprintf("query(%s) { repository(owner: $owner, name: $name) {%s } }", params.String(), fields.String()),
+		"variables": variables,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode GraphQL query: %w", err)
+	}
+
+	var (
+		blobsResp model.GitHubGraphQLBlobsResponse
+		requests  int
+	)
+	err = c.makeRequestWithRetry(ctx, "graphql_blobs", "POST", c.graphQLURL(), payload, func(resp *http.Response) error {
+		requests++
+		c.metrics.RecordGitHubAPICall("graphql_blobs", strconv.Itoa(resp.StatusCode))
+
+		if resp.StatusCode != http.StatusOK {
+			return newAPIError(resp)
+		}
+
+		return json.NewDecoder(resp.Body).Decode(&blobsResp)
+	})
+	if err != nil {
+		c.metrics.RecordContentFetch("graphql", requests, 0)
+		c.metrics.RecordError("api_error", owner, repo)
+		return nil, fmt.Errorf("failed to get file contents via GraphQL: %w", err)
+	}
+
+	if blobsResp.Data.Repository == nil && len(blobsResp.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL error: %s", blobsResp.Errors[0].Message)
+	}
+
+	contents := make(map[string][]byte, len(paths))
+	for i, path := range paths {
+		blob := blobsResp.Data.Repository[fmt.Sprintf("f%d", i)]
+		if blob == nil || blob.Text == nil || blob.IsBinary || blob.IsTruncated {
+			continue
+		}
+		contents[path] = []byte(*blob.Text)
+	}
+
+	c.metrics.RecordContentFetch("graphql", requests, len(contents))
+	return contents, nil
+}
+
+// GetBlobs fetches several blobs by SHA through the Git Data API, keeping up to
+// BlobBatchConcurrency requests in flight on shared connections. Blobs that fail
+// to fetch are left out of the result so the caller can fall back to the per-file path.
+func (c *Client) GetBlobs(ctx context.Context, owner, repo string, shas []string) map[string][]byte {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		requests int
+		blobs    = make(map[string][]byte, len(shas))
+		sem      = make(chan struct{}, max(c.config.BlobBatchConcurrency, 1))
+	)
+
+	for _, sha := range shas {
+		wg.Add(1)
+		go func(sha string) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			content, attempts, err := c.getBlob(ctx, owner, repo, sha)
+
+			mu.Lock()
+			defer mu.Unlock()
+			requests += attempts
+			if err != nil {
+				log.Printf("Failed to fetch blob %s from %s/%s: %v", sha, owner, repo, err)
+				return
+			}
+			blobs[sha] = content
+		}(sha)
+	}
+
+	wg.Wait()
+
+	c.metrics.RecordContentFetch("blob_batch", requests, len(blobs))
+	return blobs
+}
+
+// getBlob fetches a single blob and reports how many HTTP requests it took
+func (c *Client) getBlob(ctx context.Context, owner, repo, sha string) ([]byte, int, error) {
+	if err := c.waitForRateLimit(ctx, c.config.ContentRequestCost); err != nil {
+		return nil, 0, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	url := c.BlobURL(owner, repo, sha)
+
+	var (
+		content  []byte
+		requests int
+	)
+	err := c.makeRequestWithRetry(ctx, "get_blob", "GET", url, nil, func(resp *http.Response) error {
+		requests++
+		c.metrics.RecordGitHubAPICall("get_blob", strconv.Itoa(resp.StatusCode))
+
+		if resp.StatusCode != http.StatusOK {
+			return newAPIError(resp)
+		}
+
+		var blobResp model.GitHubBlobResponse
+		if err := json.NewDecoder(resp.Body).Decode(&blobResp); err != nil {
+			return fmt.Errorf("failed to decode blob response: %w", err)
+		}
+
+		if blobResp.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(blobResp.Content)
+			if err != nil {
+				return fmt.Errorf("failed to decode base64 content: %w", err)
+			}
+			content = decoded
+		} else {
+			content = []byte(blobResp.Content)
+		}
+
+		return nil
+	})
+
+	return content, requests, err
+}
+
+// BlobURL returns the Git Data API URL for a blob, a stable reference to its content
+func (c *Client) BlobURL(owner, repo, sha string) string {
+	return fmt.Sprintf("%s/repos/%s/%s/git/blobs/%s", c.baseURL, owner, repo, sha)
+}
+
+// graphQLURL returns the GraphQL endpoint for the configured API base URL
+func (c *Client) graphQLURL() string {
+	// GitHub Enterprise serves REST under /api/v3 and GraphQL under /api/graphql
+	if base, ok := strings.CutSuffix(strings.TrimSuffix(c.baseURL, "/"), "/api/v3"); ok {
+		return base + "/api/graphql"
+	}
+	return strings.TrimSuffix(c.baseURL, "/") + "/graphql"
+}
+
+// waitForRateLimit waits out any rate limit reserve pause, then reserves cost
+// tokens from the rate limiter and blocks until they are available or the
+// context is done
+func (c *Client) waitForRateLimit(ctx context.Context, cost int) error {
+	if err := c.waitForReserve(ctx); err != nil {
+		return err
+	}
+	return waitForLimiter(ctx, c.rateLimiter, cost)
+}
+
+// waitForRawRateLimit paces a raw content request. With its own limiter it
+// takes one token and ignores the reserve pause, since raw content doesn't
+// spend REST quota; otherwise it waits like any content request.
+func (c *Client) waitForRawRateLimit(ctx context.Context) error {
+	if c.rawLimiter == nil {
+		return c.waitForRateLimit(ctx, c.config.ContentRequestCost)
+	}
+	return waitForLimiter(ctx, c.rawLimiter, 1)
+}
+
+// waitForLimiter reserves cost tokens from limiter and blocks until they are
+// available or the context is done
+func waitForLimiter(ctx context.Context, limiter *rate.Limiter, cost int) error {
+	if cost <= 0 {
+		cost = 1
+	}
+
+	reservation := limiter.ReserveN(time.Now(), cost)
+	if !reservation.OK() {
+		return fmt.Errorf("request cost %d exceeds rate limiter burst %d", cost, limiter.Burst())
+	}
+
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the tokens back so other requests aren't penalized
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// slotsFor returns the concurrency cap for a request URL: raw content
+// requests share rawSlots, everything else apiSlots
+func (c *Client) slotsFor(url string) chan struct{} {
+	if strings.HasPrefix(url, c.rawBaseURL) {
+		return c.rawSlots
+	}
+	return c.apiSlots
+}
+
+// acquireSlot blocks until slots has room or the context is done; a nil
+// slots is unbounded
+func acquireSlot(ctx context.Context, slots chan struct{}) error {
+	if slots == nil {
+		return nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseSlot frees a slot taken by acquireSlot
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// makeRequestWithRetry makes an HTTP request with retry logic; endpoint labels
+// the request's latency metric
+func (c *Client) makeRequestWithRetry(ctx context.Context, endpoint, method, url string, body []byte, handler func(*http.Response) error) error {
+	return c.makeRequestWithHeaders(ctx, endpoint, method, url, body, nil, handler)
+}
+
+// makeRequestWithHeaders makes an HTTP request with retry logic and extra request headers
+func (c *Client) makeRequestWithHeaders(ctx context.Context, endpoint, method, url string, body []byte, headers map[string]string, handler func(*http.Response) error) (err error) {
+	// A tenant's token doesn't depend on the configured credentials
+	tenantToken := tokenFromContext(ctx)
+	if tenantToken != "" {
+		defer func() { err = scrubToken(err, tenantToken) }()
+	} else if err := c.AuthError(); err != nil {
+		return err
+	}
+
+	var (
+		lastErr  error
+		cred     = c.startingCredential(url)
+		fellBack bool
+	)
 
 	for attempt := 0; attempt <= c.config.RetryMaxAttempts; attempt++ {
 		if attempt > 0 {
+			backoff := c.config.GetRetryBackoff(attempt)
+
+			// Don't start a retry that can't finish before the deadline
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+				return fmt.Errorf("retry skipped, deadline too close, last error: %w", lastErr)
+			}
+
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
 			case <-time.After(backoff):
-				backoff *= 2 // Exponential backoff
 			}
 		}
 
-		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		// Rebuild the body on every attempt since a failed attempt may have consumed it
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+
+		reqCtx, guard := c.newStallGuard(ctx)
+		req, err := http.NewRequestWithContext(reqCtx, method, url, reqBody)
 		if err != nil {
+			guard.stop()
 			return fmt.Errorf("failed to create request: %w", err)
 		}
 
 		c.setHeaders(req)
+		c.authorize(req, cred)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		// A raw request falling back to the API holds its raw slot while it
+		// takes an API one; nothing takes them the other way round
+		slots := c.slotsFor(url)
+		if err := acquireSlot(reqCtx, slots); err != nil {
+			guard.stop()
+			return err
+		}
 
+		if endpoint != "get_rate_limit" {
+			countRequest(ctx)
+		}
+		start := time.Now()
 		resp, err := c.httpClient.Do(req)
+		c.metrics.RecordGitHubRequestDuration(endpoint, time.Since(start).Seconds())
 		if err != nil {
+			releaseSlot(slots)
+			guard.stop()
+			if isHeaderTimeout(err) {
+				c.metrics.RecordStalledTransfer("headers")
+			}
+			c.captureFailure(endpoint, method, url, attempt, nil, nil, err)
 			lastErr = err
 			continue
 		}
+		guard.watch(resp)
 
-		// Update rate limit metrics
-		c.updateRateLimitMetrics(resp)
+		// Update rate limit metrics; a tenant's quota says nothing about ours
+		if tenantToken == "" {
+			c.trackQuota(resp)
+		}
 
+		sampler := c.sampleBody(resp)
 		err = handler(resp)
+		if err != nil {
+			c.captureFailure(endpoint, method, url, attempt, resp, sampler, err)
+		}
 		resp.Body.Close()
+		releaseSlot(slots)
 
 		if err == nil {
+			if fellBack {
+				log.Printf("GitHub %s credential served %s %s", c.credentials[cred].method, method, url)
+				c.rememberCredential(url, cred)
+			}
 			return nil
 		}
 
-		// Check if we should retry
-		if resp.StatusCode >= 500 || resp.StatusCode == 429 {
+		// Try the next credential straight away; a refusal isn't a failed attempt
+		if tenantToken == "" && cred+1 < len(c.credentials) && refusedCredential(resp) {
+			log.Printf("GitHub %s credential refused %s %s with %d, trying %s",
+				c.credentials[cred].method, method, url, resp.StatusCode, c.credentials[cred+1].method)
+			cred++
+			fellBack = true
+			attempt--
+			continue
+		}
+
+		// Check if we should retry; a successful status with a body that
+		// doesn't decode means the response was cut short in transit
+		if resp.StatusCode >= 500 || resp.StatusCode == 429 || isStalled(err) ||
+			(resp.StatusCode < 300 && isDecodeError(err)) {
 			lastErr = err
 			continue
 		}
@@ -268,14 +1074,42 @@ func (c *Client) makeRequestWithRetry(ctx context.Context, method, url string, b
 		return err
 	}
 
+	// A payload that never decoded is corruption, not a missing file
+	if isDecodeError(lastErr) && !errors.Is(lastErr, ErrCorruptResponse) {
+		return fmt.Errorf("max retries exceeded, last error: %w: %w", ErrCorruptResponse, lastErr)
+	}
 	return fmt.Errorf("max retries exceeded, last error: %w", lastErr)
 }
 
-// setHeaders sets the required headers for GitHub API requests
+// setHeaders sets the required headers for GitHub API requests, authorized
+// with the most preferred credential
 func (c *Client) setHeaders(req *http.Request) {
-	req.Header.Set("Authorization", "token "+c.token)
+	c.authorize(req, 0)
+	c.setAPIHeaders(req)
+}
+
+// setAPIHeaders sets the headers every GitHub request carries whatever its
+// authorization: the media type, the pinned API version and any configured
+// extra headers
+func (c *Client) setAPIHeaders(req *http.Request) {
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("User-Agent", "autodocs-crawler/1.0")
+	if c.config.GitHubAPIVersion != "" {
+		req.Header.Set("X-GitHub-Api-Version", c.config.GitHubAPIVersion)
+	}
+	for name, value := range c.config.GitHubExtraHeaders {
+		req.Header.Set(name, value)
+	}
+}
+
+// trackQuota feeds the rate limit headers of a response served with the
+// configured credentials to the metrics, reserve, exhaustion and adaptive
+// rate tracking
+func (c *Client) trackQuota(resp *http.Response) {
+	c.updateRateLimitMetrics(resp)
+	c.checkReserve(resp)
+	c.checkExhausted(resp)
+	c.adaptRate(resp)
 }
 
 // updateRateLimitMetrics updates rate limit metrics from response headers
@@ -291,21 +1125,123 @@ func (c *Client) updateRateLimitMetrics(resp *http.Response) {
 	}
 }
 
-// ParseRepositoryURL parses a GitHub repository URL and extracts owner and repo name
+// RepositoryRef identifies a repository and, for browser URLs such as
+// github.com/owner/repo/tree/main/src, the ref and subpath they point at
+type RepositoryRef struct {
+	Owner  string
+	Repo   string
+	Ref    string // empty unless the URL embeds one
+	Path   string // subpath within the repository, empty for the root
+	IsFile bool   // Path names a single file (a /blob/ URL)
+}
+
+// ParseRepositoryURL parses a GitHub repository URL and extracts owner and repo name.
+// Besides full URLs it accepts git@host:owner/repo, host/owner/repo and owner/repo.
+// Malformed input returns an error wrapping ErrInvalidRepositoryURL.
 func ParseRepositoryURL(repoURL string) (owner, repo string, err error) {
-	parsed, err := url.Parse(repoURL)
+	ref, err := ParseRepositoryRef(repoURL)
 	if err != nil {
-		return "", "", fmt.Errorf("invalid repository URL: %w", err)
+		return "", "", err
+	}
+	return ref.Owner, ref.Repo, nil
+}
+
+// ParseRepositoryRef parses the same forms as ParseRepositoryURL plus
+// /tree/{ref}/{path} and /blob/{ref}/{path} URLs copied from the GitHub UI.
+// The ref is taken to be a single path segment, so a branch containing a slash
+// is split across Ref and Path; set the ref explicitly for those.
+func ParseRepositoryRef(repoURL string) (*RepositoryRef, error) {
+	if strings.TrimSpace(repoURL) == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidRepositoryURL)
+	}
+
+	parsed, err := url.Parse(normalizeRepositoryURL(repoURL))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRepositoryURL, err)
+	}
+
+	// Split the escaped path so an encoded slash can't pass as a separator
+	parts := strings.Split(strings.Trim(parsed.EscapedPath(), "/"), "/")
+
+	var result RepositoryRef
+	switch {
+	case len(parts) == 2:
+		parts[1] = strings.TrimSuffix(parts[1], ".git")
+	case len(parts) >= 4 && (parts[2] == "tree" || parts[2] == "blob"):
+		if result.Ref, err = url.PathUnescape(parts[3]); err != nil || result.Ref == "" {
+			return nil, fmt.Errorf("%w: invalid ref %q", ErrInvalidRepositoryURL, parts[3])
+		}
+		if result.Path, err = url.PathUnescape(strings.Join(parts[4:], "/")); err != nil {
+			return nil, fmt.Errorf("%w: invalid path", ErrInvalidRepositoryURL)
+		}
+		result.IsFile = parts[2] == "blob" && result.Path != ""
+	default:
+		return nil, fmt.Errorf("%w: expected owner/repo", ErrInvalidRepositoryURL)
+	}
+
+	if result.Owner, err = url.PathUnescape(parts[0]); err != nil || !validOwner(result.Owner) {
+		return nil, fmt.Errorf("%w: invalid owner %q", ErrInvalidRepositoryURL, parts[0])
 	}
 
-	// Handle different URL formats
-	path := strings.Trim(parsed.Path, "/")
-	path = strings.TrimSuffix(path, ".git")
+	if result.Repo, err = url.PathUnescape(parts[1]); err != nil || !validRepoName(result.Repo) {
+		return nil, fmt.Errorf("%w: invalid repository name %q", ErrInvalidRepositoryURL, parts[1])
+	}
+
+	return &result, nil
+}
+
+// validOwner reports whether name is a valid GitHub user or organization name:
+// up to 39 ASCII letters, digits and hyphens, not starting with a hyphen
+func validOwner(name string) bool {
+	if name == "" || len(name) > 39 || name[0] == '-' {
+		return false
+	}
+	for _, r := range name {
+		if !isASCIIAlnum(r) && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// validRepoName reports whether name is a valid GitHub repository name:
+// up to 100 ASCII letters, digits, hyphens, underscores and dots
+func validRepoName(name string) bool {
+	if name == "" || len(name) > 100 || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !isASCIIAlnum(r) && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIIAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// normalizeRepositoryURL rewrites shorthand repository references into https URLs
+func normalizeRepositoryURL(repoURL string) string {
+	repoURL = strings.TrimSpace(repoURL)
+
+	// SCP-style SSH: git@github.com:owner/repo.git
+	if rest, ok := strings.CutPrefix(repoURL, "git@"); ok {
+		if host, path, found := strings.Cut(rest, ":"); found {
+			return "https://" + host + "/" + path
+		}
+	}
+
+	if strings.Contains(repoURL, "://") {
+		return repoURL
+	}
 
-	parts := strings.Split(path, "/")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid repository URL format, expected owner/repo")
+	// GitHub owners can't contain dots, so a dotted first segment is a host
+	first, _, _ := strings.Cut(strings.TrimPrefix(repoURL, "/"), "/")
+	if strings.Contains(first, ".") {
+		return "https://" + repoURL
 	}
 
-	return parts[0], parts[1], nil
+	return "https://github.com/" + strings.TrimPrefix(repoURL, "/")
 }
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/redact"
+)
+
+// bodySampler keeps the first limit bytes read from a response body so a
+// failed request can be logged even after the handler consumed the body
+type bodySampler struct {
+	io.ReadCloser
+	sample []byte
+	limit  int
+}
+
+// Read reads from the body, copying into the sample until it is full
+func (b *bodySampler) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit - len(b.sample); room > 0 && n > 0 {
+		b.sample = append(b.sample, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+// fill reads whatever the handler left unread, up to the sample limit
+func (b *bodySampler) fill() {
+	if room := b.limit - len(b.sample); room > 0 {
+		_, _ = io.CopyN(io.Discard, b, int64(room))
+	}
+}
+
+// sampleBody wraps resp.Body for failure capture when it is enabled
+func (c *Client) sampleBody(resp *http.Response) *bodySampler {
+	if !c.config.DebugCaptureFailures {
+		return nil
+	}
+
+	sampler := &bodySampler{ReadCloser: resp.Body, limit: c.config.DebugCaptureBodyBytes}
+	resp.Body = sampler
+	return sampler
+}
+
+// captureFailure logs a bounded sample of a failed request: the URL, status,
+// rate limit headers and the start of the body, with secrets redacted. resp and
+// sampler are nil when the request failed before a response arrived.
+func (c *Client) captureFailure(endpoint, method, url string, attempt int, resp *http.Response, sampler *bodySampler, err error) {
+	if !c.config.DebugCaptureFailures {
+		return
+	}
+
+	url = redact.String(url)
+	errText := redact.String(err.Error())
+
+	if resp == nil {
+		log.Printf("DEBUG GitHub request failed: endpoint=%s method=%s url=%s attempt=%d error=%q",
+			endpoint, method, url, attempt, errText)
+		return
+	}
+
+	var body string
+	if sampler != nil {
+		sampler.fill()
+		body = redact.String(string(sampler.sample))
+	}
+
+	log.Printf("DEBUG GitHub request failed: endpoint=%s method=%s url=%s attempt=%d status=%d rate_limit_remaining=%q rate_limit_reset=%q retry_after=%q request_id=%q error=%q body=%q",
+		endpoint, method, url, attempt, resp.StatusCode,
+		resp.Header.Get("X-RateLimit-Remaining"), resp.Header.Get("X-RateLimit-Reset"),
+		resp.Header.Get("Retry-After"), resp.Header.Get("X-GitHub-Request-Id"), errText, body)
+}
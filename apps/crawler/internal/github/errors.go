@@ -0,0 +1,187 @@
+package github
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/redact"
+)
+
+// Sentinel errors for classifying GitHub API failures with errors.Is
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServerError  = errors.New("GitHub server error")
+
+	// ErrFileTooLarge is returned by GetFileContent for files over MaxFileSize;
+	// the read stops at the limit instead of downloading the rest
+	ErrFileTooLarge = errors.New("file too large")
+
+	// ErrCorruptResponse is returned when a successful response's payload
+	// can't be decoded even after retrying, as opposed to the file not existing
+	ErrCorruptResponse = errors.New("corrupt response")
+
+	// ErrTransferStalled is returned when a response body stops arriving for
+	// longer than the read idle timeout; the request is retried
+	ErrTransferStalled = errors.New("transfer stalled")
+
+	// ErrInvalidRepositoryURL is returned by ParseRepositoryURL for input that
+	// doesn't identify a repository
+	ErrInvalidRepositoryURL = errors.New("invalid repository URL")
+
+	// ErrAuthNotConfigured is returned for every request while a client that
+	// started degraded has no working credential
+	ErrAuthNotConfigured = errors.New("GitHub authentication is not configured")
+
+	// ErrUnavailableForLegalReasons is returned for a 451, such as a repository
+	// taken down after a DMCA notice
+	ErrUnavailableForLegalReasons = errors.New("repository unavailable for legal reasons")
+
+	// ErrEmptyRepository is returned for a 409, which the git data endpoints
+	// answer for a repository with no commits yet
+	ErrEmptyRepository = errors.New("repository is empty")
+
+	// ErrUnprocessable is returned for a 422, a request GitHub understood but
+	// can't serve, such as a ref or SHA that names no commit
+	ErrUnprocessable = errors.New("request unprocessable")
+)
+
+// APIError is a non-success response from the GitHub API
+type APIError struct {
+	StatusCode int
+	Body       string
+
+	// RateLimited is set when the response was rejected by the rate limiter;
+	// Reset is when the limit resets, if GitHub reported it
+	RateLimited bool
+	Reset       time.Time
+}
+
+// RepoAccessError reports a 404 on a repository tree when the token itself is
+// valid. GitHub hides private repositories from tokens that can't read them, so
+// the repository may exist but be out of the token's reach.
+type RepoAccessError struct {
+	Owner string
+	Repo  string
+	Ref   string
+	Err   error
+}
+
+// Error implements the error interface
+func (e *RepoAccessError) Error() string {
+	return fmt.Sprintf("repository %s/%s (ref %s) not found or not accessible: GitHub returns 404 for private "+
+		"repositories the token can't read, so check the name and ref, and that the token has the repo scope "+
+		"or the GitHub App is installed on the repository", e.Owner, e.Repo, e.Ref)
+}
+
+// Unwrap returns the underlying not-found error
+func (e *RepoAccessError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError builds an APIError from a response, consuming its body
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+	}
+
+	// GitHub reports primary rate limits as 403 with no remaining quota and
+	// secondary limits as 429 or 403 with Retry-After
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	retryAfter := resp.Header.Get("Retry-After")
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && (remaining == "0" || retryAfter != "")) {
+		apiErr.RateLimited = true
+
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			apiErr.Reset = time.Unix(reset, 0)
+		} else if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			apiErr.Reset = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	return apiErr
+}
+
+// Error implements the error interface. Statuses with a sentinel of their own
+// are described by it along with GitHub's message rather than the raw body.
+func (e *APIError) Error() string {
+	if sentinel := e.statusError(); sentinel != nil {
+		if message := e.message(); message != "" {
+			return fmt.Sprintf("%v (%d): %s", sentinel, e.StatusCode, message)
+		}
+		return fmt.Sprintf("%v (%d)", sentinel, e.StatusCode)
+	}
+	return fmt.Sprintf("API error %d: %s", e.StatusCode, redact.String(e.Body))
+}
+
+// statusError returns the sentinel for statuses that always mean the same
+// thing and are never worth retrying, or nil
+func (e *APIError) statusError() error {
+	switch e.StatusCode {
+	case http.StatusUnavailableForLegalReasons:
+		return ErrUnavailableForLegalReasons
+	case http.StatusConflict:
+		return ErrEmptyRepository
+	case http.StatusUnprocessableEntity:
+		return ErrUnprocessable
+	}
+	return nil
+}
+
+// message returns the message field of a JSON error body, or ""
+func (e *APIError) message() string {
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(e.Body), &body); err != nil {
+		return ""
+	}
+	return redact.String(body.Message)
+}
+
+// Unwrap maps the status code to one of the sentinel errors
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.RateLimited:
+		return ErrRateLimited
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode >= 500:
+		return ErrServerError
+	}
+	return e.statusError()
+}
+
+// RateLimitReset returns when the rate limit behind err resets, if err is a
+// rate-limit error that reported one
+func RateLimitReset(err error) (time.Time, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RateLimited && !apiErr.Reset.IsZero() {
+		return apiErr.Reset, true
+	}
+	return time.Time{}, false
+}
+
+// isDecodeError reports whether err comes from decoding an empty, truncated or
+// otherwise malformed JSON body
+func isDecodeError(err error) bool {
+	var (
+		syntaxErr *json.SyntaxError
+		base64Err base64.CorruptInputError
+	)
+	return errors.As(err, &syntaxErr) || errors.As(err, &base64Err) || errors.Is(err, ErrCorruptResponse) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
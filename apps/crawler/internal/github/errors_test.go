@@ -0,0 +1,216 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		headers     map[string]string
+		want        error
+		rateLimited bool
+	}{
+		{name: "not found", status: http.StatusNotFound, want: ErrNotFound},
+		{name: "unauthorized", status: http.StatusUnauthorized, want: ErrUnauthorized},
+		{name: "forbidden", status: http.StatusForbidden, want: ErrUnauthorized},
+		{name: "server error", status: http.StatusBadGateway, want: ErrServerError},
+		{
+			name:        "primary rate limit",
+			status:      http.StatusForbidden,
+			headers:     map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000000"},
+			want:        ErrRateLimited,
+			rateLimited: true,
+		},
+		{
+			name:        "secondary rate limit",
+			status:      http.StatusTooManyRequests,
+			headers:     map[string]string{"Retry-After": "60"},
+			want:        ErrRateLimited,
+			rateLimited: true,
+		},
+		{name: "legal takedown", status: http.StatusUnavailableForLegalReasons, want: ErrUnavailableForLegalReasons},
+		{name: "empty repository", status: http.StatusConflict, want: ErrEmptyRepository},
+		{name: "unprocessable", status: http.StatusUnprocessableEntity, want: ErrUnprocessable},
+		{name: "client error", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Header:     make(http.Header),
+				Body:       http.NoBody,
+			}
+			for key, value := range tt.headers {
+				resp.Header.Set(key, value)
+			}
+
+			apiErr := newAPIError(resp)
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+			assert.Equal(t, tt.rateLimited, apiErr.RateLimited)
+
+			if tt.want == nil {
+				assert.Nil(t, apiErr.Unwrap())
+			} else {
+				assert.True(t, errors.Is(apiErr, tt.want))
+			}
+		})
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	err := &APIError{StatusCode: http.StatusForbidden, RateLimited: true, Reset: time.Unix(1700000000, 0)}
+
+	reset, ok := RateLimitReset(errors.Join(errors.New("crawl failed"), err))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1700000000), reset.Unix())
+
+	_, ok = RateLimitReset(&APIError{StatusCode: http.StatusNotFound})
+	assert.False(t, ok)
+}
+
+func TestClientReturnsTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/git/trees/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		ContentRequestCost:    1,
+		FetchTimeoutMS:        30000,
+		RetryMaxAttempts:      1,
+		RetryBackoffBaseMS:    1,
+	}
+
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	client.rawBaseURL = server.URL
+
+	_, err = client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+	assert.ErrorIs(t, err, ErrNotFound)
+	var accessErr *RepoAccessError
+	assert.False(t, errors.As(err, &accessErr), "rate_limit check failed, so the token isn't known to be valid")
+
+	_, err = client.GetFileContent(context.Background(), "owner", "repo", "main.go", "main")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	reset, ok := RateLimitReset(err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1700000000), reset.Unix())
+}
+
+func TestGetRepositoryTreeNoAccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rate_limit" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":4999,"reset":1700000000}}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        30000,
+		RetryMaxAttempts:      1,
+		RetryBackoffBaseMS:    1,
+	}
+
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+
+	_, err = client.GetRepositoryTree(context.Background(), "owner", "private-repo", "main")
+
+	var accessErr *RepoAccessError
+	require.True(t, errors.As(err, &accessErr))
+	assert.Equal(t, "private-repo", accessErr.Repo)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, err.Error(), "not found or not accessible")
+}
+
+func TestUnusualStatusesAreTypedAndNotRetried(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    error
+		message string
+	}{
+		{
+			name:    "legal takedown",
+			status:  http.StatusUnavailableForLegalReasons,
+			body:    `{"message": "Repository access blocked", "block": {"reason": "dmca"}}`,
+			want:    ErrUnavailableForLegalReasons,
+			message: "repository unavailable for legal reasons (451): Repository access blocked",
+		},
+		{
+			name:    "empty repository",
+			status:  http.StatusConflict,
+			body:    `{"message": "Git Repository is empty."}`,
+			want:    ErrEmptyRepository,
+			message: "repository is empty (409): Git Repository is empty.",
+		},
+		{
+			name:    "unprocessable without a message",
+			status:  http.StatusUnprocessableEntity,
+			body:    `<html>unprocessable</html>`,
+			want:    ErrUnprocessable,
+			message: "request unprocessable (422)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{
+				GitHubToken:           "test-token",
+				GitHubBaseURL:         server.URL,
+				APIRateLimitThreshold: 1000,
+				FetchTimeoutMS:        5000,
+				RetryMaxAttempts:      3,
+				RetryBackoffBaseMS:    1,
+			}
+			client, err := NewClient(cfg, metrics.NewForTesting())
+			require.NoError(t, err)
+
+			_, err = client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+			assert.ErrorIs(t, err, tt.want)
+			assert.Equal(t, "failed to get repository tree: "+tt.message, err.Error())
+			assert.Equal(t, 1, requests, "never retried")
+		})
+	}
+}
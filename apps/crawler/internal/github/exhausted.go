@@ -0,0 +1,90 @@
+package github
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// checkExhausted tracks whether the core quota is used up, leaving nothing
+// above RateLimitReserve, so readiness can turn crawls away until it resets
+// rather than accepting requests that can only fail or wait
+func (c *Client) checkExhausted(resp *http.Response) {
+	if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" && resource != "core" {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	// A later response with quota to spare, such as one served by a
+	// fallback credential, ends the exhausted state early
+	if remaining > c.config.RateLimitReserve {
+		c.clearExhausted()
+		return
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	until := time.Unix(reset, 0)
+	if !until.After(time.Now()) {
+		return
+	}
+	c.markExhausted(until)
+}
+
+// markExhausted records that the quota is used up until the given reset, and
+// clears the state once the reset has passed
+func (c *Client) markExhausted(until time.Time) {
+	c.reserveMu.Lock()
+	defer c.reserveMu.Unlock()
+
+	if until.Equal(c.exhaustedUntil) {
+		return
+	}
+	if !time.Now().Before(c.exhaustedUntil) {
+		log.Printf("GitHub quota exhausted until %s", until.Format(time.RFC3339))
+	}
+	c.exhaustedUntil = until
+	c.metrics.SetRateLimitExhausted(true)
+
+	time.AfterFunc(time.Until(until), func() {
+		c.reserveMu.Lock()
+		defer c.reserveMu.Unlock()
+
+		// A later response may have moved or cleared the reset
+		if c.exhaustedUntil.IsZero() || time.Now().Before(c.exhaustedUntil) {
+			return
+		}
+		c.exhaustedUntil = time.Time{}
+		c.metrics.SetRateLimitExhausted(false)
+	})
+}
+
+// clearExhausted ends the exhausted state before the reset
+func (c *Client) clearExhausted() {
+	c.reserveMu.Lock()
+	defer c.reserveMu.Unlock()
+
+	if c.exhaustedUntil.IsZero() {
+		return
+	}
+	c.exhaustedUntil = time.Time{}
+	c.metrics.SetRateLimitExhausted(false)
+}
+
+// QuotaExhausted reports whether the last GitHub response left no core quota
+// above RateLimitReserve, and if so when it resets
+func (c *Client) QuotaExhausted() (time.Time, bool) {
+	c.reserveMu.Lock()
+	defer c.reserveMu.Unlock()
+
+	if time.Now().Before(c.exhaustedUntil) {
+		return c.exhaustedUntil, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,117 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func TestCheckExhausted(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  string
+		remaining int
+		reserve   int
+		resetIn   time.Duration
+		want      bool
+	}{
+		{name: "used up", remaining: 0, resetIn: time.Hour, want: true},
+		{name: "only the reserve left", remaining: 10, reserve: 10, resetIn: time.Hour, want: true},
+		{name: "quota to spare", remaining: 11, reserve: 10, resetIn: time.Hour},
+		{name: "other quotas are ignored", resource: "search", remaining: 0, resetIn: time.Hour},
+		{name: "reset already passed", remaining: 0, resetIn: -time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metrics.NewForTesting()
+			client := &Client{config: &config.Config{RateLimitReserve: tt.reserve}, metrics: m}
+
+			reset := time.Now().Add(tt.resetIn).Truncate(time.Second)
+			resp := &http.Response{Header: http.Header{}}
+			if tt.resource != "" {
+				resp.Header.Set("X-RateLimit-Resource", tt.resource)
+			}
+			resp.Header.Set("X-RateLimit-Remaining", strconv.Itoa(tt.remaining))
+			resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			client.checkExhausted(resp)
+
+			until, exhausted := client.QuotaExhausted()
+			assert.Equal(t, tt.want, exhausted)
+			if tt.want {
+				assert.True(t, until.Equal(reset))
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubQuotaExhausted))
+			}
+		})
+	}
+}
+
+func TestQuotaExhaustedClearsAtReset(t *testing.T) {
+	m := metrics.NewForTesting()
+	client := &Client{config: &config.Config{}, metrics: m}
+
+	client.markExhausted(time.Now().Add(50 * time.Millisecond))
+	_, exhausted := client.QuotaExhausted()
+	require.True(t, exhausted)
+
+	assert.Eventually(t, func() bool {
+		_, exhausted := client.QuotaExhausted()
+		return !exhausted && testutil.ToFloat64(m.GitHubQuotaExhausted) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCheckHealthReportsExhaustedQuota(t *testing.T) {
+	var remaining atomic.Int64
+	remaining.Store(5000)
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining.Load(), 10))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if r.URL.Path == "/rate_limit" {
+			_, _ = w.Write([]byte(`{"resources": {"core": {"limit": 5000, "remaining": 5000}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"number": 1}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 100,
+		FetchTimeoutMS:        5000,
+		HealthCheckCacheTTLMS: 60000,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.True(t, client.CheckHealth(ctx).Healthy)
+
+	// The cached healthy result is overridden while the quota is used up
+	remaining.Store(0)
+	_, err = client.GetPullRequest(ctx, "owner", "repo", 1)
+	require.NoError(t, err)
+
+	health := client.CheckHealth(ctx)
+	assert.False(t, health.Healthy)
+	assert.Contains(t, health.Error, "GitHub quota exhausted")
+	require.NotNil(t, health.QuotaExhaustedUntil)
+	assert.True(t, health.QuotaExhaustedUntil.Equal(reset))
+
+	remaining.Store(4999)
+	_, err = client.GetPullRequest(ctx, "owner", "repo", 1)
+	require.NoError(t, err)
+	assert.True(t, client.CheckHealth(ctx).Healthy)
+}
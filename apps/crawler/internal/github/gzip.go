@@ -0,0 +1,55 @@
+package github
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// sizeKey is the context key for the size the tree reported for a file
+type sizeKey struct{}
+
+// WithContentSize returns a context telling content fetches how large the
+// file is expected to be, so files of at least GzipContentMinSize are
+// requested compressed
+func WithContentSize(ctx context.Context, size int64) context.Context {
+	return context.WithValue(ctx, sizeKey{}, size)
+}
+
+// wantsGzip reports whether a content fetch in ctx should ask for gzip
+func (c *Client) wantsGzip(ctx context.Context) bool {
+	size, ok := ctx.Value(sizeKey{}).(int64)
+	return ok && c.config.GzipContentMinSize > 0 && size >= c.config.GzipContentMinSize
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read implements io.Reader
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+// decodeBody returns a reader of a response's decoded content along with the
+// count of bytes received on the wire. The transport only decompresses by
+// itself when it asked for gzip, so a response to our own Accept-Encoding is
+// decompressed here; a header that isn't gzip is corrupt and gets retried.
+func decodeBody(resp *http.Response) (io.Reader, *countingReader, error) {
+	wire := &countingReader{r: resp.Body}
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return wire, wire, nil
+	}
+
+	decoded, err := gzip.NewReader(wire)
+	if err != nil {
+		return nil, wire, fmt.Errorf("%w: gzip: %w", ErrCorruptResponse, err)
+	}
+	return decoded, wire, nil
+}
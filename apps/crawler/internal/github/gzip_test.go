@@ -0,0 +1,125 @@
+package github
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func gzipped(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestGetFileContentGzip(t *testing.T) {
+	content := strings.Repeat("package main // compresses well\n", 200)
+
+	tests := []struct {
+		name      string
+		size      int64
+		limit     int64
+		wantGzip  bool
+		want      string
+		truncated bool
+	}{
+		{name: "large file", size: int64(len(content)), wantGzip: true, want: content},
+		{name: "large file cut at the limit", size: int64(len(content)), limit: 100, wantGzip: true, want: content[:100], truncated: true},
+		{name: "small file", size: 10, limit: 100, want: content[:100], truncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var encoding, ranged string
+			compressed := gzipped(t, content)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding, ranged = r.Header.Get("Accept-Encoding"), r.Header.Get("Range")
+				if encoding == "gzip" {
+					w.Header().Set("Content-Encoding", "gzip")
+					_, _ = w.Write(compressed)
+					return
+				}
+				// Serve ranges so the uncompressed path reads only what it asked for
+				http.ServeContent(w, r, "main.go", time.Time{}, strings.NewReader(content))
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{
+				GitHubToken:           "test-token",
+				GitHubBaseURL:         server.URL,
+				APIRateLimitThreshold: 1000,
+				FetchTimeoutMS:        5000,
+				GzipContentMinSize:    1024,
+			}
+			m := metrics.NewForTesting()
+			client, err := NewClient(cfg, m)
+			require.NoError(t, err)
+			client.rawBaseURL = server.URL
+
+			ctx := WithContentSize(context.Background(), tt.size)
+			got, truncated, err := client.GetFileContentPrefix(ctx, "owner", "repo", "main.go", "main", tt.limit)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got), "content is decompressed before it's returned")
+			assert.Equal(t, tt.truncated, truncated)
+
+			decoded := testutil.ToFloat64(m.ContentBytesTotal.WithLabelValues("decoded"))
+			wire := testutil.ToFloat64(m.ContentBytesTotal.WithLabelValues("wire"))
+			if tt.wantGzip {
+				assert.Equal(t, "gzip", encoding)
+				assert.Empty(t, ranged, "a range would count compressed bytes")
+				assert.Less(t, wire, decoded)
+			} else {
+				assert.NotEqual(t, "gzip", encoding)
+				assert.NotEmpty(t, ranged)
+				assert.Equal(t, wire, decoded)
+			}
+		})
+	}
+}
+
+func TestGetFileContentCorruptGzipIsRetried(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Encoding", "gzip")
+		if requests == 1 {
+			_, _ = w.Write([]byte("not gzip at all"))
+			return
+		}
+		_, _ = w.Write(gzipped(t, "package main"))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        5000,
+		RetryMaxAttempts:      2,
+		RetryBackoffBaseMS:    1,
+		GzipContentMinSize:    1,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	client.rawBaseURL = server.URL
+
+	got, err := client.GetFileContent(WithContentSize(context.Background(), 12), "owner", "repo", "main.go", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "package main", string(got))
+	assert.Equal(t, 2, requests)
+}
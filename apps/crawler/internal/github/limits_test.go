@@ -0,0 +1,126 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+// inFlightServer counts the most requests it has had open at once, holding
+// each for delay
+type inFlightServer struct {
+	*httptest.Server
+
+	current atomic.Int32
+	peak    atomic.Int32
+}
+
+func newInFlightServer(t *testing.T, delay time.Duration, body string) *inFlightServer {
+	s := &inFlightServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.current.Add(1)
+		defer s.current.Add(-1)
+		for {
+			peak := s.peak.Load()
+			if n <= peak || s.peak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestRawRequestsUseTheirOwnLimiter(t *testing.T) {
+	raw := newInFlightServer(t, 0, "package main")
+	api := newInFlightServer(t, 0, `{"sha": "tree"}`)
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         api.URL,
+		APIRateLimitThreshold: 5,
+		RawRateLimitThreshold: 50,
+		FetchTimeoutMS:        5000,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	client.rawBaseURL = raw.URL
+
+	// Twenty raw fetches would take seconds on the API limiter's 5 a second
+	ctx := context.Background()
+	start := time.Now()
+	for range 20 {
+		_, err := client.GetFileContent(ctx, "owner", "repo", "main.go", "main")
+		require.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+	assert.InDelta(t, 5, client.rateLimiter.Tokens(), 0.5, "raw fetches leave the API budget untouched")
+
+	_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Less(t, client.rateLimiter.Tokens(), 4.5)
+}
+
+func TestConcurrencyCapsPerPath(t *testing.T) {
+	raw := newInFlightServer(t, 20*time.Millisecond, "package main")
+	api := newInFlightServer(t, 20*time.Millisecond, `{"sha": "tree"}`)
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         api.URL,
+		APIRateLimitThreshold: 1000,
+		RawMaxConcurrency:     3,
+		APIMaxConcurrency:     1,
+		FetchTimeoutMS:        5000,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	client.rawBaseURL = raw.URL
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetFileContent(ctx, "owner", "repo", "main.go", "main")
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			tree, err := client.GetRepositoryTree(ctx, "owner", "repo", "main")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "tree", tree.SHA)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, raw.peak.Load(), int32(3), "raw requests have their own slots")
+	assert.Equal(t, int32(1), api.peak.Load(), "API requests are capped separately")
+}
+
+func TestAcquireSlotHonoursContext(t *testing.T) {
+	slots := make(chan struct{}, 1)
+	require.NoError(t, acquireSlot(context.Background(), slots))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, acquireSlot(ctx, slots), context.Canceled)
+
+	releaseSlot(slots)
+	assert.NoError(t, acquireSlot(ctx, nil), "no cap never blocks")
+	releaseSlot(nil)
+}
@@ -0,0 +1,76 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/redact"
+)
+
+// getFileFromMirror tries the raw content mirror for a file, reading no more
+// than limit bytes like getFileContent. It reports false on a miss or any
+// failure so the caller falls back to GitHub, which stays the source of truth.
+// The mirror is not sent the GitHub credentials.
+func (c *Client) getFileFromMirror(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, bool) {
+	url := fmt.Sprintf("%s/%s/%s/%s/%s", c.config.RawMirrorBaseURL, owner, repo, ref, path)
+
+	reqCtx, guard := c.newStallGuard(ctx)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		guard.stop()
+		c.metrics.RecordMirrorRequest("error")
+		return nil, false, false
+	}
+	req.Header.Set("User-Agent", "autodocs-crawler/1.0")
+	if limit > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", limit))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		guard.stop()
+		if isHeaderTimeout(err) {
+			c.metrics.RecordStalledTransfer("headers")
+		}
+		c.metrics.RecordMirrorRequest("error")
+		log.Printf("Raw mirror request for %s failed, falling back to GitHub: %s", path, redact.String(err.Error()))
+		return nil, false, false
+	}
+	guard.watch(resp)
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound:
+		c.metrics.RecordMirrorRequest("miss")
+		return nil, false, false
+	default:
+		c.metrics.RecordMirrorRequest("error")
+		log.Printf("Raw mirror returned %d for %s, falling back to GitHub", resp.StatusCode, path)
+		return nil, false, false
+	}
+
+	body, sizeHint := io.Reader(resp.Body), int(resp.ContentLength)
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+		if sizeHint < 0 || int64(sizeHint) > limit+1 {
+			sizeHint = int(limit + 1)
+		}
+	}
+	content, err := readBody(body, sizeHint)
+	if err != nil {
+		c.metrics.RecordMirrorRequest("error")
+		return nil, false, false
+	}
+
+	c.metrics.RecordMirrorRequest("hit")
+	if limit > 0 && int64(len(content)) > limit {
+		c.metrics.RecordContentRead("truncated")
+		return content[:limit], true, true
+	}
+	c.metrics.RecordContentRead("full")
+	return content, false, true
+}
@@ -0,0 +1,96 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func TestGetFileContentFromMirror(t *testing.T) {
+	tests := []struct {
+		name         string
+		mirrorStatus int
+		wantGitHub   bool
+		wantResult   string
+	}{
+		{name: "hit", mirrorStatus: http.StatusOK, wantResult: "hit"},
+		{name: "miss", mirrorStatus: http.StatusNotFound, wantGitHub: true, wantResult: "miss"},
+		{name: "error", mirrorStatus: http.StatusBadGateway, wantGitHub: true, wantResult: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/owner/repo/main/a.go", r.URL.Path)
+				assert.Empty(t, r.Header.Get("Authorization"), "GitHub credentials must not reach the mirror")
+				w.WriteHeader(tt.mirrorStatus)
+				_, _ = w.Write([]byte("package mirror"))
+			}))
+			defer mirror.Close()
+
+			var githubCalls int
+			raw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				githubCalls++
+				_, _ = w.Write([]byte("package github"))
+			}))
+			defer raw.Close()
+
+			cfg := &config.Config{
+				GitHubToken:           "test-token",
+				GitHubBaseURL:         raw.URL,
+				RawMirrorBaseURL:      mirror.URL,
+				APIRateLimitThreshold: 100,
+				ContentRequestCost:    1,
+				FetchTimeoutMS:        30000,
+				MaxFileSize:           1024,
+			}
+			m := metrics.NewForTesting()
+			client, err := NewClient(cfg, m)
+			require.NoError(t, err)
+			client.rawBaseURL = raw.URL
+
+			content, err := client.GetFileContent(context.Background(), "owner", "repo", "a.go", "main")
+			require.NoError(t, err)
+
+			if tt.wantGitHub {
+				assert.Equal(t, "package github", string(content))
+				assert.Equal(t, 1, githubCalls)
+			} else {
+				assert.Equal(t, "package mirror", string(content))
+				assert.Equal(t, 0, githubCalls)
+			}
+			assert.Equal(t, float64(1), testutil.ToFloat64(m.MirrorRequestsTotal.WithLabelValues(tt.wantResult)))
+		})
+	}
+}
+
+func TestGetFileContentFromMirrorTruncates(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "bytes=0-4", r.Header.Get("Range"))
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer mirror.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         mirror.URL,
+		RawMirrorBaseURL:      mirror.URL,
+		APIRateLimitThreshold: 100,
+		FetchTimeoutMS:        30000,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+
+	content, truncated, err := client.GetFileContentPrefix(context.Background(), "owner", "repo", "a.go", "main", 4)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.Equal(t, "0123", string(content))
+}
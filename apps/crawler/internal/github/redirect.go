@@ -0,0 +1,59 @@
+package github
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxRedirects matches the net/http default
+const maxRedirects = 10
+
+// trustedDomains may receive credentials on a redirect, along with their
+// subdomains and the configured API and raw content hosts
+var trustedDomains = []string{"github.com", "githubusercontent.com"}
+
+// checkRedirect is the API client's redirect policy. net/http drops the
+// Authorization header when a redirect leaves the original host, so a raw
+// content redirect for a private repository would come back 404. Redirects
+// to trusted GitHub hosts get the header back; for anywhere else the redirect
+// response itself is returned, which callers treat like any other non-200,
+// such as raw content falling back to the contents API. Requests sent without
+// credentials, like those to the raw mirror, follow redirects as usual.
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	auth := via[0].Header.Get("Authorization")
+	if auth == "" {
+		return nil
+	}
+
+	previous := via[len(via)-1].URL
+	if !c.trustedHost(req.URL.Hostname()) || (previous.Scheme == "https" && req.URL.Scheme != "https") {
+		log.Printf("Not following redirect from %s to untrusted %s://%s", previous.Host, req.URL.Scheme, req.URL.Host)
+		return http.ErrUseLastResponse
+	}
+
+	req.Header.Set("Authorization", auth)
+	return nil
+}
+
+// trustedHost reports whether host is a GitHub host that may see credentials
+func (c *Client) trustedHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, base := range []string{c.baseURL, c.rawBaseURL} {
+		if u, err := url.Parse(base); err == nil && strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	for _, domain := range trustedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+// localhostURL addresses a test server by name rather than IP, so net/http
+// treats a redirect to it as leaving the original host
+func localhostURL(server *httptest.Server) string {
+	return strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+}
+
+func newRedirectTestClient(t *testing.T, apiURL, rawURL string) *Client {
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         apiURL,
+		APIRateLimitThreshold: 100,
+		FetchTimeoutMS:        5000,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	client.rawBaseURL = rawURL
+	return client
+}
+
+func TestRawRedirectKeepsAuthOnTrustedHost(t *testing.T) {
+	// The private file is only served to the token; anything else gets a 404
+	content := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token test-token" || r.URL.Path != "/private/file.go" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("package private"))
+	}))
+	defer content.Close()
+
+	raw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, localhostURL(content)+"/private/file.go", http.StatusFound)
+	}))
+	defer raw.Close()
+
+	// The content host is the API host, so it's trusted
+	client := newRedirectTestClient(t, localhostURL(content), raw.URL)
+
+	got, err := client.GetFileContent(context.Background(), "owner", "repo", "file.go", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "package private", string(got))
+}
+
+func TestRawRedirectToUntrustedHost(t *testing.T) {
+	var leaked atomic.Int32
+	untrusted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked.Add(1)
+		_, _ = w.Write([]byte("not from GitHub"))
+	}))
+	defer untrusted.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/repos/") {
+			encoded := base64.StdEncoding.EncodeToString([]byte("package api"))
+			_, _ = w.Write([]byte(`{"encoding": "base64", "content": "` + encoded + `"}`))
+			return
+		}
+		http.Redirect(w, r, localhostURL(untrusted)+"/file.go", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := newRedirectTestClient(t, server.URL, server.URL)
+
+	// The redirect isn't followed and the contents API serves the file
+	got, err := client.GetFileContent(context.Background(), "owner", "repo", "file.go", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "package api", string(got))
+	assert.Zero(t, leaked.Load())
+}
+
+func TestTrustedHost(t *testing.T) {
+	client := &Client{baseURL: "https://ghe.example.com/api/v3", rawBaseURL: "https://raw.githubusercontent.com"}
+
+	for host, want := range map[string]bool{
+		"github.com":                        true,
+		"objects.githubusercontent.com":     true,
+		"ghe.example.com":                   true,
+		"GHE.example.com":                   true,
+		"evilgithub.com":                    false,
+		"github.com.evil.example":           false,
+		"raw.githubusercontent.com.example": false,
+		"example.com":                       false,
+	} {
+		assert.Equal(t, want, client.trustedHost(host), host)
+	}
+}
@@ -0,0 +1,25 @@
+package github
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// requestCountKey is the context key for a crawl's GitHub request counter
+type requestCountKey struct{}
+
+// WithRequestCounter returns a context whose GitHub requests are counted in
+// the returned counter, every attempt included, so retries, credential
+// fallbacks and contents API fallbacks all show. rate_limit checks are free
+// and aren't counted; neither are raw mirror lookups, which don't reach GitHub.
+func WithRequestCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	counter := new(atomic.Int64)
+	return context.WithValue(ctx, requestCountKey{}, counter), counter
+}
+
+// countRequest adds one request to ctx's counter, if it has one
+func countRequest(ctx context.Context) {
+	if counter, ok := ctx.Value(requestCountKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+}
@@ -0,0 +1,59 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestWithRequestCounter(t *testing.T) {
+	var treeCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rate_limit":
+			_ = json.NewEncoder(w).Encode(model.GitHubRateLimitResponse{})
+		default:
+			// The first tree request fails and is retried
+			if treeCalls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{SHA: "tree"})
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        5000,
+		RetryMaxAttempts:      2,
+		RetryBackoffBaseMS:    1,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+
+	ctx, requests := WithRequestCounter(context.Background())
+	_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+	require.NoError(t, err)
+	_, err = client.GetRateLimit(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), requests.Load())
+
+	// Requests outside a counted context go uncounted
+	_, err = client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), requests.Load())
+}
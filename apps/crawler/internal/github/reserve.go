@@ -0,0 +1,85 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// checkReserve pauses new requests until the quota resets once GitHub reports
+// fewer remaining requests than RateLimitReserve, leaving the rest of the
+// quota to other systems sharing the token
+func (c *Client) checkReserve(resp *http.Response) {
+	reserve := c.config.RateLimitReserve
+	if reserve <= 0 {
+		return
+	}
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining >= reserve {
+		return
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	until := time.Unix(reset, 0)
+	if !until.After(time.Now()) {
+		return
+	}
+
+	c.pauseUntil(until, fmt.Sprintf("GitHub quota at %d, below the reserve of %d", remaining, reserve))
+}
+
+// pauseUntil holds back new requests until the given reset time, unless a
+// longer pause is already in place
+func (c *Client) pauseUntil(until time.Time, reason string) {
+	c.reserveMu.Lock()
+	defer c.reserveMu.Unlock()
+
+	if !until.After(c.pausedUntil) {
+		return
+	}
+
+	log.Printf("%s; pausing requests until %s", reason, until.Format(time.RFC3339))
+	c.pausedUntil = until
+	c.metrics.SetRateLimitReservePaused(true)
+
+	time.AfterFunc(time.Until(until), func() {
+		c.reserveMu.Lock()
+		defer c.reserveMu.Unlock()
+
+		// A later response may have extended the pause
+		if time.Now().Before(c.pausedUntil) {
+			return
+		}
+		log.Printf("GitHub quota reset, resuming requests")
+		c.metrics.SetRateLimitReservePaused(false)
+	})
+}
+
+// waitForReserve blocks while requests are paused to protect the rate limit
+// reserve, or until the context is done
+func (c *Client) waitForReserve(ctx context.Context) error {
+	c.reserveMu.Lock()
+	delay := time.Until(c.pausedUntil)
+	c.reserveMu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func TestRateLimitReserve(t *testing.T) {
+	tests := []struct {
+		name       string
+		reserve    int
+		remaining  int
+		resetIn    time.Duration
+		wantPaused bool
+	}{
+		{name: "below reserve", reserve: 10, remaining: 5, resetIn: time.Hour, wantPaused: true},
+		{name: "at reserve", reserve: 10, remaining: 10, resetIn: time.Hour, wantPaused: false},
+		{name: "reserve disabled", reserve: 0, remaining: 0, resetIn: time.Hour, wantPaused: false},
+		{name: "reset already passed", reserve: 10, remaining: 5, resetIn: -time.Minute, wantPaused: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("X-RateLimit-Limit", "5000")
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(tt.remaining))
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(tt.resetIn).Unix(), 10))
+				_, _ = w.Write([]byte(`{"number":1}`))
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{
+				GitHubToken:           "test-token",
+				GitHubBaseURL:         server.URL,
+				APIRateLimitThreshold: 100,
+				ContentRequestCost:    1,
+				FetchTimeoutMS:        30000,
+				RateLimitReserve:      tt.reserve,
+			}
+			m := metrics.NewForTesting()
+			client, err := NewClient(cfg, m)
+			require.NoError(t, err)
+
+			_, err = client.GetPullRequest(context.Background(), "owner", "repo", 1)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err = client.GetPullRequest(ctx, "owner", "repo", 1)
+
+			if tt.wantPaused {
+				// The second request waits for the reset instead of spending the reserve
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.Equal(t, 1, calls)
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubReservePaused))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, 2, calls)
+			assert.Equal(t, float64(0), testutil.ToFloat64(m.GitHubReservePaused))
+		})
+	}
+}
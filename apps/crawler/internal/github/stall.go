@@ -0,0 +1,98 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// stallGuard aborts a request whose response body delivers nothing for the
+// read idle timeout. The client-wide timeout alone lets a transfer that
+// trickles or stalls mid-stream use up the whole budget for one file.
+type stallGuard struct {
+	timeout time.Duration
+	cancel  context.CancelFunc
+	record  func(phase string)
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+// newStallGuard derives the request context the guard can cancel. It returns
+// a nil guard, which does nothing, when the read idle timeout is disabled.
+func (c *Client) newStallGuard(ctx context.Context) (context.Context, *stallGuard) {
+	timeout := c.config.GetReadIdleTimeout()
+	if timeout <= 0 {
+		return ctx, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, &stallGuard{timeout: timeout, cancel: cancel, record: c.metrics.RecordStalledTransfer}
+}
+
+// watch wraps resp.Body so every read that delivers data pushes the deadline
+// back; closing the body stops the guard
+func (g *stallGuard) watch(resp *http.Response) {
+	if g == nil {
+		return
+	}
+
+	g.timer = time.AfterFunc(g.timeout, g.abort)
+	resp.Body = &guardedBody{ReadCloser: resp.Body, guard: g}
+}
+
+// abort cancels a stalled request
+func (g *stallGuard) abort() {
+	g.stalled.Store(true)
+	g.record("body")
+	g.cancel()
+}
+
+// stop releases the guard's timer and context
+func (g *stallGuard) stop() {
+	if g == nil {
+		return
+	}
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.cancel()
+}
+
+// guardedBody is a response body watched by a stallGuard
+type guardedBody struct {
+	io.ReadCloser
+	guard *stallGuard
+}
+
+func (b *guardedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.guard.stalled.Load() {
+		b.guard.timer.Reset(b.guard.timeout)
+	}
+	if err != nil && err != io.EOF && b.guard.stalled.Load() {
+		err = fmt.Errorf("%w: no data for %s", ErrTransferStalled, b.guard.timeout)
+	}
+	return n, err
+}
+
+func (b *guardedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.guard.stop()
+	return err
+}
+
+// isHeaderTimeout reports whether a request failed waiting for response
+// headers; net/http has no sentinel for ResponseHeaderTimeout
+func isHeaderTimeout(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "timeout awaiting response headers")
+}
+
+// isStalled reports whether a request was aborted for stalling, in either phase
+func isStalled(err error) bool {
+	return errors.Is(err, ErrTransferStalled) || isHeaderTimeout(err)
+}
@@ -0,0 +1,111 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+// newStallTestClient returns a client for server with fast retries and the
+// given header and read idle timeouts
+func newStallTestClient(t *testing.T, server *httptest.Server, headerTimeoutMS, idleTimeoutMS int) (*Client, *metrics.Metrics) {
+	cfg := &config.Config{
+		GitHubToken:             "test-token",
+		GitHubBaseURL:           server.URL,
+		APIRateLimitThreshold:   100,
+		ContentRequestCost:      1,
+		FetchTimeoutMS:          5000,
+		MaxFileSize:             1024,
+		RetryMaxAttempts:        1,
+		RetryBackoffBaseMS:      1,
+		ResponseHeaderTimeoutMS: headerTimeoutMS,
+		ReadIdleTimeoutMS:       idleTimeoutMS,
+	}
+	m := metrics.NewForTesting()
+	client, err := NewClient(cfg, m)
+	require.NoError(t, err)
+	client.rawBaseURL = server.URL
+	return client, m
+}
+
+// waitOrStop blocks until the client gives up on the request, or a while passes
+func waitOrStop(r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(2 * time.Second):
+	}
+}
+
+func TestStalledBodyIsAbortedAndRetried(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Content-Length", "14")
+			_, _ = w.Write([]byte("package"))
+			w.(http.Flusher).Flush()
+			waitOrStop(r)
+			return
+		}
+		_, _ = w.Write([]byte("package stall"))
+	}))
+	defer server.Close()
+
+	client, m := newStallTestClient(t, server, 0, 50)
+
+	start := time.Now()
+	content, err := client.GetFileContent(context.Background(), "owner", "repo", "a.go", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "package stall", string(content))
+	assert.Less(t, time.Since(start), time.Second, "the stall is cut short rather than waiting out the fetch timeout")
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.StalledTransfers.WithLabelValues("body")))
+}
+
+func TestSlowResponseHeadersAreAbortedAndRetried(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			waitOrStop(r)
+			return
+		}
+		_, _ = w.Write([]byte("package headers"))
+	}))
+	defer server.Close()
+
+	client, m := newStallTestClient(t, server, 50, 0)
+
+	content, err := client.GetFileContent(context.Background(), "owner", "repo", "a.go", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "package headers", string(content))
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.StalledTransfers.WithLabelValues("headers")))
+}
+
+func TestTricklingBodyIsNotAborted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range []string{"pack", "age ", "tric", "kle"} {
+			_, _ = w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	// Each chunk arrives within the idle timeout, though the whole body doesn't
+	client, m := newStallTestClient(t, server, 0, 100)
+
+	content, err := client.GetFileContent(context.Background(), "owner", "repo", "a.go", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "package trickle", string(content))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.StalledTransfers.WithLabelValues("body")))
+}
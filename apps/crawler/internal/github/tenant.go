@@ -0,0 +1,58 @@
+package github
+
+import (
+	"context"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/redact"
+)
+
+// tokenKey is the context key for a tenant-supplied GitHub token
+type tokenKey struct{}
+
+// WithToken returns a context whose GitHub requests authenticate with token
+// instead of the configured credentials, so a tenant can crawl private
+// repositories with their own access. There is no fallback to the configured
+// credentials, which would expose what they can read, and the tenant's quota
+// isn't mixed into the shared rate limit state. Errors from such requests
+// have the token masked. An empty token leaves ctx unchanged.
+func WithToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// HasToken reports whether ctx carries a tenant token from WithToken
+func HasToken(ctx context.Context) bool {
+	return tokenFromContext(ctx) != ""
+}
+
+// tokenFromContext returns the tenant token in ctx, or ""
+func tokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	return token
+}
+
+// scrubbedError masks a tenant token in the text of the error it wraps
+type scrubbedError struct {
+	err   error
+	token string
+}
+
+// Error implements the error interface
+func (e *scrubbedError) Error() string {
+	return redact.Literal(e.err.Error(), e.token)
+}
+
+// Unwrap returns the wrapped error, for errors.Is and errors.As
+func (e *scrubbedError) Unwrap() error {
+	return e.err
+}
+
+// scrubToken wraps err so it never repeats token, if there is one
+func scrubToken(err error, token string) error {
+	if err == nil || token == "" {
+		return err
+	}
+	return &scrubbedError{err: err, token: token}
+}
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func TestTenantTokenReplacesCredentials(t *testing.T) {
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		used = append(used, r.Header.Get("Authorization"))
+
+		// The tenant's quota is spent, which must not pause shared requests
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		if r.Header.Get("Authorization") != "token tenant-secret-42" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		// Echo the token back, as a misbehaving proxy might
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message": "Bad credentials: tenant-secret-42"}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "service-token",
+		GitHubAppID:           "123456",
+		GitHubAppKey:          generatePrivateKey(t),
+		GitHubInstallID:       "789012",
+		GitHubAuthOrder:       []string{config.AuthMethodToken, config.AuthMethodApp},
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        5000,
+		RetryMaxAttempts:      1,
+		RetryBackoffBaseMS:    1,
+		RateLimitReserve:      10,
+	}
+	// The App's token can't be generated against this server, so only the
+	// PAT is set up
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	used = nil
+
+	ctx := WithToken(context.Background(), "tenant-secret-42")
+	assert.True(t, HasToken(ctx))
+	_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+	require.Error(t, err)
+
+	// Refused, with no fallback to the service's credentials
+	assert.Equal(t, []string{"token tenant-secret-42"}, used)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	assert.NotContains(t, err.Error(), "tenant-secret-42")
+
+	_, exhausted := client.QuotaExhausted()
+	assert.False(t, exhausted)
+	assert.True(t, client.pausedUntil.IsZero())
+}
+
+func TestTenantTokenOnDegradedClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token tenant-token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"number": 7}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubAppID:           "123456",
+		GitHubAppKey:          generatePrivateKey(t),
+		GitHubInstallID:       "789012",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        5000,
+		AllowDegradedStartup:  true,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	require.ErrorIs(t, client.AuthError(), ErrAuthNotConfigured)
+
+	// Tenants bring their own credentials, so they can crawl meanwhile
+	pr, err := client.GetPullRequest(WithToken(context.Background(), "tenant-token"), "owner", "repo", 7)
+	require.NoError(t, err)
+	assert.Equal(t, 7, pr.Number)
+
+	_, err = client.GetPullRequest(context.Background(), "owner", "repo", 7)
+	assert.ErrorIs(t, err, ErrAuthNotConfigured)
+}
+
+func TestWithEmptyToken(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ctx, WithToken(ctx, ""))
+	assert.False(t, HasToken(ctx))
+}
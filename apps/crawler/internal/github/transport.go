@@ -0,0 +1,111 @@
+package github
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+)
+
+// newTransport builds the HTTP transport used for all GitHub requests.
+// A custom transport loses the default HTTP/2 upgrade unless it is requested
+// explicitly. Over HTTP/2 all workers multiplex onto a few connections, so the
+// per-host connection limits only matter when GitHub falls back to HTTP/1.1.
+func newTransport(cfg *config.Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = max(cfg.MaxConcurrentFetches, 2)
+	transport.ResponseHeaderTimeout = cfg.GetResponseHeaderTimeout()
+
+	if cfg.HTTPSProxy != "" {
+		proxyURL, err := url.Parse(cfg.HTTPSProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = proxyFunc(proxyURL, cfg.NoProxy)
+	}
+
+	if err := configureTLS(transport, cfg); err != nil {
+		return nil, err
+	}
+
+	return transport, nil
+}
+
+// configureTLS applies the custom CA bundle and verification settings to the
+// transport, leaving the defaults alone when neither is configured
+func configureTLS(transport *http.Transport, cfg *config.Config) error {
+	if cfg.CABundlePath == "" && !cfg.TLSInsecureSkipVerify {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+
+	if cfg.CABundlePath != "" {
+		pem, err := os.ReadFile(cfg.CABundlePath)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		// Custom CAs extend the system roots rather than replacing them
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundlePath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSInsecureSkipVerify {
+		log.Printf("WARNING: TLS certificate verification is disabled for GitHub requests; never use this in production")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return nil
+}
+
+// proxyFunc routes requests through proxyURL unless the target host matches
+// one of noProxy. Entries follow NO_PROXY conventions: "*" matches every host,
+// and "example.com" or ".example.com" match the domain and its subdomains.
+func proxyFunc(proxyURL *url.URL, noProxy []string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+}
+
+// bypassProxy reports whether host matches a NO_PROXY entry
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range noProxy {
+		if entry == "*" {
+			return true
+		}
+
+		// Drop any port so "example.com:443" matches too
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
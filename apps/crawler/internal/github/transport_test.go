@@ -0,0 +1,112 @@
+package github
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+)
+
+func TestBypassProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		noProxy []string
+		want    bool
+	}{
+		{name: "no entries", host: "api.github.com", want: false},
+		{name: "wildcard", host: "api.github.com", noProxy: []string{"*"}, want: true},
+		{name: "exact host", host: "api.github.com", noProxy: []string{"api.github.com"}, want: true},
+		{name: "domain suffix", host: "api.github.com", noProxy: []string{"github.com"}, want: true},
+		{name: "leading dot", host: "api.github.com", noProxy: []string{".github.com"}, want: true},
+		{name: "entry with port", host: "ghe.corp", noProxy: []string{"ghe.corp:443"}, want: true},
+		{name: "partial label", host: "notgithub.com", noProxy: []string{"github.com"}, want: false},
+		{name: "case insensitive", host: "API.GitHub.com", noProxy: []string{"github.com"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, bypassProxy(tt.host, tt.noProxy))
+		})
+	}
+}
+
+func TestNewTransportProxy(t *testing.T) {
+	cfg := &config.Config{
+		MaxConcurrentFetches: 10,
+		HTTPSProxy:           "http://proxy.internal:3128",
+		NoProxy:              []string{"localhost"},
+	}
+
+	transport, err := newTransport(cfg)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "https://api.github.com/rate_limit", nil)
+	proxyURL, err := transport.Proxy(req)
+	require.NoError(t, err)
+	require.NotNil(t, proxyURL)
+	assert.Equal(t, "proxy.internal:3128", proxyURL.Host)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	proxyURL, err = transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+}
+
+func TestNewTransportCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, certPEM, 0o600))
+
+	// Without the bundle the test server's certificate is untrusted
+	transport, err := newTransport(&config.Config{})
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Get(server.URL)
+	require.Error(t, err)
+
+	transport, err = newTransport(&config.Config{CABundlePath: bundle})
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestNewTransportTLSErrors(t *testing.T) {
+	_, err := newTransport(&config.Config{CABundlePath: filepath.Join(t.TempDir(), "missing.pem")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read CA bundle")
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0o600))
+	_, err = newTransport(&config.Config{CABundlePath: empty})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no certificates found")
+}
+
+func TestNewTransportInsecureSkipVerify(t *testing.T) {
+	transport, err := newTransport(&config.Config{TLSInsecureSkipVerify: true})
+	require.NoError(t, err)
+	require.NotNil(t, transport.TLSClientConfig)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+
+	// Defaults keep the standard TLS settings
+	transport, err = newTransport(&config.Config{})
+	require.NoError(t, err)
+	if transport.TLSClientConfig != nil {
+		assert.False(t, transport.TLSClientConfig.InsecureSkipVerify)
+		assert.Nil(t, transport.TLSClientConfig.RootCAs)
+	}
+}
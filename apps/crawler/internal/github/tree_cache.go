@@ -0,0 +1,97 @@
+package github
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// cachedTree is a tree response along with the ETag GitHub returned for it
+type cachedTree struct {
+	etag string
+	tree *model.GitHubTreeResponse
+}
+
+// treeCache holds the last tree seen per owner/repo/ref so re-crawls can be
+// served from a 304 Not Modified. Once full, the oldest entry is evicted.
+type treeCache struct {
+	mu         sync.Mutex
+	entries    map[string]cachedTree
+	order      []string
+	maxEntries int
+}
+
+// newTreeCache creates a tree cache holding up to maxEntries trees
+func newTreeCache(maxEntries int) *treeCache {
+	return &treeCache{
+		entries:    make(map[string]cachedTree),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the cached tree for key
+func (c *treeCache) get(key string) (cachedTree, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+// put stores a tree under key, evicting the oldest entry if the cache is full
+func (c *treeCache) put(key, etag string, tree *model.GitHubTreeResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok {
+		if len(c.order) >= c.maxEntries {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+
+	c.entries[key] = cachedTree{etag: etag, tree: tree}
+}
+
+// invalidate drops the entries within a scope and returns how many it dropped.
+// An empty owner, repo or ref matches any; owner and repo match regardless of
+// case, like GitHub does.
+func (c *treeCache) invalidate(owner, repo, ref string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dropped := 0
+	c.order = slices.DeleteFunc(c.order, func(key string) bool {
+		// The ref is last since it may contain slashes itself
+		parts := strings.SplitN(key, "/", 3)
+		if len(parts) != 3 ||
+			(owner != "" && !strings.EqualFold(parts[0], owner)) ||
+			(repo != "" && !strings.EqualFold(parts[1], repo)) ||
+			(ref != "" && parts[2] != ref) {
+			return false
+		}
+		delete(c.entries, key)
+		dropped++
+		return true
+	})
+	return dropped
+}
+
+// InvalidateCache drops cached trees so the next crawl of them refetches in
+// full, for a ref that was force-pushed to an unrelated history or to test
+// against a cold cache. An empty owner clears everything; repo and ref narrow
+// the scope and need the parts before them. It returns how many trees were
+// dropped.
+func (c *Client) InvalidateCache(owner, repo, ref string) (int, error) {
+	if (repo != "" && owner == "") || (ref != "" && repo == "") {
+		return 0, errors.New("cache scope needs owner before repo and repo before ref")
+	}
+	if c.treeCache == nil {
+		return 0, nil
+	}
+	return c.treeCache.invalidate(owner, repo, ref), nil
+}
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestTreeCacheEviction(t *testing.T) {
+	cache := newTreeCache(2)
+
+	cache.put("a", `"1"`, &model.GitHubTreeResponse{SHA: "a"})
+	cache.put("b", `"2"`, &model.GitHubTreeResponse{SHA: "b"})
+	cache.put("a", `"3"`, &model.GitHubTreeResponse{SHA: "a2"}) // update keeps position
+	cache.put("c", `"4"`, &model.GitHubTreeResponse{SHA: "c"})
+
+	_, ok := cache.get("a")
+	assert.False(t, ok)
+
+	entry, ok := cache.get("b")
+	assert.True(t, ok)
+	assert.Equal(t, `"2"`, entry.etag)
+
+	entry, ok = cache.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "c", entry.tree.SHA)
+}
+
+func TestTreeCacheInvalidate(t *testing.T) {
+	tests := []struct {
+		name             string
+		owner, repo, ref string
+		dropped          int
+		left             []string
+	}{
+		{name: "everything", dropped: 4, left: []string{}},
+		{name: "owner", owner: "Owner", dropped: 3, left: []string{"other/repo/main"}},
+		{name: "repo", owner: "owner", repo: "repo", dropped: 2, left: []string{"owner/docs/main", "other/repo/main"}},
+		{name: "ref with slashes", owner: "owner", repo: "repo", ref: "feature/x", dropped: 1, left: []string{"owner/repo/main", "owner/docs/main", "other/repo/main"}},
+		{name: "nothing matches", owner: "nobody", left: []string{"owner/repo/main", "owner/repo/feature/x", "owner/docs/main", "other/repo/main"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newTreeCache(10)
+			for _, key := range []string{"owner/repo/main", "owner/repo/feature/x", "owner/docs/main", "other/repo/main"} {
+				cache.put(key, `"etag"`, &model.GitHubTreeResponse{SHA: key})
+			}
+
+			assert.Equal(t, tt.dropped, cache.invalidate(tt.owner, tt.repo, tt.ref))
+			assert.Equal(t, tt.left, cache.order)
+			assert.Len(t, cache.entries, len(tt.left))
+		})
+	}
+}
+
+func TestInvalidateCacheRefetches(t *testing.T) {
+	var full int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"tree-etag"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"tree-etag"`)
+		_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{SHA: "abc123"})
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeCacheSize:         10,
+		FetchTimeoutMS:        5000,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for range 2 {
+		_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, full, "the second fetch is revalidated")
+
+	dropped, err := client.InvalidateCache("owner", "repo", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+
+	_, err = client.GetRepositoryTree(ctx, "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, 2, full, "an invalidated tree is fetched in full")
+
+	_, err = client.InvalidateCache("", "repo", "")
+	assert.Error(t, err)
+	_, err = client.InvalidateCache("owner", "", "main")
+	assert.Error(t, err)
+}
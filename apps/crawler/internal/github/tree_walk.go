@@ -0,0 +1,175 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// treeTooLarge reports whether GitHub refused a recursive tree request because
+// the tree is too large, a 422 a directory-by-directory walk gets around.
+// Other 422s, such as for a ref naming no commit, would fail the walk too.
+func treeTooLarge(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity &&
+		strings.Contains(strings.ToLower(apiErr.message()), "too large")
+}
+
+// treeDir is a directory still to be listed by a tree walk
+type treeDir struct {
+	path string
+	sha  string
+}
+
+// treeWalk gathers the entries of a tree walk, listing no more than limit
+// files when limit is set
+type treeWalk struct {
+	mu    sync.Mutex
+	tree  *model.GitHubTreeResponse
+	files int
+	limit int
+}
+
+// add records the entries of the directory at dir, with paths relative to the
+// repository root, and returns its subdirectories. Once the file limit is
+// reached the tree is marked truncated and nothing more is added.
+func (w *treeWalk) add(dir string, entries []model.TreeEntry) []treeDir {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var subdirs []treeDir
+	for _, entry := range entries {
+		if w.tree.Truncated {
+			break
+		}
+		if dir != "" {
+			entry.Path = dir + "/" + entry.Path
+		}
+		if entry.Type == "blob" {
+			if w.limit > 0 && w.files >= w.limit {
+				w.tree.Truncated = true
+				break
+			}
+			w.files++
+		}
+		if entry.Type == "tree" {
+			subdirs = append(subdirs, treeDir{path: entry.Path, sha: entry.SHA})
+		}
+		w.tree.Tree = append(w.tree.Tree, entry)
+	}
+	return subdirs
+}
+
+// walkRepositoryTree lists a repository tree one directory at a time with
+// non-recursive tree requests, at most TreeFetchConcurrency at once. Entries
+// come back in path order like a recursive listing. The walk stops once
+// MaxTreeEntries files are listed and reports the tree as truncated.
+func (c *Client) walkRepositoryTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error) {
+	root, err := c.getTreeLevel(ctx, owner, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	walk := &treeWalk{
+		tree:  &model.GitHubTreeResponse{SHA: root.SHA, URL: root.URL, Truncated: root.Truncated},
+		limit: c.config.MaxTreeEntries,
+	}
+	pending := walk.add("", root.Tree)
+
+	concurrency := max(c.config.TreeFetchConcurrency, 1)
+	for len(pending) > 0 && !walk.tree.Truncated {
+		if pending, err = c.walkTreeLevel(ctx, owner, repo, pending, walk, concurrency); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(walk.tree.Tree, func(a, b model.TreeEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return walk.tree, nil
+}
+
+// walkTreeLevel lists dirs, concurrency at a time, and returns their
+// subdirectories. The first failure cancels the rest of the level.
+func (c *Client) walkTreeLevel(ctx context.Context, owner, repo string, dirs []treeDir, walk *treeWalk, concurrency int) ([]treeDir, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		next     []treeDir
+		firstErr error
+		slots    = make(chan struct{}, concurrency)
+	)
+	for _, dir := range dirs {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			level, err := c.getTreeLevel(ctx, owner, repo, dir.sha)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to list %s: %w", dir.path, err)
+				}
+				mu.Unlock()
+				cancel()
+				return
+			}
+
+			subdirs := walk.add(dir.path, level.Tree)
+			mu.Lock()
+			next = append(next, subdirs...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return next, ctx.Err()
+}
+
+// getTreeLevel fetches a single tree without its subtrees; a listing costs as
+// little quota as a content request
+func (c *Client) getTreeLevel(ctx context.Context, owner, repo, sha string) (*model.GitHubTreeResponse, error) {
+	if err := c.waitForRateLimit(ctx, c.config.ContentRequestCost); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s", c.baseURL, owner, repo, sha)
+
+	var treeResp *model.GitHubTreeResponse
+	err := c.makeRequestWithRetry(ctx, "get_tree_level", "GET", url, nil, func(resp *http.Response) error {
+		c.metrics.RecordGitHubAPICall("get_tree_level", strconv.Itoa(resp.StatusCode))
+
+		if resp.StatusCode != http.StatusOK {
+			return newAPIError(resp)
+		}
+
+		return json.NewDecoder(resp.Body).Decode(&treeResp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return treeResp, nil
+}
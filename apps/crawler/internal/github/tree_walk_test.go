@@ -0,0 +1,143 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// newTreeWalkServer serves a repository whose recursive tree is refused as
+// too large, with its directories listed by SHA
+func newTreeWalkServer(t *testing.T, levels map[string][]model.TreeEntry) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("recursive") == "1" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message":"The tree is too large to list recursively"}`))
+			return
+		}
+
+		sha := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		entries, ok := levels[sha]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{SHA: sha, Tree: entries})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTreeWalkClient(t *testing.T, baseURL string, maxTreeEntries int) *Client {
+	t.Helper()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         baseURL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		ContentRequestCost:    1,
+		FetchTimeoutMS:        5000,
+		RetryMaxAttempts:      1,
+		MaxTreeEntries:        maxTreeEntries,
+		TreeFetchConcurrency:  2,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	return client
+}
+
+var walkLevels = map[string][]model.TreeEntry{
+	"main": {
+		{Path: "README.md", Type: "blob", SHA: "readme", Size: 10},
+		{Path: "src", Type: "tree", SHA: "src"},
+		{Path: "docs", Type: "tree", SHA: "docs"},
+	},
+	"src": {
+		{Path: "main.go", Type: "blob", SHA: "main", Size: 20},
+		{Path: "util", Type: "tree", SHA: "util"},
+	},
+	"util": {
+		{Path: "util.go", Type: "blob", SHA: "util-go", Size: 30},
+	},
+	"docs": {
+		{Path: "guide.md", Type: "blob", SHA: "guide", Size: 40},
+	},
+}
+
+func TestGetRepositoryTreeWalksTooLargeTree(t *testing.T) {
+	server := newTreeWalkServer(t, walkLevels)
+	client := newTreeWalkClient(t, server.URL, 0)
+
+	tree, err := client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+
+	assert.Equal(t, "main", tree.SHA)
+	assert.False(t, tree.Truncated)
+	var paths []string
+	for _, entry := range tree.Tree {
+		paths = append(paths, entry.Path)
+	}
+	assert.Equal(t, []string{"README.md", "docs", "docs/guide.md", "src", "src/main.go", "src/util", "src/util/util.go"}, paths)
+}
+
+func TestGetRepositoryTreeWalkStopsAtMaxTreeEntries(t *testing.T) {
+	server := newTreeWalkServer(t, walkLevels)
+	client := newTreeWalkClient(t, server.URL, 2)
+
+	tree, err := client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+
+	assert.True(t, tree.Truncated)
+	files := 0
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" {
+			files++
+		}
+	}
+	assert.Equal(t, 2, files)
+}
+
+func TestGetRepositoryTreeWalkFailureKeepsOriginalError(t *testing.T) {
+	// The src directory can't be listed either
+	levels := map[string][]model.TreeEntry{"main": walkLevels["main"], "docs": walkLevels["docs"]}
+	server := newTreeWalkServer(t, levels)
+	client := newTreeWalkClient(t, server.URL, 0)
+
+	_, err := client.GetRepositoryTree(context.Background(), "owner", "repo", "main")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnprocessable)
+	assert.Contains(t, err.Error(), "too large")
+}
+
+func TestTreeTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"too large", &APIError{StatusCode: http.StatusUnprocessableEntity, Body: `{"message":"Tree is too large"}`}, true},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, false},
+		{"unknown ref", &APIError{StatusCode: http.StatusUnprocessableEntity, Body: `{"message":"No commit found for SHA: nope"}`}, false},
+		{"not found", &APIError{StatusCode: http.StatusNotFound}, false},
+		{"network", context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, treeTooLarge(tt.err))
+		})
+	}
+}
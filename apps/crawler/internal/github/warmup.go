@@ -0,0 +1,105 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warmRateLimiter seeds the limiter and rate limit metrics from the token's
+// actual quota, which other systems sharing the token may have partly spent.
+// The limiter starts with a full burst of APIRateLimitThreshold tokens; when
+// less than that remains (beyond RateLimitReserve), the excess is drained so
+// the first burst can't overrun the quota, and with nothing left requests
+// pause until the reset.
+func (c *Client) warmRateLimiter(ctx context.Context) error {
+	info, err := c.GetRateLimit(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.metrics.UpdateGitHubRateLimit(info.Limit-info.Remaining, info.Limit)
+
+	available := info.Remaining - c.config.RateLimitReserve
+	if available <= 0 {
+		if info.Reset.After(time.Now()) {
+			c.pauseUntil(info.Reset, fmt.Sprintf("GitHub quota at %d of %d at startup", info.Remaining, info.Limit))
+		}
+		return nil
+	}
+
+	if burst := c.rateLimiter.Burst(); available < burst {
+		c.rateLimiter.AllowN(time.Now(), burst-available)
+		log.Printf("GitHub quota at %d of %d at startup, limiting the initial burst to %d requests",
+			info.Remaining, info.Limit, available)
+	}
+
+	return nil
+}
+
+// warmTarget is a cheap request that opens a connection to one host
+type warmTarget struct {
+	method string
+	url    string
+	auth   bool
+}
+
+// warmConnections opens n connections to both the API and the raw content
+// host, so the first crawl doesn't pay for DNS lookups and TLS handshakes.
+// The requests are sent together, since sequential ones would reuse the
+// first connection; over HTTP/2 they share one, which is all that's needed.
+func (c *Client) warmConnections(ctx context.Context, n int) error {
+	// rate_limit requests don't count against the quota, and the raw host
+	// answers a HEAD of its root without credentials
+	targets := []warmTarget{
+		{method: http.MethodGet, url: c.baseURL + "/rate_limit", auth: true},
+		{method: http.MethodHead, url: c.rawBaseURL + "/"},
+	}
+
+	var (
+		wg      sync.WaitGroup
+		failed  atomic.Int64
+		lastErr atomic.Value
+	)
+	for i := range n * len(targets) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.warmConnection(ctx, targets[i%len(targets)]); err != nil {
+				failed.Add(1)
+				lastErr.Store(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d of %d warm-up requests failed: %w", failed.Load(), n*len(targets), lastErr.Load().(error))
+	}
+	return nil
+}
+
+// warmConnection sends target and drains the response so its connection
+// returns to the idle pool
+func (c *Client) warmConnection(ctx context.Context, target warmTarget) error {
+	req, err := http.NewRequestWithContext(ctx, target.method, target.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if target.auth {
+		c.setHeaders(req)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,171 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+)
+
+func newRateLimitServer(t *testing.T, remaining int, reset time.Time) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rate_limit", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"resources":{"core":{"limit":5000,"remaining":%d,"reset":%d}}}`, remaining, reset.Unix())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWarmRateLimiter(t *testing.T) {
+	tests := []struct {
+		name       string
+		remaining  int
+		reserve    int
+		wantTokens float64
+		wantPaused bool
+	}{
+		{name: "plenty remaining", remaining: 4000, wantTokens: 100},
+		{name: "less than a burst", remaining: 30, wantTokens: 30},
+		{name: "reserve counted", remaining: 30, reserve: 10, wantTokens: 20},
+		{name: "exhausted", remaining: 5, reserve: 10, wantTokens: 100, wantPaused: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset := time.Now().Add(time.Hour)
+			server := newRateLimitServer(t, tt.remaining, reset)
+
+			cfg := &config.Config{
+				GitHubToken:           "test-token",
+				GitHubBaseURL:         server.URL,
+				APIRateLimitThreshold: 100,
+				FetchTimeoutMS:        30000,
+				RateLimitReserve:      tt.reserve,
+				WarmRateLimiter:       true,
+			}
+			m := metrics.NewForTesting()
+			client, err := NewClient(cfg, m)
+			require.NoError(t, err)
+
+			assert.InDelta(t, tt.wantTokens, client.rateLimiter.Tokens(), 1)
+			assert.Equal(t, float64(5000), testutil.ToFloat64(m.GitHubRateLimitLimit))
+
+			client.reserveMu.Lock()
+			pausedUntil := client.pausedUntil
+			client.reserveMu.Unlock()
+			if tt.wantPaused {
+				assert.Equal(t, reset.Unix(), pausedUntil.Unix())
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubReservePaused))
+			} else {
+				assert.True(t, pausedUntil.IsZero())
+			}
+		})
+	}
+}
+
+func TestWarmRateLimiterFailureIsNotFatal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 100,
+		FetchTimeoutMS:        30000,
+		WarmRateLimiter:       true,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	assert.InDelta(t, 100, client.rateLimiter.Tokens(), 1)
+}
+
+func TestWarmConnections(t *testing.T) {
+	const n = 3
+
+	var (
+		mu        sync.Mutex
+		requests  []string
+		newConns  atomic.Int64
+		arrived   atomic.Int64
+		allArrive = make(chan struct{})
+	)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, fmt.Sprintf("%s %s %t", r.Method, r.URL.Path, r.Header.Get("Authorization") != ""))
+		mu.Unlock()
+
+		// Hold every response until all are in flight, so none reuses another's connection
+		if arrived.Add(1) == 2*n {
+			close(allArrive)
+		}
+		select {
+		case <-allArrive:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		GitHubToken:          "test-token",
+		GitHubBaseURL:        server.URL,
+		FetchTimeoutMS:       5000,
+		MaxConcurrentFetches: 2 * n,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	client.rawBaseURL = server.URL
+
+	require.NoError(t, client.warmConnections(context.Background(), n))
+	assert.Equal(t, int64(2*n), newConns.Load())
+	mu.Lock()
+	assert.ElementsMatch(t, []string{
+		"GET /rate_limit true", "GET /rate_limit true", "GET /rate_limit true",
+		"HEAD / false", "HEAD / false", "HEAD / false",
+	}, requests)
+	mu.Unlock()
+
+	// The warmed connections were left idle for the next requests
+	require.NoError(t, client.warmConnections(context.Background(), n))
+	assert.Equal(t, int64(2*n), newConns.Load())
+}
+
+func TestWarmConnectionsReportsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		GitHubToken:    "test-token",
+		GitHubBaseURL:  server.URL,
+		FetchTimeoutMS: 5000,
+	}
+	client, err := NewClient(cfg, metrics.NewForTesting())
+	require.NoError(t, err)
+	client.rawBaseURL = "http://127.0.0.1:0"
+
+	err = client.warmConnections(context.Background(), 2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 of 4 warm-up requests failed")
+}
@@ -1,10 +1,14 @@
 package metrics
 
 import (
-	"sync"
+	"fmt"
+	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // Metrics holds all the Prometheus metrics for the crawler service
@@ -16,48 +20,134 @@ type Metrics struct {
 	// Crawler metrics
 	FilesRequestedTotal *prometheus.CounterVec
 	FilesProcessedTotal *prometheus.CounterVec
+	FilesFilteredTotal  *prometheus.CounterVec
 	ErrorsTotal         *prometheus.CounterVec
 	ConcurrencyInUse    prometheus.Gauge
 
 	// GitHub API metrics
-	GitHubAPICallsTotal  *prometheus.CounterVec
-	GitHubRateLimitUsed  prometheus.Gauge
-	GitHubRateLimitLimit prometheus.Gauge
+	GitHubAPICallsTotal   *prometheus.CounterVec
+	GitHubRateLimitUsed   prometheus.Gauge
+	GitHubRateLimitLimit  prometheus.Gauge
+	GitHubHTTPProtocol    *prometheus.GaugeVec
+	GitHubNotModified     *prometheus.CounterVec
+	GitHubRequestDuration *prometheus.HistogramVec // upstream round trip, excluding our processing
+	GitHubReservePaused   prometheus.Gauge         // 1 while requests wait for the quota to reset
+	GitHubQuotaExhausted  prometheus.Gauge         // 1 while no quota above the reserve is left
+	GitHubRateTarget      prometheus.Gauge         // rate that spends the remaining quota evenly until reset
+	GitHubRateLimit       prometheus.Gauge         // rate the adaptive limiter currently allows
+
+	// GitHub App installation token metrics
+	GitHubTokenRefreshTotal  *prometheus.CounterVec // token refreshes by result: success or failure
+	GitHubTokenExpirySeconds prometheus.Gauge       // seconds until the current installation token expires
 
 	// Worker pool metrics
-	WorkerPoolSize prometheus.Gauge
-	QueueDepth     prometheus.Gauge
-	TaskDuration   *prometheus.HistogramVec
+	WorkerPoolSize    prometheus.Gauge
+	QueueDepth        prometheus.Gauge
+	TaskDuration      *prometheus.HistogramVec
+	TasksDroppedTotal *prometheus.CounterVec
+
+	// CrawlGitHubRequests is the GitHub requests each crawl made, retries and
+	// fallbacks included, for attributing quota to crawls
+	CrawlGitHubRequests prometheus.Histogram
+
+	// Result channel metrics
+	ResultChannelOccupancy prometheus.Gauge
+	ResultsSpilledTotal    prometheus.Counter
+
+	// Content fetch efficiency; requests per file is ContentRequestsTotal / ContentFilesTotal
+	ContentRequestsTotal *prometheus.CounterVec
+	ContentFilesTotal    *prometheus.CounterVec
+	ContentReadsTotal    *prometheus.CounterVec // per-file reads by result: full or truncated at the byte limit
+	MirrorRequestsTotal  *prometheus.CounterVec // raw mirror lookups by result: hit, miss or error
+	StalledTransfers     *prometheus.CounterVec // requests aborted for stalling, by phase: headers or body
+	ContentBytesTotal    *prometheus.CounterVec // raw content bytes by stage: wire as received, decoded after decompression
+	IdempotentCrawls     *prometheus.CounterVec // crawls with an idempotency key by result: new, in_flight or cached
 
 	// Resource metrics
 	FileSizeBytes *prometheus.HistogramVec
 
-	// registry for testing
-	registry prometheus.Registerer
+	// registry the metrics are registered with and gathered from
+	registry *prometheus.Registry
 }
 
-var (
-	globalMetrics *Metrics
-	metricsOnce   sync.Once
-)
-
-// New creates and registers all Prometheus metrics
+// New creates all Prometheus metrics in a registry of their own, along with
+// the Go runtime and process collectors. Every call returns an independent
+// set, so several instances can live in one process; serve each from its
+// Handler rather than the default registry.
 func New() *Metrics {
-	metricsOnce.Do(func() {
-		globalMetrics = newMetrics(prometheus.DefaultRegisterer)
-	})
-	return globalMetrics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return mustNewMetrics(registry)
 }
 
 // NewForTesting creates metrics with a custom registry for testing
 func NewForTesting() *Metrics {
-	return newMetrics(prometheus.NewRegistry())
+	return mustNewMetrics(prometheus.NewRegistry())
+}
+
+// NewWithRegistry creates all Prometheus metrics in registry, for a service
+// that exposes them alongside its own. It returns an error instead of
+// panicking when registry already holds any of them, such as from another
+// NewWithRegistry call, and registers none in that case.
+func NewWithRegistry(registry *prometheus.Registry) (*Metrics, error) {
+	var pending pendingCollectors
+	m := newMetrics(promauto.With(&pending))
+	if err := pending.registerWith(registry); err != nil {
+		return nil, fmt.Errorf("failed to register metrics: %w", err)
+	}
+	m.registry = registry
+	return m, nil
 }
 
-// newMetrics creates metrics with the specified registerer
-func newMetrics(registerer prometheus.Registerer) *Metrics {
-	factory := promauto.With(registerer)
+// mustNewMetrics creates metrics in a registry known to be empty
+func mustNewMetrics(registry *prometheus.Registry) *Metrics {
+	m, err := NewWithRegistry(registry)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// pendingCollectors is a Registerer that only remembers collectors, so they
+// can be registered together and the first conflict reported as an error
+type pendingCollectors struct {
+	collectors []prometheus.Collector
+}
 
+func (p *pendingCollectors) Register(c prometheus.Collector) error {
+	p.collectors = append(p.collectors, c)
+	return nil
+}
+
+func (p *pendingCollectors) MustRegister(cs ...prometheus.Collector) {
+	p.collectors = append(p.collectors, cs...)
+}
+
+func (p *pendingCollectors) Unregister(prometheus.Collector) bool {
+	return false
+}
+
+// registerWith registers every pending collector with registry, rolling back
+// those already registered if one fails
+func (p *pendingCollectors) registerWith(registry *prometheus.Registry) error {
+	for i, c := range p.collectors {
+		if err := registry.Register(c); err != nil {
+			for _, registered := range p.collectors[:i] {
+				registry.Unregister(registered)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// newMetrics creates the metrics through factory
+func newMetrics(factory promauto.Factory) *Metrics {
 	return &Metrics{
 		HTTPRequestsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
@@ -92,6 +182,14 @@ func newMetrics(registerer prometheus.Registerer) *Metrics {
 			[]string{"repo_owner", "repo_name", "status"},
 		),
 
+		FilesFilteredTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_files_filtered_total",
+				Help: "Total number of tree entries filtered out before fetching, by reason",
+			},
+			[]string{"reason"},
+		),
+
 		ErrorsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "crawler_errors_total",
@@ -129,6 +227,74 @@ func newMetrics(registerer prometheus.Registerer) *Metrics {
 			},
 		),
 
+		GitHubHTTPProtocol: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "crawler_github_http_protocol",
+				Help: "HTTP protocol negotiated with the GitHub API (1 for the protocol in use)",
+			},
+			[]string{"protocol"},
+		),
+
+		GitHubNotModified: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_github_not_modified_total",
+				Help: "Total number of GitHub responses served from cache after a 304 Not Modified",
+			},
+			[]string{"endpoint"},
+		),
+
+		GitHubRequestDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "crawler_github_request_duration_seconds",
+				Help:    "Round-trip latency of GitHub HTTP requests until response headers arrive",
+				Buckets: []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+			},
+			[]string{"endpoint"},
+		),
+
+		GitHubReservePaused: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "crawler_github_rate_limit_reserve_paused",
+				Help: "1 while GitHub requests are paused because the remaining quota fell below RATE_LIMIT_RESERVE",
+			},
+		),
+
+		GitHubQuotaExhausted: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "crawler_github_rate_limit_exhausted",
+				Help: "1 while the GitHub quota above RATE_LIMIT_RESERVE is used up, until it resets",
+			},
+		),
+
+		GitHubRateTarget: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "crawler_github_rate_target_per_second",
+				Help: "Requests per second that would spend the remaining GitHub quota evenly until it resets",
+			},
+		),
+
+		GitHubRateLimit: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "crawler_github_rate_limit_per_second",
+				Help: "Requests per second the adaptive rate limiter currently allows",
+			},
+		),
+
+		GitHubTokenRefreshTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_github_token_refresh_total",
+				Help: "Total number of GitHub App installation token refreshes by result",
+			},
+			[]string{"result"},
+		),
+
+		GitHubTokenExpirySeconds: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "crawler_github_token_expiry_seconds",
+				Help: "Seconds until the GitHub App installation token in use expires, as of the last request",
+			},
+		),
+
 		WorkerPoolSize: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "crawler_worker_pool_size",
@@ -152,6 +318,92 @@ func newMetrics(registerer prometheus.Registerer) *Metrics {
 			[]string{"task_type"},
 		),
 
+		CrawlGitHubRequests: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "crawler_crawl_github_requests",
+				Help:    "GitHub requests made per crawl, including retries and fallbacks",
+				Buckets: prometheus.ExponentialBuckets(1, 4, 10), // 1 to 262144
+			},
+		),
+
+		ContentRequestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_content_requests_total",
+				Help: "Total number of HTTP requests issued to fetch file content, by fetch mode",
+			},
+			[]string{"mode"},
+		),
+
+		ContentFilesTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_content_files_total",
+				Help: "Total number of files whose content was fetched, by fetch mode",
+			},
+			[]string{"mode"},
+		),
+
+		ContentReadsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_content_reads_total",
+				Help: "Total number of per-file content reads, by whether the file was read in full or cut at the byte limit",
+			},
+			[]string{"result"},
+		),
+
+		MirrorRequestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_mirror_requests_total",
+				Help: "Total number of raw content mirror lookups, by whether the mirror served the file, missed it or failed",
+			},
+			[]string{"result"},
+		),
+
+		StalledTransfers: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_stalled_transfers_total",
+				Help: "Total number of GitHub requests aborted because the response headers or body stalled",
+			},
+			[]string{"phase"},
+		),
+
+		ContentBytesTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_content_bytes_total",
+				Help: "Total raw content bytes read, by stage: as received on the wire, or decoded after any decompression",
+			},
+			[]string{"stage"},
+		),
+
+		IdempotentCrawls: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_idempotent_crawls_total",
+				Help: "Total number of crawls requested with an idempotency key, by whether they started, joined a running crawl or were served a cached result",
+			},
+			[]string{"result"},
+		),
+
+		TasksDroppedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "crawler_tasks_dropped_total",
+				Help: "Total number of crawl tasks dropped because the crawl ran out of time waiting for room in the task queue",
+			},
+			[]string{"repo_owner", "repo_name"},
+		),
+
+		ResultChannelOccupancy: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "crawler_result_channel_occupancy",
+				Help: "Number of results waiting in the result channel",
+			},
+		),
+
+		ResultsSpilledTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "crawler_results_spilled_total",
+				Help: "Total number of results spilled to disk because the result channel was full",
+			},
+		),
+
 		FileSizeBytes: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "crawler_file_size_bytes",
@@ -160,8 +412,6 @@ func newMetrics(registerer prometheus.Registerer) *Metrics {
 			},
 			[]string{"repo_owner", "repo_name"},
 		),
-
-		registry: registerer,
 	}
 }
 
@@ -185,6 +435,11 @@ func (m *Metrics) RecordFileProcessed(repoOwner, repoName, status string) {
 	m.FilesProcessedTotal.WithLabelValues(repoOwner, repoName, status).Inc()
 }
 
+// RecordFileFiltered records a file filtered out before fetching
+func (m *Metrics) RecordFileFiltered(reason string) {
+	m.FilesFilteredTotal.WithLabelValues(reason).Inc()
+}
+
 // RecordError records an error
 func (m *Metrics) RecordError(errorType, repoOwner, repoName string) {
 	m.ErrorsTotal.WithLabelValues(errorType, repoOwner, repoName).Inc()
@@ -206,6 +461,58 @@ func (m *Metrics) UpdateGitHubRateLimit(used, limit int) {
 	m.GitHubRateLimitLimit.Set(float64(limit))
 }
 
+// SetGitHubHTTPProtocol records the protocol negotiated with the GitHub API
+func (m *Metrics) SetGitHubHTTPProtocol(protocol string) {
+	m.GitHubHTTPProtocol.Reset()
+	m.GitHubHTTPProtocol.WithLabelValues(protocol).Set(1)
+}
+
+// RecordNotModified records a 304 Not Modified response served from cache
+func (m *Metrics) RecordNotModified(endpoint string) {
+	m.GitHubNotModified.WithLabelValues(endpoint).Inc()
+}
+
+// RecordGitHubRequestDuration records the latency of a single GitHub HTTP request
+func (m *Metrics) RecordGitHubRequestDuration(endpoint string, duration float64) {
+	m.GitHubRequestDuration.WithLabelValues(endpoint).Observe(duration)
+}
+
+// SetRateLimitReservePaused records whether requests are paused to protect the rate limit reserve
+func (m *Metrics) SetRateLimitReservePaused(paused bool) {
+	if paused {
+		m.GitHubReservePaused.Set(1)
+	} else {
+		m.GitHubReservePaused.Set(0)
+	}
+}
+
+// SetRateLimitExhausted records whether the GitHub quota is used up until reset
+func (m *Metrics) SetRateLimitExhausted(exhausted bool) {
+	if exhausted {
+		m.GitHubQuotaExhausted.Set(1)
+	} else {
+		m.GitHubQuotaExhausted.Set(0)
+	}
+}
+
+// SetAdaptiveRate records the adaptive limiter's target rate and the rate it
+// currently allows, in requests per second
+func (m *Metrics) SetAdaptiveRate(target, current float64) {
+	m.GitHubRateTarget.Set(target)
+	m.GitHubRateLimit.Set(current)
+}
+
+// RecordTokenRefresh records a GitHub App installation token refresh by
+// result: success or failure
+func (m *Metrics) RecordTokenRefresh(result string) {
+	m.GitHubTokenRefreshTotal.WithLabelValues(result).Inc()
+}
+
+// SetTokenExpiry records how long the current installation token has left
+func (m *Metrics) SetTokenExpiry(seconds float64) {
+	m.GitHubTokenExpirySeconds.Set(seconds)
+}
+
 // SetWorkerPoolSize sets the worker pool size
 func (m *Metrics) SetWorkerPoolSize(size float64) {
 	m.WorkerPoolSize.Set(size)
@@ -221,7 +528,136 @@ func (m *Metrics) RecordTaskDuration(taskType string, duration float64) {
 	m.TaskDuration.WithLabelValues(taskType).Observe(duration)
 }
 
+// RecordTaskDropped records a task dropped because the task queue was full
+func (m *Metrics) RecordTaskDropped(repoOwner, repoName string) {
+	m.TasksDroppedTotal.WithLabelValues(repoOwner, repoName).Inc()
+}
+
+// RecordCrawlGitHubRequests records the GitHub requests a crawl made
+func (m *Metrics) RecordCrawlGitHubRequests(requests int64) {
+	m.CrawlGitHubRequests.Observe(float64(requests))
+}
+
+// SetResultChannelOccupancy sets the number of results waiting in the result channel
+func (m *Metrics) SetResultChannelOccupancy(count float64) {
+	m.ResultChannelOccupancy.Set(count)
+}
+
+// RecordResultSpilled records a result spilled to disk
+func (m *Metrics) RecordResultSpilled() {
+	m.ResultsSpilledTotal.Inc()
+}
+
+// RecordContentFetch records the requests spent fetching content for a number of files
+func (m *Metrics) RecordContentFetch(mode string, requests, files int) {
+	m.ContentRequestsTotal.WithLabelValues(mode).Add(float64(requests))
+	m.ContentFilesTotal.WithLabelValues(mode).Add(float64(files))
+}
+
+// RecordContentRead records whether a file's content was read in full or truncated
+func (m *Metrics) RecordContentRead(result string) {
+	m.ContentReadsTotal.WithLabelValues(result).Inc()
+}
+
+// RecordMirrorRequest records the result of a raw content mirror lookup
+func (m *Metrics) RecordMirrorRequest(result string) {
+	m.MirrorRequestsTotal.WithLabelValues(result).Inc()
+}
+
+// RecordContentBytes records the bytes of a raw content response as received
+// and after decoding, which differ only when it was compressed
+func (m *Metrics) RecordContentBytes(wire, decoded int) {
+	m.ContentBytesTotal.WithLabelValues("wire").Add(float64(wire))
+	m.ContentBytesTotal.WithLabelValues("decoded").Add(float64(decoded))
+}
+
+// RecordIdempotentCrawl records how a crawl with an idempotency key was served
+func (m *Metrics) RecordIdempotentCrawl(result string) {
+	m.IdempotentCrawls.WithLabelValues(result).Inc()
+}
+
+// RecordStalledTransfer records a request aborted because its response
+// headers or body stopped arriving
+func (m *Metrics) RecordStalledTransfer(phase string) {
+	m.StalledTransfers.WithLabelValues(phase).Inc()
+}
+
 // RecordFileSize records the size of a processed file
 func (m *Metrics) RecordFileSize(repoOwner, repoName string, sizeBytes float64) {
 	m.FileSizeBytes.WithLabelValues(repoOwner, repoName).Observe(sizeBytes)
 }
+
+// Snapshot is a curated subset of current metric values for deployments
+// without a Prometheus scraper
+type Snapshot struct {
+	FilesProcessed     map[string]float64 `json:"files_processed"` // by status
+	Errors             map[string]float64 `json:"errors"`          // by error type
+	RateLimitRemaining float64            `json:"rate_limit_remaining"`
+	RateLimitLimit     float64            `json:"rate_limit_limit"`
+	QueueDepth         float64            `json:"queue_depth"`
+	WorkerPoolSize     float64            `json:"worker_pool_size"`
+	TasksDropped       float64            `json:"tasks_dropped"`
+}
+
+// Snapshot gathers the current values of the curated metrics from the registry
+func (m *Metrics) Snapshot() (*Snapshot, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	snapshot := &Snapshot{
+		FilesProcessed: make(map[string]float64),
+		Errors:         make(map[string]float64),
+	}
+
+	for _, family := range families {
+		switch family.GetName() {
+		case "crawler_files_processed_total":
+			sumByLabel(family, "status", snapshot.FilesProcessed)
+		case "crawler_errors_total":
+			sumByLabel(family, "type", snapshot.Errors)
+		case "crawler_github_rate_limit_used":
+			// Despite the name, this gauge holds the remaining quota
+			snapshot.RateLimitRemaining = metricValue(family)
+		case "crawler_github_rate_limit_limit":
+			snapshot.RateLimitLimit = metricValue(family)
+		case "crawler_queue_depth":
+			snapshot.QueueDepth = metricValue(family)
+		case "crawler_worker_pool_size":
+			snapshot.WorkerPoolSize = metricValue(family)
+		case "crawler_tasks_dropped_total":
+			snapshot.TasksDropped = metricValue(family)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// sumByLabel adds each sample in family to totals, keyed by the given label
+func sumByLabel(family *dto.MetricFamily, label string, totals map[string]float64) {
+	for _, metric := range family.GetMetric() {
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == label {
+				totals[pair.GetValue()] += sampleValue(metric)
+			}
+		}
+	}
+}
+
+// metricValue returns the sum of all samples in a counter or gauge family
+func metricValue(family *dto.MetricFamily) float64 {
+	var total float64
+	for _, metric := range family.GetMetric() {
+		total += sampleValue(metric)
+	}
+	return total
+}
+
+// sampleValue returns the value of a counter or gauge sample
+func sampleValue(metric *dto.Metric) float64 {
+	if metric.GetCounter() != nil {
+		return metric.GetCounter().GetValue()
+	}
+	return metric.GetGauge().GetValue()
+}
@@ -1,10 +1,16 @@
 package metrics
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNew(t *testing.T) {
@@ -23,6 +29,25 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, m.QueueDepth)
 	assert.NotNil(t, m.TaskDuration)
 	assert.NotNil(t, m.FileSizeBytes)
+	assert.NotNil(t, m.ContentRequestsTotal)
+	assert.NotNil(t, m.ContentFilesTotal)
+	assert.NotNil(t, m.TasksDroppedTotal)
+	assert.NotNil(t, m.ResultChannelOccupancy)
+	assert.NotNil(t, m.GitHubNotModified)
+	assert.NotNil(t, m.GitHubRequestDuration)
+	assert.NotNil(t, m.GitHubReservePaused)
+	assert.NotNil(t, m.GitHubQuotaExhausted)
+	assert.NotNil(t, m.ContentReadsTotal)
+	assert.NotNil(t, m.MirrorRequestsTotal)
+	assert.NotNil(t, m.StalledTransfers)
+	assert.NotNil(t, m.ContentBytesTotal)
+	assert.NotNil(t, m.IdempotentCrawls)
+	assert.NotNil(t, m.GitHubTokenRefreshTotal)
+	assert.NotNil(t, m.GitHubRateTarget)
+	assert.NotNil(t, m.GitHubRateLimit)
+	assert.NotNil(t, m.GitHubTokenExpirySeconds)
+	assert.NotNil(t, m.FilesFilteredTotal)
+	assert.NotNil(t, m.ResultsSpilledTotal)
 }
 
 func TestRecordHTTPRequest(t *testing.T) {
@@ -73,6 +98,15 @@ func TestRecordFileProcessed(t *testing.T) {
 	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner1", "repo1", "failed")))
 }
 
+func TestRecordFileFiltered(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordFileFiltered("path_depth")
+	m.RecordFileFiltered("path_depth")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("path_depth")))
+}
+
 func TestRecordError(t *testing.T) {
 	m := NewForTesting()
 
@@ -118,6 +152,35 @@ func TestUpdateGitHubRateLimit(t *testing.T) {
 	assert.Equal(t, float64(5000), testutil.ToFloat64(m.GitHubRateLimitLimit))
 }
 
+func TestSetGitHubHTTPProtocol(t *testing.T) {
+	m := NewForTesting()
+
+	m.SetGitHubHTTPProtocol("HTTP/1.1")
+	m.SetGitHubHTTPProtocol("HTTP/2.0")
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubHTTPProtocol.WithLabelValues("HTTP/2.0")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.GitHubHTTPProtocol))
+}
+
+func TestRecordNotModified(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordNotModified("get_tree")
+	m.RecordNotModified("get_tree")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.GitHubNotModified.WithLabelValues("get_tree")))
+}
+
+func TestRecordGitHubRequestDuration(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordGitHubRequestDuration("get_tree", 0.2)
+	m.RecordGitHubRequestDuration("get_tree", 0.4)
+	m.RecordGitHubRequestDuration("get_raw_content", 0.05)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.GitHubRequestDuration))
+}
+
 func TestSetWorkerPoolSize(t *testing.T) {
 	m := NewForTesting()
 
@@ -161,3 +224,202 @@ func TestRecordFileSize(t *testing.T) {
 	// Just verify the method works without error
 	assert.NotNil(t, m.FileSizeBytes)
 }
+
+func TestRecordTaskDropped(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordTaskDropped("owner1", "repo1")
+	m.RecordTaskDropped("owner1", "repo1")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.TasksDroppedTotal.WithLabelValues("owner1", "repo1")))
+}
+
+func TestResultChannelMetrics(t *testing.T) {
+	m := NewForTesting()
+
+	m.SetResultChannelOccupancy(42.0)
+	m.RecordResultSpilled()
+	m.RecordResultSpilled()
+
+	assert.Equal(t, float64(42), testutil.ToFloat64(m.ResultChannelOccupancy))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.ResultsSpilledTotal))
+}
+
+func TestRecordContentFetch(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordContentFetch("per_file", 2, 1) // raw miss plus API fallback
+	m.RecordContentFetch("per_file", 1, 1)
+	m.RecordContentFetch("blob_batch", 20, 20)
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.ContentRequestsTotal.WithLabelValues("per_file")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.ContentFilesTotal.WithLabelValues("per_file")))
+	assert.Equal(t, float64(20), testutil.ToFloat64(m.ContentRequestsTotal.WithLabelValues("blob_batch")))
+	assert.Equal(t, float64(20), testutil.ToFloat64(m.ContentFilesTotal.WithLabelValues("blob_batch")))
+}
+
+func TestNewInstancesAreIndependent(t *testing.T) {
+	var instances [4]*Metrics
+	var wg sync.WaitGroup
+	for i := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instances[i] = New()
+		}()
+	}
+	wg.Wait()
+
+	first, second := instances[0], instances[1]
+	first.RecordFileProcessed("owner", "repo", "success")
+	assert.Equal(t, float64(1), testutil.ToFloat64(first.FilesProcessedTotal.WithLabelValues("owner", "repo", "success")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(second.FilesProcessedTotal.WithLabelValues("owner", "repo", "success")))
+
+	recorder := httptest.NewRecorder()
+	first.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Contains(t, body, `crawler_files_processed_total{repo_name="repo",repo_owner="owner",status="success"} 1`)
+	assert.Contains(t, body, "go_goroutines", "runtime collectors are included")
+}
+
+func TestNewWithRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := NewWithRegistry(registry)
+	require.NoError(t, err)
+	m.SetQueueDepth(3)
+
+	_, err = NewWithRegistry(registry)
+	require.Error(t, err, "registering twice fails instead of panicking")
+	assert.Contains(t, err.Error(), "duplicate metrics collector registration")
+
+	// The failed attempt left the first set registered and untouched
+	snapshot, err := m.Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), snapshot.QueueDepth)
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP crawler_queue_depth Current depth of the task queue
+# TYPE crawler_queue_depth gauge
+crawler_queue_depth 3
+`), "crawler_queue_depth"))
+}
+
+func TestSnapshot(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordFileProcessed("owner1", "repo1", "success")
+	m.RecordFileProcessed("owner2", "repo2", "success")
+	m.RecordFileProcessed("owner1", "repo1", "error")
+	m.RecordError("fetch_error", "owner1", "repo1")
+	m.RecordError("fetch_error", "owner2", "repo2")
+	m.UpdateGitHubRateLimit(1000, 5000)
+	m.SetQueueDepth(7)
+	m.SetWorkerPoolSize(50)
+	m.RecordTaskDropped("owner1", "repo1")
+
+	snapshot, err := m.Snapshot()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]float64{"success": 2, "error": 1}, snapshot.FilesProcessed)
+	assert.Equal(t, map[string]float64{"fetch_error": 2}, snapshot.Errors)
+	assert.Equal(t, float64(4000), snapshot.RateLimitRemaining)
+	assert.Equal(t, float64(5000), snapshot.RateLimitLimit)
+	assert.Equal(t, float64(7), snapshot.QueueDepth)
+	assert.Equal(t, float64(50), snapshot.WorkerPoolSize)
+	assert.Equal(t, float64(1), snapshot.TasksDropped)
+}
+
+func TestSetRateLimitReservePaused(t *testing.T) {
+	m := NewForTesting()
+
+	m.SetRateLimitReservePaused(true)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubReservePaused))
+
+	m.SetRateLimitReservePaused(false)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.GitHubReservePaused))
+}
+
+func TestSetRateLimitExhausted(t *testing.T) {
+	m := NewForTesting()
+
+	m.SetRateLimitExhausted(true)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubQuotaExhausted))
+
+	m.SetRateLimitExhausted(false)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.GitHubQuotaExhausted))
+}
+
+func TestRecordContentRead(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordContentRead("full")
+	m.RecordContentRead("full")
+	m.RecordContentRead("truncated")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.ContentReadsTotal.WithLabelValues("full")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.ContentReadsTotal.WithLabelValues("truncated")))
+}
+
+func TestRecordStalledTransfer(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordStalledTransfer("body")
+	m.RecordStalledTransfer("headers")
+	m.RecordStalledTransfer("body")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.StalledTransfers.WithLabelValues("body")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.StalledTransfers.WithLabelValues("headers")))
+}
+
+func TestRecordContentBytes(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordContentBytes(100, 100)
+	m.RecordContentBytes(300, 1200)
+
+	assert.Equal(t, float64(400), testutil.ToFloat64(m.ContentBytesTotal.WithLabelValues("wire")))
+	assert.Equal(t, float64(1300), testutil.ToFloat64(m.ContentBytesTotal.WithLabelValues("decoded")))
+}
+
+func TestRecordIdempotentCrawl(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordIdempotentCrawl("new")
+	m.RecordIdempotentCrawl("cached")
+	m.RecordIdempotentCrawl("cached")
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.IdempotentCrawls.WithLabelValues("new")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.IdempotentCrawls.WithLabelValues("cached")))
+}
+
+func TestSetAdaptiveRate(t *testing.T) {
+	m := NewForTesting()
+
+	m.SetAdaptiveRate(2.5, 1.75)
+
+	assert.Equal(t, 2.5, testutil.ToFloat64(m.GitHubRateTarget))
+	assert.Equal(t, 1.75, testutil.ToFloat64(m.GitHubRateLimit))
+}
+
+func TestRecordTokenRefresh(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordTokenRefresh("success")
+	m.RecordTokenRefresh("failure")
+	m.RecordTokenRefresh("success")
+	m.SetTokenExpiry(3300)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.GitHubTokenRefreshTotal.WithLabelValues("success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.GitHubTokenRefreshTotal.WithLabelValues("failure")))
+	assert.Equal(t, float64(3300), testutil.ToFloat64(m.GitHubTokenExpirySeconds))
+}
+
+func TestRecordMirrorRequest(t *testing.T) {
+	m := NewForTesting()
+
+	m.RecordMirrorRequest("hit")
+	m.RecordMirrorRequest("miss")
+	m.RecordMirrorRequest("hit")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.MirrorRequestsTotal.WithLabelValues("hit")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.MirrorRequestsTotal.WithLabelValues("miss")))
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	_ "embed"
+	"slices"
+)
+
+// openAPISpec is the OpenAPI 3 document for the HTTP API. openapi_test.go
+// checks it against the request and response types, so a field added to one
+// without the other fails the tests.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPISpec returns the OpenAPI 3 document for the crawl request and
+// response models. Nothing in this module serves it; a server can serve it as
+// is.
+func OpenAPISpec() []byte {
+	return slices.Clone(openAPISpec)
+}
@@ -0,0 +1,334 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schema is the subset of OpenAPI schema objects the spec uses
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Nullable             bool               `json:"nullable"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []string           `json:"enum"`
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                    `json:"openapi"`
+	Paths      map[string]map[string]any `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) *openAPIDocument {
+	t.Helper()
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(OpenAPISpec(), &doc))
+	return &doc
+}
+
+// validate checks a decoded JSON value against a schema. Objects with listed
+// properties are closed, so a field the spec doesn't know about is an error.
+func (d *openAPIDocument) validate(s *schema, value any, at string) error {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, s.Ref)
+		}
+		return d.validate(resolved, value, at)
+	}
+
+	if value == nil {
+		if s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", at)
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: want string, got %T", at, value)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q is not one of %v", at, str, s.Enum)
+		}
+	case "integer":
+		num, ok := value.(float64)
+		if !ok || num != float64(int64(num)) {
+			return fmt.Errorf("%s: want integer, got %v", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: want boolean, got %T", at, value)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want array, got %T", at, value)
+		}
+		for i, item := range items {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want object, got %T", at, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %s", at, name)
+			}
+		}
+		for name, field := range obj {
+			var err error
+			switch {
+			case s.Properties[name] != nil:
+				err = d.validate(s.Properties[name], field, at+"."+name)
+			case s.AdditionalProperties != nil:
+				err = d.validate(s.AdditionalProperties, field, at+"."+name)
+			case len(s.Properties) > 0:
+				err = fmt.Errorf("%s: property %s is not in the spec", at, name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", at, s.Type)
+	}
+	return nil
+}
+
+// validateExample encodes v and validates it against the named schema
+func (d *openAPIDocument) validateExample(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	return d.validate(&schema{Ref: "#/components/schemas/" + name}, decoded, name)
+}
+
+func TestOpenAPISpecDocument(t *testing.T) {
+	doc := loadSpec(t)
+
+	assert.True(t, strings.HasPrefix(doc.OpenAPI, "3."))
+	for _, path := range []string{"/invoke", "/manifest", "/health", "/metrics", "/openapi.json"} {
+		assert.Contains(t, doc.Paths, path)
+	}
+
+	// Every $ref must resolve
+	var refs []string
+	var walk func(any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for key, child := range v {
+				if ref, ok := child.(string); ok && key == "$ref" {
+					refs = append(refs, ref)
+				}
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	var raw any
+	require.NoError(t, json.Unmarshal(OpenAPISpec(), &raw))
+	walk(raw)
+	require.NotEmpty(t, refs)
+	for _, ref := range refs {
+		assert.Contains(t, doc.Components.Schemas, strings.TrimPrefix(ref, "#/components/schemas/"), ref)
+	}
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	doc := loadSpec(t)
+
+	types := map[string]any{
+		"CrawlRequest":     CrawlRequest{},
+		"CrawlResponse":    CrawlResponse{},
+		"CrawlError":       CrawlError{},
+		"RepositoryInfo":   RepositoryInfo{},
+		"FileResult":       FileResult{},
+		"HealthResponse":   HealthResponse{},
+		"ValidationErrors": ValidationErrors{},
+		"FieldError":       FieldError{},
+		"ManifestResponse": ManifestResponse{},
+		"TreeEntry":        TreeEntry{},
+		"TreeNode":         TreeNode{},
+	}
+
+	for name, v := range types {
+		t.Run(name, func(t *testing.T) {
+			s := doc.Components.Schemas[name]
+			require.NotNil(t, s, "schema %s is missing", name)
+
+			var fields, required []string
+			typ := reflect.TypeOf(v)
+			for i := range typ.NumField() {
+				tag := typ.Field(i).Tag.Get("json")
+				field, opts, _ := strings.Cut(tag, ",")
+				if field == "" || field == "-" {
+					continue
+				}
+				fields = append(fields, field)
+				if !strings.Contains(opts, "omitempty") {
+					required = append(required, field)
+				}
+			}
+
+			assert.ElementsMatch(t, fields, slices.Collect(maps.Keys(s.Properties)), "properties must match the struct's JSON fields")
+			if name != "CrawlRequest" {
+				// Fields always present in responses are required
+				assert.ElementsMatch(t, required, s.Required)
+			}
+		})
+	}
+}
+
+func TestOpenAPIExamplesValidate(t *testing.T) {
+	doc := loadSpec(t)
+
+	fetchedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		schema string
+		value  any
+	}{
+		{
+			name:   "minimal request",
+			schema: "CrawlRequest",
+			value:  CrawlRequest{RepoURL: "owner/repo"},
+		},
+		{
+			name:   "full request",
+			schema: "CrawlRequest",
+			value: CrawlRequest{
+				RepoURL:           "https://github.com/owner/repo.git",
+				Ref:               "main",
+				PathFilter:        []string{"src/"},
+				OutputMode:        OutputModeReference,
+				PullRequest:       42,
+				MaxPathDepth:      3,
+				Languages:         []string{"go"},
+				Paths:             []string{"README.md"},
+				AllowedExtensions: []string{".md"},
+				Ordered:           true,
+				KnownSHAs:         map[string]string{"README.md": "abc"},
+				ResumeFrom:        "9f2c4e1a7b3d5f60",
+				IncludeTree:       true,
+			},
+		},
+		{
+			name:   "response",
+			schema: "CrawlResponse",
+			value: CrawlResponse{
+				CrawlID:        "9f2c4e1a7b3d5f60",
+				TotalFiles:     2,
+				ProcessedFiles: 1,
+				SkippedFiles:   1,
+				FilteredFiles:  3,
+				TreeFiles:      5,
+				SkipReasons:    map[string]int{SkipFiltered: 3, SkipBinary: 1},
+				Partial:        true,
+				Errors:         []CrawlError{{FilePath: "logo.png", Error: "skipping binary file", Type: SkipBinary}},
+				RootTreeSHA:    "root123",
+				Duration:       "1.5s",
+				RepoInfo:       RepositoryInfo{Owner: "owner", Name: "repo", Ref: "main"},
+				OutputMode:     OutputModeBase64Explicit,
+				Fingerprint:    "3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+				Warnings:       []string{"skipped vendor/x: unknown tree entry type \"symlink\""},
+				Files: []FileResult{
+					{Path: "main.go", Content: []byte("package main"), Encoding: "base64", SHA: "abc", Size: 12, FetchedAt: fetchedAt},
+					{Path: "logo.png", SHA: "def", Size: 8, Error: errors.New("skipping binary file"), FetchedAt: fetchedAt},
+					{Path: "old.go", SHA: "ghi", Status: "renamed", PreviousPath: "older.go", Truncated: true, OriginalSize: 99, FetchedAt: fetchedAt},
+				},
+				Tree: []TreeNode{
+					{Name: "docs", Path: "docs", Type: "tree", SHA: "t1"},
+					{Name: "main.go", Path: "main.go", Type: "blob", SHA: "abc", Size: 12},
+				},
+			},
+		},
+		{
+			name:   "response without errors",
+			schema: "CrawlResponse",
+			value:  CrawlResponse{OutputMode: OutputModeInline},
+		},
+		{
+			name:   "manifest",
+			schema: "ManifestResponse",
+			value: ManifestResponse{
+				RootTreeSHA:   "root123",
+				RepoInfo:      RepositoryInfo{Owner: "owner", Name: "repo", Ref: "main"},
+				TreeFiles:     3,
+				FilteredFiles: 1,
+				Files: []TreeEntry{
+					{Path: "main.go", Mode: "100644", Type: "blob", SHA: "abc", Size: 12},
+					{Path: "empty.go", Mode: "100644", Type: "blob", SHA: "def"},
+				},
+				Duration: "120ms",
+			},
+		},
+		{
+			name:   "validation errors",
+			schema: "ValidationErrors",
+			value: ValidationErrors{Errors: []FieldError{
+				{Field: "repo_url", Message: "is required"},
+				{Field: "languages[0]", Message: `unknown language: "klingon"`},
+			}},
+		},
+		{
+			name:   "health",
+			schema: "HealthResponse",
+			value:  HealthResponse{Status: "healthy", Service: "crawler", Timestamp: fetchedAt, Version: "1.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, doc.validateExample(tt.schema, tt.value))
+		})
+	}
+}
+
+func TestOpenAPIValidatorRejectsDrift(t *testing.T) {
+	doc := loadSpec(t)
+
+	var unknownField any
+	require.NoError(t, json.Unmarshal([]byte(`{"repo_url": "owner/repo", "dry_run": true}`), &unknownField))
+	assert.ErrorContains(t, doc.validate(&schema{Ref: "#/components/schemas/CrawlRequest"}, unknownField, "CrawlRequest"), "dry_run is not in the spec")
+
+	var badMode any
+	require.NoError(t, json.Unmarshal([]byte(`{"repo_url": "owner/repo", "output_mode": "zip"}`), &badMode))
+	assert.ErrorContains(t, doc.validate(&schema{Ref: "#/components/schemas/CrawlRequest"}, badMode, "CrawlRequest"), "is not one of")
+
+	var missing any
+	require.NoError(t, json.Unmarshal([]byte(`{"ref": "main"}`), &missing))
+	assert.ErrorContains(t, doc.validate(&schema{Ref: "#/components/schemas/CrawlRequest"}, missing, "CrawlRequest"), "missing required property repo_url")
+}
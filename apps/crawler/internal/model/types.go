@@ -1,26 +1,114 @@
 package model
 
 import (
+	"context"
 	"time"
 )
 
+// Output modes control how file contents are returned in a CrawlResponse
+const (
+	OutputModeInline         = "inline"          // raw bytes, JSON-encoded as base64
+	OutputModeBase64Explicit = "base64-explicit" // base64 content with an explicit encoding field
+	OutputModeReference      = "reference"       // content omitted, ContentURL points at the blob
+)
+
+// Skip reasons break down CrawlResponse.SkipReasons
+const (
+	SkipBinary          = "binary"           // binary content
+	SkipInvalidEncoding = "invalid_encoding" // content that isn't valid UTF-8
+	SkipTooLarge        = "too_large"        // over MaxFileSize, by tree size or once read
+	SkipFiltered        = "filtered"         // left out by path, extension, language or minimum size filters
+	SkipFileHook        = "file_hook"        // rejected by the pool's file hook
+	SkipFetchError      = "fetch_error"      // the content couldn't be fetched
+)
+
+// File categories classify fetched files by role when ClassifyFiles is set,
+// see FileResult.Category
+const (
+	CategorySource    = "source"    // code that isn't any of the below
+	CategoryTest      = "test"      // tests and test fixtures
+	CategoryDoc       = "doc"       // documentation
+	CategoryConfig    = "config"    // configuration, manifests and build files
+	CategoryVendored  = "vendored"  // third-party code checked into the repository
+	CategoryGenerated = "generated" // produced by a tool, such as protobuf stubs or lockfiles
+)
+
 // CrawlRequest represents the incoming request to crawl a repository
 type CrawlRequest struct {
-	RepoURL    string   `json:"repo_url"`
-	Ref        string   `json:"ref,omitempty"`         // branch/tag/sha, defaults to "main"
-	PathFilter []string `json:"path_filter,omitempty"` // optional filter for specific paths
+	RepoURL      string   `json:"repo_url"`
+	Ref          string   `json:"ref,omitempty"`            // branch/tag/sha, defaults to "main"
+	PathFilter   []string `json:"path_filter,omitempty"`    // optional filter for specific paths
+	OutputMode   string   `json:"output_mode,omitempty"`    // inline, base64-explicit or reference
+	PullRequest  int      `json:"pull_request,omitempty"`   // crawl only the files changed in this PR
+	MaxPathDepth int      `json:"max_path_depth,omitempty"` // skip files nested deeper than this many directories
+	Languages    []string `json:"languages,omitempty"`      // only crawl files of these languages, e.g. ["python"]
+	Paths        []string `json:"paths,omitempty"`          // fetch exactly these paths, skipping the tree fetch
+
+	// AllowedExtensions overrides the configured extension allowlist for this
+	// crawl; empty falls back to ALLOWED_EXTENSIONS
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+
+	// Ordered returns files in tree order rather than as they complete
+	Ordered bool `json:"ordered,omitempty"`
+
+	// KnownSHAs maps paths the client already has to their blob SHAs; files
+	// still at that SHA are reported as unchanged instead of being fetched
+	KnownSHAs map[string]string `json:"known_shas,omitempty"`
+
+	// ResumeFrom is the crawl ID of an earlier, unfinished crawl of the same
+	// repository and ref; files its checkpoint lists as completed are reported
+	// as unchanged instead of being fetched again
+	ResumeFrom string `json:"resume_from,omitempty"`
+
+	// AllowLarge lifts MAX_TREE_ENTRIES for this crawl
+	AllowLarge bool `json:"allow_large,omitempty"`
+
+	// IncludeTree adds the filtered directory hierarchy to the response
+	IncludeTree bool `json:"include_tree,omitempty"`
+
+	// GitHubToken crawls with the caller's own token instead of the service's
+	// credentials, for private repositories only the caller can read. It is
+	// never logged or echoed back.
+	GitHubToken string `json:"github_token,omitempty"`
 }
 
 // CrawlResponse represents the response after crawling
 type CrawlResponse struct {
-	TotalFiles     int            `json:"total_files"`
-	SkippedFiles   int            `json:"skipped_files"`
-	ProcessedFiles int            `json:"processed_files"`
-	Errors         []CrawlError   `json:"errors"`
-	RootTreeSHA    string         `json:"root_tree_sha"`
-	Duration       string         `json:"duration"`
-	RepoInfo       RepositoryInfo `json:"repo_info"`
-	Files          []FileResult   `json:"files,omitempty"`
+	CrawlID         string         `json:"crawl_id"`
+	TotalFiles      int            `json:"total_files"`
+	SkippedFiles    int            `json:"skipped_files"`
+	ProcessedFiles  int            `json:"processed_files"`
+	DroppedFiles    int            `json:"dropped_files"`             // files never fetched because the task queue was full
+	UnchangedFiles  int            `json:"unchanged_files,omitempty"` // files at the client's known SHA, not fetched or counted in TotalFiles
+	FilteredFiles   int            `json:"filtered_files"`            // files left out by filters or size limits before fetching
+	TreeFiles       int            `json:"tree_files,omitempty"`      // every file in the tree or archive, before filtering
+	SkipReasons     map[string]int `json:"skip_reasons,omitempty"`    // skipped files by reason, including those filtered out before fetching
+	Categories      map[string]int `json:"categories,omitempty"`      // fetched files by category, when files are classified
+	ContentOmitted  int            `json:"content_omitted,omitempty"` // files returned without content because MaxInMemoryContentBytes was reached
+	Partial         bool           `json:"partial,omitempty"`         // the crawl deadline passed before every file was fetched
+	APIRequestCount int            `json:"api_request_count"`         // GitHub requests the crawl made, retries and fallbacks included
+	Errors          []CrawlError   `json:"errors"`
+	RootTreeSHA     string         `json:"root_tree_sha"`
+	Duration        string         `json:"duration"`
+	RepoInfo        RepositoryInfo `json:"repo_info"`
+	PullRequest     int            `json:"pull_request,omitempty"`
+	OutputMode      string         `json:"output_mode"`
+	Fingerprint     string         `json:"fingerprint"`        // SHA-256 of the sorted path and blob SHA pairs of every file covered, equal for equal snapshots
+	Warnings        []string       `json:"warnings,omitempty"` // malformed tree entries, skipped or crawled as best they could be
+	Files           []FileResult   `json:"files,omitempty"`    // sorted by path unless the crawl was ordered
+	Tree            []TreeNode     `json:"tree,omitempty"`     // top-level directories and files, when include_tree is set
+}
+
+// ManifestResponse lists the files a crawl with the same filters would fetch,
+// taken from the repository tree without fetching any content
+type ManifestResponse struct {
+	RootTreeSHA   string         `json:"root_tree_sha"`
+	RepoInfo      RepositoryInfo `json:"repo_info"`
+	TreeFiles     int            `json:"tree_files"`          // every file in the tree, before filtering
+	FilteredFiles int            `json:"filtered_files"`      // files left out by filters or size limits
+	Truncated     bool           `json:"truncated,omitempty"` // GitHub truncated the tree, so some files are missing
+	Files         []TreeEntry    `json:"files"`               // in tree order
+	Duration      string         `json:"duration"`
 }
 
 // CrawlError represents an error that occurred during crawling
@@ -46,14 +134,52 @@ type TreeEntry struct {
 	Size int    `json:"size,omitempty"`
 }
 
+// TreeNode is a file or directory in a crawl's filtered tree, with a
+// directory's contents nested under it. Directories whose files were all
+// filtered out are kept, so the hierarchy matches the repository's.
+type TreeNode struct {
+	Name     string     `json:"name"`
+	Path     string     `json:"path"`
+	Type     string     `json:"type"`          // "blob" or "tree"
+	SHA      string     `json:"sha,omitempty"` // empty for a directory missing from a truncated tree
+	Size     int        `json:"size,omitempty"`
+	Children []TreeNode `json:"children,omitempty"` // directories first, then files, each by name
+}
+
 // FileResult represents the result of fetching a file
 type FileResult struct {
-	Path      string    `json:"path"`
-	Content   []byte    `json:"content,omitempty"`
-	SHA       string    `json:"sha"`
-	Size      int       `json:"size"`
-	Error     error     `json:"error,omitempty"`
-	FetchedAt time.Time `json:"fetched_at"`
+	Path       string    `json:"path"`
+	Content    []byte    `json:"content,omitempty"`
+	Encoding   string    `json:"encoding,omitempty"`    // set to "base64" in base64-explicit mode
+	ContentURL string    `json:"content_url,omitempty"` // set in reference mode or when content is omitted
+	SHA        string    `json:"sha"`
+	Size       int       `json:"size"`
+	Error      error     `json:"error,omitempty"`
+	FetchedAt  time.Time `json:"fetched_at"`
+
+	// ContentOmitted is set when the crawl's in-memory content budget was exhausted
+	ContentOmitted bool `json:"content_omitted,omitempty"`
+
+	// Truncated is set when the file exceeded the size limit and only its first
+	// TruncateOversizeBytes are included; OriginalSize is its full size when
+	// known, which it isn't if the tree under-reported it
+	Truncated    bool `json:"truncated,omitempty"`
+	OriginalSize int  `json:"original_size,omitempty"`
+
+	// CrawlID correlates the result with the crawl that requested it; the
+	// response carries it once as CrawlResponse.CrawlID
+	CrawlID string `json:"-"`
+
+	// Status is unchanged for files matching the crawl's KnownSHAs, and the
+	// change type (added, modified, removed, renamed, ...) in pull request crawls
+	Status string `json:"status,omitempty"`
+
+	// Category is the file's role, one of the Category constants, when the
+	// crawler classifies files
+	Category string `json:"category,omitempty"`
+
+	// Pull request crawls only
+	PreviousPath string `json:"previous_path,omitempty"` // original path of a renamed file
 }
 
 // WorkerTask represents a task for the worker pool
@@ -64,6 +190,20 @@ type WorkerTask struct {
 	Owner string // Repository owner
 	Repo  string // Repository name
 	Ref   string // Git reference (branch/tag/sha)
+
+	// CrawlID identifies the crawl that submitted the task and is copied to its result
+	CrawlID string
+
+	// Ctx is the submitting crawl's context, so its deadline and cancellation
+	// reach in-flight fetches; nil uses the pool's context alone
+	Ctx context.Context
+
+	// Results receives the task's result; nil sends it to the pool's shared result channel
+	Results chan<- FileResult
+
+	// ResultBatches, when set instead of Results, receives the task's result
+	// batched with others of the same crawl that the worker processed
+	ResultBatches chan<- []FileResult
 }
 
 // GitHubTreeResponse represents the GitHub API tree response
@@ -89,6 +229,59 @@ type GitHubContentResponse struct {
 	Encoding    string `json:"encoding"`
 }
 
+// GitHubBlobResponse represents the GitHub Git Data API blob response
+type GitHubBlobResponse struct {
+	SHA      string `json:"sha"`
+	Size     int    `json:"size"`
+	URL      string `json:"url"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+// GitHubPullRequestResponse represents the GitHub API pull request response
+type GitHubPullRequestResponse struct {
+	Number int                  `json:"number"`
+	State  string               `json:"state"`
+	Head   GitHubPullRequestRef `json:"head"`
+	Base   GitHubPullRequestRef `json:"base"`
+}
+
+// GitHubPullRequestRef represents the head or base commit of a pull request
+type GitHubPullRequestRef struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// GitHubPullRequestFile represents a file in the GitHub API pull request files response
+type GitHubPullRequestFile struct {
+	SHA              string `json:"sha"`
+	Filename         string `json:"filename"`
+	Status           string `json:"status"` // added, removed, modified, renamed, copied, changed, unchanged
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Changes          int    `json:"changes"`
+	PreviousFilename string `json:"previous_filename,omitempty"`
+}
+
+// GitHubGraphQLBlob represents a blob object returned by the GitHub GraphQL API
+type GitHubGraphQLBlob struct {
+	Text        *string `json:"text"`
+	IsBinary    bool    `json:"isBinary"`
+	IsTruncated bool    `json:"isTruncated"`
+	ByteSize    int     `json:"byteSize"`
+}
+
+// GitHubGraphQLBlobsResponse represents a batched GraphQL blob query response,
+// keyed by the alias used for each requested object
+type GitHubGraphQLBlobsResponse struct {
+	Data struct {
+		Repository map[string]*GitHubGraphQLBlob `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors,omitempty"`
+}
+
 // RateLimitInfo represents GitHub API rate limit information
 type RateLimitInfo struct {
 	Limit     int       `json:"limit"`
@@ -96,6 +289,32 @@ type RateLimitInfo struct {
 	Reset     time.Time `json:"reset"`
 }
 
+// GitHubHealth is the result of a deep health check against the GitHub API
+type GitHubHealth struct {
+	Healthy   bool           `json:"healthy"`
+	RateLimit *RateLimitInfo `json:"rate_limit,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	CheckedAt time.Time      `json:"checked_at"`
+
+	// QuotaExhaustedUntil is the reset time while the quota is used up
+	QuotaExhaustedUntil *time.Time `json:"quota_exhausted_until,omitempty"`
+}
+
+// GitHubRateLimitResponse represents the GitHub API rate_limit response
+type GitHubRateLimitResponse struct {
+	Resources struct {
+		Core    GitHubRateLimitResource `json:"core"`
+		GraphQL GitHubRateLimitResource `json:"graphql"`
+	} `json:"resources"`
+}
+
+// GitHubRateLimitResource represents the quota for one GitHub API resource
+type GitHubRateLimitResource struct {
+	Limit     int   `json:"limit"`
+	Remaining int   `json:"remaining"`
+	Reset     int64 `json:"reset"` // unix seconds
+}
+
 // HealthResponse represents the health check response
 type HealthResponse struct {
 	Status    string    `json:"status"`
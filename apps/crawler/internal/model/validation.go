@@ -0,0 +1,39 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is one problem with a field of a request
+type FieldError struct {
+	Field   string `json:"field"` // JSON field name, with an index for list entries, e.g. languages[1]
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every problem found in a request, so a client can fix
+// them in one go; it is the error worker.ValidateRequest returns
+type ValidationErrors struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Add records a problem with field
+func (v *ValidationErrors) Add(field, format string, args ...any) {
+	v.Errors = append(v.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns v as an error, or nil when no problems were added
+func (v *ValidationErrors) Err() error {
+	if len(v.Errors) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v *ValidationErrors) Error() string {
+	problems := make([]string, len(v.Errors))
+	for i, e := range v.Errors {
+		problems[i] = e.Field + " " + e.Message
+	}
+	return "invalid request: " + strings.Join(problems, "; ")
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationErrors(t *testing.T) {
+	var v ValidationErrors
+	assert.NoError(t, v.Err())
+
+	v.Add("repo_url", "is required")
+	v.Add("languages[1]", "is not a known language: %q", "klingon")
+
+	err := v.Err()
+	require.Error(t, err)
+	assert.Equal(t, `invalid request: repo_url is required; languages[1] is not a known language: "klingon"`, err.Error())
+
+	var validation *ValidationErrors
+	require.True(t, errors.As(err, &validation))
+
+	data, err := json.Marshal(validation)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"errors": [
+		{"field": "repo_url", "message": "is required"},
+		{"field": "languages[1]", "message": "is not a known language: \"klingon\""}
+	]}`, string(data))
+}
@@ -0,0 +1,70 @@
+// Package redact masks credentials and other secrets in text on its way into
+// logs and error messages, such as GitHub response bodies and request URLs.
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mask replaces each secret
+const Mask = "[REDACTED]"
+
+// rule is a secret pattern and its replacement; replacements keep the
+// non-secret part of the match, such as a key name or token prefix
+type rule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// builtinRules match secrets in the formats most likely to show up in GitHub
+// traffic: tokens, authorization headers, JWTs, private keys and credentials
+// in URLs or key=value pairs
+var builtinRules = []rule{
+	{regexp.MustCompile(`-----BEGIN[A-Z ]*PRIVATE KEY-----[\s\S]*?-----END[A-Z ]*PRIVATE KEY-----`), Mask},
+	{regexp.MustCompile(`\b(gh[pousr]_)[A-Za-z0-9]{20,}`), "${1}" + Mask},
+	{regexp.MustCompile(`\b(github_pat_)[A-Za-z0-9_]{20,}`), "${1}" + Mask},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]+`), Mask},
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), Mask},
+	{regexp.MustCompile(`(?i)(authorization["']?\s*[:=]\s*["']?(?:token |bearer |basic )?)[^\s"',]+`), "${1}" + Mask},
+	{regexp.MustCompile(`(?i)((?:api[_-]?key|secret|password|passwd|access[_-]?token|refresh[_-]?token|private[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',&}]+`), "${1}" + Mask},
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + Mask + "@"},
+}
+
+var (
+	mu    sync.RWMutex
+	extra []*regexp.Regexp
+)
+
+// SetExtraPatterns adds deployment-specific secret patterns to the built-in
+// ones, replacing any set before. Matches are masked whole. The patterns are
+// process-wide, like the log output they protect.
+func SetExtraPatterns(patterns []*regexp.Regexp) {
+	mu.Lock()
+	defer mu.Unlock()
+	extra = patterns
+}
+
+// Literal returns s with every occurrence of secret masked, for secrets such
+// as a caller-supplied token whose format no pattern recognizes
+func Literal(s, secret string) string {
+	if secret == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, secret, Mask)
+}
+
+// String returns s with every secret masked
+func String(s string) string {
+	for _, r := range builtinRules {
+		s = r.pattern.ReplaceAllString(s, r.replacement)
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, pattern := range extra {
+		s = pattern.ReplaceAllLiteralString(s, Mask)
+	}
+	return s
+}
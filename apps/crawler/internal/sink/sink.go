@@ -0,0 +1,218 @@
+// Package sink writes crawled files to object storage in a content-addressed
+// layout: each distinct file content is stored once under its SHA-256, and a
+// manifest per repository and ref maps paths to those hashes.
+//
+//	objects/sha256/ab/ab12...ef              file content
+//	manifests/<owner>/<repo>/<ref>.json      path -> hash for one crawl
+//
+// Identical files across paths, refs and repositories share one object, and
+// re-crawling a ref rewrites only its manifest and any new content.
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// Store is the object storage a sink writes to. Keys are slash-separated.
+type Store interface {
+	// Exists reports whether an object has been written under key
+	Exists(ctx context.Context, key string) (bool, error)
+	// Put writes an object, replacing any existing one
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// ManifestEntry locates one file's content
+type ManifestEntry struct {
+	SHA256  string `json:"sha256"`   // content hash, the object key's last segment
+	BlobSHA string `json:"blob_sha"` // Git blob SHA from the crawl
+	Size    int    `json:"size"`
+}
+
+// Manifest maps a crawl's paths to their content objects
+type Manifest struct {
+	Owner     string                   `json:"owner"`
+	Repo      string                   `json:"repo"`
+	Ref       string                   `json:"ref"`
+	CrawlID   string                   `json:"crawl_id,omitempty"`
+	WrittenAt time.Time                `json:"written_at"`
+	Files     map[string]ManifestEntry `json:"files"`
+}
+
+// ContentAddressed stores a crawl's files by content hash. Pass Write as the
+// crawl's ResultSink, then Close to write the manifest.
+type ContentAddressed struct {
+	store Store
+	ctx   context.Context
+
+	mu       sync.Mutex
+	manifest Manifest
+	stored   int // objects written by this crawl
+	reused   int // files whose content was already stored
+	err      error
+}
+
+// NewContentAddressed creates a sink for one crawl of owner/repo at ref
+func NewContentAddressed(ctx context.Context, store Store, owner, repo, ref string) *ContentAddressed {
+	return &ContentAddressed{
+		store: store,
+		ctx:   ctx,
+		manifest: Manifest{
+			Owner: owner,
+			Repo:  repo,
+			Ref:   ref,
+			Files: make(map[string]ManifestEntry),
+		},
+	}
+}
+
+// Write stores a file's content unless an object with the same hash exists.
+// Failed files and files without content, such as reference mode or
+// unchanged results, aren't stored. The first storage error is kept for Close.
+func (c *ContentAddressed) Write(result model.FileResult) {
+	if result.Error != nil || result.Content == nil {
+		return
+	}
+
+	sum := sha256.Sum256(result.Content)
+	hash := hex.EncodeToString(sum[:])
+	key := ObjectKey(hash)
+
+	exists, err := c.store.Exists(c.ctx, key)
+	if err == nil && !exists {
+		err = c.store.Put(c.ctx, key, result.Content)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		if c.err == nil {
+			c.err = fmt.Errorf("failed to store %s: %w", result.Path, err)
+		}
+		return
+	}
+
+	if exists {
+		c.reused++
+	} else {
+		c.stored++
+	}
+	if c.manifest.CrawlID == "" {
+		c.manifest.CrawlID = result.CrawlID
+	}
+	c.manifest.Files[result.Path] = ManifestEntry{SHA256: hash, BlobSHA: result.SHA, Size: len(result.Content)}
+}
+
+// Close writes the manifest and returns it, or the first error Write hit, in
+// which case no manifest is written
+func (c *ContentAddressed) Close() (*Manifest, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.manifest.WrittenAt = time.Now().UTC()
+	data, err := json.Marshal(c.manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := c.store.Put(c.ctx, ManifestKey(c.manifest.Owner, c.manifest.Repo, c.manifest.Ref), data); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	manifest := c.manifest
+	return &manifest, nil
+}
+
+// Stats returns how many objects this crawl wrote and how many files reused
+// content that was already stored
+func (c *ContentAddressed) Stats() (stored, reused int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stored, c.reused
+}
+
+// ObjectKey returns the key content with the given SHA-256 is stored under,
+// fanned out by the first byte so no prefix holds every object
+func ObjectKey(hash string) string {
+	return "objects/sha256/" + hash[:2] + "/" + hash
+}
+
+// ManifestKey returns the key of the manifest for owner/repo at ref. Each
+// segment is escaped, so refs containing slashes stay one segment.
+func ManifestKey(owner, repo, ref string) string {
+	return "manifests/" + url.PathEscape(owner) + "/" + url.PathEscape(repo) + "/" + url.PathEscape(ref) + ".json"
+}
+
+// DirStore is a Store backed by a local directory, one file per key
+type DirStore struct {
+	Root string
+}
+
+// Exists reports whether the key's file exists
+func (d DirStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put writes the key's file through a temp file and a rename, so readers never
+// see a partial object
+func (d DirStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// path maps a key to a file under Root, refusing keys that would escape it
+func (d DirStore) path(key string) (string, error) {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid object key %q", key)
+		}
+	}
+	return filepath.Join(d.Root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+const helloSHA256 = "185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969" // sha256("Hello")
+
+func TestContentAddressedStoresContentOnce(t *testing.T) {
+	store := DirStore{Root: t.TempDir()}
+	ctx := context.Background()
+
+	first := NewContentAddressed(ctx, store, "owner", "repo", "main")
+	first.Write(model.FileResult{Path: "a.txt", SHA: "blob-a", Content: []byte("Hello"), CrawlID: "crawl-1"})
+	first.Write(model.FileResult{Path: "copy/a.txt", SHA: "blob-a", Content: []byte("Hello"), CrawlID: "crawl-1"})
+	first.Write(model.FileResult{Path: "b.txt", SHA: "blob-b", Content: []byte("World"), CrawlID: "crawl-1"})
+
+	manifest, err := first.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "crawl-1", manifest.CrawlID)
+	assert.Equal(t, ManifestEntry{SHA256: helloSHA256, BlobSHA: "blob-a", Size: 5}, manifest.Files["a.txt"])
+	assert.Equal(t, manifest.Files["a.txt"], manifest.Files["copy/a.txt"])
+
+	stored, reused := first.Stats()
+	assert.Equal(t, 2, stored)
+	assert.Equal(t, 1, reused)
+
+	content, err := os.ReadFile(filepath.Join(store.Root, "objects", "sha256", "18", helloSHA256))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", string(content))
+
+	// Another repository with the same content reuses the object
+	second := NewContentAddressed(ctx, store, "other", "repo", "feature/x")
+	second.Write(model.FileResult{Path: "hello.txt", Content: []byte("Hello")})
+	_, err = second.Close()
+	require.NoError(t, err)
+
+	stored, reused = second.Stats()
+	assert.Equal(t, 0, stored)
+	assert.Equal(t, 1, reused)
+
+	data, err := os.ReadFile(filepath.Join(store.Root, "manifests", "other", "repo", "feature%2Fx.json"))
+	require.NoError(t, err)
+	var written Manifest
+	require.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, "feature/x", written.Ref)
+	assert.Equal(t, helloSHA256, written.Files["hello.txt"].SHA256)
+}
+
+func TestContentAddressedSkipsFilesWithoutContent(t *testing.T) {
+	sink := NewContentAddressed(context.Background(), DirStore{Root: t.TempDir()}, "owner", "repo", "main")
+	sink.Write(model.FileResult{Path: "failed.go", Error: errors.New("connection reset")})
+	sink.Write(model.FileResult{Path: "ref.go", ContentURL: "https://api.github.com/repos/owner/repo/git/blobs/abc"})
+	sink.Write(model.FileResult{Path: "same.go", Status: "unchanged"})
+
+	manifest, err := sink.Close()
+	require.NoError(t, err)
+	assert.Empty(t, manifest.Files)
+}
+
+// failingStore fails every Put
+type failingStore struct{ DirStore }
+
+func (failingStore) Put(ctx context.Context, key string, data []byte) error {
+	return errors.New("bucket unavailable")
+}
+
+func TestContentAddressedReportsStoreErrors(t *testing.T) {
+	sink := NewContentAddressed(context.Background(), failingStore{DirStore{Root: t.TempDir()}}, "owner", "repo", "main")
+	sink.Write(model.FileResult{Path: "a.txt", Content: []byte("Hello")})
+	sink.Write(model.FileResult{Path: "b.txt", Content: []byte("World")})
+
+	manifest, err := sink.Close()
+	assert.Nil(t, manifest)
+	assert.EqualError(t, err, "failed to store a.txt: bucket unavailable")
+}
+
+func TestDirStoreRejectsEscapingKeys(t *testing.T) {
+	store := DirStore{Root: t.TempDir()}
+
+	for _, key := range []string{"../outside", "objects//x", "a/./b", ""} {
+		assert.Error(t, store.Put(context.Background(), key, []byte("x")), key)
+		_, err := store.Exists(context.Background(), key)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	assert.Equal(t, "objects/sha256/18/"+helloSHA256, ObjectKey(helloSHA256))
+	assert.Equal(t, "manifests/owner/repo/release%2F1.0.json", ManifestKey("owner", "repo", "release/1.0"))
+}
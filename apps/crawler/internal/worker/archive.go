@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// crawlArchive crawls a whole repository from its tarball: one API call instead
+// of one per file. Entries go through the same path, extension, size, binary and
+// encoding checks as the per-file path. The archive is decompressed and read as
+// it downloads, so at most one entry's content is buffered at a time; entries
+// over MaxFileSize are skipped on their header size without being read. The
+// download stops with ErrCrawlTooLarge once more than MaxTreeEntries files pass
+// the filters, unless the request allows large crawls.
+func (p *Pool) crawlArchive(ctx context.Context, owner, repo, ref string, opts CrawlOptions, outputMode string, startTime time.Time) (*model.CrawlResponse, error) {
+	log.Printf("Starting archive crawl of %s/%s at ref %s", owner, repo, ref)
+
+	var (
+		collected  = p.newCollector(owner, repo, outputMode, opts)
+		totalFiles = 0
+		treeFiles  = 0
+	)
+	collected.start(ref)
+
+	if err := p.checkRateLimitBudget(ctx, 1); err != nil {
+		collected.finish(nil, err)
+		return nil, err
+	}
+	err := p.githubClient.GetTarball(ctx, owner, repo, ref, func(body io.Reader) error {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return fmt.Errorf("failed to read tarball: %w", err)
+		}
+		defer gz.Close()
+
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read tarball: %w", err)
+			}
+
+			path, ok := archivePath(header)
+			if !ok {
+				continue
+			}
+			treeFiles++
+			if reason := p.filterReason(path, int(header.Size), opts); reason != "" {
+				collected.filtered(path, int(header.Size), reason)
+				continue
+			}
+			if limit := p.config.MaxTreeEntries; limit > 0 && totalFiles >= limit && !opts.AllowLarge {
+				return fmt.Errorf("%w: more than %d files left after filtering; narrow it with path_filter or languages, or set allow_large",
+					ErrCrawlTooLarge, limit)
+			}
+
+			maxSize := p.config.MaxFileSizeFor(path)
+			content, sha, err := readArchiveEntry(tr, header.Size, maxSize, truncateLength(p.config, maxSize))
+			if err != nil {
+				return fmt.Errorf("failed to read %s from tarball: %w", path, err)
+			}
+
+			totalFiles++
+			p.metrics.RecordFileRequested(owner, repo)
+
+			task := model.WorkerTask{Path: path, SHA: sha, Size: len(content), Owner: owner, Repo: repo, Ref: ref}
+			result := model.FileResult{Path: path, SHA: sha, Size: task.Size, FetchedAt: time.Now()}
+			if int64(len(content)) < header.Size {
+				result.Truncated = true
+				result.OriginalSize = int(header.Size)
+				content = trimPartialRune(content)
+			}
+			collected.add(p.checkContent(ctx, -1, task, content, result))
+		}
+	})
+
+	response := collected.response(ref, totalFiles)
+	response.TreeFiles = treeFiles
+	response.Duration = time.Since(startTime).String()
+
+	if err != nil {
+		// Past the crawl deadline, return what was extracted rather than nothing
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			response.Partial = true
+			log.Printf("Crawl %s: deadline reached after %d archive entries, returning partial response", response.CrawlID, totalFiles)
+			collected.finish(response, nil)
+			return response, nil
+		}
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	p.metrics.RecordContentFetch("tarball", 1, totalFiles)
+	log.Printf("Archive crawl completed: %d processed, %d skipped", response.ProcessedFiles, response.SkippedFiles)
+	collected.finish(response, nil)
+
+	return response, nil
+}
+
+// archivePath returns the repository path of a regular file entry. GitHub
+// tarballs nest everything under a single owner-repo-sha directory.
+func archivePath(header *tar.Header) (string, bool) {
+	if header.Typeflag != tar.TypeReg {
+		return "", false
+	}
+
+	_, path, found := strings.Cut(header.Name, "/")
+	if !found || path == "" {
+		return "", false
+	}
+
+	return path, true
+}
+
+// readArchiveEntry reads a tar entry of the given size and returns its content
+// and git blob SHA. Entries over maxSize keep only their first truncateTo
+// bytes, while the SHA still covers the whole entry.
+func readArchiveEntry(r io.Reader, size, maxSize, truncateTo int64) ([]byte, string, error) {
+	// The header size is exact and already within maxSize unless truncating
+	if size <= maxSize {
+		content := make([]byte, size)
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, "", err
+		}
+		return content, gitBlobSHA(content), nil
+	}
+
+	h := sha1.New()
+	h.Write([]byte("blob " + strconv.FormatInt(size, 10) + "\x00"))
+
+	content := make([]byte, truncateTo)
+	if _, err := io.ReadFull(io.TeeReader(r, h), content); err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, "", err
+	}
+	return content, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// gitBlobSHA computes the Git object ID of a blob, matching the SHA the tree
+// and blobs APIs report for the same content
+func gitBlobSHA(content []byte) string {
+	h := sha1.New()
+	h.Write([]byte("blob " + strconv.Itoa(len(content)) + "\x00"))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
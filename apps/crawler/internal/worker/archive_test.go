@@ -0,0 +1,352 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// archiveEntry is a file in a test tarball; an empty body with a trailing
+// slash in the name makes a directory entry
+type archiveEntry struct {
+	name string
+	body string
+}
+
+// buildTarball builds a gzipped tarball laid out like GitHub's, with a pax
+// global header and everything under a single top-level directory
+func buildTarball(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": "0123456789abcdef0123456789abcdef01234567"},
+	}))
+
+	for _, entry := range entries {
+		name := "owner-repo-0123456/" + entry.name
+		if strings.HasSuffix(name, "/") {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0o755}))
+			continue
+		}
+
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: int64(len(entry.body))}))
+		_, err := tw.Write([]byte(entry.body))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestCrawlRepositoryArchive(t *testing.T) {
+	tarball := buildTarball(t, []archiveEntry{
+		{name: "docs/"},
+		{name: "main.go", body: "package main"},
+		{name: "docs/guide.md", body: "# Guide"},
+		{name: "logo.png", body: "\x89PNG"},
+		{name: "data.go", body: "package data\x00\x00\x00"},
+		{name: "big.go", body: strings.Repeat("x", 2048)},
+		{name: "Makefile", body: "all:"},
+	})
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/tarball/main":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			_, _ = w.Write(tarball)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		AllowedExtensions:     []string{".go", ".md"},
+		SpecialFiles:          []string{"makefile"},
+		EnableBinaryDetection: true,
+		EnableArchiveCrawl:    true,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	// One API call covers the whole repository
+	assert.Equal(t, []string{"/repos/owner/repo/tarball/main"}, requests)
+
+	// logo.png fails the extension filter and big.go the size filter before being read
+	assert.Equal(t, 4, response.TotalFiles)
+	assert.Equal(t, 2, response.FilteredFiles)
+	assert.Equal(t, 6, response.TreeFiles)
+	assert.Equal(t, 3, response.ProcessedFiles)
+	assert.Equal(t, 1, response.SkippedFiles)
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "data.go", response.Errors[0].FilePath)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("too_large")))
+
+	byPath := make(map[string][]byte)
+	shas := make(map[string]string)
+	for _, file := range response.Files {
+		if file.Error == nil {
+			byPath[file.Path] = file.Content
+			shas[file.Path] = file.SHA
+		}
+	}
+	assert.Equal(t, map[string][]byte{
+		"main.go":       []byte("package main"),
+		"docs/guide.md": []byte("# Guide"),
+		"Makefile":      []byte("all:"),
+	}, byPath)
+
+	// SHAs match what git reports for the same content
+	assert.Equal(t, "85f0393b7b97da09ea050aaf524d8502c0286460", shas["main.go"])
+}
+
+func TestCrawlRepositoryArchiveTruncatesOversizedFiles(t *testing.T) {
+	big := "// é\n" + strings.Repeat("x", 2048)
+	tarball := buildTarball(t, []archiveEntry{
+		{name: "big.go", body: big},
+		{name: "small.go", body: "package small"},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tarball)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        30000,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		TruncateOversizeBytes: 4, // cuts "é" in half
+		EnableArchiveCrawl:    true,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, response.ProcessedFiles)
+
+	files := make(map[string]model.FileResult)
+	for _, file := range response.Files {
+		files[file.Path] = file
+	}
+
+	truncated := files["big.go"]
+	assert.True(t, truncated.Truncated)
+	assert.Equal(t, "// ", string(truncated.Content)) // the partial rune is dropped
+	assert.Equal(t, 3, truncated.Size)
+	assert.Equal(t, len(big), truncated.OriginalSize)
+	assert.Equal(t, gitBlobSHA([]byte(big)), truncated.SHA) // the SHA still covers the whole file
+
+	assert.False(t, files["small.go"].Truncated)
+	assert.Zero(t, files["small.go"].OriginalSize)
+}
+
+func TestCrawlRepositoryArchiveMaxTreeEntries(t *testing.T) {
+	tarball := buildTarball(t, []archiveEntry{
+		{name: "a.go", body: "package a"},
+		{name: "b.go", body: "package b"},
+		{name: "c.go", body: "package c"},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tarball)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        30000,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		MaxTreeEntries:        2,
+		EnableArchiveCrawl:    true,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+
+	_, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	assert.ErrorIs(t, err, ErrCrawlTooLarge)
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{AllowLarge: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, response.ProcessedFiles)
+}
+
+func TestCrawlRepositoryArchiveSkippedForPathFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/tarball/") {
+			t.Errorf("path-filtered crawls should not download the tarball")
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		EnableArchiveCrawl:    true,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+
+	_, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{PathFilter: []string{"src/"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get repository tree")
+}
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		header *tar.Header
+		want   string
+		wantOK bool
+	}{
+		{name: "nested file", header: &tar.Header{Typeflag: tar.TypeReg, Name: "o-r-sha/src/main.go"}, want: "src/main.go", wantOK: true},
+		{name: "top-level file", header: &tar.Header{Typeflag: tar.TypeReg, Name: "o-r-sha/README.md"}, want: "README.md", wantOK: true},
+		{name: "directory", header: &tar.Header{Typeflag: tar.TypeDir, Name: "o-r-sha/src/"}},
+		{name: "symlink", header: &tar.Header{Typeflag: tar.TypeSymlink, Name: "o-r-sha/link"}},
+		{name: "root directory only", header: &tar.Header{Typeflag: tar.TypeReg, Name: "o-r-sha"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ok := archivePath(tt.header)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, path)
+		})
+	}
+}
+
+func TestCrawlRepositoryArchiveStreamsResults(t *testing.T) {
+	// Incompressible filler keeps the second half of the archive from arriving
+	// early, so main.go can only be emitted if entries are processed as they stream
+	filler := make([]byte, 256*1024)
+	_, err := rand.Read(filler)
+	require.NoError(t, err)
+
+	tarball := buildTarball(t, []archiveEntry{
+		{name: "main.go", body: "package main"},
+		{name: "filler.bin", body: string(filler)},
+		{name: "huge.go", body: strings.Repeat("x", 4*1024*1024)},
+		{name: "util.go", body: "package util"},
+	})
+
+	firstResult := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		half := len(tarball) / 2
+		_, _ = w.Write(tarball[:half])
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-firstResult:
+		case <-time.After(5 * time.Second):
+			t.Error("no result was emitted before the archive finished downloading")
+		}
+		_, _ = w.Write(tarball[half:])
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		TreeRequestCost:       1,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		AllowedExtensions:     []string{".go"},
+		EnableArchiveCrawl:    true,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+
+	var streamed []model.FileResult
+	opts := CrawlOptions{ResultSink: func(result model.FileResult) {
+		if len(streamed) == 0 {
+			close(firstResult)
+		}
+		streamed = append(streamed, result)
+	}}
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", opts)
+	require.NoError(t, err)
+
+	require.Len(t, streamed, 2)
+	assert.Equal(t, "main.go", streamed[0].Path)
+	assert.Equal(t, "util.go", streamed[1].Path)
+	assert.Equal(t, response.CrawlID, streamed[0].CrawlID)
+
+	// Streamed crawls only report counts; huge.go was skipped on its header size
+	assert.Empty(t, response.Files)
+	assert.Equal(t, 2, response.ProcessedFiles)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("too_large")))
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// BatchTarget is one repository of a batch crawl
+type BatchTarget struct {
+	Owner string
+	Repo  string
+	Ref   string
+}
+
+// BatchResult is the outcome of crawling one target of a batch
+type BatchResult struct {
+	Target   BatchTarget
+	Response *model.CrawlResponse
+	Err      error
+}
+
+// CrawlBatch crawls several repositories at once, at most BatchConcurrency at
+// a time. Their trees are fetched in parallel, at most TreeFetchConcurrency at
+// a time, and their files share the pool's workers. Results are returned in
+// target order; a target that fails doesn't stop the others.
+//
+// opts applies to every target. KnownSHAs, ResumeFrom and Paths describe a
+// single repository, so they're refused. A CrawlID or IdempotencyKey is
+// suffixed with the target's index, and ResultSink calls are serialized
+// across the whole batch.
+func (p *Pool) CrawlBatch(ctx context.Context, targets []BatchTarget, opts CrawlOptions) ([]BatchResult, error) {
+	if len(opts.KnownSHAs) > 0 || opts.ResumeFrom != "" || len(opts.Paths) > 0 {
+		return nil, fmt.Errorf("known SHAs, resuming and explicit paths are not supported for batch crawls")
+	}
+
+	if sink := opts.ResultSink; sink != nil {
+		var mu sync.Mutex
+		opts.ResultSink = func(result model.FileResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			sink(result)
+		}
+	}
+
+	// Bounds whole crawls, archive ones included, so a large batch can't
+	// flood the task queue; 0 leaves them unbounded
+	var slots chan struct{}
+	if p.config.BatchConcurrency > 0 {
+		slots = make(chan struct{}, p.config.BatchConcurrency)
+	}
+
+	results := make([]BatchResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		targetOpts := opts
+		if opts.CrawlID != "" {
+			targetOpts.CrawlID = fmt.Sprintf("%s-%d", opts.CrawlID, i)
+		}
+		if opts.IdempotencyKey != "" {
+			targetOpts.IdempotencyKey = fmt.Sprintf("%s-%d", opts.IdempotencyKey, i)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-ctx.Done():
+					results[i] = BatchResult{Target: target, Err: ctx.Err()}
+					return
+				}
+			}
+
+			response, err := p.CrawlRepository(ctx, target.Owner, target.Repo, target.Ref, targetOpts)
+			results[i] = BatchResult{Target: target, Response: response, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	return results, nil
+}
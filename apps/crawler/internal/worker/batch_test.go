@@ -0,0 +1,238 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// slowTreeFetcher takes a while to return each tree and records how many tree
+// fetches overlapped; repos listed in missing fail
+type slowTreeFetcher struct {
+	*fakeFetcher
+
+	missing map[string]bool
+	active  atomic.Int32
+	peak    atomic.Int32
+}
+
+func (f *slowTreeFetcher) GetRepositoryTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error) {
+	active := f.active.Add(1)
+	defer f.active.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if active <= peak || f.peak.CompareAndSwap(peak, active) {
+			break
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if f.missing[repo] {
+		return nil, errors.New("not found")
+	}
+	return f.fakeFetcher.GetRepositoryTree(ctx, owner, repo, ref)
+}
+
+func newBatchTestPool(t *testing.T, fetcher GitHubFetcher, treeConcurrency int) *Pool {
+	cfg := &config.Config{
+		MaxWorkers:           2,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		TreeFetchConcurrency: treeConcurrency,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	t.Cleanup(func() { _ = pool.Stop() })
+	return pool
+}
+
+func TestCrawlBatchBoundsTreeFetches(t *testing.T) {
+	fetcher := &slowTreeFetcher{
+		fakeFetcher: &fakeFetcher{
+			tree: &model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "a.go", Type: "blob", SHA: "a1", Size: 9},
+					{Path: "b.go", Type: "blob", SHA: "b1", Size: 9},
+				},
+			},
+			contents: map[string][]byte{
+				"a.go": []byte("package a"),
+				"b.go": []byte("package b"),
+			},
+		},
+		missing: map[string]bool{"gone": true},
+	}
+	pool := newBatchTestPool(t, fetcher, 2)
+
+	targets := []BatchTarget{
+		{Owner: "owner", Repo: "one", Ref: "main"},
+		{Owner: "owner", Repo: "two", Ref: "main"},
+		{Owner: "owner", Repo: "gone", Ref: "main"},
+		{Owner: "owner", Repo: "three", Ref: "v1"},
+		{Owner: "owner", Repo: "four", Ref: "main"},
+	}
+
+	var (
+		mu     sync.Mutex
+		synced int
+	)
+	results, err := pool.CrawlBatch(context.Background(), targets, CrawlOptions{
+		CrawlID: "batch",
+		ResultSink: func(model.FileResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			synced++
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, len(targets))
+
+	assert.Equal(t, int32(2), fetcher.peak.Load(), "tree fetches are bounded by TREE_FETCH_CONCURRENCY")
+	assert.Equal(t, 8, synced)
+
+	for i, result := range results {
+		assert.Equal(t, targets[i], result.Target)
+		if result.Target.Repo == "gone" {
+			assert.ErrorContains(t, result.Err, "failed to get repository tree: not found")
+			assert.Nil(t, result.Response)
+			continue
+		}
+		require.NoError(t, result.Err, result.Target.Repo)
+		assert.Equal(t, 2, result.Response.ProcessedFiles)
+		assert.Equal(t, "root123", result.Response.RootTreeSHA)
+	}
+	assert.Equal(t, "batch-0", results[0].Response.CrawlID)
+	assert.Equal(t, "batch-4", results[4].Response.CrawlID)
+}
+
+func TestCrawlBatchBoundsCrawls(t *testing.T) {
+	tree := &model.GitHubTreeResponse{SHA: "root123"}
+	contents := make(map[string][]byte)
+	for i := range 10 {
+		path := fmt.Sprintf("file%d.go", i)
+		tree.Tree = append(tree.Tree, model.TreeEntry{Path: path, Type: "blob", SHA: path, Size: 9})
+		contents[path] = []byte("package a")
+	}
+	fetcher := &slowTreeFetcher{fakeFetcher: &fakeFetcher{tree: tree, contents: contents}}
+
+	cfg := &config.Config{
+		MaxWorkers:           2,
+		MaxConcurrentFetches: 2,
+		TaskQueueSize:        2,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		TreeFetchConcurrency: 10,
+		BatchConcurrency:     2,
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	t.Cleanup(func() { _ = pool.Stop() })
+
+	var targets []BatchTarget
+	for i := range 12 {
+		targets = append(targets, BatchTarget{Owner: "owner", Repo: fmt.Sprintf("repo%d", i), Ref: "main"})
+	}
+	results, err := pool.CrawlBatch(context.Background(), targets, CrawlOptions{})
+	require.NoError(t, err)
+
+	assert.LessOrEqual(t, fetcher.peak.Load(), int32(2), "crawls are bounded by BATCH_CONCURRENCY")
+	for _, result := range results {
+		require.NoError(t, result.Err, result.Target.Repo)
+		assert.Equal(t, 10, result.Response.ProcessedFiles, result.Target.Repo)
+		assert.Zero(t, result.Response.DroppedFiles, result.Target.Repo)
+		assert.Empty(t, result.Response.Errors, result.Target.Repo)
+		assert.Zero(t, testutil.ToFloat64(m.TasksDroppedTotal.WithLabelValues("owner", result.Target.Repo)))
+	}
+}
+
+func TestCrawlBatchIdempotencyKey(t *testing.T) {
+	fetcher := &countingFetcher{fakeFetcher: &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA:  "root123",
+			Tree: []model.TreeEntry{{Path: "main.go", Type: "blob", SHA: "a1", Size: 9}},
+		},
+		contents: map[string][]byte{"main.go": []byte("package a")},
+	}}
+	cfg := &config.Config{
+		MaxWorkers:           2,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		IdempotencyTTLMS:     60000,
+		IdempotencyMaxKeys:   10,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	t.Cleanup(func() { _ = pool.Stop() })
+
+	targets := []BatchTarget{
+		{Owner: "owner", Repo: "one", Ref: "main"},
+		{Owner: "owner", Repo: "two", Ref: "main"},
+	}
+	opts := CrawlOptions{IdempotencyKey: "retry-1"}
+	first, err := pool.CrawlBatch(context.Background(), targets, opts)
+	require.NoError(t, err)
+	for _, result := range first {
+		require.NoError(t, result.Err, "each target gets a key of its own")
+	}
+
+	// A retried batch gets every target's cached response back
+	second, err := pool.CrawlBatch(context.Background(), targets, opts)
+	require.NoError(t, err)
+	for i, result := range second {
+		require.NoError(t, result.Err)
+		assert.Same(t, first[i].Response, result.Response)
+	}
+	assert.Equal(t, int32(2), fetcher.trees.Load())
+}
+
+func TestCrawlBatchRefusesPerRepositoryOptions(t *testing.T) {
+	pool := newBatchTestPool(t, &fakeFetcher{}, 1)
+	targets := []BatchTarget{{Owner: "owner", Repo: "repo", Ref: "main"}}
+
+	for name, opts := range map[string]CrawlOptions{
+		"known SHAs":     {KnownSHAs: map[string]string{"a.go": "a1"}},
+		"resume":         {ResumeFrom: "9f2c4e1a7b3d5f60"},
+		"explicit paths": {Paths: []string{"a.go"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			results, err := pool.CrawlBatch(context.Background(), targets, opts)
+			assert.ErrorContains(t, err, "not supported for batch crawls")
+			assert.Nil(t, results)
+		})
+	}
+}
+
+func TestFetchTreeWaitsForSlot(t *testing.T) {
+	pool := newBatchTestPool(t, &fakeFetcher{tree: &model.GitHubTreeResponse{SHA: "root"}}, 1)
+
+	// Hold the only slot, so the fetch gives up when its context ends
+	pool.treeSlots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pool.fetchTree(ctx, "owner", "repo", "main")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	<-pool.treeSlots
+	tree, err := pool.fetchTree(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "root", tree.SHA)
+}
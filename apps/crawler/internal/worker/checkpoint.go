@@ -0,0 +1,176 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrCheckpointNotFound is returned when a crawl asks to resume from a
+// checkpoint that doesn't exist, or checkpoints are disabled
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// ErrCheckpointMismatch is returned when a checkpoint belongs to a different
+// repository or ref than the crawl resuming from it
+var ErrCheckpointMismatch = errors.New("checkpoint is for a different crawl")
+
+// checkpoint is the on-disk record of the files a crawl has completed
+type checkpoint struct {
+	CrawlID   string            `json:"crawl_id"`
+	Owner     string            `json:"owner"`
+	Repo      string            `json:"repo"`
+	Ref       string            `json:"ref"`
+	Completed map[string]string `json:"completed"` // path to blob SHA
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// checkpointWriter persists a crawl's completed files every interval
+// completions. Its methods are called with the collector's lock held.
+type checkpointWriter struct {
+	dir      string
+	interval int
+	pending  int
+	state    checkpoint
+}
+
+// newCheckpointWriter creates a writer for a crawl, seeded with the files a
+// resumed crawl already had so checkpoints can be chained
+func newCheckpointWriter(dir string, interval int, crawlID, owner, repo string, seed map[string]string) *checkpointWriter {
+	completed := maps.Clone(seed)
+	if completed == nil {
+		completed = make(map[string]string)
+	}
+
+	return &checkpointWriter{
+		dir:      dir,
+		interval: interval,
+		state: checkpoint{
+			CrawlID:   crawlID,
+			Owner:     owner,
+			Repo:      repo,
+			Completed: completed,
+		},
+	}
+}
+
+// complete records a finished file, writing the checkpoint once interval files
+// have finished since the last write
+func (w *checkpointWriter) complete(path, sha string) {
+	if sha == "" {
+		return
+	}
+	w.state.Completed[path] = sha
+	w.pending++
+
+	if w.pending >= w.interval {
+		w.save()
+	}
+}
+
+// save writes the checkpoint, replacing the previous one atomically
+func (w *checkpointWriter) save() {
+	w.pending = 0
+	w.state.UpdatedAt = time.Now()
+
+	if err := writeCheckpoint(w.dir, w.state); err != nil {
+		log.Printf("Crawl %s: failed to write checkpoint: %v", w.state.CrawlID, err)
+	}
+}
+
+// remove deletes the checkpoint of a crawl that finished
+func (w *checkpointWriter) remove() {
+	err := os.Remove(checkpointPath(w.dir, w.state.CrawlID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Crawl %s: failed to remove checkpoint: %v", w.state.CrawlID, err)
+	}
+}
+
+// checkpointPath returns the checkpoint file for a crawl ID. Crawl IDs come
+// from callers, so the name is a hash rather than the ID itself.
+func checkpointPath(dir, crawlID string) string {
+	sum := sha256.Sum256([]byte(crawlID))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".checkpoint.json")
+}
+
+// writeCheckpoint writes a checkpoint through a temp file and a rename, so a
+// crash mid-write leaves the previous checkpoint intact
+func writeCheckpoint(dir string, state checkpoint) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "checkpoint-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+
+	return os.Rename(file.Name(), checkpointPath(dir, state.CrawlID))
+}
+
+// loadCheckpoint reads the checkpoint a crawl resumes from and checks that it
+// is for the same repository and ref
+func (p *Pool) loadCheckpoint(crawlID, owner, repo, ref string) (*checkpoint, error) {
+	if p.config.CheckpointDir == "" {
+		return nil, fmt.Errorf("%w: checkpoints are disabled", ErrCheckpointNotFound)
+	}
+
+	data, err := os.ReadFile(checkpointPath(p.config.CheckpointDir, crawlID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, crawlID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var state checkpoint
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	if state.Owner != owner || state.Repo != repo || state.Ref != ref {
+		return nil, fmt.Errorf("%w: %s is for %s/%s at %s", ErrCheckpointMismatch, crawlID, state.Owner, state.Repo, state.Ref)
+	}
+
+	return &state, nil
+}
+
+// resume loads the checkpoint named by opts.ResumeFrom and folds its completed
+// files into KnownSHAs, so they are reported as unchanged instead of fetched.
+// Unless the caller picked a new crawl ID, the crawl continues under the old
+// one and keeps updating the same checkpoint.
+func (p *Pool) resume(opts *CrawlOptions, owner, repo, ref string) error {
+	state, err := p.loadCheckpoint(opts.ResumeFrom, owner, repo, ref)
+	if err != nil {
+		return err
+	}
+
+	if opts.CrawlID == "" {
+		opts.CrawlID = opts.ResumeFrom
+	}
+
+	known := make(map[string]string, len(state.Completed)+len(opts.KnownSHAs))
+	maps.Copy(known, state.Completed)
+	maps.Copy(known, opts.KnownSHAs)
+	opts.KnownSHAs = known
+	opts.resumed = state.Completed
+
+	log.Printf("Resuming crawl %s: %d files already completed", opts.ResumeFrom, len(state.Completed))
+	return nil
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestCheckpointWriterInterval(t *testing.T) {
+	dir := t.TempDir()
+	pool := NewPool(&config.Config{MaxConcurrentFetches: 1, CheckpointDir: dir}, metrics.NewForTesting(), &fakeFetcher{})
+	w := newCheckpointWriter(dir, 2, "crawl-1", "owner", "repo", map[string]string{"old.go": "o1"})
+	w.state.Ref = "main"
+
+	w.complete("a.go", "a1")
+	_, err := pool.loadCheckpoint("crawl-1", "owner", "repo", "main")
+	require.ErrorIs(t, err, ErrCheckpointNotFound, "nothing is written before the interval")
+
+	w.complete("b.go", "b1")
+	w.complete("c.go", "c1")
+	state, err := pool.loadCheckpoint("crawl-1", "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"old.go": "o1", "a.go": "a1", "b.go": "b1"}, state.Completed)
+
+	w.save()
+	state, err = pool.loadCheckpoint("crawl-1", "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Len(t, state.Completed, 4)
+
+	w.remove()
+	_, err = os.Stat(checkpointPath(dir, "crawl-1"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCheckpointPathHashesCrawlID(t *testing.T) {
+	path := checkpointPath("/var/lib/checkpoints", "../../etc/passwd")
+	assert.Regexp(t, `^/var/lib/checkpoints/[0-9a-f]{64}\.checkpoint\.json$`, path)
+}
+
+func TestLoadCheckpointErrors(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeCheckpoint(dir, checkpoint{CrawlID: "crawl-1", Owner: "owner", Repo: "repo", Ref: "main"}))
+
+	disabled := NewPool(&config.Config{MaxConcurrentFetches: 1}, metrics.NewForTesting(), &fakeFetcher{})
+	_, err := disabled.loadCheckpoint("crawl-1", "owner", "repo", "main")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+
+	pool := NewPool(&config.Config{MaxConcurrentFetches: 1, CheckpointDir: dir}, metrics.NewForTesting(), &fakeFetcher{})
+	_, err = pool.loadCheckpoint("crawl-2", "owner", "repo", "main")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+
+	_, err = pool.loadCheckpoint("crawl-1", "owner", "repo", "develop")
+	assert.ErrorIs(t, err, ErrCheckpointMismatch)
+}
+
+func TestCollectorKeepsCheckpointOfFailedCrawl(t *testing.T) {
+	dir := t.TempDir()
+	pool := NewPool(&config.Config{MaxConcurrentFetches: 1, CheckpointDir: dir, CheckpointIntervalFiles: 100}, metrics.NewForTesting(), &fakeFetcher{})
+
+	collected := pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{CrawlID: "crawl-1"})
+	collected.start("main")
+	collected.add(model.FileResult{Path: "a.go", SHA: "a1", Content: []byte("package a")})
+	collected.add(model.FileResult{Path: "b.go", SHA: "b1", Error: errors.New("connection reset")})
+	collected.finish(nil, errors.New("boom"))
+
+	state, err := pool.loadCheckpoint("crawl-1", "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a.go": "a1"}, state.Completed)
+
+	// A crawl that gets through every file removes its checkpoint
+	collected = pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{CrawlID: "crawl-1"})
+	collected.start("main")
+	collected.finish(&model.CrawlResponse{}, nil)
+
+	_, err = pool.loadCheckpoint("crawl-1", "owner", "repo", "main")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+}
+
+func TestCrawlRepositoryResume(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeCheckpoint(dir, checkpoint{
+		CrawlID:   "crawl-1",
+		Owner:     "owner",
+		Repo:      "repo",
+		Ref:       "main",
+		Completed: map[string]string{"done.go": "d1", "moved.go": "m1"},
+	}))
+
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: "done.go", Type: "blob", SHA: "d1", Size: 9},
+				{Path: "moved.go", Type: "blob", SHA: "m2", Size: 9},
+				{Path: "todo.go", Type: "blob", SHA: "t1", Size: 9},
+			},
+		},
+		contents: map[string][]byte{
+			"moved.go": []byte("package m"),
+			"todo.go":  []byte("package t"),
+		},
+	}
+	cfg := &config.Config{
+		MaxWorkers:              1,
+		MaxConcurrentFetches:    10,
+		MaxFileSize:             1024,
+		FetchTimeoutMS:          1000,
+		CheckpointDir:           dir,
+		CheckpointIntervalFiles: 100,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{ResumeFrom: "crawl-1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "crawl-1", response.CrawlID)
+	assert.Equal(t, 1, response.UnchangedFiles)
+	assert.Equal(t, 2, response.ProcessedFiles, "files that changed since the checkpoint are fetched again")
+
+	// The crawl finished, so its checkpoint is gone
+	_, err = pool.loadCheckpoint("crawl-1", "owner", "repo", "main")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+
+	_, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{ResumeFrom: "crawl-1"})
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+
+	_, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{ResumeFrom: "crawl-1", Paths: []string{"todo.go"}})
+	assert.ErrorContains(t, err, "not supported for explicit path crawls")
+}
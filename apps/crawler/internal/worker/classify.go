@@ -0,0 +1,113 @@
+package worker
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// generatedMarkerWindow is how much of a file's start is searched for a
+// generated-code marker; tools put them in the header
+const generatedMarkerWindow = 1024
+
+// vendoredDirs are directories holding third-party code
+var vendoredDirs = newStringSet([]string{"vendor", "node_modules", "third_party", "third-party", "bower_components"})
+
+// testDirs are directories holding tests
+var testDirs = newStringSet([]string{"test", "tests", "__tests__", "spec", "testdata", "fixtures"})
+
+// docDirs are directories holding documentation
+var docDirs = newStringSet([]string{"docs", "doc", "documentation"})
+
+// generatedFiles are lockfiles and other files tools write
+var generatedFiles = newStringSet([]string{
+	"package-lock.json", "yarn.lock", "pnpm-lock.yaml", "go.sum", "cargo.lock",
+	"poetry.lock", "composer.lock", "gemfile.lock", "pipfile.lock",
+})
+
+// generatedSuffixes mark generated files by name
+var generatedSuffixes = []string{".pb.go", "_pb2.py", ".pb.h", ".pb.cc", "_generated.go", ".generated.ts", ".min.js", ".min.css", ".g.dart"}
+
+// generatedMarkers are the header comments code generators leave
+var generatedMarkers = [][]byte{[]byte("code generated"), []byte("do not edit"), []byte("@generated"), []byte("autogenerated"), []byte("auto-generated")}
+
+// testSuffixes mark test files by lowercased name, and testClassSuffixes by
+// name as written, since FooTest.java is a test but latest.java isn't
+var (
+	testSuffixes      = []string{"_test.go", ".test.js", ".test.ts", ".test.tsx", ".spec.js", ".spec.ts", ".spec.tsx", "_test.py", "_spec.rb"}
+	testClassSuffixes = []string{"Test.java", "Tests.java", "Test.kt", "Tests.cs"}
+)
+
+// docExtensions and docNames mark documentation files
+var (
+	docExtensions = newStringSet([]string{".md", ".mdx", ".rst", ".adoc", ".txt"})
+	docNames      = newStringSet([]string{"readme", "license", "changelog", "contributing", "authors", "notice"})
+)
+
+// configExtensions and configNames mark configuration files
+var (
+	configExtensions = newStringSet([]string{".json", ".yaml", ".yml", ".toml", ".ini", ".cfg", ".conf", ".env", ".properties", ".xml"})
+	configNames      = newStringSet([]string{
+		"dockerfile", "makefile", "go.mod", "cargo.toml", "pyproject.toml", "setup.cfg",
+		"gemfile", "rakefile", "build.gradle", "build.gradle.kts", "build.sbt", "pom.xml",
+	})
+)
+
+// classifyFile returns the category of a file from its path and content.
+// Vendored code wins over everything, since a vendored test or doc is still
+// someone else's; generated files come next, then tests, docs and config.
+func classifyFile(filePath string, content []byte) string {
+	lowerPath := strings.ToLower(filePath)
+	dirs := strings.Split(path.Dir(lowerPath), "/")
+	name := path.Base(lowerPath)
+	ext := path.Ext(name)
+
+	inDir := func(set stringSet) bool {
+		for _, dir := range dirs {
+			if set.has(dir) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case inDir(vendoredDirs):
+		return model.CategoryVendored
+	case generatedFiles.has(name) || hasAnySuffix(name, generatedSuffixes) || hasGeneratedMarker(content):
+		return model.CategoryGenerated
+	case inDir(testDirs) || hasAnySuffix(name, testSuffixes) || hasAnySuffix(path.Base(filePath), testClassSuffixes) ||
+		strings.HasPrefix(name, "test_"):
+		return model.CategoryTest
+	case inDir(docDirs) || docExtensions.has(ext) || docNames.has(strings.TrimSuffix(name, ext)):
+		return model.CategoryDoc
+	case configExtensions.has(ext) || configNames.has(name) || strings.HasPrefix(name, "."):
+		return model.CategoryConfig
+	default:
+		return model.CategorySource
+	}
+}
+
+// hasAnySuffix reports whether name ends with one of suffixes
+func hasAnySuffix(name string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGeneratedMarker reports whether a generated-code marker appears near the
+// start of content
+func hasGeneratedMarker(content []byte) bool {
+	head := bytes.ToLower(content[:min(len(content), generatedMarkerWindow)])
+	for _, marker := range generatedMarkers {
+		if bytes.Contains(head, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestClassifyFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		expected string
+	}{
+		{name: "source", path: "internal/worker/pool.go", content: "package worker", expected: model.CategorySource},
+		{name: "go test", path: "internal/worker/pool_test.go", expected: model.CategoryTest},
+		{name: "test directory", path: "tests/helpers.py", expected: model.CategoryTest},
+		{name: "jest spec", path: "src/App.spec.tsx", expected: model.CategoryTest},
+		{name: "java test class", path: "src/test/FooTest.java", expected: model.CategoryTest},
+		{name: "java class ending in test", path: "src/main/Latest.java", expected: model.CategorySource},
+		{name: "docs directory", path: "docs/guide/setup.html", expected: model.CategoryDoc},
+		{name: "markdown", path: "README.md", expected: model.CategoryDoc},
+		{name: "license", path: "LICENSE", expected: model.CategoryDoc},
+		{name: "yaml", path: ".github/workflows/ci.yml", expected: model.CategoryConfig},
+		{name: "dockerfile", path: "Dockerfile", expected: model.CategoryConfig},
+		{name: "dotfile", path: ".eslintrc", expected: model.CategoryConfig},
+		{name: "vendor", path: "vendor/github.com/pkg/errors/errors.go", expected: model.CategoryVendored},
+		{name: "vendored test", path: "web/node_modules/left-pad/test/index.js", expected: model.CategoryVendored},
+		{name: "lockfile", path: "package-lock.json", expected: model.CategoryGenerated},
+		{name: "protobuf stub", path: "api/v1/service.pb.go", expected: model.CategoryGenerated},
+		{name: "generated marker", path: "internal/mocks/client.go", content: "// Code generated by mockgen. DO NOT EDIT.\npackage mocks", expected: model.CategoryGenerated},
+		{name: "marker past the header", path: "main.go", content: string(make([]byte, generatedMarkerWindow)) + "DO NOT EDIT", expected: model.CategorySource},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, classifyFile(tt.path, []byte(tt.content)))
+		})
+	}
+}
+
+func TestCollectorCategories(t *testing.T) {
+	pool := NewPool(&config.Config{ClassifyFiles: true}, metrics.NewForTesting(), &github.Client{})
+
+	collected := pool.newCollector("owner", "repo", model.OutputModeReference, CrawlOptions{})
+	collected.add(model.FileResult{Path: "main.go", Content: []byte("package main")})
+	collected.add(model.FileResult{Path: "main_test.go", Content: []byte("package main")})
+	collected.add(model.FileResult{Path: "gen.go", Content: []byte("// Code generated by stringer. DO NOT EDIT.")})
+	collected.add(model.FileResult{Path: "util.go", Content: []byte("package main")})
+	collected.add(model.FileResult{Path: "missing.go", Error: github.ErrNotFound})
+
+	response := collected.response("main", 5)
+	assert.Equal(t, map[string]int{model.CategorySource: 2, model.CategoryTest: 1, model.CategoryGenerated: 1}, response.Categories)
+	// Reference mode drops the content after the classifier has seen it
+	assert.Equal(t, model.CategoryGenerated, response.Files[0].Category)
+	assert.Nil(t, response.Files[0].Content)
+	assert.Empty(t, response.Files[3].Category)
+}
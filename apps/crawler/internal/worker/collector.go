@@ -0,0 +1,384 @@
+package worker
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// collector accumulates a crawl's results into counts, errors and files,
+// applying the output mode and the in-memory content budget as results arrive
+type collector struct {
+	pool       *Pool
+	crawlID    string
+	owner      string
+	repo       string
+	outputMode string
+
+	// ref and started are set by start, for the crawl's lifecycle events
+	ref     string
+	started time.Time
+
+	// checkpoint records completed files when CheckpointDir is set
+	checkpoint *checkpointWriter
+
+	// sink receives results as they arrive instead of fileResults keeping them
+	sink func(model.FileResult)
+
+	// decorate, if set, adjusts each result before it is recorded
+	decorate func(*model.FileResult)
+
+	// order releases results in tree order when the crawl asked for it
+	ordered bool
+	order   *orderedBuffer
+
+	mu             sync.Mutex
+	processedFiles int
+	skippedFiles   int
+	unchangedFiles int
+	filteredFiles  int
+	skipReasons    map[string]int
+	categories     map[string]int // fetched files by category when ClassifyFiles is set
+	crawlErrors    []model.CrawlError
+	fileResults    []model.FileResult
+
+	// manifest maps every file the crawl covers to its blob SHA, whether or
+	// not its fetch succeeded, for the response's fingerprint
+	manifest map[string]string
+
+	// Content budget; once exhausted, later files keep only their metadata
+	contentBytes   int64
+	contentOmitted int
+	overBudget     bool
+}
+
+// newCollector creates a collector for one crawl
+func (p *Pool) newCollector(owner, repo, outputMode string, opts CrawlOptions) *collector {
+	c := &collector{
+		pool:       p,
+		crawlID:    crawlID(opts),
+		owner:      owner,
+		repo:       repo,
+		outputMode: outputMode,
+		sink:       opts.ResultSink,
+		ordered:    opts.Ordered,
+		manifest:   make(map[string]string),
+	}
+
+	if dir := p.config.CheckpointDir; dir != "" {
+		c.checkpoint = newCheckpointWriter(dir, p.config.CheckpointIntervalFiles, c.crawlID, owner, repo, opts.resumed)
+	}
+
+	return c
+}
+
+// start records the crawl's ref and fires its CrawlStarted event
+func (c *collector) start(ref string) {
+	c.ref = ref
+	c.started = time.Now()
+	if c.checkpoint != nil {
+		c.checkpoint.state.Ref = ref
+	}
+	c.event(Event{Type: EventCrawlStarted, Ref: ref})
+}
+
+// event fires a lifecycle event tagged with the crawl's identity
+func (c *collector) event(e Event) {
+	e.CrawlID = c.crawlID
+	e.Owner = c.owner
+	e.Repo = c.repo
+	c.pool.emitEvent(e)
+}
+
+// finish fires the crawl's CrawlCompleted event for its response, or for the
+// error that ended it
+func (c *collector) finish(response *model.CrawlResponse, err error) {
+	e := Event{Type: EventCrawlCompleted, Ref: c.ref}
+	if !c.started.IsZero() {
+		e.Duration = time.Since(c.started)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if response != nil {
+		e.TotalFiles = response.TotalFiles
+		e.ProcessedFiles = response.ProcessedFiles
+		e.SkippedFiles = response.SkippedFiles
+		e.Partial = response.Partial
+	}
+	c.event(e)
+
+	// Keep the checkpoint of a crawl that didn't get through every file, so
+	// it can be resumed; a finished crawl has no use for it
+	if c.checkpoint != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err != nil || response == nil || response.Partial {
+			c.checkpoint.save()
+		} else {
+			c.checkpoint.remove()
+		}
+	}
+}
+
+// expect sets the order results are released in when the crawl is ordered
+func (c *collector) expect(files []model.TreeEntry) {
+	if !c.ordered {
+		return
+	}
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order = newOrderedBuffer(paths, c.pool.config.OrderedBufferMaxResults)
+}
+
+// plan records the files a crawl is about to fetch in its manifest, so a file
+// whose fetch fails or never happens still counts towards the fingerprint
+func (c *collector) plan(files []model.TreeEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, file := range files {
+		c.manifest[file.Path] = file.SHA
+	}
+}
+
+// skip records that a file will never produce a result
+func (c *collector) skip(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.order != nil {
+		c.order.skip(path, c.emit)
+	}
+}
+
+// add records a single file result
+func (c *collector) add(result model.FileResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result.CrawlID = c.crawlID
+	if c.decorate != nil {
+		c.decorate(&result)
+	}
+	// Explicit path crawls only learn a file's SHA once it's fetched
+	if result.SHA != "" || c.manifest[result.Path] == "" {
+		c.manifest[result.Path] = result.SHA
+	}
+
+	if result.Error != nil {
+		reason := skipReason(result.Error)
+		errorType := reason
+		switch {
+		case errors.Is(result.Error, github.ErrNotFound):
+			errorType = "not_found"
+		case errors.Is(result.Error, github.ErrCorruptResponse):
+			errorType = "corrupt_response"
+		}
+
+		c.countSkip(reason)
+		c.skippedFiles++
+		c.crawlErrors = append(c.crawlErrors, model.CrawlError{
+			FilePath: result.Path,
+			Error:    result.Error.Error(),
+			Type:     errorType,
+		})
+		c.event(Event{Type: EventFileSkipped, Path: result.Path, SHA: result.SHA, Size: result.Size, Reason: reason, Error: result.Error.Error()})
+	} else {
+		c.processedFiles++
+		c.event(Event{Type: EventFileFetched, Path: result.Path, SHA: result.SHA, Size: result.Size})
+		if c.checkpoint != nil {
+			c.checkpoint.complete(result.Path, result.SHA)
+		}
+		if c.pool.config.ClassifyFiles {
+			c.classify(&result)
+		}
+		c.pool.applyOutputMode(&result, c.outputMode, c.owner, c.repo)
+
+		// Streamed results aren't held, so the content budget doesn't apply
+		if limit := c.pool.config.MaxInMemoryContentBytes; limit > 0 && c.sink == nil && result.Content != nil {
+			if !c.overBudget && c.contentBytes+int64(len(result.Content)) > limit {
+				c.overBudget = true
+				log.Printf("Crawl %s: content exceeded %d bytes in memory, omitting content for remaining files", c.crawlID, limit)
+			}
+
+			if c.overBudget {
+				result.Content = nil
+				result.Encoding = ""
+				result.ContentURL = c.pool.githubClient.BlobURL(c.owner, c.repo, result.SHA)
+				result.ContentOmitted = true
+				c.contentOmitted++
+			} else {
+				c.contentBytes += int64(len(result.Content))
+			}
+		}
+	}
+
+	if c.order != nil {
+		c.order.push(result, c.emit)
+		return
+	}
+	c.emit(result)
+}
+
+// emit hands a finished result to the sink or keeps it for the response;
+// the caller holds c.mu
+func (c *collector) emit(result model.FileResult) {
+	if c.sink != nil {
+		c.sink(result)
+		return
+	}
+	c.fileResults = append(c.fileResults, result)
+}
+
+// filtered records a file left out before fetching
+func (c *collector) filtered(path string, size int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filteredFiles++
+	c.countSkip(reason)
+	c.event(Event{Type: EventFileSkipped, Path: path, Size: size, Reason: reason})
+}
+
+// countSkip adds a skip to the per-reason breakdown; callers hold c.mu
+func (c *collector) countSkip(reason string) {
+	if c.skipReasons == nil {
+		c.skipReasons = make(map[string]int)
+	}
+	c.skipReasons[reason]++
+}
+
+// classify sets a fetched file's category and counts it, before the output
+// mode drops its content; callers hold c.mu
+func (c *collector) classify(result *model.FileResult) {
+	result.Category = classifyFile(result.Path, result.Content)
+	if c.categories == nil {
+		c.categories = make(map[string]int)
+	}
+	c.categories[result.Category]++
+}
+
+// skipReason classifies a failed result's error for SkipReasons
+func skipReason(err error) string {
+	switch {
+	case errors.Is(err, ErrBinaryFile):
+		return model.SkipBinary
+	case errors.Is(err, ErrInvalidEncoding):
+		return model.SkipInvalidEncoding
+	case errors.Is(err, github.ErrFileTooLarge):
+		return model.SkipTooLarge
+	case errors.Is(err, ErrFileHook):
+		return model.SkipFileHook
+	default:
+		return model.SkipFetchError
+	}
+}
+
+// unchanged records a file the caller already has at its current SHA
+func (c *collector) unchanged(entry model.TreeEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.unchangedFiles++
+	c.manifest[entry.Path] = entry.SHA
+	c.pool.metrics.RecordFileProcessed(c.owner, c.repo, "unchanged")
+	c.event(Event{Type: EventFileSkipped, Path: entry.Path, SHA: entry.SHA, Size: entry.Size, Reason: "unchanged"})
+	if c.checkpoint != nil {
+		c.checkpoint.complete(entry.Path, entry.SHA)
+	}
+	c.emit(model.FileResult{
+		Path:    entry.Path,
+		SHA:     entry.SHA,
+		Size:    entry.Size,
+		Status:  "unchanged",
+		CrawlID: c.crawlID,
+	})
+}
+
+// removed records a file a pull request deletes, which has no content to fetch
+func (c *collector) removed(file model.GitHubPullRequestFile, fetchedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.emit(model.FileResult{
+		Path:      file.Filename,
+		SHA:       file.SHA,
+		Status:    file.Status,
+		CrawlID:   c.crawlID,
+		FetchedAt: fetchedAt,
+	})
+}
+
+// addErrors records crawl errors that have no file result, such as dropped tasks
+func (c *collector) addErrors(crawlErrors []model.CrawlError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.crawlErrors = append(c.crawlErrors, crawlErrors...)
+}
+
+// response builds the crawl response from everything collected so far
+func (c *collector) response(ref string, totalFiles int) *model.CrawlResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Results still held for ordering never got their predecessors, e.g. after
+	// the crawl deadline; release them rather than losing them
+	if c.order != nil {
+		c.order.flush(c.emit)
+	}
+
+	// Workers finish in any order; sort by path so the same repo and ref give
+	// the same response. Ordered crawls keep the tree order they asked for.
+	if !c.ordered {
+		slices.SortStableFunc(c.fileResults, func(a, b model.FileResult) int {
+			return cmp.Compare(a.Path, b.Path)
+		})
+	}
+
+	return &model.CrawlResponse{
+		CrawlID:        c.crawlID,
+		TotalFiles:     totalFiles,
+		ProcessedFiles: c.processedFiles,
+		SkippedFiles:   c.skippedFiles,
+		UnchangedFiles: c.unchangedFiles,
+		FilteredFiles:  c.filteredFiles,
+		SkipReasons:    maps.Clone(c.skipReasons),
+		Categories:     maps.Clone(c.categories),
+		ContentOmitted: c.contentOmitted,
+		Errors:         c.crawlErrors,
+		RepoInfo: model.RepositoryInfo{
+			Owner: c.owner,
+			Name:  c.repo,
+			Ref:   ref,
+		},
+		OutputMode:  c.outputMode,
+		Fingerprint: manifestFingerprint(c.manifest),
+		Files:       c.fileResults,
+	}
+}
+
+// manifestFingerprint hashes path and SHA pairs in path order, so the same
+// snapshot crawled with the same filters always gives the same value
+func manifestFingerprint(manifest map[string]string) string {
+	h := sha256.New()
+	for _, path := range slices.Sorted(maps.Keys(manifest)) {
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write([]byte(manifest[path]))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
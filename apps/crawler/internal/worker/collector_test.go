@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestCollector(t *testing.T) {
+	pool := NewPool(&config.Config{}, metrics.NewForTesting(), &github.Client{})
+
+	collected := pool.newCollector("owner", "repo", model.OutputModeBase64Explicit, CrawlOptions{CrawlID: "crawl-1"})
+	collected.addErrors([]model.CrawlError{{FilePath: "dropped.go", Type: "task_dropped"}})
+	collected.add(model.FileResult{Path: "a.go", Content: []byte("a")})
+	collected.add(model.FileResult{Path: "missing.go", Error: github.ErrNotFound})
+	collected.add(model.FileResult{Path: "b.go", Error: errors.New("boom")})
+
+	response := collected.response("main", 4)
+	assert.Equal(t, "crawl-1", response.CrawlID)
+	assert.Equal(t, 4, response.TotalFiles)
+	assert.Equal(t, 1, response.ProcessedFiles)
+	assert.Equal(t, 2, response.SkippedFiles)
+	assert.Equal(t, model.RepositoryInfo{Owner: "owner", Name: "repo", Ref: "main"}, response.RepoInfo)
+
+	require.Len(t, response.Errors, 3)
+	assert.Equal(t, "task_dropped", response.Errors[0].Type)
+	assert.Equal(t, "not_found", response.Errors[1].Type)
+	assert.Equal(t, "fetch_error", response.Errors[2].Type)
+
+	require.Len(t, response.Files, 3)
+	assert.Equal(t, "crawl-1", response.Files[0].CrawlID)
+	assert.Equal(t, "base64", response.Files[0].Encoding)
+}
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "binary", err: ErrBinaryFile, expected: model.SkipBinary},
+		{name: "invalid encoding", err: ErrInvalidEncoding, expected: model.SkipInvalidEncoding},
+		{name: "too large", err: fmt.Errorf("file size 2 exceeds limit 1: %w", github.ErrFileTooLarge), expected: model.SkipTooLarge},
+		{name: "file hook", err: fmt.Errorf("%w: rejected", ErrFileHook), expected: model.SkipFileHook},
+		{name: "not found", err: github.ErrNotFound, expected: model.SkipFetchError},
+		{name: "other", err: errors.New("connection reset"), expected: model.SkipFetchError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, skipReason(tt.err))
+		})
+	}
+}
+
+func TestCollectorSkipReasons(t *testing.T) {
+	pool := NewPool(&config.Config{}, metrics.NewForTesting(), &github.Client{})
+
+	collected := pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{})
+	collected.filtered("notes.txt", 10, model.SkipFiltered)
+	collected.filtered("big.go", 1<<30, model.SkipTooLarge)
+	collected.add(model.FileResult{Path: "logo.go", Error: ErrBinaryFile})
+	collected.add(model.FileResult{Path: "a.go", Content: []byte("a")})
+
+	response := collected.response("main", 2)
+	assert.Equal(t, 1, response.SkippedFiles)
+	assert.Equal(t, map[string]int{model.SkipFiltered: 1, model.SkipTooLarge: 1, model.SkipBinary: 1}, response.SkipReasons)
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, model.SkipBinary, response.Errors[0].Type)
+}
+
+func TestCollectorSortsFilesByPath(t *testing.T) {
+	pool := NewPool(&config.Config{}, metrics.NewForTesting(), &github.Client{})
+
+	collected := pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{})
+	for _, path := range []string{"src/b.go", "README.md", "src/a.go", "go.mod"} {
+		collected.add(model.FileResult{Path: path, Content: []byte("x")})
+	}
+
+	response := collected.response("main", 4)
+	require.Len(t, response.Files, 4)
+	paths := make([]string, len(response.Files))
+	for i, file := range response.Files {
+		paths[i] = file.Path
+	}
+	assert.Equal(t, []string{"README.md", "go.mod", "src/a.go", "src/b.go"}, paths)
+}
+
+func TestCollectorSink(t *testing.T) {
+	pool := NewPool(&config.Config{MaxInMemoryContentBytes: 1}, metrics.NewForTesting(), &github.Client{})
+
+	var streamed []model.FileResult
+	collected := pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{
+		ResultSink: func(result model.FileResult) { streamed = append(streamed, result) },
+	})
+	collected.decorate = func(result *model.FileResult) { result.Status = "modified" }
+
+	collected.add(model.FileResult{Path: "a.go", Content: []byte("package a")})
+	collected.add(model.FileResult{Path: "b.go", Error: errors.New("boom")})
+
+	response := collected.response("main", 2)
+	assert.Empty(t, response.Files)
+	assert.Equal(t, 1, response.ProcessedFiles)
+	assert.Len(t, response.Errors, 1)
+
+	// Streamed content isn't held, so the in-memory budget doesn't strip it
+	require.Len(t, streamed, 2)
+	assert.Equal(t, []byte("package a"), streamed[0].Content)
+	assert.Equal(t, 0, response.ContentOmitted)
+	assert.Equal(t, "modified", streamed[0].Status)
+	assert.Equal(t, response.CrawlID, streamed[1].CrawlID)
+}
+
+func TestCollectorFingerprint(t *testing.T) {
+	pool := NewPool(&config.Config{}, metrics.NewForTesting(), &github.Client{})
+	files := []model.TreeEntry{
+		{Path: "b.go", SHA: "b1"},
+		{Path: "a.go", SHA: "a1"},
+		{Path: "c.go", SHA: "c1"},
+	}
+
+	fingerprint := func(order []int, failed string, shas map[string]string) string {
+		collected := pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{})
+		collected.plan(files)
+		for _, i := range order {
+			result := model.FileResult{Path: files[i].Path, SHA: files[i].SHA}
+			if sha, ok := shas[result.Path]; ok {
+				result.SHA = sha
+			}
+			if result.Path == failed {
+				result.Error = errors.New("boom")
+			}
+			collected.add(result)
+		}
+		return collected.response("main", len(files)).Fingerprint
+	}
+
+	want := fingerprint([]int{0, 1, 2}, "", nil)
+	assert.Len(t, want, 64)
+	assert.Equal(t, want, fingerprint([]int{2, 0, 1}, "", nil), "completion order doesn't matter")
+	assert.Equal(t, want, fingerprint([]int{1, 2}, "b.go", nil), "failed and missing results still count")
+	assert.NotEqual(t, want, fingerprint([]int{0, 1, 2}, "", map[string]string{"c.go": "c2"}), "a changed blob changes it")
+
+	// An unchanged file counts like a fetched one
+	collected := pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{})
+	collected.unchanged(files[0])
+	collected.plan(files[1:])
+	assert.Equal(t, want, collected.response("main", 2).Fingerprint)
+}
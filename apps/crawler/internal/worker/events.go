@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// EventType names a step in a crawl's lifecycle
+type EventType string
+
+const (
+	// EventCrawlStarted fires once per crawl, before anything is fetched
+	EventCrawlStarted EventType = "crawl_started"
+	// EventTreeFetched fires when the repository tree has been retrieved
+	EventTreeFetched EventType = "tree_fetched"
+	// EventFileFetched fires for every file whose content was fetched
+	EventFileFetched EventType = "file_fetched"
+	// EventFileSkipped fires for every file left out of the response's content,
+	// whether filtered before fetching, unchanged, dropped or rejected after
+	EventFileSkipped EventType = "file_skipped"
+	// EventCrawlCompleted fires once per crawl when it ends, successfully or not
+	EventCrawlCompleted EventType = "crawl_completed"
+)
+
+// Event is a structured crawl lifecycle event. Fields that don't apply to the
+// event's type are left zero.
+type Event struct {
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	CrawlID string    `json:"crawl_id"`
+	Owner   string    `json:"owner"`
+	Repo    string    `json:"repo"`
+	Ref     string    `json:"ref,omitempty"`
+
+	// File events
+	Path string `json:"path,omitempty"`
+	SHA  string `json:"sha,omitempty"`
+	Size int    `json:"size,omitempty"`
+
+	// Reason is the skip reason of a FileSkipped event, one of the model.Skip*
+	// constants, "unchanged" or "task_dropped"
+	Reason string `json:"reason,omitempty"`
+
+	// Error is set on skipped files that failed and on crawls that failed
+	Error string `json:"error,omitempty"`
+
+	// TreeEntries is the number of tree entries of a TreeFetched event
+	TreeEntries int `json:"tree_entries,omitempty"`
+
+	// Crawl totals of a CrawlCompleted event
+	TotalFiles     int           `json:"total_files,omitempty"`
+	ProcessedFiles int           `json:"processed_files,omitempty"`
+	SkippedFiles   int           `json:"skipped_files,omitempty"`
+	Partial        bool          `json:"partial,omitempty"`
+	Duration       time.Duration `json:"duration,omitempty"`
+}
+
+// String formats the event as space-separated key=value pairs, leaving out
+// zero fields
+func (e Event) String() string {
+	var b strings.Builder
+	field := func(key string, value any) {
+		s := fmt.Sprint(value)
+		if strings.ContainsAny(s, " \t\n\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(s)
+	}
+	str := func(key, value string) {
+		if value != "" {
+			field(key, value)
+		}
+	}
+	num := func(key string, value int) {
+		if value != 0 {
+			field(key, value)
+		}
+	}
+
+	field("event", e.Type)
+	str("crawl_id", e.CrawlID)
+	str("owner", e.Owner)
+	str("repo", e.Repo)
+	str("ref", e.Ref)
+	str("path", e.Path)
+	str("sha", e.SHA)
+	num("size", e.Size)
+	str("reason", e.Reason)
+	str("error", e.Error)
+	num("tree_entries", e.TreeEntries)
+	num("total_files", e.TotalFiles)
+	num("processed_files", e.ProcessedFiles)
+	num("skipped_files", e.SkippedFiles)
+	if e.Partial {
+		field("partial", true)
+	}
+	if e.Duration > 0 {
+		field("duration", e.Duration)
+	}
+
+	return b.String()
+}
+
+// EventEmitter receives crawl lifecycle events. Emit is called from crawl and
+// worker goroutines concurrently and inline with the crawl, so it must be safe
+// for concurrent use and should hand slow work such as publishing off to a
+// buffer of its own.
+type EventEmitter interface {
+	Emit(Event)
+}
+
+// LogEmitter logs events as one line of key=value fields. It is the pool's
+// default emitter. Per-file events would flood the log on a large
+// repository, so only crawl-level events and files skipped with an error are
+// logged unless Files is set.
+type LogEmitter struct {
+	// Files logs every file_fetched and file_skipped event too
+	Files bool
+}
+
+// Emit logs the event
+func (l LogEmitter) Emit(e Event) {
+	if !l.Files {
+		switch e.Type {
+		case EventFileFetched:
+			return
+		case EventFileSkipped:
+			if e.Error == "" {
+				return
+			}
+		}
+	}
+	log.Print(e.String())
+}
+
+// SetEventEmitter replaces the pool's event emitter; nil disables events
+func (p *Pool) SetEventEmitter(emitter EventEmitter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = emitter
+}
+
+// emitEvent stamps an event with the current time and hands it to the emitter
+func (p *Pool) emitEvent(e Event) {
+	p.mu.RLock()
+	emitter := p.events
+	p.mu.RUnlock()
+
+	if emitter == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	emitter.Emit(e)
+}
@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// recordingEmitter keeps every event it receives
+type recordingEmitter struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recordingEmitter) Emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// ofType returns the recorded events of the given type
+func (r *recordingEmitter) ofType(eventType EventType) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var events []Event
+	for _, e := range r.events {
+		if e.Type == eventType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "zero fields omitted",
+			event: Event{Type: EventCrawlStarted, CrawlID: "c1", Owner: "owner", Repo: "repo", Ref: "main"},
+			want:  "event=crawl_started crawl_id=c1 owner=owner repo=repo ref=main",
+		},
+		{
+			name:  "values with spaces quoted",
+			event: Event{Type: EventFileSkipped, CrawlID: "c1", Path: "a.go", Reason: model.SkipFetchError, Error: "connection reset"},
+			want:  `event=file_skipped crawl_id=c1 path=a.go reason=fetch_error error="connection reset"`,
+		},
+		{
+			name:  "completion totals",
+			event: Event{Type: EventCrawlCompleted, CrawlID: "c1", TotalFiles: 3, ProcessedFiles: 2, SkippedFiles: 1, Partial: true, Duration: 1500 * time.Millisecond},
+			want:  "event=crawl_completed crawl_id=c1 total_files=3 processed_files=2 skipped_files=1 partial=true duration=1.5s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.event.String())
+		})
+	}
+}
+
+func TestCrawlRepositoryEvents(t *testing.T) {
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: "main.go", Type: "blob", SHA: "m1", Size: 12},
+				{Path: "broken.go", Type: "blob", SHA: "b1", Size: 9},
+				{Path: "notes.bin", Type: "blob", SHA: "n1", Size: 9},
+				{Path: "docs", Type: "tree", SHA: "d1"},
+			},
+		},
+		contents: map[string][]byte{"main.go": []byte("package main")},
+		errs:     map[string]error{"broken.go": errors.New("connection reset")},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	events := &recordingEmitter{}
+	pool.SetEventEmitter(events)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{CrawlID: "crawl-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.ProcessedFiles)
+
+	events.mu.Lock()
+	first, last := events.events[0], events.events[len(events.events)-1]
+	events.mu.Unlock()
+	assert.Equal(t, EventCrawlStarted, first.Type)
+	assert.Equal(t, "main", first.Ref)
+	assert.Equal(t, EventCrawlCompleted, last.Type)
+	assert.Equal(t, 2, last.TotalFiles)
+	assert.Equal(t, 1, last.ProcessedFiles)
+	assert.Equal(t, 1, last.SkippedFiles)
+	assert.Empty(t, last.Error)
+
+	for _, e := range events.events {
+		assert.Equal(t, "crawl-1", e.CrawlID)
+		assert.Equal(t, "owner", e.Owner)
+		assert.Equal(t, "repo", e.Repo)
+		assert.False(t, e.Time.IsZero())
+	}
+
+	tree := events.ofType(EventTreeFetched)
+	require.Len(t, tree, 1)
+	assert.Equal(t, "root123", tree[0].SHA)
+	assert.Equal(t, 4, tree[0].TreeEntries)
+
+	fetched := events.ofType(EventFileFetched)
+	require.Len(t, fetched, 1)
+	assert.Equal(t, "main.go", fetched[0].Path)
+	assert.Equal(t, "m1", fetched[0].SHA)
+
+	skipped := events.ofType(EventFileSkipped)
+	require.Len(t, skipped, 2)
+	reasons := map[string]string{}
+	for _, e := range skipped {
+		reasons[e.Path] = e.Reason
+	}
+	assert.Equal(t, map[string]string{"notes.bin": model.SkipFiltered, "broken.go": model.SkipFetchError}, reasons)
+}
+
+func TestCrawlRepositoryEventsOnFailure(t *testing.T) {
+	fetcher := &fakeFetcher{treeErr: errors.New("boom")}
+	pool := NewPool(&config.Config{MaxWorkers: 1, MaxConcurrentFetches: 10}, metrics.NewForTesting(), fetcher)
+	events := &recordingEmitter{}
+	pool.SetEventEmitter(events)
+
+	_, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.Error(t, err)
+
+	require.Len(t, events.events, 2)
+	assert.Equal(t, EventCrawlStarted, events.events[0].Type)
+	assert.Equal(t, EventCrawlCompleted, events.events[1].Type)
+	assert.Contains(t, events.events[1].Error, "failed to get repository tree: boom")
+}
+
+func TestSetEventEmitterNilDisablesEvents(t *testing.T) {
+	fetcher := &fakeFetcher{treeErr: errors.New("boom")}
+	pool := NewPool(&config.Config{MaxWorkers: 1, MaxConcurrentFetches: 10}, metrics.NewForTesting(), fetcher)
+	assert.Equal(t, LogEmitter{}, pool.events)
+
+	pool.SetEventEmitter(nil)
+	assert.NotPanics(t, func() {
+		_, _ = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	})
+}
+
+func TestLogEmitterLeavesOutFileEvents(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	events := []Event{
+		{Type: EventCrawlStarted, CrawlID: "c1"},
+		{Type: EventFileFetched, Path: "a.go"},
+		{Type: EventFileSkipped, Path: "b.png", Reason: model.SkipFiltered},
+		{Type: EventFileSkipped, Path: "c.go", Reason: model.SkipFetchError, Error: "boom"},
+		{Type: EventCrawlCompleted, CrawlID: "c1"},
+	}
+
+	for _, e := range events {
+		LogEmitter{}.Emit(e)
+	}
+	out := buf.String()
+	assert.Contains(t, out, "event=crawl_started")
+	assert.Contains(t, out, "event=crawl_completed")
+	assert.Contains(t, out, "path=c.go", "skips with an error are still logged")
+	assert.NotContains(t, out, "path=a.go")
+	assert.NotContains(t, out, "path=b.png")
+
+	buf.Reset()
+	for _, e := range events {
+		LogEmitter{Files: true}.Emit(e)
+	}
+	assert.Equal(t, len(events), strings.Count(buf.String(), "event="))
+}
@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// GitHubFetcher is the part of the GitHub client the pool depends on. The pool
+// takes it as an interface so tests can inject canned trees, content and errors.
+type GitHubFetcher interface {
+	// Trees and content
+	GetRepositoryTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error)
+	GetFileContentPrefix(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, error)
+	GetFileContentsGraphQL(ctx context.Context, owner, repo, ref string, paths []string) (map[string][]byte, error)
+	GetBlobs(ctx context.Context, owner, repo string, shas []string) map[string][]byte
+	GetTarball(ctx context.Context, owner, repo, ref string, fn func(io.Reader) error) error
+	BlobURL(owner, repo, sha string) string
+
+	// Pull requests
+	GetPullRequest(ctx context.Context, owner, repo string, number int) (*model.GitHubPullRequestResponse, error)
+	ListPullRequestFiles(ctx context.Context, owner, repo string, number int) ([]model.GitHubPullRequestFile, error)
+
+	// Rate limiting
+	GetRateLimit(ctx context.Context) (*model.RateLimitInfo, error)
+	ThrottleUntil(reset time.Time, budget int)
+}
+
+var _ GitHubFetcher = (*github.Client)(nil)
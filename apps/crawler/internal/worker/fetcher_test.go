@@ -0,0 +1,237 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// fakeFetcher serves canned trees, content and errors. Methods it doesn't
+// override panic through the nil embedded interface, so a test fails loudly if
+// the pool takes a path the fake wasn't set up for.
+type fakeFetcher struct {
+	GitHubFetcher
+
+	tree     *model.GitHubTreeResponse
+	treeErr  error
+	contents map[string][]byte
+	errs     map[string]error
+}
+
+func (f *fakeFetcher) GetRepositoryTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error) {
+	if f.treeErr != nil {
+		return nil, f.treeErr
+	}
+	return f.tree, nil
+}
+
+func (f *fakeFetcher) GetFileContentPrefix(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, error) {
+	if err := f.errs[path]; err != nil {
+		return nil, false, err
+	}
+	content, ok := f.contents[path]
+	if !ok {
+		return nil, false, fmt.Errorf("file not found: %s", path)
+	}
+	if int64(len(content)) > limit {
+		return content[:limit], true, nil
+	}
+	return content, false, nil
+}
+
+func (f *fakeFetcher) BlobURL(owner, repo, sha string) string {
+	return fmt.Sprintf("https://api.github.com/repos/%s/%s/git/blobs/%s", owner, repo, sha)
+}
+
+func TestProcessTaskWithFakeFetcher(t *testing.T) {
+	fetcher := &fakeFetcher{
+		contents: map[string][]byte{
+			"main.go":    []byte("package main\n"),
+			"image.go":   {0x89, 'P', 'N', 'G', 0x00, 0x00, 0x00, 0x0d},
+			"latin1.go":  {'c', 'a', 'f', 0xe9},
+			"growing.go": []byte("0123456789abcdef"),
+		},
+		errs: map[string]error{
+			"broken.go": errors.New("connection reset"),
+		},
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		size        int
+		wantContent string
+		wantErr     string
+		wantStatus  string
+	}{
+		{name: "success", path: "main.go", size: 13, wantContent: "package main\n", wantStatus: "success"},
+		{name: "binary", path: "image.go", size: 8, wantErr: "skipping binary file", wantStatus: "skipped_binary"},
+		{name: "invalid utf-8", path: "latin1.go", size: 4, wantErr: "not valid UTF-8", wantStatus: "skipped_invalid_encoding"},
+		{name: "fetch error", path: "broken.go", size: 10, wantErr: "connection reset", wantStatus: "failed"},
+		// The tree under-reports the size; the capped read catches it
+		{name: "larger than tree size", path: "growing.go", size: 4, wantErr: "exceeds limit 14", wantStatus: "skipped_too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{MaxFileSize: 14, EnableBinaryDetection: true, FetchTimeoutMS: 1000}
+			m := metrics.NewForTesting()
+			pool := NewPool(cfg, m, fetcher)
+
+			task := model.WorkerTask{Path: tt.path, Size: tt.size, Owner: "owner", Repo: "repo", Ref: "main"}
+			result := pool.processTask(1, task)
+
+			if tt.wantErr != "" {
+				require.Error(t, result.Error)
+				assert.Contains(t, result.Error.Error(), tt.wantErr)
+				assert.Nil(t, result.Content)
+			} else {
+				require.NoError(t, result.Error)
+				assert.Equal(t, tt.wantContent, string(result.Content))
+			}
+			assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner", "repo", tt.wantStatus)))
+		})
+	}
+}
+
+func TestProcessTaskWithFakeFetcherTruncates(t *testing.T) {
+	fetcher := &fakeFetcher{contents: map[string][]byte{"big.go": []byte("0123456789abcdef")}}
+	cfg := &config.Config{MaxFileSize: 10, TruncateOversizeBytes: 6, FetchTimeoutMS: 1000}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+
+	result := pool.processTask(1, model.WorkerTask{Path: "big.go", Size: 16, Owner: "owner", Repo: "repo", Ref: "main"})
+
+	require.NoError(t, result.Error)
+	assert.Equal(t, "012345", string(result.Content))
+	assert.True(t, result.Truncated)
+	assert.Equal(t, 16, result.OriginalSize)
+}
+
+// stuckFetcher blocks content fetches until release is closed, ignoring
+// context cancellation like a request wedged below the HTTP client
+type stuckFetcher struct {
+	fakeFetcher
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *stuckFetcher) GetFileContentPrefix(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, error) {
+	f.started <- struct{}{}
+	<-f.release
+	return []byte("package main\n"), false, nil
+}
+
+func TestStopAbandonsStuckWorkers(t *testing.T) {
+	fetcher := &stuckFetcher{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(fetcher.release)
+
+	cfg := &config.Config{MaxWorkers: 1, MaxConcurrentFetches: 10, MaxFileSize: 100, FetchTimeoutMS: 1000, ShutdownTimeoutMS: 50}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+
+	require.NoError(t, pool.SubmitTask(model.WorkerTask{Path: "stuck.go", Size: 13, Owner: "owner", Repo: "repo", Ref: "main"}))
+	<-fetcher.started
+
+	start := time.Now()
+	err := pool.Stop()
+	assert.ErrorIs(t, err, ErrShutdownTimeout)
+	assert.Contains(t, err.Error(), "1 workers still running")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.False(t, pool.IsRunning())
+}
+
+func TestStopWaitsForWorkersWithinTimeout(t *testing.T) {
+	fetcher := &stuckFetcher{started: make(chan struct{}, 1), release: make(chan struct{})}
+
+	cfg := &config.Config{MaxWorkers: 1, MaxConcurrentFetches: 10, MaxFileSize: 100, FetchTimeoutMS: 1000, ShutdownTimeoutMS: 5000}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+
+	require.NoError(t, pool.SubmitTask(model.WorkerTask{Path: "slow.go", Size: 13, Owner: "owner", Repo: "repo", Ref: "main"}))
+	<-fetcher.started
+
+	time.AfterFunc(20*time.Millisecond, func() { close(fetcher.release) })
+	require.NoError(t, pool.Stop())
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	assert.Empty(t, pool.inFlight)
+}
+
+// blobFetcher serves blobs by SHA on top of fakeFetcher's per-path content
+type blobFetcher struct {
+	*fakeFetcher
+	blobs     map[string][]byte
+	blobCalls int
+}
+
+func (f *blobFetcher) GetBlobs(ctx context.Context, owner, repo string, shas []string) map[string][]byte {
+	f.blobCalls++
+	found := make(map[string][]byte)
+	for _, sha := range shas {
+		if blob, ok := f.blobs[sha]; ok {
+			found[sha] = blob
+		}
+	}
+	return found
+}
+
+func TestProcessTaskVerifiesContentSHA(t *testing.T) {
+	current := []byte("package main // v2\n")
+	sha := gitBlobSHA(current)
+
+	tests := []struct {
+		name        string
+		served      []byte // what the per-file path returns
+		blob        []byte // what the blobs API returns for sha, nil for nothing
+		verify      bool
+		refetch     bool
+		wantContent string
+		wantBlobs   int
+	}{
+		{name: "match", served: current, verify: true, refetch: true, wantContent: string(current)},
+		{name: "stale refetched", served: []byte("package main // v1\n"), blob: current, verify: true, refetch: true, wantContent: string(current), wantBlobs: 1},
+		{name: "stale without refetch", served: []byte("package main // v1\n"), verify: true},
+		{name: "refetch mismatched too", served: []byte("v1"), blob: []byte("v0"), verify: true, refetch: true, wantBlobs: 1},
+		{name: "verification off", served: []byte("v1"), wantContent: "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &blobFetcher{fakeFetcher: &fakeFetcher{contents: map[string][]byte{"main.go": tt.served}}}
+			if tt.blob != nil {
+				fetcher.blobs = map[string][]byte{sha: tt.blob}
+			}
+			cfg := &config.Config{MaxFileSize: 1024, FetchTimeoutMS: 1000, VerifyContentSHA: tt.verify, RefetchSHAMismatch: tt.refetch}
+			m := metrics.NewForTesting()
+			pool := NewPool(cfg, m, fetcher)
+
+			result := pool.processTask(1, model.WorkerTask{Path: "main.go", SHA: sha, Size: len(current), Owner: "owner", Repo: "repo", Ref: "main"})
+
+			assert.Equal(t, tt.wantBlobs, fetcher.blobCalls)
+			mismatches := testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("sha_mismatch", "owner", "repo"))
+			if tt.wantContent == "" {
+				assert.ErrorIs(t, result.Error, ErrSHAMismatch)
+				assert.Nil(t, result.Content)
+				assert.Equal(t, float64(1), mismatches)
+				return
+			}
+			require.NoError(t, result.Error)
+			assert.Equal(t, tt.wantContent, string(result.Content))
+			if tt.wantBlobs > 0 {
+				assert.Equal(t, float64(1), mismatches, "the mismatch is recorded even when the refetch fixes it")
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package worker
+
+// stringSet is a precomputed set of extensions or filenames, so per-file
+// checks are map lookups instead of scans over the configured lists
+type stringSet map[string]struct{}
+
+// newStringSet builds a set from values
+func newStringSet(values []string) stringSet {
+	set := make(stringSet, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
+
+// has reports whether value is in the set
+func (s stringSet) has(value string) bool {
+	_, ok := s[value]
+	return ok
+}
@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// ErrIdempotencyKeyReused is returned when an idempotency key comes back with
+// a different crawl than the one it was first used for
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused for a different crawl")
+
+// errCrawlAborted is what callers waiting on a crawl get when it panicked
+var errCrawlAborted = errors.New("idempotent crawl aborted")
+
+// idempotentCrawl is a crawl started under an idempotency key. done is closed
+// once response and err are set.
+type idempotentCrawl struct {
+	fingerprint string
+	done        chan struct{}
+	response    *model.CrawlResponse
+	err         error
+	finished    time.Time
+}
+
+// idempotencyCache holds crawls by idempotency key, so a retried request joins
+// the crawl still running for it or gets the result of the one that finished
+// within ttl. Once maxKeys are held the oldest key is dropped; failed crawls
+// aren't kept, so retrying one starts it again.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	crawls  map[string]*idempotentCrawl
+	order   []string
+	ttl     time.Duration
+	maxKeys int
+}
+
+// newIdempotencyCache creates a cache holding up to maxKeys keys for ttl
+func newIdempotencyCache(ttl time.Duration, maxKeys int) *idempotencyCache {
+	return &idempotencyCache{crawls: make(map[string]*idempotentCrawl), ttl: ttl, maxKeys: maxKeys}
+}
+
+// do runs crawl under key unless a crawl with the same key and fingerprint is
+// running or finished recently, in which case it waits for or returns that
+// crawl's response. The response is shared between callers, who must not
+// modify it. result is "new", "in_flight" or "cached". crawl must not depend
+// on the first caller's cancellation, since the callers joining it would get
+// that caller's error.
+func (c *idempotencyCache) do(ctx context.Context, key, fingerprint string, crawl func() (*model.CrawlResponse, error)) (response *model.CrawlResponse, result string, err error) {
+	c.mu.Lock()
+	if existing, ok := c.crawls[key]; ok && !c.expired(existing) {
+		c.mu.Unlock()
+		if existing.fingerprint != fingerprint {
+			return nil, "", fmt.Errorf("%w: %q", ErrIdempotencyKeyReused, key)
+		}
+
+		result = "cached"
+		select {
+		case <-existing.done:
+		default:
+			result = "in_flight"
+		}
+		select {
+		case <-existing.done:
+			return existing.response, result, existing.err
+		case <-ctx.Done():
+			return nil, result, ctx.Err()
+		}
+	}
+
+	entry := &idempotentCrawl{fingerprint: fingerprint, done: make(chan struct{})}
+	c.put(key, entry)
+	c.mu.Unlock()
+
+	// Deferred so joiners are released, and the key freed, even if crawl panics
+	entry.err = errCrawlAborted
+	defer func() {
+		c.mu.Lock()
+		entry.finished = time.Now()
+		if entry.err != nil && c.crawls[key] == entry {
+			c.remove(key)
+		}
+		c.mu.Unlock()
+		close(entry.done)
+	}()
+
+	entry.response, entry.err = crawl()
+	return entry.response, "new", entry.err
+}
+
+// expired reports whether a finished crawl is past the TTL; running crawls
+// never expire
+func (c *idempotencyCache) expired(entry *idempotentCrawl) bool {
+	return !entry.finished.IsZero() && time.Since(entry.finished) > c.ttl
+}
+
+// put stores an entry under key, dropping the oldest keys once full
+func (c *idempotencyCache) put(key string, entry *idempotentCrawl) {
+	if _, ok := c.crawls[key]; ok {
+		c.remove(key)
+	}
+	for len(c.order) >= c.maxKeys {
+		delete(c.crawls, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.crawls[key] = entry
+	c.order = append(c.order, key)
+}
+
+// remove drops key from the cache
+func (c *idempotencyCache) remove(key string) {
+	delete(c.crawls, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// idempotent runs crawl under opts.IdempotencyKey, or just runs it when the
+// key is empty or idempotency is disabled. target identifies what is crawled;
+// the rest of the request and any tenant token are folded into the
+// fingerprint, so a key reused by another request or tenant can't return a
+// result it didn't ask for.
+func (p *Pool) idempotent(ctx context.Context, target string, opts CrawlOptions, crawl func() (*model.CrawlResponse, error)) (*model.CrawlResponse, error) {
+	if opts.IdempotencyKey == "" || p.idempotency == nil {
+		return crawl()
+	}
+
+	response, result, err := p.idempotency.do(ctx, opts.IdempotencyKey, crawlFingerprint(target, opts), crawl)
+	if result != "" {
+		p.metrics.RecordIdempotentCrawl(result)
+	}
+	return response, err
+}
+
+// detachCrawl returns a context for a crawl shared with retries: it outlives
+// the caller's cancellation, so a client going away doesn't fail the retries
+// waiting on it, but keeps the caller's deadline. CRAWL_DEADLINE_MS still
+// applies inside the crawl, so a caller without a deadline is bounded by that
+// alone.
+func detachCrawl(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return detached, func() {}
+}
+
+// crawlFingerprint hashes what a crawl's result depends on
+func crawlFingerprint(target string, opts CrawlOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%v\x00%s\x00%v\x00%d\x00%v\x00%v\x00%v\x00%s\x00%v\x00%v\x00%s",
+		target, opts.OutputMode, opts.PathFilter, opts.Paths, opts.Languages, opts.MaxPathDepth,
+		opts.AllowedExtensions, opts.Ordered, opts.KnownSHAs, opts.ResumeFrom, opts.AllowLarge,
+		opts.IncludeTree, opts.GitHubToken)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,293 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestIdempotencyCacheJoinsRunningCrawl(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute, 10)
+	release := make(chan struct{})
+	var runs atomic.Int32
+	crawl := func() (*model.CrawlResponse, error) {
+		runs.Add(1)
+		<-release
+		return &model.CrawlResponse{CrawlID: "first"}, nil
+	}
+
+	first := make(chan *model.CrawlResponse)
+	go func() {
+		response, result, err := cache.do(context.Background(), "key", "fp", crawl)
+		assert.NoError(t, err)
+		assert.Equal(t, "new", result)
+		first <- response
+	}()
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	joined := make(chan *model.CrawlResponse)
+	go func() {
+		response, _, err := cache.do(context.Background(), "key", "fp", crawl)
+		assert.NoError(t, err)
+		joined <- response
+	}()
+
+	// A joiner that gives up doesn't affect the crawl
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, result, err := cache.do(ctx, "key", "fp", crawl)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "in_flight", result)
+
+	close(release)
+	assert.Equal(t, "first", (<-first).CrawlID)
+	assert.Equal(t, "first", (<-joined).CrawlID)
+
+	response, result, err := cache.do(context.Background(), "key", "fp", crawl)
+	require.NoError(t, err)
+	assert.Equal(t, "cached", result)
+	assert.Equal(t, "first", response.CrawlID)
+	assert.Equal(t, int32(1), runs.Load())
+}
+
+func TestIdempotencyCacheExpiryAndFailures(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute, 2)
+	var runs int
+	crawl := func() (*model.CrawlResponse, error) {
+		runs++
+		return &model.CrawlResponse{}, nil
+	}
+	failing := func() (*model.CrawlResponse, error) {
+		runs++
+		return nil, errors.New("tree fetch failed")
+	}
+	ctx := context.Background()
+
+	_, _, err := cache.do(ctx, "key", "fp", crawl)
+	require.NoError(t, err)
+
+	_, _, err = cache.do(ctx, "key", "other", crawl)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	// Past the TTL the key starts a new crawl
+	cache.crawls["key"].finished = time.Now().Add(-2 * time.Minute)
+	_, result, err := cache.do(ctx, "key", "other", crawl)
+	require.NoError(t, err)
+	assert.Equal(t, "new", result)
+	assert.Equal(t, 2, runs)
+
+	// Failures are retried rather than remembered
+	for range 2 {
+		_, result, err = cache.do(ctx, "failing", "fp", failing)
+		assert.Error(t, err)
+		assert.Equal(t, "new", result)
+	}
+	assert.Equal(t, 4, runs)
+
+	// Only the newest keys are held
+	_, _, err = cache.do(ctx, "second", "fp", crawl)
+	require.NoError(t, err)
+	_, _, err = cache.do(ctx, "third", "fp", crawl)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second", "third"}, cache.order)
+	assert.Len(t, cache.crawls, 2)
+}
+
+func TestIdempotencyCacheReleasesJoinersOnPanic(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute, 10)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _, _ = cache.do(context.Background(), "key", "fp", func() (*model.CrawlResponse, error) {
+			close(started)
+			<-release
+			panic("crawl blew up")
+		})
+	}()
+	<-started
+
+	joined := make(chan error)
+	go func() {
+		_, _, err := cache.do(context.Background(), "key", "fp", func() (*model.CrawlResponse, error) {
+			return nil, errors.New("joiner ran its own crawl")
+		})
+		joined <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	close(release)
+	select {
+	case err := <-joined:
+		assert.ErrorIs(t, err, errCrawlAborted)
+	case <-time.After(time.Second):
+		t.Fatal("joiner still blocked after the crawl panicked")
+	}
+
+	cache.mu.Lock()
+	assert.NotContains(t, cache.crawls, "key", "a panicked crawl isn't remembered")
+	cache.mu.Unlock()
+}
+
+// countingFetcher counts tree fetches
+type countingFetcher struct {
+	*fakeFetcher
+	trees atomic.Int32
+}
+
+func (f *countingFetcher) GetRepositoryTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error) {
+	f.trees.Add(1)
+	return f.fakeFetcher.GetRepositoryTree(ctx, owner, repo, ref)
+}
+
+func TestCrawlRepositoryIdempotencyKey(t *testing.T) {
+	fetcher := &countingFetcher{fakeFetcher: &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA:  "root123",
+			Tree: []model.TreeEntry{{Path: "main.go", Type: "blob", SHA: "a1", Size: 9}},
+		},
+		contents: map[string][]byte{"main.go": []byte("package a")},
+	}}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		IdempotencyTTLMS:     60000,
+		IdempotencyMaxKeys:   10,
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	ctx := context.Background()
+	opts := CrawlOptions{IdempotencyKey: "retry-1"}
+	first, err := pool.CrawlRepository(ctx, "owner", "repo", "main", opts)
+	require.NoError(t, err)
+	second, err := pool.CrawlRepository(ctx, "owner", "repo", "main", opts)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, int32(1), fetcher.trees.Load(), "the retry doesn't crawl again")
+
+	_, err = pool.CrawlRepository(ctx, "owner", "repo", "dev", opts)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+	_, err = pool.CrawlRepository(ctx, "owner", "repo", "main", CrawlOptions{IdempotencyKey: "retry-1", GitHubToken: "tenant"})
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused, "another tenant can't read the result")
+
+	_, err = pool.CrawlRepository(ctx, "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), fetcher.trees.Load(), "crawls without a key always run")
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.IdempotentCrawls.WithLabelValues("new")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.IdempotentCrawls.WithLabelValues("cached")))
+}
+
+// blockingFetcher holds tree fetches until release is closed or the fetch is
+// cancelled
+type blockingFetcher struct {
+	*fakeFetcher
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *blockingFetcher) GetRepositoryTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error) {
+	close(f.started)
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return f.fakeFetcher.GetRepositoryTree(ctx, owner, repo, ref)
+}
+
+func TestCrawlRepositoryIdempotencyOutlivesFirstCaller(t *testing.T) {
+	fetcher := &blockingFetcher{
+		fakeFetcher: &fakeFetcher{
+			tree: &model.GitHubTreeResponse{
+				SHA:  "root123",
+				Tree: []model.TreeEntry{{Path: "main.go", Type: "blob", SHA: "a1", Size: 9}},
+			},
+			contents: map[string][]byte{"main.go": []byte("package a")},
+		},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		IdempotencyTTLMS:     60000,
+		IdempotencyMaxKeys:   10,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	opts := CrawlOptions{IdempotencyKey: "retry-1"}
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := pool.CrawlRepository(firstCtx, "owner", "repo", "main", opts)
+		first <- err
+	}()
+	<-fetcher.started
+
+	joined := make(chan *model.CrawlResponse)
+	go func() {
+		response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", opts)
+		assert.NoError(t, err)
+		joined <- response
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The first client goes away while the retry waits for its crawl
+	cancelFirst()
+	time.Sleep(20 * time.Millisecond)
+	close(fetcher.release)
+
+	response := <-joined
+	require.NotNil(t, response)
+	assert.Equal(t, 1, response.TotalFiles)
+	assert.NoError(t, <-first)
+}
+
+func TestCrawlRepositoryIdempotencyKeepsCallerDeadline(t *testing.T) {
+	fetcher := &blockingFetcher{
+		fakeFetcher: &fakeFetcher{},
+		started:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		IdempotencyTTLMS:     60000,
+		IdempotencyMaxKeys:   10,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	// With no crawl deadline, the caller's is all that bounds the shared crawl
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := pool.CrawlRepository(ctx, "owner", "repo", "main", CrawlOptions{IdempotencyKey: "retry-1"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// ignoreFilePaths are where a repository can keep the crawler's ignore file,
+// in order of preference
+var ignoreFilePaths = []string{".autodocs/ignore", ".autodocsignore"}
+
+// maxIgnoreFileSize caps how much of an ignore file is read
+const maxIgnoreFileSize = 64 * 1024
+
+// ignoreRule is one pattern of an ignore file
+type ignoreRule struct {
+	segments []string // pattern split on "/"; "**" matches any number of segments
+	negate   bool     // "!" re-includes what earlier rules excluded
+	dirOnly  bool     // a trailing "/" only matches directories
+}
+
+// ignoreRules is a parsed ignore file. Patterns follow gitignore syntax and
+// are relative to the repository root; the last matching rule wins, and a
+// file under an ignored directory can't be re-included.
+type ignoreRules struct {
+	rules []ignoreRule
+}
+
+// parseIgnoreFile parses gitignore-style patterns, skipping blank lines,
+// comments and invalid patterns
+func parseIgnoreFile(content []byte) *ignoreRules {
+	var rules []ignoreRule
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " \t")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// A pattern with a slash before its end is anchored to the root;
+		// one without matches at any depth
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		rule.segments = strings.Split(line, "/")
+		if !validIgnorePattern(rule.segments) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &ignoreRules{rules: rules}
+}
+
+// validIgnorePattern reports whether every segment is a valid glob
+func validIgnorePattern(segments []string) bool {
+	for _, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ignored reports whether a file is excluded by the rules. A nil set ignores
+// nothing.
+func (r *ignoreRules) ignored(file string) bool {
+	if r == nil {
+		return false
+	}
+	parts := strings.Split(file, "/")
+	for i := 1; i < len(parts); i++ {
+		if r.excluded(parts[:i], true) {
+			return true
+		}
+	}
+	return r.excluded(parts, false)
+}
+
+// excluded applies every rule to one path, the last match deciding
+func (r *ignoreRules) excluded(parts []string, isDir bool) bool {
+	excluded := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.segments, parts) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// matchSegments matches path segments against glob segments, where "**"
+// matches zero or more whole segments, or one or more at the end, so "tmp/**"
+// matches everything inside tmp but not tmp itself
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for skip := 0; skip <= len(parts); skip++ {
+				if matchSegments(pattern[1:], parts[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// loadIgnoreFile fetches and parses the repository's ignore file when
+// HonorIgnoreFile is set. With the tree at hand only a file it lists is
+// fetched; otherwise each location is tried in turn. A missing file ignores
+// nothing, but any other failure fails the crawl rather than crawling files
+// the repository opted out of.
+func (p *Pool) loadIgnoreFile(ctx context.Context, owner, repo, ref string, tree []model.TreeEntry) (*ignoreRules, error) {
+	if !p.config.HonorIgnoreFile {
+		return nil, nil
+	}
+
+	candidates := ignoreFilePaths
+	if tree != nil {
+		candidates = nil
+		for _, name := range ignoreFilePaths {
+			if slices.ContainsFunc(tree, func(entry model.TreeEntry) bool { return entry.Type == "blob" && entry.Path == name }) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	for _, name := range candidates {
+		content, _, err := p.githubClient.GetFileContentPrefix(ctx, owner, repo, name, ref, maxIgnoreFileSize)
+		if errors.Is(err, github.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		rules := parseIgnoreFile(content)
+		if rules != nil {
+			log.Printf("Applying %d patterns from %s in %s/%s", len(rules.rules), name, owner, repo)
+		}
+		return rules, nil
+	}
+	return nil, nil
+}
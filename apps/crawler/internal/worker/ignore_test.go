@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules := parseIgnoreFile([]byte(`# generated code
+*.pb.go
+/build/
+docs/internal
+vendor/
+!vendor/keep.go
+tmp/**
+**/fixtures/*.json
+scripts/*.sh
+!important.pb.go
+\#literal.md
+[a-
+`))
+	require.NotNil(t, rules)
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"main.go", false},
+		{"api/service.pb.go", true},
+		{"api/important.pb.go", false},
+		{"build/out.go", true},
+		{"cmd/build/main.go", false},
+		{"docs/internal/notes.md", true},
+		{"docs/internal.md", false},
+		{"pkg/docs/internal/notes.md", false},
+		{"vendor/lib/a.go", true},
+		{"vendor/keep.go", true},
+		{"vendor", false},
+		{"tmp/a/b.go", true},
+		{"tmp", false},
+		{"fixtures/data.json", true},
+		{"test/deep/fixtures/data.json", true},
+		{"test/fixtures/nested/data.json", false},
+		{"scripts/deploy.sh", true},
+		{"scripts/ci/deploy.sh", false},
+		{"#literal.md", true},
+		{"[a-", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.ignored, rules.ignored(tt.path))
+		})
+	}
+
+	assert.Nil(t, parseIgnoreFile([]byte("# nothing here\n\n")))
+	assert.False(t, (*ignoreRules)(nil).ignored("main.go"))
+}
+
+func TestCrawlRepositoryHonorsIgnoreFile(t *testing.T) {
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: ".autodocsignore", Type: "blob", SHA: "i1", Size: 20},
+				{Path: "main.go", Type: "blob", SHA: "a1", Size: 9},
+				{Path: "gen/api.go", Type: "blob", SHA: "a2", Size: 9},
+			},
+		},
+		contents: map[string][]byte{
+			".autodocsignore": []byte("gen/\n"),
+			"main.go":         []byte("package a"),
+			"gen/api.go":      []byte("package b"),
+		},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		HonorIgnoreFile:      true,
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+	require.Len(t, response.Files, 1)
+	assert.Equal(t, "main.go", response.Files[0].Path)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("ignore_file")))
+
+	// Without an ignore file in the tree nothing is fetched for it; the fake
+	// would fail the crawl if it were
+	fetcher.tree.Tree = fetcher.tree.Tree[1:]
+	response, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+	assert.Len(t, response.Files, 2)
+
+	// An ignore file that can't be read fails the crawl
+	fetcher.tree.Tree = append(fetcher.tree.Tree, model.TreeEntry{Path: ".autodocs/ignore", Type: "blob", SHA: "i2", Size: 5})
+	fetcher.errs = map[string]error{".autodocs/ignore": errors.New("connection reset")}
+	_, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	assert.ErrorContains(t, err, "failed to read .autodocs/ignore")
+}
+
+func TestLoadIgnoreFileWithoutTree(t *testing.T) {
+	fetcher := &fakeFetcher{
+		contents: map[string][]byte{".autodocsignore": []byte("*.md\n")},
+		errs:     map[string]error{".autodocs/ignore": fmt.Errorf("%w: .autodocs/ignore", github.ErrNotFound)},
+	}
+	pool := NewPool(&config.Config{HonorIgnoreFile: true, MaxConcurrentFetches: 1}, metrics.NewForTesting(), fetcher)
+
+	rules, err := pool.loadIgnoreFile(context.Background(), "owner", "repo", "main", nil)
+	require.NoError(t, err)
+	assert.True(t, rules.ignored("README.md"), "falls back to .autodocsignore")
+
+	fetcher.errs[".autodocsignore"] = github.ErrNotFound
+	rules, err = pool.loadIgnoreFile(context.Background(), "owner", "repo", "main", nil)
+	require.NoError(t, err)
+	assert.Nil(t, rules)
+
+	pool.config.HonorIgnoreFile = false
+	fetcher.errs = nil
+	rules, err = pool.loadIgnoreFile(context.Background(), "owner", "repo", "main", nil)
+	require.NoError(t, err)
+	assert.Nil(t, rules, "off unless configured")
+}
@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnknownLanguage is returned when a crawl names a language with no file mapping
+var ErrUnknownLanguage = errors.New("unknown language")
+
+// languageFiles describes the files that belong to a language
+type languageFiles struct {
+	extensions []string // lowercased, with leading dot
+	filenames  []string // lowercased special filenames such as manifests
+}
+
+// languages maps language names to their file extensions and special files
+var languages = map[string]languageFiles{
+	"python": {
+		extensions: []string{".py", ".pyi", ".pyx"},
+		filenames:  []string{"requirements.txt", "setup.py", "setup.cfg", "pyproject.toml", "pipfile", "poetry.lock"},
+	},
+	"go": {
+		extensions: []string{".go"},
+		filenames:  []string{"go.mod", "go.sum"},
+	},
+	"javascript": {
+		extensions: []string{".js", ".jsx", ".mjs", ".cjs"},
+		filenames:  []string{"package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml"},
+	},
+	"typescript": {
+		extensions: []string{".ts", ".tsx", ".mts", ".cts"},
+		filenames:  []string{"package.json", "tsconfig.json"},
+	},
+	"java": {
+		extensions: []string{".java"},
+		filenames:  []string{"pom.xml", "build.gradle"},
+	},
+	"kotlin": {
+		extensions: []string{".kt", ".kts"},
+		filenames:  []string{"build.gradle", "build.gradle.kts"},
+	},
+	"scala": {
+		extensions: []string{".scala", ".sc"},
+		filenames:  []string{"build.sbt"},
+	},
+	"rust": {
+		extensions: []string{".rs"},
+		filenames:  []string{"cargo.toml", "cargo.lock"},
+	},
+	"ruby": {
+		extensions: []string{".rb"},
+		filenames:  []string{"gemfile", "rakefile"},
+	},
+	"php": {
+		extensions: []string{".php"},
+		filenames:  []string{"composer.json", "composer.lock"},
+	},
+	"c": {
+		extensions: []string{".c", ".h"},
+		filenames:  []string{"makefile"},
+	},
+	"cpp": {
+		extensions: []string{".cpp", ".cc", ".cxx", ".hpp", ".hh", ".h"},
+		filenames:  []string{"makefile", "cmakelists.txt"},
+	},
+	"csharp": {
+		extensions: []string{".cs"},
+	},
+	"swift": {
+		extensions: []string{".swift"},
+		filenames:  []string{"package.swift", "podfile"},
+	},
+	"shell": {
+		extensions: []string{".sh", ".bash", ".zsh", ".fish"},
+	},
+	"markdown": {
+		extensions: []string{".md", ".rst"},
+	},
+}
+
+// ValidateLanguages checks that every language name has a file mapping
+func ValidateLanguages(names []string) error {
+	for _, name := range names {
+		if _, ok := languages[strings.ToLower(strings.TrimSpace(name))]; !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownLanguage, name)
+		}
+	}
+	return nil
+}
+
+// matchesLanguages reports whether path belongs to any of the named languages.
+// An empty set matches everything.
+func matchesLanguages(path string, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	filename := strings.ToLower(filepath.Base(path))
+
+	for _, name := range names {
+		files := languages[strings.ToLower(strings.TrimSpace(name))]
+		for _, e := range files.extensions {
+			if ext == e {
+				return true
+			}
+		}
+		for _, f := range files.filenames {
+			if filename == f {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLanguages(t *testing.T) {
+	assert.NoError(t, ValidateLanguages(nil))
+	assert.NoError(t, ValidateLanguages([]string{"python", "Go", " rust "}))
+
+	err := ValidateLanguages([]string{"python", "klingon"})
+	assert.ErrorIs(t, err, ErrUnknownLanguage)
+	assert.Contains(t, err.Error(), "klingon")
+}
+
+func TestMatchesLanguages(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		languages []string
+		expected  bool
+	}{
+		{name: "no languages", path: "main.go", expected: true},
+		{name: "extension match", path: "src/app.py", languages: []string{"python"}, expected: true},
+		{name: "stub file", path: "src/app.pyi", languages: []string{"python"}, expected: true},
+		{name: "special file", path: "requirements.txt", languages: []string{"python"}, expected: true},
+		{name: "case insensitive", path: "PyProject.toml", languages: []string{"Python"}, expected: true},
+		{name: "other language", path: "main.go", languages: []string{"python"}, expected: false},
+		{name: "any of several", path: "main.go", languages: []string{"python", "go"}, expected: true},
+		{name: "unrelated text file", path: "notes.txt", languages: []string{"python"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchesLanguages(tt.path, tt.languages))
+		})
+	}
+}
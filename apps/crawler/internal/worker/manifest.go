@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// Manifest lists the files of a repository at ref that pass the crawl's
+// filters, with their sizes and SHAs, from a single tree fetch. No content is
+// fetched, so it costs one API call however large the repository.
+func (p *Pool) Manifest(ctx context.Context, owner, repo, ref string, opts CrawlOptions) (*model.ManifestResponse, error) {
+	startTime := time.Now()
+	ctx = github.WithToken(ctx, opts.GitHubToken)
+
+	if len(opts.Paths) > 0 {
+		return nil, fmt.Errorf("manifests are built from the tree; explicit paths are not supported")
+	}
+	if err := ValidateLanguages(opts.Languages); err != nil {
+		return nil, err
+	}
+	opts.AllowedExtensions = config.NormalizeExtensions(opts.AllowedExtensions)
+	opts.allowedExtensionSet = newStringSet(opts.AllowedExtensions)
+
+	tree, err := p.fetchTree(ctx, owner, repo, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository tree: %w", err)
+	}
+	if tree.Truncated {
+		log.Printf("Tree of %s/%s at %s is truncated; the manifest is incomplete", owner, repo, ref)
+	}
+
+	manifest := &model.ManifestResponse{
+		RootTreeSHA: tree.SHA,
+		RepoInfo:    model.RepositoryInfo{Owner: owner, Name: repo, Ref: ref},
+		Truncated:   tree.Truncated,
+		Files:       []model.TreeEntry{},
+	}
+	for _, entry := range tree.Tree {
+		if entry.Type != "blob" {
+			continue
+		}
+		manifest.TreeFiles++
+		if p.filterReason(entry.Path, entry.Size, opts) != "" {
+			manifest.FilteredFiles++
+			continue
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	manifest.Duration = time.Since(startTime).String()
+
+	return manifest, nil
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestManifest(t *testing.T) {
+	// No contents: fetching any file would fail the test
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA:       "root123",
+			Truncated: true,
+			Tree: []model.TreeEntry{
+				{Path: "src", Type: "tree", SHA: "t1"},
+				{Path: "src/main.go", Mode: "100644", Type: "blob", SHA: "g1", Size: 120},
+				{Path: "src/app.py", Mode: "100644", Type: "blob", SHA: "p1", Size: 80},
+				{Path: "src/huge.go", Mode: "100644", Type: "blob", SHA: "g2", Size: 5000},
+				{Path: "docs/guide.md", Mode: "100644", Type: "blob", SHA: "m1", Size: 40},
+				{Path: "run.sh", Mode: "100755", Type: "blob", SHA: "s1", Size: 30},
+			},
+		},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go", ".py", ".md", ".sh"},
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+
+	manifest, err := pool.Manifest(context.Background(), "owner", "repo", "main", CrawlOptions{PathFilter: []string{"src/"}, Languages: []string{"go", "python"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "root123", manifest.RootTreeSHA)
+	assert.Equal(t, model.RepositoryInfo{Owner: "owner", Name: "repo", Ref: "main"}, manifest.RepoInfo)
+	assert.True(t, manifest.Truncated)
+	assert.Equal(t, 5, manifest.TreeFiles)
+	assert.Equal(t, 3, manifest.FilteredFiles)
+	assert.Equal(t, []model.TreeEntry{
+		{Path: "src/main.go", Mode: "100644", Type: "blob", SHA: "g1", Size: 120},
+		{Path: "src/app.py", Mode: "100644", Type: "blob", SHA: "p1", Size: 80},
+	}, manifest.Files)
+}
+
+func TestManifestErrors(t *testing.T) {
+	pool := NewPool(&config.Config{MaxWorkers: 1, MaxConcurrentFetches: 1, MaxFileSize: 1024}, metrics.NewForTesting(), &fakeFetcher{treeErr: assert.AnError})
+
+	_, err := pool.Manifest(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	assert.ErrorIs(t, err, assert.AnError)
+
+	_, err = pool.Manifest(context.Background(), "owner", "repo", "main", CrawlOptions{Languages: []string{"klingon"}})
+	assert.ErrorIs(t, err, ErrUnknownLanguage)
+
+	_, err = pool.Manifest(context.Background(), "owner", "repo", "main", CrawlOptions{Paths: []string{"a.go"}})
+	assert.ErrorContains(t, err, "explicit paths are not supported")
+}
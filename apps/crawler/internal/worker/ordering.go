@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"log"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// orderedBuffer releases results in a fixed path order, holding back results
+// that arrive ahead of a slower earlier file. At most max results are held;
+// past that the buffer gives up on the missing files and releases what it has,
+// and results for the skipped positions are released whenever they arrive.
+type orderedBuffer struct {
+	index      map[string]int
+	next       int
+	pending    map[int]model.FileResult
+	gaps       map[int]bool
+	max        int
+	overflowed bool
+}
+
+// newOrderedBuffer creates a buffer releasing results in the order of paths
+func newOrderedBuffer(paths []string, max int) *orderedBuffer {
+	index := make(map[string]int, len(paths))
+	for i, path := range paths {
+		index[path] = i
+	}
+
+	return &orderedBuffer{
+		index:   index,
+		pending: make(map[int]model.FileResult),
+		gaps:    make(map[int]bool),
+		max:     max,
+	}
+}
+
+// push adds a result and releases every result that is now in sequence
+func (b *orderedBuffer) push(result model.FileResult, emit func(model.FileResult)) {
+	i, ok := b.index[result.Path]
+	if !ok || i < b.next {
+		emit(result) // unknown path or a position already given up on
+		return
+	}
+
+	b.pending[i] = result
+	b.release(emit)
+
+	if b.max > 0 && len(b.pending) > b.max {
+		if !b.overflowed {
+			b.overflowed = true
+			log.Printf("Ordered buffer exceeded %d results, releasing out of order", b.max)
+		}
+		b.skipToPending()
+		b.release(emit)
+	}
+}
+
+// skip marks a path that will never produce a result, such as a dropped task
+func (b *orderedBuffer) skip(path string, emit func(model.FileResult)) {
+	if i, ok := b.index[path]; ok && i >= b.next {
+		b.gaps[i] = true
+		b.release(emit)
+	}
+}
+
+// flush releases everything still held, in order
+func (b *orderedBuffer) flush(emit func(model.FileResult)) {
+	for len(b.pending) > 0 {
+		b.skipToPending()
+		b.release(emit)
+	}
+}
+
+// release emits results from the head of the sequence until it hits a gap
+func (b *orderedBuffer) release(emit func(model.FileResult)) {
+	for {
+		if result, ok := b.pending[b.next]; ok {
+			delete(b.pending, b.next)
+			emit(result)
+		} else if b.gaps[b.next] {
+			delete(b.gaps, b.next)
+		} else {
+			return
+		}
+		b.next++
+	}
+}
+
+// skipToPending moves the head of the sequence to the earliest held result
+func (b *orderedBuffer) skipToPending() {
+	lowest := -1
+	for i := range b.pending {
+		if lowest == -1 || i < lowest {
+			lowest = i
+		}
+	}
+	if lowest > b.next {
+		for i := b.next; i < lowest; i++ {
+			delete(b.gaps, i)
+		}
+		b.next = lowest
+	}
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// recorder collects emitted paths in order
+type recorder struct {
+	paths []string
+}
+
+func (r *recorder) emit(result model.FileResult) {
+	r.paths = append(r.paths, result.Path)
+}
+
+func TestOrderedBuffer(t *testing.T) {
+	var out recorder
+	b := newOrderedBuffer([]string{"a", "b", "c", "d"}, 10)
+
+	b.push(model.FileResult{Path: "c"}, out.emit)
+	b.push(model.FileResult{Path: "b"}, out.emit)
+	assert.Empty(t, out.paths, "results ahead of a are held back")
+
+	b.push(model.FileResult{Path: "a"}, out.emit)
+	assert.Equal(t, []string{"a", "b", "c"}, out.paths)
+
+	b.push(model.FileResult{Path: "d"}, out.emit)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, out.paths)
+}
+
+func TestOrderedBufferSkip(t *testing.T) {
+	var out recorder
+	b := newOrderedBuffer([]string{"a", "b", "c"}, 10)
+
+	b.push(model.FileResult{Path: "b"}, out.emit)
+	b.push(model.FileResult{Path: "c"}, out.emit)
+	b.skip("a", out.emit)
+
+	assert.Equal(t, []string{"b", "c"}, out.paths)
+}
+
+func TestOrderedBufferOverflow(t *testing.T) {
+	var out recorder
+	b := newOrderedBuffer([]string{"slow", "b", "c", "d"}, 2)
+
+	b.push(model.FileResult{Path: "b"}, out.emit)
+	b.push(model.FileResult{Path: "c"}, out.emit)
+	assert.Empty(t, out.paths)
+
+	// A third held result exceeds the cap and releases past the slow file
+	b.push(model.FileResult{Path: "d"}, out.emit)
+	assert.Equal(t, []string{"b", "c", "d"}, out.paths)
+
+	// The slow file is still delivered when it arrives
+	b.push(model.FileResult{Path: "slow"}, out.emit)
+	assert.Equal(t, []string{"b", "c", "d", "slow"}, out.paths)
+}
+
+func TestOrderedBufferFlush(t *testing.T) {
+	var out recorder
+	b := newOrderedBuffer([]string{"a", "b", "c", "d"}, 10)
+
+	b.push(model.FileResult{Path: "d"}, out.emit)
+	b.push(model.FileResult{Path: "b"}, out.emit)
+	b.flush(out.emit)
+
+	assert.Equal(t, []string{"b", "d"}, out.paths)
+}
+
+func TestCollectorOrdered(t *testing.T) {
+	pool := NewPool(&config.Config{OrderedBufferMaxResults: 10}, metrics.NewForTesting(), &github.Client{})
+
+	collected := pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{Ordered: true})
+	collected.expect([]model.TreeEntry{{Path: "a.go"}, {Path: "b.go"}, {Path: "c.go"}})
+
+	collected.add(model.FileResult{Path: "c.go"})
+	collected.add(model.FileResult{Path: "a.go"})
+	collected.skip("b.go")
+
+	response := collected.response("main", 3)
+	paths := make([]string, len(response.Files))
+	for i, file := range response.Files {
+		paths[i] = file.Path
+	}
+	assert.Equal(t, []string{"a.go", "c.go"}, paths)
+}
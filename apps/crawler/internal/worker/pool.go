@@ -2,11 +2,16 @@ package worker
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -16,38 +21,187 @@ import (
 	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
 )
 
+// ErrInsufficientQuota is returned when a crawl is refused because it would
+// exceed the remaining GitHub rate limit
+var ErrInsufficientQuota = errors.New("insufficient GitHub rate limit for crawl")
+
+// ErrCrawlTooLarge is returned when a tree crawl has more files left after
+// filtering than MaxTreeEntries and the request didn't allow large crawls
+var ErrCrawlTooLarge = errors.New("crawl too large")
+
+// Errors set on results for fetched files that fail the content checks
+var (
+	ErrBinaryFile      = errors.New("skipping binary file")
+	ErrInvalidEncoding = errors.New("file content is not valid UTF-8")
+	ErrFileHook        = errors.New("file hook")
+
+	// ErrSHAMismatch is set when fetched content doesn't hash to the tree's
+	// blob SHA, such as a stale copy from the raw content CDN
+	ErrSHAMismatch = errors.New("content does not match blob SHA")
+)
+
+// ErrTaskQueueFull is returned by SubmitTask when TaskQueueSize
+// tasks are already waiting for a worker
+var ErrTaskQueueFull = errors.New("task queue is full")
+
+// ErrShutdownTimeout is returned by Stop when workers are still busy after
+// ShutdownTimeoutMS; they are abandoned rather than waited for
+var ErrShutdownTimeout = errors.New("worker pool shutdown timed out")
+
 // Pool represents a worker pool for processing crawl tasks
 type Pool struct {
 	config       *config.Config
 	metrics      *metrics.Metrics
-	githubClient *github.Client
+	githubClient GitHubFetcher
 
 	// Channels
 	taskChan   chan model.WorkerTask
+	submitMu   sync.RWMutex // held to send on taskChan, and by Stop to close it
 	resultChan chan model.FileResult
 
+	// spill buffers results on disk when the shared result channel is full
+	spill *spillBuffer
+
+	// fileHook runs custom processing on each fetched file, see SetFileHook
+	fileHook FileHook
+
+	// events receives crawl lifecycle events, see SetEventEmitter
+	events EventEmitter
+
+	// treeSlots bounds concurrent tree fetches to TreeFetchConcurrency; nil
+	// leaves them unbounded
+	treeSlots chan struct{}
+
+	// transforms are the configured ContentTransforms, applied in order by
+	// checkContent
+	transforms []Transform
+
+	// ramp admits workers gradually after the pool was idle; nil when
+	// RampUpMS is 0
+	ramp *rampUp
+
+	// idempotency holds crawls by CrawlOptions.IdempotencyKey; nil when
+	// IdempotencyTTLMS is 0
+	idempotency *idempotencyCache
+
+	// Lookup sets for the configured allowlists, built once in NewPool
+	allowedExtensionSet stringSet
+	specialFileSet      stringSet
+
 	// Control
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 
 	// State
+	running       bool
 	activeWorkers int
+	nextWorkerID  int
+	inFlight      map[int]inFlightTask // by worker ID, for naming stuck workers at shutdown
 	mu            sync.RWMutex
 }
 
+// inFlightTask is the file a worker is currently processing
+type inFlightTask struct {
+	path    string
+	started time.Time
+}
+
+// FileHook processes a successfully fetched file inline, in the goroutine that
+// fetched it. It may modify the result; a non-nil error turns the file into a
+// skip carrying that error.
+type FileHook func(ctx context.Context, result *model.FileResult) error
+
+// CrawlOptions holds per-crawl settings taken from the crawl request
+type CrawlOptions struct {
+	PathFilter []string // only crawl paths with one of these prefixes
+	OutputMode string   // content output mode, defaults to the configured mode
+	CrawlID    string   // correlation ID for the crawl, generated when empty
+	Paths      []string // fetch exactly these paths and skip the tree fetch and filters
+	Languages  []string // only crawl files of these languages, narrowing AllowedExtensions
+
+	// MaxPathDepth skips files nested deeper than this many directories,
+	// overriding the configured limit when set
+	MaxPathDepth int
+
+	// AllowedExtensions replaces the configured extension allowlist for this
+	// crawl when non-empty; entries are normalized like ALLOWED_EXTENSIONS
+	AllowedExtensions []string
+
+	// Ordered releases results in tree order instead of as they complete.
+	// Results that finish early are held until the files before them arrive,
+	// up to OrderedBufferMaxResults, so memory grows with the slowest file.
+	Ordered bool
+
+	// KnownSHAs maps paths the caller already has to their SHAs; tree entries
+	// still at that SHA are reported as unchanged without being fetched
+	KnownSHAs map[string]string
+
+	// AllowLarge lifts MaxTreeEntries for this crawl
+	AllowLarge bool
+
+	// IncludeTree returns the filtered tree hierarchy in CrawlResponse.Tree.
+	// It needs the tree, so such crawls don't use the archive path.
+	IncludeTree bool
+
+	// ResumeFrom is the crawl ID of an earlier crawl of the same repository
+	// and ref; files its checkpoint lists as completed are treated as known
+	ResumeFrom string
+
+	// GitHubToken is a tenant-supplied token the crawl authenticates with
+	// instead of the configured credentials, see github.WithToken. It is
+	// never logged.
+	GitHubToken string
+
+	// IdempotencyKey makes a retried request safe: while a crawl with the same
+	// key is running, or for IdempotencyTTLMS after it succeeded, the same
+	// request gets that crawl's response instead of starting another. A
+	// joined crawl's files aren't sent to the joiner's ResultSink.
+	IdempotencyKey string
+
+	// ResultSink, when set, receives each file result as it completes and the
+	// response carries only counts and errors, so memory stays flat however
+	// large the crawl. Calls are serialized.
+	ResultSink func(model.FileResult)
+
+	// allowedExtensionSet is AllowedExtensions as a set, built once per crawl
+	allowedExtensionSet stringSet
+
+	// resumed holds the completed files of the checkpoint being resumed
+	resumed map[string]string
+
+	// ignore holds the repository's ignore file patterns, see HonorIgnoreFile
+	ignore *ignoreRules
+}
+
 // NewPool creates a new worker pool
-func NewPool(cfg *config.Config, m *metrics.Metrics, ghClient *github.Client) *Pool {
+func NewPool(cfg *config.Config, m *metrics.Metrics, ghClient GitHubFetcher) *Pool {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	pool := &Pool{
 		config:       cfg,
 		metrics:      m,
 		githubClient: ghClient,
-		taskChan:     make(chan model.WorkerTask, cfg.MaxConcurrentFetches),
+		taskChan:     make(chan model.WorkerTask, cfg.GetTaskQueueSize()),
 		resultChan:   make(chan model.FileResult, cfg.MaxConcurrentFetches),
 		ctx:          ctx,
 		cancel:       cancel,
+		inFlight:     make(map[int]inFlightTask),
+		events:       LogEmitter{},
+
+		allowedExtensionSet: newStringSet(cfg.AllowedExtensions),
+		specialFileSet:      newStringSet(cfg.SpecialFiles),
+		transforms:          newTransforms(cfg.ContentTransforms),
+	}
+
+	if cfg.TreeFetchConcurrency > 0 {
+		pool.treeSlots = make(chan struct{}, cfg.TreeFetchConcurrency)
+	}
+	if cfg.RampUpMS > 0 {
+		pool.ramp = newRampUp(cfg.GetRampUp(), cfg.RampUpInitialWorkers, cfg.MaxWorkers)
+	}
+	if cfg.IdempotencyTTLMS > 0 {
+		pool.idempotency = newIdempotencyCache(cfg.GetIdempotencyTTL(), cfg.IdempotencyMaxKeys)
 	}
 
 	// Set initial metrics
@@ -56,20 +210,39 @@ func NewPool(cfg *config.Config, m *metrics.Metrics, ghClient *github.Client) *P
 	return pool
 }
 
+// SetFileHook installs a hook run on every fetched file that passes the
+// content checks. Set it before Start; nil removes the hook.
+func (p *Pool) SetFileHook(hook FileHook) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fileHook = hook
+}
+
 // Start starts the worker pool
 func (p *Pool) Start(ctx context.Context) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.activeWorkers > 0 {
+	if p.running {
 		return fmt.Errorf("worker pool is already running")
 	}
 
-	// Start workers
-	for i := range p.config.MaxWorkers {
+	// Set up the spill buffer for result channel overflow
+	if p.config.ResultOverflow == config.ResultOverflowSpill && p.spill == nil {
+		spill, err := newSpillBuffer(p.config.ResultSpillDir, p.config.ResultSpillMaxBytes)
+		if err != nil {
+			return err
+		}
+		p.spill = spill
+
 		p.wg.Add(1)
-		go p.worker(i)
-		p.activeWorkers++
+		go p.drainSpill()
+	}
+
+	// Start workers
+	p.running = true
+	for range p.config.MaxWorkers {
+		p.spawnWorker()
 	}
 
 	log.Printf("Started %d workers", p.activeWorkers)
@@ -78,15 +251,44 @@ func (p *Pool) Start(ctx context.Context) error {
 	return nil
 }
 
+// spawnWorker starts one more worker; the caller must hold p.mu
+func (p *Pool) spawnWorker() {
+	p.wg.Add(1)
+	go p.worker(p.nextWorkerID)
+	p.nextWorkerID++
+	p.activeWorkers++
+}
+
 // Stop stops the worker pool gracefully
 func (p *Pool) Stop() error {
+	// No workers may be spawned once shutdown begins
+	p.mu.Lock()
+	p.running = false
+	p.mu.Unlock()
+
 	p.cancel()
 
-	// Close task channel
+	// Close task channel once no submitter can still be sending to it;
+	// cancelling first releases any waiting for room
+	p.submitMu.Lock()
 	close(p.taskChan)
+	p.submitMu.Unlock()
+
+	// Wait for the workers to finish, up to the shutdown timeout. A worker
+	// stuck in a request that ignores cancellation may still send a result,
+	// so the result channel and spill file are left open for it.
+	if !p.waitForWorkers(p.config.GetShutdownTimeout()) {
+		stuck := p.logStuckWorkers()
+		p.metrics.SetWorkerPoolSize(0)
+		return fmt.Errorf("%w: %d workers still running", ErrShutdownTimeout, stuck)
+	}
 
-	// Wait for all workers to finish
-	p.wg.Wait()
+	// Results still spilled at this point are discarded with the pool
+	if p.spill != nil {
+		if err := p.spill.close(); err != nil {
+			log.Printf("Failed to remove spill file: %v", err)
+		}
+	}
 
 	// Close result channel
 	close(p.resultChan)
@@ -101,19 +303,135 @@ func (p *Pool) Stop() error {
 	return nil
 }
 
-// SubmitTask submits a task to the worker pool
+// waitForWorkers waits for every worker to exit, reporting false if the
+// timeout passes first; 0 waits forever
+func (p *Pool) waitForWorkers(timeout time.Duration) bool {
+	if timeout <= 0 {
+		p.wg.Wait()
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// logStuckWorkers logs the file each still-busy worker is processing and
+// returns how many there are
+func (p *Pool) logStuckWorkers() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	ids := make([]int, 0, len(p.inFlight))
+	for id := range p.inFlight {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		task := p.inFlight[id]
+		log.Printf("Worker %d still processing %s after %s, abandoning it", id, task.path, time.Since(task.started).Round(time.Millisecond))
+	}
+	log.Printf("Worker pool shutdown timed out with %d workers still running", len(ids))
+
+	return len(ids)
+}
+
+// setInFlight records the file a worker is processing; an empty path clears it
+func (p *Pool) setInFlight(workerID int, path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if path == "" {
+		delete(p.inFlight, workerID)
+		return
+	}
+	p.inFlight[workerID] = inFlightTask{path: path, started: time.Now()}
+}
+
+// SubmitTask submits a task to the worker pool without waiting, returning
+// ErrTaskQueueFull when TaskQueueSize tasks are already queued
 func (p *Pool) SubmitTask(task model.WorkerTask) error {
+	p.submitMu.RLock()
+	defer p.submitMu.RUnlock()
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+
 	select {
 	case p.taskChan <- task:
-		p.metrics.SetQueueDepth(float64(len(p.taskChan)))
+		p.taskQueued()
 		return nil
+	default:
+		return fmt.Errorf("%w: %d tasks waiting", ErrTaskQueueFull, cap(p.taskChan))
+	}
+}
+
+// submitTaskWait submits a task, waiting for room in the queue until ctx or
+// the pool is done. Crawls submit their own files this way, so a full queue
+// slows them down instead of dropping files.
+func (p *Pool) submitTaskWait(ctx context.Context, task model.WorkerTask) error {
+	p.submitMu.RLock()
+	defer p.submitMu.RUnlock()
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case p.taskChan <- task:
+		p.taskQueued()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	case <-p.ctx.Done():
 		return p.ctx.Err()
-	default:
-		return fmt.Errorf("task queue is full")
 	}
 }
 
+// taskQueued updates the queue depth and workers after a task is queued
+func (p *Pool) taskQueued() {
+	p.metrics.SetQueueDepth(float64(len(p.taskChan)))
+	p.scaleUp()
+}
+
+// scaleUp re-spawns a worker, up to MaxWorkers, while tasks are waiting in the queue
+func (p *Pool) scaleUp() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running && p.activeWorkers < p.config.MaxWorkers && len(p.taskChan) > 0 {
+		p.spawnWorker()
+		p.metrics.SetWorkerPoolSize(float64(p.activeWorkers))
+	}
+}
+
+// retireIdleWorker lets an idle worker exit unless tasks are waiting. It
+// shares p.mu with scaleUp so a queued task always has a worker to run it.
+func (p *Pool) retireIdleWorker() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.taskChan) > 0 {
+		return false
+	}
+
+	p.activeWorkers--
+	p.metrics.SetWorkerPoolSize(float64(p.activeWorkers))
+	return true
+}
+
 // GetResultChannel returns the result channel
 func (p *Pool) GetResultChannel() <-chan model.FileResult {
 	return p.resultChan
@@ -128,7 +446,14 @@ func (p *Pool) GetQueueDepth() int {
 func (p *Pool) IsRunning() bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	return p.activeWorkers > 0
+	return p.running
+}
+
+// ActiveWorkers returns the number of live workers, which shrinks while idle
+func (p *Pool) ActiveWorkers() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.activeWorkers
 }
 
 // worker is the main worker routine
@@ -137,7 +462,29 @@ func (p *Pool) worker(workerID int) {
 
 	log.Printf("Worker %d started", workerID)
 
+	// Idle workers exit after the idle timeout and are re-spawned on demand
+	idleTimeout := p.config.GetWorkerIdleTimeout()
+	var (
+		idleTimer *time.Timer
+		idle      <-chan time.Time
+	)
+	if idleTimeout > 0 {
+		idleTimer = time.NewTimer(idleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	// Results gathered for a crawl, handed over once the batch is full or
+	// there's no task waiting
+	var batch resultBatch
+	defer p.flushResults(&batch)
+
 	for {
+		if len(p.taskChan) == 0 && !p.flushResults(&batch) {
+			log.Printf("Worker %d: context cancelled while sending results", workerID)
+			return
+		}
+
 		select {
 		case task, ok := <-p.taskChan:
 			if !ok {
@@ -148,18 +495,46 @@ func (p *Pool) worker(workerID int) {
 			// Update queue depth metric
 			p.metrics.SetQueueDepth(float64(len(p.taskChan)))
 
+			// Wait for the ramp to let one more worker fetch
+			if p.ramp != nil {
+				if err := p.ramp.admit(p.ctx); err != nil {
+					log.Printf("Worker %d: context cancelled during ramp-up", workerID)
+					return
+				}
+			}
+
 			// Process the task
+			p.setInFlight(workerID, task.Path)
 			result := p.processTask(workerID, task)
+			if p.ramp != nil {
+				p.ramp.release()
+			}
 
-			// Send result
-			select {
-			case p.resultChan <- result:
-				// Result sent successfully
-			case <-p.ctx.Done():
+			// Send result to the originating crawl, or the shared channel
+			delivered := p.deliverResult(task, result, &batch)
+			p.setInFlight(workerID, "")
+			if !delivered {
 				log.Printf("Worker %d: context cancelled while sending result", workerID)
 				return
 			}
 
+			if idleTimer != nil {
+				if !idleTimer.Stop() {
+					select {
+					case <-idleTimer.C:
+					default:
+					}
+				}
+				idleTimer.Reset(idleTimeout)
+			}
+
+		case <-idle:
+			if p.retireIdleWorker() {
+				log.Printf("Worker %d: idle for %s, exiting", workerID, idleTimeout)
+				return
+			}
+			idleTimer.Reset(idleTimeout)
+
 		case <-p.ctx.Done():
 			log.Printf("Worker %d: context cancelled, shutting down", workerID)
 			return
@@ -167,6 +542,126 @@ func (p *Pool) worker(workerID int) {
 	}
 }
 
+// deliverResult routes a result to the crawl that submitted the task, adding
+// it to batch when the crawl takes batches. Per-crawl channels are sized to the
+// crawl's task count, so the send never blocks even if that crawl has already
+// given up collecting.
+func (p *Pool) deliverResult(task model.WorkerTask, result model.FileResult, batch *resultBatch) bool {
+	if task.ResultBatches != nil {
+		return p.batchResult(batch, task.ResultBatches, result)
+	}
+	// Don't hold another crawl's batch while this send might block
+	if !p.flushResults(batch) {
+		return false
+	}
+	if task.Results == nil {
+		return p.sendResult(result)
+	}
+
+	select {
+	case task.Results <- result:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// resultBatch is the results a worker has gathered for one crawl, see
+// ResultBatchSize
+type resultBatch struct {
+	dest    chan<- []model.FileResult
+	results []model.FileResult
+}
+
+// batchResult adds a result bound for dest to batch, first handing over what
+// the batch holds for another crawl, and sends the batch once it's full. It
+// returns false if the pool stopped first.
+func (p *Pool) batchResult(batch *resultBatch, dest chan<- []model.FileResult, result model.FileResult) bool {
+	if batch.dest != dest && !p.flushResults(batch) {
+		return false
+	}
+	batch.dest = dest
+	batch.results = append(batch.results, result)
+	if len(batch.results) >= p.config.ResultBatchSize {
+		return p.flushResults(batch)
+	}
+	return true
+}
+
+// flushResults sends whatever batch holds to its crawl; the receiver owns the
+// sent slice, so the batch starts a new one
+func (p *Pool) flushResults(batch *resultBatch) bool {
+	if len(batch.results) == 0 {
+		return true
+	}
+
+	select {
+	case batch.dest <- batch.results:
+		batch.results = nil
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// sendResult delivers a result to the result channel, spilling it to disk when
+// the channel is full and spilling is enabled. It blocks otherwise, which holds
+// the worker back from fetching more files until the collector catches up.
+func (p *Pool) sendResult(result model.FileResult) bool {
+	p.metrics.SetResultChannelOccupancy(float64(len(p.resultChan)))
+
+	if p.spill != nil {
+		// Keep FIFO order with anything already spilled
+		if p.spill.len() == 0 {
+			select {
+			case p.resultChan <- result:
+				return true
+			default:
+			}
+		}
+
+		if p.spill.push(result) {
+			p.metrics.RecordResultSpilled()
+			return true
+		}
+		// Spill file is full, fall back to blocking
+	}
+
+	select {
+	case p.resultChan <- result:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// drainSpill moves spilled results back into the result channel as room frees up
+func (p *Pool) drainSpill() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.spill.notify:
+		case <-p.ctx.Done():
+			return
+		}
+
+		for {
+			result, ok := p.spill.pop()
+			if !ok {
+				break
+			}
+
+			select {
+			case p.resultChan <- result:
+				p.metrics.SetResultChannelOccupancy(float64(len(p.resultChan)))
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
 // processTask processes a single task
 func (p *Pool) processTask(workerID int, task model.WorkerTask) model.FileResult {
 	startTime := time.Now()
@@ -176,6 +671,7 @@ func (p *Pool) processTask(workerID int, task model.WorkerTask) model.FileResult
 		SHA:       task.SHA,
 		Size:      task.Size,
 		FetchedAt: startTime,
+		CrawlID:   task.CrawlID,
 	}
 
 	// Record concurrency
@@ -184,30 +680,133 @@ func (p *Pool) processTask(workerID int, task model.WorkerTask) model.FileResult
 	// Use repository information from the task
 	owner, repo, ref := task.Owner, task.Repo, task.Ref
 
-	// Check file size limit
-	if int64(task.Size) > p.config.MaxFileSize {
-		result.Error = fmt.Errorf("file size %d exceeds limit %d", task.Size, p.config.MaxFileSize)
-		p.metrics.RecordError("file_too_large", owner, repo)
-		return result
+	// Check file size limit; oversized files are either skipped or truncated.
+	// The read is capped either way in case the tree under-reports the size.
+	maxSize := p.config.MaxFileSizeFor(task.Path)
+	limit := maxSize
+	if int64(task.Size) > maxSize {
+		if p.config.TruncateOversizeBytes <= 0 {
+			result.Error = fmt.Errorf("file size %d exceeds limit %d: %w", task.Size, maxSize, github.ErrFileTooLarge)
+			p.metrics.RecordError("file_too_large", owner, repo)
+			return result
+		}
+		limit = truncateLength(p.config, maxSize)
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(p.ctx, p.config.GetFetchTimeout())
+	// Create context with the per-file timeout, bounded by both the crawl and the pool
+	parent := p.ctx
+	if task.Ctx != nil {
+		parent = task.Ctx
+	}
+	ctx, cancel := context.WithTimeout(parent, p.config.GetPerFileTimeout(task.Size))
 	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
 
-	// Fetch file content using the correct ref
-	content, err := p.githubClient.GetFileContent(ctx, owner, repo, task.Path, ref)
+	// Fetch file content using the correct ref; the tree size decides whether
+	// it's worth asking for gzip
+	ctx = github.WithContentSize(ctx, int64(task.Size))
+	content, truncated, err := p.githubClient.GetFileContentPrefix(ctx, owner, repo, task.Path, ref, limit)
 	if err != nil {
 		result.Error = err
-		p.metrics.RecordError("fetch_failed", owner, repo)
-		p.metrics.RecordFileProcessed(owner, repo, "failed")
+		// Only the file's own timeout counts; a crawl deadline or shutdown isn't the file's fault
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+			p.metrics.RecordError("file_timeout", owner, repo)
+			p.metrics.RecordFileProcessed(owner, repo, "timeout")
+		} else {
+			p.metrics.RecordError("fetch_failed", owner, repo)
+			p.metrics.RecordFileProcessed(owner, repo, "failed")
+		}
 		log.Printf("Worker %d: failed to fetch %s: %v", workerID, task.Path, err)
 		return result
 	}
 
+	// A truncated read can't be hashed against the whole blob
+	if p.config.VerifyContentSHA && !truncated && task.SHA != "" {
+		var ok bool
+		if content, truncated, ok = p.verifyContent(ctx, workerID, task, content, limit); !ok {
+			result.Error = fmt.Errorf("%s: %w", task.Path, ErrSHAMismatch)
+			p.metrics.RecordFileProcessed(owner, repo, "failed")
+			return result
+		}
+	}
+
+	if truncated {
+		if p.config.TruncateOversizeBytes <= 0 {
+			result.Error = fmt.Errorf("file exceeds limit %d: %w", maxSize, github.ErrFileTooLarge)
+			p.metrics.RecordError("file_too_large", owner, repo)
+			p.metrics.RecordFileProcessed(owner, repo, "skipped_too_large")
+			return result
+		}
+
+		if keep := truncateLength(p.config, maxSize); int64(len(content)) > keep {
+			content = content[:keep]
+		}
+		result.Truncated = true
+		if task.Size > len(content) {
+			result.OriginalSize = task.Size
+		}
+		content = trimPartialRune(content)
+	}
+
+	result = p.checkContent(ctx, workerID, task, content, result)
+
+	// Record task duration
+	duration := time.Since(startTime).Seconds()
+	p.metrics.RecordTaskDuration("file_fetch", duration)
+
+	return result
+}
+
+// verifyContent checks content against the task's blob SHA. On a mismatch it
+// fetches the blob by SHA when RefetchSHAMismatch is set, which can't be
+// stale, and returns that instead, cut to limit. ok is false when no content
+// matching the SHA could be had.
+func (p *Pool) verifyContent(ctx context.Context, workerID int, task model.WorkerTask, content []byte, limit int64) (verified []byte, truncated, ok bool) {
+	got := gitBlobSHA(content)
+	if got == task.SHA {
+		return content, false, true
+	}
+
+	p.metrics.RecordError("sha_mismatch", task.Owner, task.Repo)
+	log.Printf("Worker %d: content of %s hashes to %s, not the tree's %s", workerID, task.Path, got, task.SHA)
+	if !p.config.RefetchSHAMismatch {
+		return nil, false, false
+	}
+
+	blob, found := p.githubClient.GetBlobs(ctx, task.Owner, task.Repo, []string{task.SHA})[task.SHA]
+	if !found || gitBlobSHA(blob) != task.SHA {
+		return nil, false, false
+	}
+	if limit > 0 && int64(len(blob)) > limit {
+		return blob[:limit], true, true
+	}
+	return blob, false, true
+}
+
+// checkContent applies binary and encoding checks and the file hook to fetched
+// content and fills in the result
+func (p *Pool) checkContent(ctx context.Context, workerID int, task model.WorkerTask, content []byte, result model.FileResult) model.FileResult {
+	owner, repo := task.Owner, task.Repo
+
+	// Explicitly requested paths have no tree size, so enforce the limit on the content
+	maxSize := p.config.MaxFileSizeFor(task.Path)
+	if int64(len(content)) > maxSize {
+		if p.config.TruncateOversizeBytes <= 0 {
+			result.Error = fmt.Errorf("file size %d exceeds limit %d: %w", len(content), maxSize, github.ErrFileTooLarge)
+			p.metrics.RecordError("file_too_large", owner, repo)
+			p.metrics.RecordFileProcessed(owner, repo, "skipped_too_large")
+			return result
+		}
+
+		result.Truncated = true
+		result.OriginalSize = len(content)
+		content = trimPartialRune(content[:truncateLength(p.config, maxSize)])
+	}
+
 	// Binary detection
 	if p.config.EnableBinaryDetection && p.IsBinaryContent(content) {
-		result.Error = fmt.Errorf("skipping binary file")
+		result.Error = ErrBinaryFile
 		p.metrics.RecordError("binary_file_skipped", owner, repo)
 		p.metrics.RecordFileProcessed(owner, repo, "skipped_binary")
 		log.Printf("Worker %d: skipped binary file %s", workerID, task.Path)
@@ -216,99 +815,645 @@ func (p *Pool) processTask(workerID int, task model.WorkerTask) model.FileResult
 
 	// UTF-8 validation
 	if !utf8.Valid(content) {
-		result.Error = fmt.Errorf("file content is not valid UTF-8")
+		result.Error = ErrInvalidEncoding
 		p.metrics.RecordError("invalid_utf8", owner, repo)
 		p.metrics.RecordFileProcessed(owner, repo, "skipped_invalid_encoding")
 		log.Printf("Worker %d: skipped non-UTF-8 file %s", workerID, task.Path)
 		return result
 	}
 
+	for _, transform := range p.transforms {
+		content = transform(content)
+	}
+
 	result.Content = content
 	result.Size = len(content)
+
+	p.mu.RLock()
+	hook := p.fileHook
+	p.mu.RUnlock()
+	if hook != nil {
+		if err := hook(ctx, &result); err != nil {
+			result.Content = nil
+			result.Error = fmt.Errorf("%w: %w", ErrFileHook, err)
+			p.metrics.RecordError("file_hook", owner, repo)
+			p.metrics.RecordFileProcessed(owner, repo, "skipped_hook")
+			log.Printf("Worker %d: file hook skipped %s: %v", workerID, task.Path, err)
+			return result
+		}
+	}
+
 	p.metrics.RecordFileProcessed(owner, repo, "success")
 	p.metrics.RecordFileSize(owner, repo, float64(len(content)))
 	log.Printf("Worker %d: successfully fetched %s (%d bytes)", workerID, task.Path, len(content))
 
-	// Record task duration
-	duration := time.Since(startTime).Seconds()
-	p.metrics.RecordTaskDuration("file_fetch", duration)
-
 	return result
 }
 
+// fetchInlineContent fetches small files through batched GraphQL queries.
+// It returns the finished results and the entries that still need a REST fetch.
+func (p *Pool) fetchInlineContent(ctx context.Context, owner, repo, ref string, files []model.TreeEntry) ([]model.FileResult, []model.TreeEntry) {
+	var (
+		inline    []model.TreeEntry
+		remaining []model.TreeEntry
+		results   []model.FileResult
+	)
+
+	for _, file := range files {
+		if int64(file.Size) <= p.config.GraphQLInlineMaxSize {
+			inline = append(inline, file)
+		} else {
+			remaining = append(remaining, file)
+		}
+	}
+
+	for start := 0; start < len(inline); start += p.config.GraphQLBatchSize {
+		batch := inline[start:min(start+p.config.GraphQLBatchSize, len(inline))]
+
+		paths := make([]string, len(batch))
+		for i, file := range batch {
+			paths[i] = file.Path
+		}
+
+		startTime := time.Now()
+		contents, err := p.githubClient.GetFileContentsGraphQL(ctx, owner, repo, ref, paths)
+		if err != nil {
+			// Let the REST path handle the whole batch
+			log.Printf("GraphQL batch failed, falling back to REST for %d files: %v", len(batch), err)
+			remaining = append(remaining, batch...)
+			continue
+		}
+
+		for _, file := range batch {
+			content, ok := contents[file.Path]
+			if !ok {
+				remaining = append(remaining, file)
+				continue
+			}
+
+			task := model.WorkerTask{Path: file.Path, SHA: file.SHA, Size: file.Size, Owner: owner, Repo: repo, Ref: ref}
+			result := model.FileResult{Path: file.Path, SHA: file.SHA, Size: file.Size, FetchedAt: startTime}
+			results = append(results, p.checkContent(ctx, -1, task, content, result))
+			p.metrics.RecordFileRequested(owner, repo)
+		}
+
+		p.metrics.RecordTaskDuration("graphql_batch_fetch", time.Since(startTime).Seconds())
+	}
+
+	return results, remaining
+}
+
+// fetchBatchedBlobs fetches small files by blob SHA through the Git Data API in batches.
+// It returns the finished results and the entries that still need a per-file fetch.
+func (p *Pool) fetchBatchedBlobs(ctx context.Context, owner, repo, ref string, files []model.TreeEntry) ([]model.FileResult, []model.TreeEntry) {
+	var (
+		batched   []model.TreeEntry
+		remaining []model.TreeEntry
+		results   []model.FileResult
+	)
+
+	for _, file := range files {
+		if file.SHA != "" && int64(file.Size) <= p.config.BlobBatchMaxFileSize {
+			batched = append(batched, file)
+		} else {
+			remaining = append(remaining, file)
+		}
+	}
+
+	for start := 0; start < len(batched); start += p.config.BlobBatchSize {
+		batch := batched[start:min(start+p.config.BlobBatchSize, len(batched))]
+
+		shas := make([]string, len(batch))
+		for i, file := range batch {
+			shas[i] = file.SHA
+		}
+
+		startTime := time.Now()
+		blobs := p.githubClient.GetBlobs(ctx, owner, repo, shas)
+
+		for _, file := range batch {
+			content, ok := blobs[file.SHA]
+			if !ok {
+				remaining = append(remaining, file)
+				continue
+			}
+
+			task := model.WorkerTask{Path: file.Path, SHA: file.SHA, Size: file.Size, Owner: owner, Repo: repo, Ref: ref}
+			result := model.FileResult{Path: file.Path, SHA: file.SHA, Size: file.Size, FetchedAt: startTime}
+			results = append(results, p.checkContent(ctx, -1, task, content, result))
+			p.metrics.RecordFileRequested(owner, repo)
+		}
+
+		p.metrics.RecordTaskDuration("blob_batch_fetch", time.Since(startTime).Seconds())
+	}
+
+	return results, remaining
+}
+
 // CrawlRepository crawls an entire repository
-func (p *Pool) CrawlRepository(ctx context.Context, owner, repo, ref string, pathFilter []string) (*model.CrawlResponse, error) {
+func (p *Pool) CrawlRepository(ctx context.Context, owner, repo, ref string, opts CrawlOptions) (*model.CrawlResponse, error) {
+	if opts.IdempotencyKey != "" {
+		inner := opts
+		inner.IdempotencyKey = ""
+		return p.idempotent(ctx, fmt.Sprintf("repo %s/%s@%s", owner, repo, ref), opts, func() (*model.CrawlResponse, error) {
+			// Shared with retries, so it outlives this caller's cancellation but
+			// not its deadline
+			ctx, cancel := detachCrawl(ctx)
+			defer cancel()
+			return p.CrawlRepository(ctx, owner, repo, ref, inner)
+		})
+	}
+
+	ctx, requests := github.WithRequestCounter(ctx)
+	response, err := p.crawlRepository(ctx, owner, repo, ref, opts)
+	p.recordRequests(response, requests)
+	return response, err
+}
+
+// crawlRepository runs a repository crawl for CrawlRepository
+func (p *Pool) crawlRepository(ctx context.Context, owner, repo, ref string, opts CrawlOptions) (*model.CrawlResponse, error) {
 	startTime := time.Now()
 
+	ctx = github.WithToken(ctx, opts.GitHubToken)
+	ctx, cancel := p.withCrawlDeadline(ctx)
+	defer cancel()
+
+	outputMode, err := p.resolveOutputMode(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateLanguages(opts.Languages); err != nil {
+		return nil, err
+	}
+	opts.AllowedExtensions = config.NormalizeExtensions(opts.AllowedExtensions)
+	opts.allowedExtensionSet = newStringSet(opts.AllowedExtensions)
+
+	if opts.ResumeFrom != "" {
+		if len(opts.Paths) > 0 {
+			return nil, fmt.Errorf("resuming is not supported for explicit path crawls")
+		}
+		if err := p.resume(&opts, owner, repo, ref); err != nil {
+			return nil, err
+		}
+	}
+
+	// Explicit path lists skip the tree fetch entirely
+	if len(opts.Paths) > 0 {
+		return p.crawlPaths(ctx, owner, repo, ref, opts, outputMode, startTime)
+	}
+
+	// Whole-repository crawls can come from a single tarball download; an
+	// incremental crawl usually fetches few files, so it stays per file
+	if p.config.EnableArchiveCrawl && len(opts.PathFilter) == 0 && len(opts.KnownSHAs) == 0 && !opts.IncludeTree {
+		if opts.ignore, err = p.loadIgnoreFile(ctx, owner, repo, ref, nil); err != nil {
+			return nil, err
+		}
+		return p.crawlArchive(ctx, owner, repo, ref, opts, outputMode, startTime)
+	}
+
 	log.Printf("Starting crawl of %s/%s at ref %s", owner, repo, ref)
 
+	collected := p.newCollector(owner, repo, outputMode, opts)
+	collected.start(ref)
+
 	// Get repository tree
-	tree, err := p.githubClient.GetRepositoryTree(ctx, owner, repo, ref)
+	tree, err := p.fetchTree(ctx, owner, repo, ref)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get repository tree: %w", err)
+		err = fmt.Errorf("failed to get repository tree: %w", err)
+		collected.finish(nil, err)
+		return nil, err
 	}
 
 	log.Printf("Retrieved tree with %d entries", len(tree.Tree))
+	collected.event(Event{Type: EventTreeFetched, Ref: ref, SHA: tree.SHA, TreeEntries: len(tree.Tree)})
 
-	// Filter files
-	var filesToProcess []model.TreeEntry
+	if opts.ignore, err = p.loadIgnoreFile(ctx, owner, repo, ref, tree.Tree); err != nil {
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	// Filter files, setting aside those the caller already has
+	var (
+		filesToProcess []model.TreeEntry
+		treeEntries    []model.TreeEntry // directories and files kept for IncludeTree
+		treeFiles      = 0
+		warnings       treeWarnings
+	)
 	for _, entry := range tree.Tree {
-		if entry.Type == "blob" && p.shouldProcessFile(entry.Path, pathFilter) {
-			filesToProcess = append(filesToProcess, entry)
+		if warnings.check(entry) {
+			continue
+		}
+		if entry.Type != "blob" {
+			if opts.IncludeTree && entry.Type == "tree" && dirMatchesPathFilter(entry.Path, opts.PathFilter) {
+				treeEntries = append(treeEntries, entry)
+			}
+			continue
+		}
+		treeFiles++
+		if reason := p.filterReason(entry.Path, entry.Size, opts); reason != "" {
+			collected.filtered(entry.Path, entry.Size, reason)
+			continue
+		}
+		if opts.IncludeTree {
+			treeEntries = append(treeEntries, entry)
+		}
+
+		if known, ok := opts.KnownSHAs[entry.Path]; ok && known == entry.SHA {
+			collected.unchanged(entry)
+			continue
+		}
+		filesToProcess = append(filesToProcess, entry)
+	}
+
+	log.Printf("Processing %d of %d files after filtering, %d unchanged", len(filesToProcess), treeFiles, collected.unchangedFiles)
+	if treeWarnings := warnings.list(); len(treeWarnings) > 0 {
+		log.Printf("Tree of %s/%s at %s has malformed entries: %s", owner, repo, ref, strings.Join(treeWarnings, "; "))
+	}
+
+	if limit := p.config.MaxTreeEntries; limit > 0 && len(filesToProcess) > limit && !opts.AllowLarge {
+		err := fmt.Errorf("%w: %d files left after filtering exceed the limit of %d; narrow it with path_filter or languages, or set allow_large",
+			ErrCrawlTooLarge, len(filesToProcess), limit)
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	if err := p.checkRateLimitBudget(ctx, len(filesToProcess)); err != nil {
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	response, err := p.fetchFiles(ctx, collected, ref, filesToProcess)
+	if err != nil {
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	response.RootTreeSHA = tree.SHA
+	response.TreeFiles = treeFiles
+	response.Warnings = warnings.list()
+	if tree.Truncated {
+		response.Warnings = append(response.Warnings, "repository tree was truncated, so some files are missing")
+	}
+	if opts.IncludeTree {
+		response.Tree = buildTree(treeEntries)
+	}
+	response.Duration = time.Since(startTime).String()
+	collected.finish(response, nil)
+
+	return response, nil
+}
+
+// recordRequests reports the GitHub requests a crawl made in its response, if
+// it got one, and in the requests-per-crawl histogram. A crawl refused before
+// it reached GitHub isn't observed.
+func (p *Pool) recordRequests(response *model.CrawlResponse, requests *atomic.Int64) {
+	count := requests.Load()
+	if response == nil && count == 0 {
+		return
+	}
+	p.metrics.RecordCrawlGitHubRequests(count)
+	if response != nil {
+		response.APIRequestCount = int(count)
+	}
+}
+
+// fetchTree fetches a repository tree once a tree fetch slot is free
+func (p *Pool) fetchTree(ctx context.Context, owner, repo, ref string) (*model.GitHubTreeResponse, error) {
+	if p.treeSlots != nil {
+		select {
+		case p.treeSlots <- struct{}{}:
+			defer func() { <-p.treeSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return p.githubClient.GetRepositoryTree(ctx, owner, repo, ref)
+}
+
+// crawlPaths fetches an explicit list of paths at ref without fetching the tree.
+// Sizes are unknown up front, so MaxFileSize is enforced once content arrives,
+// and paths that don't exist are reported as per-file not_found errors.
+func (p *Pool) crawlPaths(ctx context.Context, owner, repo, ref string, opts CrawlOptions, outputMode string, startTime time.Time) (*model.CrawlResponse, error) {
+	log.Printf("Starting crawl of %d explicit paths in %s/%s at ref %s", len(opts.Paths), owner, repo, ref)
+
+	var (
+		filesToProcess []model.TreeEntry
+		seen           = make(map[string]bool, len(opts.Paths))
+	)
+	for _, path := range opts.Paths {
+		path = strings.TrimPrefix(strings.TrimSpace(path), "/")
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		filesToProcess = append(filesToProcess, model.TreeEntry{Path: path, Type: "blob"})
+	}
+
+	collected := p.newCollector(owner, repo, outputMode, opts)
+	collected.start(ref)
+
+	if err := p.checkRateLimitBudget(ctx, len(filesToProcess)); err != nil {
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	response, err := p.fetchFiles(ctx, collected, ref, filesToProcess)
+	if err != nil {
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	response.Duration = time.Since(startTime).String()
+	collected.finish(response, nil)
+
+	return response, nil
+}
+
+// CrawlPullRequest crawls the files changed in a pull request, fetching their
+// content at the pull request's head commit. Removed files are reported with
+// their change status but no content.
+func (p *Pool) CrawlPullRequest(ctx context.Context, owner, repo string, number int, opts CrawlOptions) (*model.CrawlResponse, error) {
+	if opts.IdempotencyKey != "" {
+		inner := opts
+		inner.IdempotencyKey = ""
+		return p.idempotent(ctx, fmt.Sprintf("pull %s/%s#%d", owner, repo, number), opts, func() (*model.CrawlResponse, error) {
+			// Shared with retries, so it outlives this caller's cancellation but
+			// not its deadline
+			ctx, cancel := detachCrawl(ctx)
+			defer cancel()
+			return p.CrawlPullRequest(ctx, owner, repo, number, inner)
+		})
+	}
+
+	ctx, requests := github.WithRequestCounter(ctx)
+	response, err := p.crawlPullRequest(ctx, owner, repo, number, opts)
+	p.recordRequests(response, requests)
+	return response, err
+}
+
+// crawlPullRequest runs a pull request crawl for CrawlPullRequest
+func (p *Pool) crawlPullRequest(ctx context.Context, owner, repo string, number int, opts CrawlOptions) (*model.CrawlResponse, error) {
+	startTime := time.Now()
+
+	ctx = github.WithToken(ctx, opts.GitHubToken)
+	ctx, cancel := p.withCrawlDeadline(ctx)
+	defer cancel()
+
+	outputMode, err := p.resolveOutputMode(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateLanguages(opts.Languages); err != nil {
+		return nil, err
+	}
+	opts.AllowedExtensions = config.NormalizeExtensions(opts.AllowedExtensions)
+	opts.allowedExtensionSet = newStringSet(opts.AllowedExtensions)
+
+	if opts.ResumeFrom != "" {
+		return nil, fmt.Errorf("resuming is not supported for pull request crawls")
+	}
+
+	log.Printf("Starting crawl of %s/%s pull request #%d", owner, repo, number)
+
+	pr, err := p.githubClient.GetPullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+
+	changedFiles, err := p.githubClient.ListPullRequestFiles(ctx, owner, repo, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull request files: %w", err)
+	}
+
+	log.Printf("Pull request #%d changes %d files at head %s", number, len(changedFiles), pr.Head.SHA)
+
+	if opts.ignore, err = p.loadIgnoreFile(ctx, owner, repo, pr.Head.SHA, nil); err != nil {
+		return nil, err
+	}
+
+	var (
+		filesToProcess []model.TreeEntry
+		removedFiles   int
+		changes        = make(map[string]model.GitHubPullRequestFile, len(changedFiles))
+	)
+	collected := p.newCollector(owner, repo, outputMode, opts)
+	collected.start(pr.Head.SHA)
+	for _, file := range changedFiles {
+		if !p.shouldProcessFile(file.Filename, opts) {
+			collected.filtered(file.Filename, 0, model.SkipFiltered)
+			continue
+		}
+
+		if file.Status == "removed" {
+			collected.removed(file, startTime)
+			removedFiles++
+			continue
 		}
+
+		changes[file.Filename] = file
+		filesToProcess = append(filesToProcess, model.TreeEntry{Path: file.Filename, Type: "blob", SHA: file.SHA})
+	}
+
+	collected.decorate = func(result *model.FileResult) {
+		change := changes[result.Path]
+		result.Status = change.Status
+		result.PreviousPath = change.PreviousFilename
+	}
+
+	response, err := p.fetchFiles(ctx, collected, pr.Head.SHA, filesToProcess)
+	if err != nil {
+		collected.finish(nil, err)
+		return nil, err
+	}
+
+	response.TotalFiles += removedFiles
+	response.PullRequest = number
+	response.Duration = time.Since(startTime).String()
+	collected.finish(response, nil)
+
+	return response, nil
+}
+
+// withCrawlDeadline bounds a whole crawl, including every retry, by CrawlDeadlineMS
+func (p *Pool) withCrawlDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline := p.config.GetCrawlDeadline(); deadline > 0 {
+		return context.WithTimeout(ctx, deadline)
+	}
+	return context.WithCancel(ctx)
+}
+
+// crawlID returns the caller's crawl ID, or a new random one
+func crawlID(opts CrawlOptions) string {
+	if opts.CrawlID != "" {
+		return opts.CrawlID
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// checkRateLimitBudget compares the estimated request count for a crawl with the
+// remaining GitHub quota and refuses or throttles according to the preflight mode
+func (p *Pool) checkRateLimitBudget(ctx context.Context, estimatedRequests int) error {
+	mode := p.config.RateLimitPreflight
+	if mode == "" || mode == config.PreflightOff {
+		return nil
+	}
+
+	info, err := p.githubClient.GetRateLimit(ctx)
+	if err != nil {
+		// The preflight is best-effort; the crawl itself will surface quota errors
+		log.Printf("Rate limit preflight failed, proceeding: %v", err)
+		return nil
+	}
+
+	// The reserve is left for other systems sharing the token; a tenant's
+	// own token has no reserve, and its crawls are never throttled since
+	// that would slow the limiter shared with everyone else
+	tenant := github.HasToken(ctx)
+	reserve := p.config.RateLimitReserve
+	if tenant {
+		reserve = 0
+	}
+	available := max(info.Remaining-reserve, 0)
+	if estimatedRequests <= available {
+		return nil
+	}
+
+	if mode == config.PreflightThrottle && !tenant {
+		log.Printf("Crawl needs ~%d requests but only %d remain until %s, throttling",
+			estimatedRequests, available, info.Reset.Format(time.RFC3339))
+		p.githubClient.ThrottleUntil(info.Reset, available)
+		return nil
 	}
 
-	log.Printf("Processing %d files after filtering", len(filesToProcess))
+	return fmt.Errorf("%w: crawl needs ~%d requests but only %d of %d remain, resets at %s",
+		ErrInsufficientQuota, estimatedRequests, available, info.Limit, info.Reset.Format(time.RFC3339))
+}
 
-	// Submit tasks with repository context
-	for _, file := range filesToProcess {
+// resolveOutputMode returns the crawl's output mode, falling back to the configured default
+func (p *Pool) resolveOutputMode(opts CrawlOptions) (string, error) {
+	outputMode := opts.OutputMode
+	if outputMode == "" {
+		outputMode = p.config.OutputMode
+	}
+	if outputMode == "" {
+		outputMode = model.OutputModeInline
+	}
+	if !config.IsValidOutputMode(outputMode) {
+		return "", fmt.Errorf("invalid output mode %q", outputMode)
+	}
+	return outputMode, nil
+}
+
+// fetchFiles fetches the content of the given files at ref and builds the crawl response for them
+func (p *Pool) fetchFiles(ctx context.Context, collected *collector, ref string, filesToProcess []model.TreeEntry) (*model.CrawlResponse, error) {
+	crawlID, owner, repo := collected.crawlID, collected.owner, collected.repo
+	collected.expect(filesToProcess)
+	collected.plan(filesToProcess)
+
+	// Batch small files via GraphQL or the blobs API; everything else goes through the workers
+	var inlineResults []model.FileResult
+	restFiles := filesToProcess
+	if p.config.EnableGraphQL {
+		inlineResults, restFiles = p.fetchInlineContent(ctx, owner, repo, ref, filesToProcess)
+		log.Printf("Fetched %d files via GraphQL, %d remaining for REST", len(inlineResults), len(restFiles))
+	}
+	if p.config.EnableBlobBatching {
+		var blobResults []model.FileResult
+		blobResults, restFiles = p.fetchBatchedBlobs(ctx, owner, repo, ref, restFiles)
+		inlineResults = append(inlineResults, blobResults...)
+		log.Printf("Fetched %d files via blob batches, %d remaining for REST", len(blobResults), len(restFiles))
+	}
+
+	// Submit tasks with repository context; results come back on this crawl's
+	// own channel, one at a time or in batches of up to ResultBatchSize
+	var (
+		submitted    = 0
+		droppedFiles []model.CrawlError
+		results      chan model.FileResult
+		batches      chan []model.FileResult
+	)
+	if p.config.ResultBatchSize > 1 {
+		batches = make(chan []model.FileResult, len(restFiles))
+	} else {
+		results = make(chan model.FileResult, len(restFiles))
+	}
+	for _, file := range restFiles {
 		task := model.WorkerTask{
-			Path:  file.Path,
-			SHA:   file.SHA,
-			Size:  file.Size,
-			Owner: owner, // Pass repository owner
-			Repo:  repo,  // Pass repository name
-			Ref:   ref,   // Pass the correct ref
+			Path:    file.Path,
+			SHA:     file.SHA,
+			Size:    file.Size,
+			Owner:   owner, // Pass repository owner
+			Repo:    repo,  // Pass repository name
+			Ref:     ref,   // Pass the correct ref
+			CrawlID: crawlID,
+			Ctx:     ctx,
+		}
+		if batches != nil {
+			task.ResultBatches = batches
+		} else {
+			task.Results = results
 		}
 
-		if err := p.SubmitTask(task); err != nil {
-			log.Printf("Failed to submit task for %s: %v", file.Path, err)
+		// Waits for room rather than dropping, so only a crawl out of time drops files
+		if err := p.submitTaskWait(ctx, task); err != nil {
+			log.Printf("Dropped task for %s: %v", file.Path, err)
+			p.metrics.RecordTaskDropped(owner, repo)
+			collected.skip(file.Path)
+			collected.event(Event{Type: EventFileSkipped, Path: file.Path, SHA: file.SHA, Size: file.Size, Reason: "task_dropped", Error: err.Error()})
+			droppedFiles = append(droppedFiles, model.CrawlError{
+				FilePath: file.Path,
+				Error:    err.Error(),
+				Type:     "task_dropped",
+			})
 			continue
 		}
 
+		submitted++
 		p.metrics.RecordFileRequested(owner, repo)
 	}
 
+	if len(droppedFiles) > 0 {
+		log.Printf("Dropped %d of %d tasks for %s/%s, crawl results are incomplete", len(droppedFiles), len(restFiles), owner, repo)
+	}
+
 	// Collect results
-	var (
-		processedFiles = 0
-		skippedFiles   = 0
-		errors         []model.CrawlError
-		mu             sync.Mutex
-		fileResults    []model.FileResult
-	)
+	collected.addErrors(droppedFiles)
+	for _, result := range inlineResults {
+		collected.add(result)
+	}
 
 	// Create a done channel to signal completion
-	done := make(chan struct{})
+	var (
+		done     = make(chan struct{})
+		received = 0
+	)
+	collect := func(result model.FileResult) {
+		if result.CrawlID != crawlID {
+			log.Printf("Crawl %s: ignoring result for %s from crawl %s", crawlID, result.Path, result.CrawlID)
+			return
+		}
+		received++
+		collected.add(result)
+	}
 	go func() {
 		defer close(done)
 
-		for range filesToProcess {
+		// Dropped tasks never produce a result, so only wait for submitted ones
+		for received < submitted {
 			select {
-			case result := <-p.resultChan:
-				mu.Lock()
-				if result.Error != nil {
-					skippedFiles++
-					errors = append(errors, model.CrawlError{
-						FilePath: result.Path,
-						Error:    result.Error.Error(),
-						Type:     "fetch_error",
-					})
-				} else {
-					processedFiles++
+			case result := <-results:
+				collect(result)
+
+			case batch := <-batches:
+				for _, result := range batch {
+					collect(result)
 				}
-				fileResults = append(fileResults, result)
-				mu.Unlock()
 
 			case <-ctx.Done():
 				log.Printf("Context cancelled while waiting for results")
@@ -317,40 +1462,65 @@ func (p *Pool) CrawlRepository(ctx context.Context, owner, repo, ref string, pat
 		}
 	}()
 
-	// Wait for completion or timeout
-	select {
-	case <-done:
+	// Wait for completion; the collector also stops when the context ends
+	<-done
+
+	response := collected.response(ref, len(filesToProcess))
+	response.DroppedFiles = len(droppedFiles)
+
+	if err := ctx.Err(); err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+
+		// Past the crawl deadline, return what was collected rather than nothing
+		response.Partial = true
+		log.Printf("Crawl %s: deadline reached with %d of %d results, returning partial response", crawlID, received, submitted)
+	} else {
 		log.Printf("Crawl completed: %d processed, %d skipped, %d errors",
-			processedFiles, skippedFiles, len(errors))
-	case <-ctx.Done():
-		return nil, ctx.Err()
+			response.ProcessedFiles, response.SkippedFiles, len(response.Errors))
 	}
 
-	// Build response
-	response := &model.CrawlResponse{
-		TotalFiles:     len(filesToProcess),
-		ProcessedFiles: processedFiles,
-		SkippedFiles:   skippedFiles,
-		Errors:         errors,
-		RootTreeSHA:    tree.SHA,
-		Duration:       time.Since(startTime).String(),
-		RepoInfo: model.RepositoryInfo{
-			Owner: owner,
-			Name:  repo,
-			Ref:   ref,
-		},
-		Files: fileResults,
+	return response, nil
+}
+
+// truncateLength returns how much of a file over maxSize is kept: the first
+// TruncateOversizeBytes, but never more than the file's own limit
+func truncateLength(cfg *config.Config, maxSize int64) int64 {
+	return min(cfg.TruncateOversizeBytes, maxSize)
+}
+
+// trimPartialRune drops a UTF-8 sequence left incomplete by cutting content
+// short, so truncated text files still pass UTF-8 validation
+func trimPartialRune(content []byte) []byte {
+	for i := 0; i < utf8.UTFMax-1 && len(content) > 0; i++ {
+		r, size := utf8.DecodeLastRune(content)
+		if r != utf8.RuneError || size != 1 {
+			break
+		}
+		content = content[:len(content)-1]
 	}
+	return content
+}
 
-	return response, nil
+// applyOutputMode shapes a successful result's content for the requested output mode
+func (p *Pool) applyOutputMode(result *model.FileResult, mode, owner, repo string) {
+	switch mode {
+	case model.OutputModeBase64Explicit:
+		// Content still marshals as base64; the encoding field makes that explicit
+		result.Encoding = "base64"
+	case model.OutputModeReference:
+		result.Content = nil
+		result.ContentURL = p.githubClient.BlobURL(owner, repo, result.SHA)
+	}
 }
 
-// shouldProcessFile determines if a file should be processed based on path filters and file extensions
-func (p *Pool) shouldProcessFile(path string, pathFilter []string) bool {
+// shouldProcessFile determines if a file should be processed based on path filters, the ignore file, regexes, depth and file extensions
+func (p *Pool) shouldProcessFile(path string, opts CrawlOptions) bool {
 	// Check path filters first (existing logic)
-	if len(pathFilter) > 0 {
+	if len(opts.PathFilter) > 0 {
 		matchesFilter := false
-		for _, filter := range pathFilter {
+		for _, filter := range opts.PathFilter {
 			if len(path) >= len(filter) && path[:len(filter)] == filter {
 				matchesFilter = true
 				break
@@ -361,50 +1531,106 @@ func (p *Pool) shouldProcessFile(path string, pathFilter []string) bool {
 		}
 	}
 
+	// Check the repository's ignore file
+	if opts.ignore.ignored(path) {
+		p.metrics.RecordFileFiltered("ignore_file")
+		return false
+	}
+
+	// Check path regexes, exclude taking precedence
+	if p.config.ExcludePattern != nil && p.config.ExcludePattern.MatchString(path) {
+		p.metrics.RecordFileFiltered("exclude_regex")
+		return false
+	}
+	if p.config.IncludePattern != nil && !p.config.IncludePattern.MatchString(path) {
+		p.metrics.RecordFileFiltered("include_regex")
+		return false
+	}
+
+	// Check path depth
+	maxDepth := p.config.MaxPathDepth
+	if opts.MaxPathDepth > 0 {
+		maxDepth = opts.MaxPathDepth
+	}
+	if maxDepth > 0 && strings.Count(path, "/") > maxDepth {
+		p.metrics.RecordFileFiltered("path_depth")
+		return false
+	}
+
+	// Check language set
+	if !matchesLanguages(path, opts.Languages) {
+		p.metrics.RecordFileFiltered("language")
+		return false
+	}
+
 	// Check file extension
-	if len(p.config.AllowedExtensions) > 0 {
-		return p.IsAllowedFileType(path)
+	return p.isAllowedFileType(path, p.allowedExtensions(opts))
+}
+
+// filterReason returns why a file is left out before fetching, or "" if it
+// should be fetched
+func (p *Pool) filterReason(path string, size int, opts CrawlOptions) string {
+	if !p.shouldProcessFile(path, opts) {
+		return model.SkipFiltered
+	}
+	if !p.withinSizeLimits(path, size) {
+		if int64(size) < p.config.MinFileSize {
+			return model.SkipFiltered
+		}
+		return model.SkipTooLarge
+	}
+	return ""
+}
+
+// allowedExtensions returns the extension allowlist for a crawl, preferring
+// the per-crawl override over the configured list
+func (p *Pool) allowedExtensions(opts CrawlOptions) stringSet {
+	if len(opts.AllowedExtensions) == 0 {
+		return p.allowedExtensionSet
+	}
+	if opts.allowedExtensionSet != nil {
+		return opts.allowedExtensionSet
+	}
+	return newStringSet(opts.AllowedExtensions)
+}
+
+// withinSizeLimits checks a file's tree-reported size against the configured
+// bounds, including any limit for its extension, so empty and oversized files
+// are dropped before a task is submitted.
+// Oversized files are kept when they will be truncated instead.
+func (p *Pool) withinSizeLimits(path string, size int) bool {
+	if int64(size) < p.config.MinFileSize {
+		p.metrics.RecordFileFiltered("too_small")
+		return false
+	}
+
+	if maxSize := p.config.MaxFileSizeFor(path); maxSize > 0 && int64(size) > maxSize && p.config.TruncateOversizeBytes <= 0 {
+		p.metrics.RecordFileFiltered("too_large")
+		return false
 	}
 
 	return true
 }
 
 // IsAllowedFileType checks if the file extension is in the allowed list
-func (p *Pool) IsAllowedFileType(path string) bool {
-	if len(p.config.AllowedExtensions) == 0 {
+func (p *Pool) IsAllowedFileType(path string, allowedExtensions []string) bool {
+	return p.isAllowedFileType(path, newStringSet(allowedExtensions))
+}
+
+// isAllowedFileType checks a path against an extension set and the configured
+// special filenames; an empty extension set allows everything
+func (p *Pool) isAllowedFileType(path string, allowedExtensions stringSet) bool {
+	if len(allowedExtensions) == 0 {
 		return true // No restrictions if no extensions configured
 	}
 
-	ext := strings.ToLower(filepath.Ext(path))
-	filename := strings.ToLower(filepath.Base(path))
-
 	// Check extension
-	for _, allowedExt := range p.config.AllowedExtensions {
-		if ext == allowedExt {
-			return true
-		}
+	if allowedExtensions.has(strings.ToLower(filepath.Ext(path))) {
+		return true
 	}
 
 	// Check special filenames (dockerfile, makefile, etc.)
-	specialFiles := []string{
-		"dockerfile", "makefile", "rakefile", "gemfile", "guardfile",
-		"capfile", "berksfile", "cheffile", "vagrantfile", "fastfile",
-		"appfile", "deliverfile", "matchfile", "gymfile", "scanfile",
-		"snapfile", "podfile", "cartfile", "brewfile", "requirements.txt",
-		"setup.py", "setup.cfg", "pyproject.toml", "pipfile", "poetry.lock",
-		"package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml",
-		"composer.json", "composer.lock", "go.mod", "go.sum", "cargo.toml",
-		"cargo.lock", "build.gradle", "pom.xml", "build.sbt", "mix.exs",
-		"deps.edn", "project.clj", "stack.yaml", "cabal.project",
-	}
-
-	for _, special := range specialFiles {
-		if filename == special {
-			return true
-		}
-	}
-
-	return false
+	return p.specialFileSet.has(strings.ToLower(filepath.Base(path)))
 }
 
 // IsBinaryContent detects if content is binary by checking for null bytes and non-printable characters
@@ -0,0 +1,194 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// benchmarkTreePaths builds a tree shaped like a large monorepo: nested
+// packages of source files mixed with tests, docs, manifests, vendored code,
+// generated files and binary assets
+func benchmarkTreePaths(n int) []string {
+	dirs := []string{
+		"cmd/server", "internal/api/handlers", "internal/storage/postgres", "pkg/client",
+		"web/src/components/forms", "web/src/hooks", "docs/guides", "scripts",
+		"vendor/github.com/pkg/errors", "third_party/proto/google/api", "assets/images",
+		"services/billing/src/main/java/com/example/billing", "deploy/helm/templates",
+	}
+	files := []string{
+		"main.go", "handler_test.go", "README.md", "index.tsx", "styles.css",
+		"Dockerfile", "Makefile", "package.json", "logo.png", "schema.pb.go",
+		"BillingService.java", "values.yaml", "font.woff2", "setup.py", "archive.tar.gz",
+	}
+
+	paths := make([]string, 0, n)
+	for i := 0; len(paths) < n; i++ {
+		dir := dirs[i%len(dirs)]
+		file := files[(i/len(dirs))%len(files)]
+		paths = append(paths, fmt.Sprintf("%s/m%d/%s", dir, i/(len(dirs)*len(files)), file))
+	}
+	return paths
+}
+
+func newBenchmarkPool() *Pool {
+	cfg := &config.Config{
+		AllowedExtensions:     config.NormalizeExtensions([]string{".go", ".js", ".ts", ".tsx", ".py", ".java", ".md", ".yaml", ".yml", ".json", ".toml", ".proto"}),
+		SpecialFiles:          config.DefaultSpecialFiles,
+		EnableBinaryDetection: true,
+		MaxPathDepth:          10,
+	}
+	return NewPool(cfg, metrics.NewForTesting(), nil)
+}
+
+func BenchmarkIsBinaryContent(b *testing.B) {
+	pool := newBenchmarkPool()
+
+	// Borderline content sits just under the 30% non-printable threshold so
+	// every byte of the sample is scanned
+	borderline := make([]byte, 8192)
+	for i := range borderline {
+		if i%10 < 3 {
+			borderline[i] = 0x80
+		} else {
+			borderline[i] = 'a'
+		}
+	}
+
+	inputs := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "text", content: bytes.Repeat([]byte("func main() { fmt.Println(\"hello\") }\n"), 1000)},
+		{name: "binary", content: append([]byte{0x89, 'P', 'N', 'G', 0, 0, 0, 0x0d}, bytes.Repeat([]byte{0xff, 0x00}, 8192)...)},
+		{name: "borderline", content: borderline},
+		{name: "small", content: []byte("package main\n")},
+	}
+
+	for _, input := range inputs {
+		b.Run(input.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				pool.IsBinaryContent(input.content)
+			}
+		})
+	}
+}
+
+// linearAllowedFileType is the original slice-scanning IsAllowedFileType,
+// kept as a baseline for the set lookups
+func linearAllowedFileType(path string, allowedExtensions, specialFiles []string) bool {
+	if len(allowedExtensions) == 0 {
+		return true
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	filename := strings.ToLower(filepath.Base(path))
+
+	for _, allowedExt := range allowedExtensions {
+		if ext == allowedExt {
+			return true
+		}
+	}
+	for _, special := range specialFiles {
+		if filename == special {
+			return true
+		}
+	}
+	return false
+}
+
+func BenchmarkIsAllowedFileType(b *testing.B) {
+	pool := newBenchmarkPool()
+	paths := benchmarkTreePaths(50000)
+	allowed := pool.config.AllowedExtensions
+
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			linearAllowedFileType(paths[i%len(paths)], allowed, pool.config.SpecialFiles)
+		}
+	})
+
+	b.Run("set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pool.isAllowedFileType(paths[i%len(paths)], pool.allowedExtensionSet)
+		}
+	})
+}
+
+func BenchmarkShouldProcessFile(b *testing.B) {
+	pool := newBenchmarkPool()
+	paths := benchmarkTreePaths(50000)
+
+	options := []struct {
+		name string
+		opts CrawlOptions
+	}{
+		{name: "defaults", opts: CrawlOptions{}},
+		{name: "path filter", opts: CrawlOptions{PathFilter: []string{"internal/", "pkg/", "docs/"}}},
+		{name: "languages", opts: CrawlOptions{Languages: []string{"go", "typescript"}}},
+	}
+
+	for _, option := range options {
+		b.Run(option.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				pool.shouldProcessFile(paths[i%len(paths)], option.opts)
+			}
+		})
+	}
+}
+
+// BenchmarkResultDelivery crawls a tree of small files with a large pool,
+// comparing one channel send per result with worker-side batches
+func BenchmarkResultDelivery(b *testing.B) {
+	paths := benchmarkTreePaths(20000)
+	tree := &model.GitHubTreeResponse{SHA: "root"}
+	contents := make(map[string][]byte, len(paths))
+	for i, path := range paths {
+		tree.Tree = append(tree.Tree, model.TreeEntry{Path: path, Type: "blob", SHA: fmt.Sprintf("%040d", i), Size: 12})
+		contents[path] = []byte("package main")
+	}
+	fetcher := &fakeFetcher{tree: tree, contents: contents}
+
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	for _, workers := range []int{64, 1024} {
+		for _, batchSize := range []int{1, 16, 64} {
+			b.Run(fmt.Sprintf("workers=%d/batch=%d", workers, batchSize), func(b *testing.B) {
+				cfg := &config.Config{
+					MaxWorkers:           workers,
+					MaxConcurrentFetches: workers,
+					TaskQueueSize:        len(paths),
+					MaxFileSize:          1024,
+					FetchTimeoutMS:       10000,
+					ResultBatchSize:      batchSize,
+					AllowedExtensions:    config.NormalizeExtensions([]string{".go", ".md", ".json", ".yaml", ".tsx", ".py", ".java"}),
+					SpecialFiles:         config.DefaultSpecialFiles,
+				}
+				pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+				require.NoError(b, pool.Start(context.Background()))
+				defer pool.Stop()
+
+				opts := CrawlOptions{ResultSink: func(model.FileResult) {}}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", opts)
+					require.NoError(b, err)
+					require.Equal(b, len(paths), response.TotalFiles+response.FilteredFiles)
+				}
+			})
+		}
+	}
+}
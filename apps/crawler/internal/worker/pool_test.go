@@ -2,9 +2,20 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
 	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
@@ -89,10 +100,26 @@ func TestSubmitTask(t *testing.T) {
 
 	// Submit third task should fail (queue full)
 	err = pool.SubmitTask(task)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrTaskQueueFull)
 	assert.Contains(t, err.Error(), "queue is full")
 }
 
+func TestSubmitTaskQueueSizeSeparateFromConcurrency(t *testing.T) {
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 1,
+		TaskQueueSize:        5,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), &github.Client{})
+
+	task := model.WorkerTask{Path: "test.go", Owner: "owner", Repo: "repo", Ref: "main"}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pool.SubmitTask(task))
+	}
+	assert.Equal(t, 5, pool.GetQueueDepth())
+	assert.ErrorIs(t, pool.SubmitTask(task), ErrTaskQueueFull)
+}
+
 func TestGetQueueDepth(t *testing.T) {
 	cfg := &config.Config{
 		MaxWorkers:           1,
@@ -126,6 +153,7 @@ func TestGetQueueDepth(t *testing.T) {
 func TestShouldProcessFile(t *testing.T) {
 	cfg := &config.Config{
 		AllowedExtensions: []string{".go", ".js", ".py"},
+		SpecialFiles:      config.DefaultSpecialFiles,
 	}
 	m := metrics.NewForTesting()
 	ghClient := &github.Client{}
@@ -133,10 +161,11 @@ func TestShouldProcessFile(t *testing.T) {
 	pool := NewPool(cfg, m, ghClient)
 
 	tests := []struct {
-		name       string
-		path       string
-		pathFilter []string
-		expected   bool
+		name         string
+		path         string
+		pathFilter   []string
+		maxPathDepth int
+		expected     bool
 	}{
 		{
 			name:     "allowed extension",
@@ -170,19 +199,151 @@ func TestShouldProcessFile(t *testing.T) {
 			path:     "Makefile",
 			expected: true,
 		},
+		{
+			name:         "within path depth",
+			path:         "docs/guide/intro.go",
+			maxPathDepth: 2,
+			expected:     true,
+		},
+		{
+			name:         "exceeds path depth",
+			path:         "gen/proto/v1/api/service.go",
+			maxPathDepth: 2,
+			expected:     false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := pool.shouldProcessFile(tt.path, tt.pathFilter)
+			result := pool.shouldProcessFile(tt.path, CrawlOptions{PathFilter: tt.pathFilter, MaxPathDepth: tt.maxPathDepth})
 			assert.Equal(t, tt.expected, result)
 		})
 	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("path_depth")))
+}
+
+func TestShouldProcessFileLanguages(t *testing.T) {
+	cfg := &config.Config{AllowedExtensions: []string{".py", ".go", ".txt"}}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, &github.Client{})
+
+	opts := CrawlOptions{Languages: []string{"python"}}
+	assert.True(t, pool.shouldProcessFile("app.py", opts))
+	assert.True(t, pool.shouldProcessFile("requirements.txt", opts))
+	assert.False(t, pool.shouldProcessFile("main.go", opts))
+
+	// Languages narrow AllowedExtensions rather than widening it
+	assert.False(t, pool.shouldProcessFile("stubs.pyi", opts))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("language")))
+}
+
+func TestShouldProcessFileAllowedExtensionsOverride(t *testing.T) {
+	cfg := &config.Config{AllowedExtensions: []string{".go"}, SpecialFiles: []string{"makefile"}}
+	pool := NewPool(cfg, metrics.NewForTesting(), &github.Client{})
+
+	// An override replaces the configured list
+	opts := CrawlOptions{AllowedExtensions: []string{".md", ".rst"}}
+	assert.True(t, pool.shouldProcessFile("docs/guide.md", opts))
+	assert.True(t, pool.shouldProcessFile("index.rst", opts))
+	assert.False(t, pool.shouldProcessFile("main.go", opts))
+
+	// Special filenames are still allowed
+	assert.True(t, pool.shouldProcessFile("Makefile", opts))
+
+	// Empty falls back to the configured list
+	assert.True(t, pool.shouldProcessFile("main.go", CrawlOptions{}))
+	assert.False(t, pool.shouldProcessFile("docs/guide.md", CrawlOptions{}))
+}
+
+func TestCrawlRepositoryUnknownLanguage(t *testing.T) {
+	pool := NewPool(&config.Config{}, metrics.NewForTesting(), &github.Client{})
+
+	_, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{Languages: []string{"cobol++"}})
+	assert.ErrorIs(t, err, ErrUnknownLanguage)
+}
+
+func TestShouldProcessFileConfiguredDepth(t *testing.T) {
+	cfg := &config.Config{MaxPathDepth: 1}
+	pool := NewPool(cfg, metrics.NewForTesting(), &github.Client{})
+
+	assert.True(t, pool.shouldProcessFile("docs/README.md", CrawlOptions{}))
+	assert.False(t, pool.shouldProcessFile("docs/api/README.md", CrawlOptions{}))
+
+	// A per-request limit overrides the configured one
+	assert.True(t, pool.shouldProcessFile("docs/api/README.md", CrawlOptions{MaxPathDepth: 3}))
+}
+
+func TestShouldProcessFilePathRegexes(t *testing.T) {
+	cfg := &config.Config{
+		IncludePattern: regexp.MustCompile(`_test\.go$`),
+		ExcludePattern: regexp.MustCompile(`(^|/)generated/`),
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, &github.Client{})
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "pkg/api/handler_test.go", expected: true},
+		{path: "pkg/api/handler.go", expected: false},
+		{path: "generated/client_test.go", expected: false}, // exclude wins over include
+		{path: "pkg/generated/types_test.go", expected: false},
+		{path: "pkg/notgenerated/types_test.go", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expected, pool.shouldProcessFile(tt.path, CrawlOptions{}))
+		})
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("include_regex")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("exclude_regex")))
+}
+
+func TestWithinSizeLimits(t *testing.T) {
+	cfg := &config.Config{
+		MinFileSize: 1,
+		MaxFileSize: 1024,
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, &github.Client{})
+
+	tests := []struct {
+		name     string
+		size     int
+		expected bool
+	}{
+		{name: "empty file", size: 0, expected: false},
+		{name: "smallest allowed", size: 1, expected: true},
+		{name: "largest allowed", size: 1024, expected: true},
+		{name: "oversized file", size: 1025, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, pool.withinSizeLimits("main.go", tt.size))
+		})
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("too_small")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("too_large")))
+}
+
+func TestWithinSizeLimitsKeepsFilesToTruncate(t *testing.T) {
+	cfg := &config.Config{MaxFileSize: 100, TruncateOversizeBytes: 10}
+	pool := NewPool(cfg, metrics.NewForTesting(), &github.Client{})
+
+	assert.True(t, pool.withinSizeLimits("main.go", 1000))
 }
 
 func TestIsAllowedFileType(t *testing.T) {
 	cfg := &config.Config{
 		AllowedExtensions: []string{".go", ".js", ".py"},
+		SpecialFiles:      []string{"dockerfile", "makefile", "package.json", "go.mod", "cmakelists.txt"},
 	}
 	m := metrics.NewForTesting()
 	ghClient := &github.Client{}
@@ -229,16 +390,36 @@ func TestIsAllowedFileType(t *testing.T) {
 			path:     "go.mod",
 			expected: true,
 		},
+		{
+			name:     "configured special file matches case-insensitively",
+			path:     "src/CMakeLists.txt",
+			expected: true,
+		},
+		{
+			name:     "unlisted special file",
+			path:     "Gemfile",
+			expected: false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := pool.IsAllowedFileType(tt.path)
+			result := pool.IsAllowedFileType(tt.path, cfg.AllowedExtensions)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
 }
 
+func TestIsAllowedFileTypeMatchesLinearScan(t *testing.T) {
+	pool := newBenchmarkPool()
+
+	for _, path := range benchmarkTreePaths(5000) {
+		expected := linearAllowedFileType(path, pool.config.AllowedExtensions, pool.config.SpecialFiles)
+		assert.Equal(t, expected, pool.IsAllowedFileType(path, pool.config.AllowedExtensions), path)
+		assert.Equal(t, expected, pool.isAllowedFileType(path, pool.allowedExtensions(CrawlOptions{})), path)
+	}
+}
+
 func TestIsAllowedFileTypeNoRestrictions(t *testing.T) {
 	cfg := &config.Config{
 		AllowedExtensions: []string{}, // No restrictions
@@ -249,8 +430,8 @@ func TestIsAllowedFileTypeNoRestrictions(t *testing.T) {
 	pool := NewPool(cfg, m, ghClient)
 
 	// Should allow any file when no restrictions
-	assert.True(t, pool.IsAllowedFileType("any.file"))
-	assert.True(t, pool.IsAllowedFileType("no.extension"))
+	assert.True(t, pool.IsAllowedFileType("any.file", cfg.AllowedExtensions))
+	assert.True(t, pool.IsAllowedFileType("no.extension", cfg.AllowedExtensions))
 }
 
 func TestIsBinaryContent(t *testing.T) {
@@ -332,6 +513,92 @@ func TestProcessTaskFileTooLarge(t *testing.T) {
 	assert.Contains(t, result.Error.Error(), "file size 200 exceeds limit 100")
 }
 
+func TestProcessTaskPerFileTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"number":1}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1, // one request per second
+		ContentRequestCost:    1,
+		FetchTimeoutMS:        30000,
+		PerFileTimeoutMS:      20,
+		MaxFileSize:           1000,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	// Spend the only token so the file fetch waits on the limiter past its timeout
+	_, err = ghClient.GetPullRequest(context.Background(), "owner", "repo", 1)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	task := model.WorkerTask{Path: "slow.go", Size: 10, Owner: "owner", Repo: "repo", Ref: "main"}
+
+	start := time.Now()
+	result := pool.processTask(1, task)
+	require.Error(t, result.Error)
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("file_timeout", "owner", "repo")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner", "repo", "timeout")))
+
+	// A cancelled crawl is a plain failure, not a per-file timeout
+	crawlCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	task.Ctx = crawlCtx
+	result = pool.processTask(1, task)
+	require.Error(t, result.Error)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("fetch_failed", "owner", "repo")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("file_timeout", "owner", "repo")))
+}
+
+func TestCheckContentTruncatesOversizedContent(t *testing.T) {
+	cfg := &config.Config{MaxFileSize: 8, TruncateOversizeBytes: 4}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, &github.Client{})
+
+	task := model.WorkerTask{Path: "notes.md", Owner: "owner", Repo: "repo"}
+	result := pool.checkContent(context.Background(), 1, task, []byte("0123456789"), model.FileResult{Path: "notes.md"})
+
+	require.NoError(t, result.Error)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, []byte("0123"), result.Content)
+	assert.Equal(t, 4, result.Size)
+	assert.Equal(t, 10, result.OriginalSize)
+
+	// Without truncation the same file is skipped
+	pool = NewPool(&config.Config{MaxFileSize: 8}, m, &github.Client{})
+	result = pool.checkContent(context.Background(), 1, task, []byte("0123456789"), model.FileResult{Path: "notes.md"})
+	assert.Error(t, result.Error)
+	assert.False(t, result.Truncated)
+}
+
+func TestTrimPartialRune(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "ascii", content: "hello", expected: "hello"},
+		{name: "complete rune", content: "caf\u00e9", expected: "caf\u00e9"},
+		{name: "half of a two-byte rune", content: "caf\xc3", expected: "caf"},
+		{name: "two thirds of a three-byte rune", content: "a\xe2\x82", expected: "a"},
+		{name: "three quarters of a four-byte rune", content: "a\xf0\x9f\x98", expected: "a"},
+		{name: "empty", content: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(trimPartialRune([]byte(tt.content))))
+		})
+	}
+}
+
 func TestGetResultChannel(t *testing.T) {
 	cfg := &config.Config{
 		MaxWorkers:           1,
@@ -349,3 +616,1151 @@ func TestGetResultChannel(t *testing.T) {
 	_, ok := interface{}(resultChan).(<-chan model.FileResult)
 	assert.True(t, ok)
 }
+
+func TestCrawlRepositoryGraphQL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/git/trees/main":
+			response := model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "main.go", Type: "blob", SHA: "aaa", Size: 12},
+					{Path: "README.md", Type: "blob", SHA: "bbb", Size: 7},
+					{Path: "docs", Type: "tree", SHA: "ccc"},
+				},
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		case "/graphql":
+			_, _ = w.Write([]byte(`{"data":{"repository":{
+				"f0":{"text":"package main","isBinary":false,"isTruncated":false,"byteSize":12},
+				"f1":{"text":"# Hello","isBinary":false,"isTruncated":false,"byteSize":7}}}}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		AllowedExtensions:     []string{".go", ".md"},
+		EnableBinaryDetection: true,
+		EnableGraphQL:         true,
+		GraphQLInlineMaxSize:  1024,
+		GraphQLBatchSize:      10,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, response.TotalFiles)
+	assert.Equal(t, 2, response.ProcessedFiles)
+	assert.Equal(t, 0, response.SkippedFiles)
+	assert.Equal(t, "root123", response.RootTreeSHA)
+	require.Len(t, response.Files, 2)
+	assert.Equal(t, []byte("# Hello"), response.Files[0].Content)
+	assert.Equal(t, []byte("package main"), response.Files[1].Content)
+
+	// The tree and one GraphQL query
+	assert.Equal(t, 2, response.APIRequestCount)
+	assert.Equal(t, 1, testutil.CollectAndCount(m.CrawlGitHubRequests))
+}
+
+func TestCrawlRepositoryBlobBatching(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/git/trees/main":
+			response := model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "a.go", Type: "blob", SHA: "aaa", Size: 9},
+					{Path: "b.go", Type: "blob", SHA: "bbb", Size: 9},
+					{Path: "c.go", Type: "blob", SHA: "ccc", Size: 9},
+				},
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		case "/repos/owner/repo/git/blobs/aaa", "/repos/owner/repo/git/blobs/bbb", "/repos/owner/repo/git/blobs/ccc":
+			_, _ = w.Write([]byte(`{"content":"cGFja2FnZSBh","encoding":"base64"}`)) // "package a"
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		EnableBlobBatching:    true,
+		BlobBatchMaxFileSize:  1024,
+		BlobBatchSize:         2,
+		BlobBatchConcurrency:  2,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, response.TotalFiles)
+	assert.Equal(t, 3, response.ProcessedFiles)
+	for _, file := range response.Files {
+		assert.Equal(t, []byte("package a"), file.Content)
+	}
+}
+
+func TestCrawlRepositoryFileHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/git/trees/main":
+			response := model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "a.go", Type: "blob", SHA: "aaa", Size: 9},
+					{Path: "b.go", Type: "blob", SHA: "bbb", Size: 9},
+				},
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		case "/repos/owner/repo/git/blobs/aaa", "/repos/owner/repo/git/blobs/bbb":
+			_, _ = w.Write([]byte(`{"content":"cGFja2FnZSBh","encoding":"base64"}`)) // "package a"
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		EnableBlobBatching:    true,
+		BlobBatchMaxFileSize:  1024,
+		BlobBatchSize:         2,
+		BlobBatchConcurrency:  2,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	pool.SetFileHook(func(ctx context.Context, result *model.FileResult) error {
+		require.NotNil(t, ctx)
+		if result.Path == "b.go" {
+			return fmt.Errorf("generated file")
+		}
+		result.Content = []byte(strings.ToUpper(string(result.Content)))
+		return nil
+	})
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, response.ProcessedFiles)
+	assert.Equal(t, 1, response.SkippedFiles)
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "b.go", response.Errors[0].FilePath)
+	assert.Contains(t, response.Errors[0].Error, "file hook: generated file")
+
+	files := make(map[string]model.FileResult)
+	for _, file := range response.Files {
+		files[file.Path] = file
+	}
+	assert.Equal(t, []byte("PACKAGE A"), files["a.go"].Content)
+	assert.Error(t, files["b.go"].Error)
+	assert.Nil(t, files["b.go"].Content)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner", "repo", "skipped_hook")))
+}
+
+func TestApplyOutputMode(t *testing.T) {
+	cfg := &config.Config{}
+	m := metrics.NewForTesting()
+	ghClient := &github.Client{}
+
+	pool := NewPool(cfg, m, ghClient)
+
+	tests := []struct {
+		name           string
+		mode           string
+		wantContent    []byte
+		wantEncoding   string
+		wantContentURL string
+	}{
+		{
+			name:        "inline",
+			mode:        model.OutputModeInline,
+			wantContent: []byte("hello"),
+		},
+		{
+			name:         "base64 explicit",
+			mode:         model.OutputModeBase64Explicit,
+			wantContent:  []byte("hello"),
+			wantEncoding: "base64",
+		},
+		{
+			name:           "reference",
+			mode:           model.OutputModeReference,
+			wantContentURL: "/repos/owner/repo/git/blobs/abc123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := model.FileResult{Path: "main.go", SHA: "abc123", Content: []byte("hello")}
+			pool.applyOutputMode(&result, tt.mode, "owner", "repo")
+
+			assert.Equal(t, tt.wantContent, result.Content)
+			assert.Equal(t, tt.wantEncoding, result.Encoding)
+			assert.Equal(t, tt.wantContentURL, result.ContentURL)
+		})
+	}
+}
+
+func TestCrawlRepositoryInvalidOutputMode(t *testing.T) {
+	cfg := &config.Config{}
+	m := metrics.NewForTesting()
+	ghClient := &github.Client{}
+
+	pool := NewPool(cfg, m, ghClient)
+
+	_, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{OutputMode: "yaml"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid output mode "yaml"`)
+}
+
+func TestCrawlPullRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/pulls/7":
+			_, _ = w.Write([]byte(`{"number":7,"state":"open","head":{"ref":"feature","sha":"head123"}}`))
+		case "/repos/owner/repo/pulls/7/files":
+			_, _ = w.Write([]byte(`[
+				{"sha":"aaa","filename":"new.go","status":"added"},
+				{"sha":"bbb","filename":"moved.go","status":"renamed","previous_filename":"old.go"},
+				{"sha":"ccc","filename":"gone.go","status":"removed"},
+				{"sha":"ddd","filename":"image.png","status":"added"}
+			]`))
+		case "/repos/owner/repo/git/blobs/aaa", "/repos/owner/repo/git/blobs/bbb":
+			_, _ = w.Write([]byte(`{"content":"cGFja2FnZSBh","encoding":"base64"}`)) // "package a"
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		AllowedExtensions:     []string{".go"},
+		EnableBlobBatching:    true,
+		BlobBatchMaxFileSize:  1024,
+		BlobBatchSize:         10,
+		BlobBatchConcurrency:  2,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlPullRequest(context.Background(), "owner", "repo", 7, CrawlOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, response.PullRequest)
+	assert.Equal(t, "head123", response.RepoInfo.Ref)
+	assert.Equal(t, 3, response.TotalFiles)
+	assert.Equal(t, 2, response.ProcessedFiles)
+
+	statuses := make(map[string]model.FileResult)
+	for _, file := range response.Files {
+		statuses[file.Path] = file
+	}
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "added", statuses["new.go"].Status)
+	assert.Equal(t, []byte("package a"), statuses["new.go"].Content)
+	assert.Equal(t, "renamed", statuses["moved.go"].Status)
+	assert.Equal(t, "old.go", statuses["moved.go"].PreviousPath)
+	assert.Equal(t, "removed", statuses["gone.go"].Status)
+	assert.Nil(t, statuses["gone.go"].Content)
+}
+
+func TestCrawlPullRequestSortsRemovedFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/pulls/7":
+			_, _ = w.Write([]byte(`{"number":7,"state":"open","head":{"ref":"feature","sha":"head123"}}`))
+		case "/repos/owner/repo/pulls/7/files":
+			_, _ = w.Write([]byte(`[
+				{"sha":"bbb","filename":"b.go","status":"modified"},
+				{"sha":"ccc","filename":"c.go","status":"added"},
+				{"sha":"aaa","filename":"a.go","status":"removed"}
+			]`))
+		case "/repos/owner/repo/git/blobs/bbb", "/repos/owner/repo/git/blobs/ccc":
+			_, _ = w.Write([]byte(`{"content":"cGFja2FnZSBh","encoding":"base64"}`)) // "package a"
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		AllowedExtensions:     []string{".go"},
+		EnableBlobBatching:    true,
+		BlobBatchMaxFileSize:  1024,
+		BlobBatchSize:         10,
+		BlobBatchConcurrency:  2,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlPullRequest(context.Background(), "owner", "repo", 7, CrawlOptions{CrawlID: "pr-7"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, response.TotalFiles)
+
+	// The removed file sorts with the fetched ones rather than after them
+	var paths []string
+	for _, file := range response.Files {
+		paths = append(paths, file.Path)
+		assert.Equal(t, "pr-7", file.CrawlID)
+	}
+	assert.Equal(t, []string{"a.go", "b.go", "c.go"}, paths)
+	assert.Equal(t, "removed", response.Files[0].Status)
+}
+
+func TestCrawlRepositoryRateLimitPreflight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/git/trees/main":
+			response := model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "a.go", Type: "blob", SHA: "aaa", Size: 9},
+					{Path: "b.go", Type: "blob", SHA: "bbb", Size: 9},
+				},
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		case "/rate_limit":
+			_, _ = w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":1,"reset":1700000000}}}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		RateLimitPreflight:    config.PreflightRefuse,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+
+	_, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInsufficientQuota)
+	assert.Contains(t, err.Error(), "only 1 of 5000 remain")
+}
+
+func TestCrawlRepositoryRateLimitPreflightReserve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/git/trees/main":
+			response := model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "a.go", Type: "blob", SHA: "aaa", Size: 9},
+					{Path: "b.go", Type: "blob", SHA: "bbb", Size: 9},
+				},
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		case "/rate_limit":
+			_, _ = w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":10,"reset":1700000000}}}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		RateLimitPreflight:    config.PreflightRefuse,
+		RateLimitReserve:      9,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+
+	// 10 remain, but 9 of them are reserved for other systems
+	_, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInsufficientQuota)
+	assert.Contains(t, err.Error(), "only 1 of 5000 remain")
+}
+
+func TestCrawlRepositoryTenantToken(t *testing.T) {
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.URL.Path+" "+r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/repos/owner/private/git/trees/main":
+			_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{
+				SHA:  "root123",
+				Tree: []model.TreeEntry{{Path: "main.go", Type: "blob", SHA: "aaa", Size: 12}},
+			})
+		case "/graphql":
+			_, _ = w.Write([]byte(`{"data":{"repository":{"f0":{"text":"package main","isBinary":false,"isTruncated":false,"byteSize":12}}}}`))
+		case "/rate_limit":
+			// All the tenant's quota is theirs; the reserve is for the shared token
+			_, _ = w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":2,"reset":1700000000}}}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "service-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           1024,
+		AllowedExtensions:     []string{".go"},
+		EnableGraphQL:         true,
+		GraphQLInlineMaxSize:  1024,
+		GraphQLBatchSize:      10,
+		RateLimitPreflight:    config.PreflightRefuse,
+		RateLimitReserve:      100,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "private", "main", CrawlOptions{GitHubToken: "tenant-token"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.ProcessedFiles)
+
+	assert.Equal(t, []string{
+		"/repos/owner/private/git/trees/main token tenant-token",
+		"/rate_limit token tenant-token",
+		"/graphql token tenant-token",
+	}, seen)
+}
+
+func TestFetchFilesReportsDroppedTasks(t *testing.T) {
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 1,
+	}
+	m := metrics.NewForTesting()
+	ghClient := &github.Client{}
+
+	pool := NewPool(cfg, m, ghClient)
+
+	// Fill the queue of a pool with no workers, so the crawl runs out of
+	// time waiting for room
+	require.NoError(t, pool.SubmitTask(model.WorkerTask{Path: "other.go"}))
+
+	files := []model.TreeEntry{
+		{Path: "a.go", Type: "blob", SHA: "aaa"},
+		{Path: "b.go", Type: "blob", SHA: "bbb"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	response, err := pool.fetchFiles(ctx, pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{CrawlID: "crawl-1"}), "main", files)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, response.DroppedFiles)
+	assert.Equal(t, 0, response.ProcessedFiles)
+	require.Len(t, response.Errors, 2)
+	assert.Equal(t, "task_dropped", response.Errors[0].Type)
+	assert.Contains(t, response.Errors[0].Error, context.DeadlineExceeded.Error())
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.TasksDroppedTotal.WithLabelValues("owner", "repo")))
+}
+
+func TestCrawlWaitsForQueueRoom(t *testing.T) {
+	tree := &model.GitHubTreeResponse{SHA: "root123"}
+	contents := make(map[string][]byte)
+	for i := range 20 {
+		path := fmt.Sprintf("file%02d.go", i)
+		tree.Tree = append(tree.Tree, model.TreeEntry{Path: path, Type: "blob", SHA: path, Size: 9})
+		contents[path] = []byte("package a")
+	}
+	cfg := &config.Config{
+		MaxWorkers:           2,
+		MaxConcurrentFetches: 2,
+		TaskQueueSize:        1,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, &fakeFetcher{tree: tree, contents: contents})
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 20, response.ProcessedFiles)
+	assert.Equal(t, 0, response.DroppedFiles)
+	assert.Empty(t, response.Errors)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.TasksDroppedTotal.WithLabelValues("owner", "repo")))
+}
+
+func TestSendResultSpillsOverflow(t *testing.T) {
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 1,
+		ResultOverflow:       config.ResultOverflowSpill,
+		ResultSpillDir:       t.TempDir(),
+		ResultSpillMaxBytes:  1024 * 1024,
+	}
+	m := metrics.NewForTesting()
+
+	pool := NewPool(cfg, m, &github.Client{})
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	// The channel holds one result, the rest go to disk without blocking
+	for _, path := range []string{"a.go", "b.go", "c.go"} {
+		require.True(t, pool.sendResult(model.FileResult{Path: path}))
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.ResultsSpilledTotal))
+
+	var paths []string
+	for range 3 {
+		result := <-pool.GetResultChannel()
+		paths = append(paths, result.Path)
+	}
+	assert.Equal(t, []string{"a.go", "b.go", "c.go"}, paths)
+}
+
+func TestPoolIdleShrinkAndRespawn(t *testing.T) {
+	cfg := &config.Config{
+		MaxWorkers:           3,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1,
+		WorkerIdleTimeoutMS:  20,
+	}
+	m := metrics.NewForTesting()
+
+	pool := NewPool(cfg, m, &github.Client{})
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	// All workers retire once idle but the pool keeps running
+	assert.Eventually(t, func() bool { return pool.ActiveWorkers() == 0 }, time.Second, 5*time.Millisecond)
+	assert.True(t, pool.IsRunning())
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.WorkerPoolSize))
+
+	// A new task brings a worker back; the oversized file fails without a network call
+	require.NoError(t, pool.SubmitTask(model.WorkerTask{Path: "big.go", Size: 100}))
+
+	select {
+	case result := <-pool.GetResultChannel():
+		assert.Equal(t, "big.go", result.Path)
+		assert.Error(t, result.Error)
+	case <-time.After(time.Second):
+		t.Fatal("task was not processed after scaling up")
+	}
+	assert.LessOrEqual(t, pool.ActiveWorkers(), cfg.MaxWorkers)
+}
+
+func TestConcurrentCrawlsReceiveOwnResults(t *testing.T) {
+	for _, batchSize := range []int{1, 8} {
+		t.Run(fmt.Sprintf("batch=%d", batchSize), func(t *testing.T) {
+			testConcurrentCrawlsReceiveOwnResults(t, batchSize)
+		})
+	}
+}
+
+func testConcurrentCrawlsReceiveOwnResults(t *testing.T, batchSize int) {
+	cfg := &config.Config{
+		MaxWorkers:           4,
+		MaxConcurrentFetches: 100,
+		MaxFileSize:          1,
+		ResultBatchSize:      batchSize,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), &github.Client{})
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	// Oversized files fail in the worker without a network call
+	filesFor := func(prefix string) []model.TreeEntry {
+		var files []model.TreeEntry
+		for i := range 20 {
+			files = append(files, model.TreeEntry{Path: fmt.Sprintf("%s/%d.go", prefix, i), Type: "blob", Size: 100})
+		}
+		return files
+	}
+
+	var (
+		wg        sync.WaitGroup
+		responses = make([]*model.CrawlResponse, 2)
+	)
+	for i, repo := range []string{"repo-a", "repo-b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := pool.fetchFiles(context.Background(), pool.newCollector("owner", repo, model.OutputModeInline, CrawlOptions{CrawlID: "crawl-" + repo}), "main", filesFor(repo))
+			assert.NoError(t, err)
+			responses[i] = response
+		}()
+	}
+	wg.Wait()
+
+	for i, repo := range []string{"repo-a", "repo-b"} {
+		require.NotNil(t, responses[i])
+		assert.Equal(t, "crawl-"+repo, responses[i].CrawlID)
+		require.Len(t, responses[i].Files, 20)
+		for _, file := range responses[i].Files {
+			assert.True(t, strings.HasPrefix(file.Path, repo+"/"), "%s received result for %s", repo, file.Path)
+			assert.Equal(t, "crawl-"+repo, file.CrawlID)
+		}
+	}
+}
+
+func TestCrawlID(t *testing.T) {
+	assert.Equal(t, "req-123", crawlID(CrawlOptions{CrawlID: "req-123"}))
+
+	generated := crawlID(CrawlOptions{})
+	assert.Len(t, generated, 16)
+	assert.NotEqual(t, generated, crawlID(CrawlOptions{}))
+}
+
+func TestCrawlRepositoryContentBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/repos/owner/repo/git/trees/main" {
+			_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "a.go", Type: "blob", SHA: "aaa", Size: 9},
+					{Path: "b.go", Type: "blob", SHA: "bbb", Size: 9},
+					{Path: "c.go", Type: "blob", SHA: "ccc", Size: 9},
+				},
+			})
+			return
+		}
+		_, _ = w.Write([]byte(`{"content":"cGFja2FnZSBh","encoding":"base64"}`)) // "package a"
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:             "test-token",
+		GitHubBaseURL:           server.URL,
+		APIRateLimitThreshold:   1000,
+		FetchTimeoutMS:          30000,
+		RetryBackoffBaseMS:      100,
+		MaxWorkers:              1,
+		MaxConcurrentFetches:    10,
+		MaxFileSize:             1024,
+		MaxInMemoryContentBytes: 20, // room for two 9-byte files
+		EnableBlobBatching:      true,
+		BlobBatchMaxFileSize:    1024,
+		BlobBatchSize:           3,
+		BlobBatchConcurrency:    1,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, response.ProcessedFiles)
+	assert.Equal(t, 1, response.ContentOmitted)
+
+	var withContent int
+	for _, file := range response.Files {
+		if file.ContentOmitted {
+			assert.Nil(t, file.Content)
+			assert.NotEmpty(t, file.ContentURL)
+			continue
+		}
+		assert.Equal(t, []byte("package a"), file.Content)
+		withContent++
+	}
+	assert.Equal(t, 2, withContent)
+}
+
+func TestCrawlRepositoryExplicitPaths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"repository":{
+			"f0":{"text":"# Docs","isBinary":false,"isTruncated":false,"byteSize":6},
+			"f1":{"text":"this file is far too large","isBinary":false,"isTruncated":false,"byteSize":27}}}}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            1,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           16,
+		EnableGraphQL:         true,
+		GraphQLInlineMaxSize:  1024,
+		GraphQLBatchSize:      10,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, ghClient)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	// The tree is never fetched; duplicates and leading slashes are normalised
+	opts := CrawlOptions{Paths: []string{"/docs/README.md", "docs/big.md", "docs/README.md"}}
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, response.TotalFiles)
+	assert.Equal(t, 1, response.ProcessedFiles)
+	assert.Empty(t, response.RootTreeSHA)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "docs/big.md", response.Errors[0].FilePath)
+	assert.Contains(t, response.Errors[0].Error, "exceeds limit")
+}
+
+func TestFetchFilesReturnsPartialOnDeadline(t *testing.T) {
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+	}
+	m := metrics.NewForTesting()
+	ghClient := &github.Client{}
+
+	// The pool isn't started, so queued tasks are never picked up
+	pool := NewPool(cfg, m, ghClient)
+
+	files := []model.TreeEntry{
+		{Path: "a.go", Type: "blob", SHA: "aaa"},
+		{Path: "b.go", Type: "blob", SHA: "bbb"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	response, err := pool.fetchFiles(ctx, pool.newCollector("owner", "repo", model.OutputModeInline, CrawlOptions{CrawlID: "crawl-1"}), "main", files)
+	require.NoError(t, err)
+
+	assert.True(t, response.Partial)
+	assert.Equal(t, 0, response.ProcessedFiles)
+	assert.Equal(t, 2, response.TotalFiles)
+}
+
+// serverFetcher is the real client for everything but file content, which it
+// reads from the test server's /raw/ routes; the client's raw CDN URL can't be
+// pointed at a test server from outside the github package.
+type serverFetcher struct {
+	*github.Client
+	baseURL string
+}
+
+func (f *serverFetcher) GetFileContentPrefix(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, error) {
+	url := fmt.Sprintf("%s/raw/%s/%s/%s/%s", f.baseURL, owner, repo, ref, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("failed to get file content for %s: status %d", path, resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(content)) > limit {
+		return content[:limit], true, nil
+	}
+	return content, false, nil
+}
+
+func TestCrawlRepositoryEndToEnd(t *testing.T) {
+	contents := map[string][]byte{
+		"main.go":      []byte("package main\n"),
+		"util/util.go": []byte("package util\n"),
+		"logo.go":      {0x89, 'P', 'N', 'G', 0x00, 0x00, 0x00, 0x0d},
+		"grown.go":     []byte(strings.Repeat("x", 100)),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/owner/repo/git/trees/main" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(model.GitHubTreeResponse{
+				SHA: "root123",
+				Tree: []model.TreeEntry{
+					{Path: "main.go", Type: "blob", SHA: "a1", Size: 13},
+					{Path: "util", Type: "tree", SHA: "a2"},
+					{Path: "util/util.go", Type: "blob", SHA: "a3", Size: 13},
+					{Path: "logo.go", Type: "blob", SHA: "a4", Size: 8},
+					{Path: "huge.go", Type: "blob", SHA: "a5", Size: 4096},
+					{Path: "grown.go", Type: "blob", SHA: "a6", Size: 10}, // stale tree size
+					{Path: "broken.go", Type: "blob", SHA: "a7", Size: 10},
+					{Path: "notes.bin", Type: "blob", SHA: "a8", Size: 10},
+				},
+			})
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/raw/owner/repo/main/")
+		if path == "broken.go" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		content, ok := contents[path]
+		if !ok {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken:           "test-token",
+		GitHubBaseURL:         server.URL,
+		APIRateLimitThreshold: 1000,
+		FetchTimeoutMS:        30000,
+		RetryBackoffBaseMS:    100,
+		MaxWorkers:            2,
+		MaxConcurrentFetches:  10,
+		MaxFileSize:           64,
+		AllowedExtensions:     []string{".go"},
+		EnableBinaryDetection: true,
+	}
+	m := metrics.NewForTesting()
+	ghClient, err := github.NewClient(cfg, m)
+	require.NoError(t, err)
+
+	pool := NewPool(cfg, m, &serverFetcher{Client: ghClient, baseURL: server.URL})
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	// huge.go is over the limit by tree size and notes.bin isn't allowed, so
+	// neither is fetched or counted
+	assert.Equal(t, "root123", response.RootTreeSHA)
+	assert.Equal(t, 5, response.TotalFiles)
+	assert.Equal(t, 2, response.ProcessedFiles)
+	assert.Equal(t, 3, response.SkippedFiles)
+	assert.Equal(t, 2, response.FilteredFiles)
+	assert.Equal(t, 7, response.TreeFiles)
+	assert.Equal(t, map[string]int{
+		model.SkipTooLarge:   2,
+		model.SkipFiltered:   1,
+		model.SkipBinary:     1,
+		model.SkipFetchError: 1,
+	}, response.SkipReasons)
+
+	byPath := make(map[string]model.FileResult)
+	for _, file := range response.Files {
+		byPath[file.Path] = file
+	}
+	assert.NotContains(t, byPath, "huge.go")
+	assert.NotContains(t, byPath, "notes.bin")
+	assert.Equal(t, []byte("package main\n"), byPath["main.go"].Content)
+	assert.Equal(t, []byte("package util\n"), byPath["util/util.go"].Content)
+	assert.Equal(t, "a3", byPath["util/util.go"].SHA)
+
+	errs := make(map[string]string)
+	for _, crawlErr := range response.Errors {
+		errs[crawlErr.FilePath] = crawlErr.Error
+	}
+	require.Len(t, errs, 3)
+	assert.Contains(t, errs["logo.go"], "skipping binary file")
+	assert.Contains(t, errs["grown.go"], "exceeds limit 64")
+	assert.Contains(t, errs["broken.go"], "status 500")
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner", "repo", "skipped_binary")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner", "repo", "skipped_too_large")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner", "repo", "failed")))
+}
+
+func TestCrawlRepositoryTreeFailure(t *testing.T) {
+	cfg := &config.Config{MaxWorkers: 1, MaxConcurrentFetches: 1, MaxFileSize: 64}
+	pool := NewPool(cfg, metrics.NewForTesting(), &fakeFetcher{treeErr: github.ErrNotFound})
+
+	_, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, github.ErrNotFound)
+	assert.Contains(t, err.Error(), "failed to get repository tree")
+}
+
+func TestCrawlRepositoryKnownSHAs(t *testing.T) {
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: "same.go", Type: "blob", SHA: "s1", Size: 9},
+				{Path: "changed.go", Type: "blob", SHA: "c2", Size: 9},
+				{Path: "new.go", Type: "blob", SHA: "n1", Size: 9},
+				{Path: "notes.bin", Type: "blob", SHA: "b1", Size: 9},
+			},
+		},
+		contents: map[string][]byte{
+			"changed.go": []byte("package c"),
+			"new.go":     []byte("package n"),
+		},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{
+		KnownSHAs: map[string]string{
+			"same.go":    "s1",
+			"changed.go": "c1",
+			"notes.bin":  "b1", // filtered out regardless
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, response.TotalFiles)
+	assert.Equal(t, 2, response.ProcessedFiles)
+	assert.Equal(t, 1, response.UnchangedFiles)
+	assert.Equal(t, 1, response.FilteredFiles)
+	assert.Equal(t, response.TreeFiles, response.TotalFiles+response.FilteredFiles+response.UnchangedFiles)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesProcessedTotal.WithLabelValues("owner", "repo", "unchanged")))
+
+	require.Len(t, response.Files, 3)
+	assert.Equal(t, "changed.go", response.Files[0].Path)
+	assert.Equal(t, []byte("package c"), response.Files[0].Content)
+	assert.Equal(t, "new.go", response.Files[1].Path)
+	assert.Equal(t, model.FileResult{Path: "same.go", SHA: "s1", Size: 9, Status: "unchanged", CrawlID: response.CrawlID}, response.Files[2])
+}
+
+func TestCrawlRepositoryMaxTreeEntries(t *testing.T) {
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: "a.go", Type: "blob", SHA: "a1", Size: 9},
+				{Path: "b.go", Type: "blob", SHA: "b1", Size: 9},
+				{Path: "c.go", Type: "blob", SHA: "c1", Size: 9},
+				{Path: "notes.bin", Type: "blob", SHA: "n1", Size: 9},
+			},
+		},
+		contents: map[string][]byte{
+			"a.go": []byte("package a"),
+			"b.go": []byte("package b"),
+			"c.go": []byte("package c"),
+		},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		MaxTreeEntries:       2,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	_, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.ErrorIs(t, err, ErrCrawlTooLarge)
+	assert.Contains(t, err.Error(), "3 files left after filtering exceed the limit of 2")
+
+	// Files the caller already has don't count towards the limit
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{KnownSHAs: map[string]string{"c.go": "c1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, response.ProcessedFiles)
+
+	response, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{AllowLarge: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, response.ProcessedFiles)
+}
+
+func TestCrawlRepositoryPerExtensionMaxSize(t *testing.T) {
+	data := []byte(strings.Repeat(`{"k": 1}`, 500)) // 4000 bytes, over MaxFileSize
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: "main.go", Type: "blob", SHA: "g1", Size: 12},
+				{Path: "data.json", Type: "blob", SHA: "j1", Size: len(data)},
+				{Path: "huge.md", Type: "blob", SHA: "m1", Size: 200},
+				{Path: "liar.md", Type: "blob", SHA: "m2", Size: 10}, // the tree under-reports its size
+			},
+		},
+		contents: map[string][]byte{
+			"main.go":   []byte("package main"),
+			"data.json": data,
+			"liar.md":   []byte(strings.Repeat("#", 200)),
+		},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go", ".json", ".md"},
+		PerExtensionMaxSize:  map[string]int64{".json": 8192, ".md": 100},
+	}
+	m := metrics.NewForTesting()
+	pool := NewPool(cfg, m, fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+
+	// The data file passes its lenient limit and the oversized markdown is
+	// filtered out of the tree; the under-reported one is caught at fetch time
+	assert.Equal(t, 2, response.ProcessedFiles)
+	assert.Equal(t, 1, response.FilteredFiles)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.FilesFilteredTotal.WithLabelValues("too_large")))
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "liar.md", response.Errors[0].FilePath)
+	assert.Contains(t, response.Errors[0].Error, "exceeds limit 100")
+
+	paths := make([]string, 0, len(response.Files))
+	for _, file := range response.Files {
+		if file.Error == nil {
+			paths = append(paths, file.Path)
+		}
+	}
+	assert.ElementsMatch(t, []string{"main.go", "data.json"}, paths)
+}
+
+func TestTruncateLengthRespectsExtensionLimit(t *testing.T) {
+	cfg := &config.Config{MaxFileSize: 1000, TruncateOversizeBytes: 500}
+
+	assert.Equal(t, int64(500), truncateLength(cfg, 1000))
+	assert.Equal(t, int64(100), truncateLength(cfg, 100), "a stricter extension limit caps the kept bytes")
+}
@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rampUp admits workers to fetch gradually, from initial at once up to max
+// over period, so a crawl starting on a quiet pool doesn't fire MaxWorkers
+// requests in its first second and trip GitHub's secondary rate limit. The
+// ramp starts over once the pool has been idle for a whole period.
+type rampUp struct {
+	mu        sync.Mutex
+	period    time.Duration
+	initial   int
+	max       int
+	active    int
+	start     time.Time
+	idleSince time.Time
+	changed   chan struct{} // closed and replaced whenever a worker leaves
+}
+
+// newRampUp creates a ramp from initial to full concurrent fetches over period
+func newRampUp(period time.Duration, initial, full int) *rampUp {
+	return &rampUp{period: period, initial: initial, max: full, changed: make(chan struct{})}
+}
+
+// admit blocks until the ramp has room for one more fetch or ctx is done;
+// every successful admit must be followed by release
+func (r *rampUp) admit(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		if r.active == 0 && (r.start.IsZero() || now.Sub(r.idleSince) >= r.period) {
+			r.start = now
+		}
+		if r.active < r.allowed(now) {
+			r.active++
+			r.mu.Unlock()
+			return nil
+		}
+		wait, changed := r.untilNext(now), r.changed
+		r.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the slot taken by admit
+func (r *rampUp) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active--
+	if r.active == 0 {
+		r.idleSince = time.Now()
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// allowed returns how many fetches may run at now; the caller must hold r.mu
+func (r *rampUp) allowed(now time.Time) int {
+	elapsed := now.Sub(r.start)
+	if elapsed >= r.period || r.max <= r.initial {
+		return r.max
+	}
+	return r.initial + int(float64(r.max-r.initial)*float64(elapsed)/float64(r.period))
+}
+
+// untilNext returns how long until the ramp allows one more fetch than are
+// running; the caller must hold r.mu
+func (r *rampUp) untilNext(now time.Time) time.Duration {
+	if r.active >= r.max {
+		// Only a release makes room
+		return r.period
+	}
+	step := float64(r.active+1-r.initial) / float64(r.max-r.initial)
+	return max(r.start.Add(time.Duration(step*float64(r.period))).Sub(now), time.Millisecond)
+}
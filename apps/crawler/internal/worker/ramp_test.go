@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestRampUpAllowed(t *testing.T) {
+	r := newRampUp(10*time.Second, 2, 12)
+	r.start = time.Now()
+
+	assert.Equal(t, 2, r.allowed(r.start))
+	assert.Equal(t, 7, r.allowed(r.start.Add(5*time.Second)))
+	assert.Equal(t, 12, r.allowed(r.start.Add(10*time.Second)))
+	assert.Equal(t, 12, r.allowed(r.start.Add(time.Hour)))
+
+	r.active = 2
+	assert.Equal(t, time.Second, r.untilNext(r.start), "the third fetch is allowed a tenth of the way in")
+}
+
+func TestRampUpAdmitsGradually(t *testing.T) {
+	r := newRampUp(200*time.Millisecond, 1, 4)
+	ctx := context.Background()
+
+	require.NoError(t, r.admit(ctx))
+	start := time.Now()
+	for range 3 {
+		require.NoError(t, r.admit(ctx))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 140*time.Millisecond, "the last fetch waits for most of the ramp")
+
+	// At full concurrency another fetch waits for a release, not the clock
+	admitted := make(chan struct{})
+	go func() {
+		assert.NoError(t, r.admit(ctx))
+		close(admitted)
+	}()
+	select {
+	case <-admitted:
+		t.Fatal("admitted beyond the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	r.release()
+	<-admitted
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, r.admit(cancelled), context.Canceled)
+}
+
+func TestRampUpRestartsAfterIdle(t *testing.T) {
+	r := newRampUp(50*time.Millisecond, 1, 4)
+	ctx := context.Background()
+	require.NoError(t, r.admit(ctx))
+	first := r.start
+
+	// A brief gap keeps the ramp's progress
+	r.release()
+	require.NoError(t, r.admit(ctx))
+	assert.Equal(t, first, r.start)
+
+	r.release()
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, r.admit(ctx))
+	assert.True(t, r.start.After(first), "a pool idle for the whole period ramps again")
+}
+
+// peakFetcher records the most fetches running at once
+type peakFetcher struct {
+	*fakeFetcher
+	mu      sync.Mutex
+	current int
+	peaks   []int // fetches running as each one started
+}
+
+func (f *peakFetcher) GetFileContentPrefix(ctx context.Context, owner, repo, path, ref string, limit int64) ([]byte, bool, error) {
+	f.mu.Lock()
+	f.current++
+	f.peaks = append(f.peaks, f.current)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.current--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	return []byte("package a"), false, nil
+}
+
+func TestCrawlRepositoryRampsUp(t *testing.T) {
+	var entries []model.TreeEntry
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		entries = append(entries, model.TreeEntry{Path: name + ".go", Type: "blob", SHA: name, Size: 9})
+	}
+	fetcher := &peakFetcher{fakeFetcher: &fakeFetcher{tree: &model.GitHubTreeResponse{SHA: "root", Tree: entries}}}
+	cfg := &config.Config{
+		MaxWorkers:           8,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		RampUpMS:             10000,
+		RampUpInitialWorkers: 2,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 8, response.ProcessedFiles)
+	assert.LessOrEqual(t, slices.Max(fetcher.peaks), 2, "eight workers fetch no more than two files at once early in the ramp")
+}
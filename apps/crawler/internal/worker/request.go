@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// ValidateRequest checks a crawl request before any crawl starts and returns
+// every problem it finds at once as a *model.ValidationErrors, or nil. The
+// crawl methods still check what they depend on, so this only saves clients
+// from fixing one field per round trip.
+func ValidateRequest(req model.CrawlRequest) error {
+	var v model.ValidationErrors
+
+	if strings.TrimSpace(req.RepoURL) == "" {
+		v.Add("repo_url", "is required")
+	} else if _, _, err := github.ParseRepositoryURL(req.RepoURL); err != nil {
+		v.Add("repo_url", "%v", err)
+	}
+
+	if req.OutputMode != "" && !config.IsValidOutputMode(req.OutputMode) {
+		v.Add("output_mode", "must be one of %s, %s or %s, got %q",
+			model.OutputModeInline, model.OutputModeBase64Explicit, model.OutputModeReference, req.OutputMode)
+	}
+
+	if req.PullRequest < 0 {
+		v.Add("pull_request", "must be a positive pull request number")
+	}
+	if req.MaxPathDepth < 0 {
+		v.Add("max_path_depth", "must be non-negative")
+	}
+
+	for i, name := range req.Languages {
+		if err := ValidateLanguages([]string{name}); err != nil {
+			v.Add(fmt.Sprintf("languages[%d]", i), "%v", err)
+		}
+	}
+
+	for i, path := range req.Paths {
+		if strings.TrimSpace(path) == "" {
+			v.Add(fmt.Sprintf("paths[%d]", i), "must not be empty")
+		}
+	}
+
+	// Explicit paths skip the tree and its filters, and pull request crawls
+	// fetch the changed files, so neither combines with the other options
+	if len(req.Paths) > 0 {
+		if len(req.PathFilter) > 0 || len(req.Languages) > 0 || len(req.AllowedExtensions) > 0 {
+			v.Add("paths", "can't be combined with path_filter, languages or allowed_extensions, which only filter the tree")
+		}
+		if req.PullRequest > 0 {
+			v.Add("paths", "can't be combined with pull_request")
+		}
+	}
+	if req.IncludeTree {
+		if len(req.Paths) > 0 {
+			v.Add("include_tree", "is not supported for explicit path crawls")
+		}
+		if req.PullRequest > 0 {
+			v.Add("include_tree", "is not supported for pull request crawls")
+		}
+	}
+	if req.ResumeFrom != "" {
+		if len(req.Paths) > 0 {
+			v.Add("resume_from", "is not supported for explicit path crawls")
+		}
+		if req.PullRequest > 0 {
+			v.Add("resume_from", "is not supported for pull request crawls")
+		}
+	}
+
+	return v.Err()
+}
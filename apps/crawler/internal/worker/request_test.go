@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    model.CrawlRequest
+		fields []string // fields with errors, in order
+	}{
+		{
+			name: "valid tree crawl",
+			req:  model.CrawlRequest{RepoURL: "owner/repo", Languages: []string{"go"}, PathFilter: []string{"src/"}, OutputMode: model.OutputModeReference},
+		},
+		{
+			name: "valid path crawl",
+			req:  model.CrawlRequest{RepoURL: "https://github.com/owner/repo", Paths: []string{"README.md"}},
+		},
+		{
+			name:   "missing repo url",
+			req:    model.CrawlRequest{RepoURL: "  "},
+			fields: []string{"repo_url"},
+		},
+		{
+			name: "every problem at once",
+			req: model.CrawlRequest{
+				RepoURL:      "https://github.com/owner",
+				OutputMode:   "zip",
+				PullRequest:  -1,
+				MaxPathDepth: -2,
+				Languages:    []string{"go", "klingon", "elvish"},
+			},
+			fields: []string{"repo_url", "output_mode", "pull_request", "max_path_depth", "languages[1]", "languages[2]"},
+		},
+		{
+			name:   "paths with tree filters",
+			req:    model.CrawlRequest{RepoURL: "owner/repo", Paths: []string{"a.go", ""}, Languages: []string{"go"}},
+			fields: []string{"paths[1]", "paths"},
+		},
+		{
+			name:   "paths in a pull request crawl",
+			req:    model.CrawlRequest{RepoURL: "owner/repo", Paths: []string{"a.go"}, PullRequest: 7, ResumeFrom: "9f2c4e1a7b3d5f60"},
+			fields: []string{"paths", "resume_from", "resume_from"},
+		},
+		{
+			name:   "tree in a path crawl",
+			req:    model.CrawlRequest{RepoURL: "owner/repo", Paths: []string{"a.go"}, IncludeTree: true},
+			fields: []string{"include_tree"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRequest(tt.req)
+			if len(tt.fields) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validation *model.ValidationErrors
+			require.True(t, errors.As(err, &validation), "got %v", err)
+			var fields []string
+			for _, e := range validation.Errors {
+				fields = append(fields, e.Field)
+				assert.NotEmpty(t, e.Message)
+			}
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestValidateRequestMessages(t *testing.T) {
+	err := ValidateRequest(model.CrawlRequest{RepoURL: "owner/repo", OutputMode: "zip", Languages: []string{"klingon"}})
+	assert.EqualError(t, err, `invalid request: output_mode must be one of inline, base64-explicit or reference, got "zip"; languages[0] unknown language: "klingon"`)
+}
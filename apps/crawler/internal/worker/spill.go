@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// spillBuffer is a bounded, file-backed FIFO for results that don't fit in the
+// shared result channel. Records are length-prefixed JSON appended to a temp
+// file; the file is truncated whenever the buffer drains so disk usage stays
+// under maxBytes. Only tasks submitted without a result channel of their own
+// reach it: crawls collect through a per-crawl channel with room for every
+// file, which never needs to spill.
+type spillBuffer struct {
+	mu       sync.Mutex
+	file     *os.File
+	writeOff int64
+	readOff  int64
+	pending  int
+	maxBytes int64
+
+	// notify is signalled whenever a record is pushed
+	notify chan struct{}
+}
+
+// spillRecord is the on-disk form of a FileResult; errors and the crawl ID
+// don't survive JSON encoding, so they are stored separately
+type spillRecord struct {
+	Result  model.FileResult `json:"result"`
+	Error   string           `json:"error,omitempty"`
+	CrawlID string           `json:"crawl_id,omitempty"`
+}
+
+// newSpillBuffer creates a spill buffer backed by a temp file in dir
+func newSpillBuffer(dir string, maxBytes int64) (*spillBuffer, error) {
+	file, err := os.CreateTemp(dir, "crawler-results-*.spill")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+
+	return &spillBuffer{
+		file:     file,
+		maxBytes: maxBytes,
+		notify:   make(chan struct{}, 1),
+	}, nil
+}
+
+// push appends a result to the buffer. It returns false if the buffer is full
+// or the write failed, in which case the caller should fall back to blocking.
+func (b *spillBuffer) push(result model.FileResult) bool {
+	record := spillRecord{Result: result, CrawlID: result.CrawlID}
+	if result.Error != nil {
+		record.Error = result.Error.Error()
+		record.Result.Error = nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	size := int64(8 + len(data))
+	if b.writeOff+size > b.maxBytes {
+		return false
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint64(buf, uint64(len(data)))
+	copy(buf[8:], data)
+
+	if _, err := b.file.WriteAt(buf, b.writeOff); err != nil {
+		return false
+	}
+
+	b.writeOff += size
+	b.pending++
+
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// pop removes the oldest result from the buffer
+func (b *spillBuffer) pop() (model.FileResult, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending == 0 {
+		return model.FileResult{}, false
+	}
+
+	header := make([]byte, 8)
+	if _, err := b.file.ReadAt(header, b.readOff); err != nil {
+		return model.FileResult{}, false
+	}
+
+	data := make([]byte, binary.BigEndian.Uint64(header))
+	if _, err := b.file.ReadAt(data, b.readOff+8); err != nil {
+		return model.FileResult{}, false
+	}
+
+	b.readOff += int64(8 + len(data))
+	b.pending--
+
+	// Reclaim disk space once everything has been drained
+	if b.pending == 0 {
+		b.readOff, b.writeOff = 0, 0
+		_ = b.file.Truncate(0)
+	}
+
+	var record spillRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return model.FileResult{}, false
+	}
+
+	result := record.Result
+	result.CrawlID = record.CrawlID
+	if record.Error != "" {
+		result.Error = errors.New(record.Error)
+	}
+
+	return result, true
+}
+
+// len returns the number of results waiting in the buffer
+func (b *spillBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pending
+}
+
+// close closes and removes the backing file
+func (b *spillBuffer) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	name := b.file.Name()
+	if err := b.file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestSpillBufferRoundTrip(t *testing.T) {
+	buf, err := newSpillBuffer(t.TempDir(), 1024*1024)
+	require.NoError(t, err)
+	defer buf.close()
+
+	require.True(t, buf.push(model.FileResult{Path: "a.go", Content: []byte("package a"), CrawlID: "crawl-1"}))
+	require.True(t, buf.push(model.FileResult{Path: "b.go", Error: errors.New("fetch failed")}))
+	assert.Equal(t, 2, buf.len())
+
+	first, ok := buf.pop()
+	require.True(t, ok)
+	assert.Equal(t, "a.go", first.Path)
+	assert.Equal(t, []byte("package a"), first.Content)
+	assert.Equal(t, "crawl-1", first.CrawlID)
+	assert.NoError(t, first.Error)
+
+	second, ok := buf.pop()
+	require.True(t, ok)
+	assert.Equal(t, "b.go", second.Path)
+	assert.EqualError(t, second.Error, "fetch failed")
+
+	_, ok = buf.pop()
+	assert.False(t, ok)
+
+	// The file is truncated once drained
+	info, err := buf.file.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestSpillBufferBound(t *testing.T) {
+	buf, err := newSpillBuffer(t.TempDir(), 128)
+	require.NoError(t, err)
+	defer buf.close()
+
+	assert.True(t, buf.push(model.FileResult{Path: "a.go"}))
+	assert.False(t, buf.push(model.FileResult{Path: "b.go", Content: make([]byte, 256)}))
+	assert.Equal(t, 1, buf.len())
+}
+
+func TestSpillBufferClose(t *testing.T) {
+	buf, err := newSpillBuffer(t.TempDir(), 1024)
+	require.NoError(t, err)
+
+	name := buf.file.Name()
+	require.NoError(t, buf.close())
+
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+}
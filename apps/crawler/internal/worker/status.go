@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// StatusForError returns the HTTP status a server should answer a failed
+// crawl with, so clients can tell a missing repository from a rate limit or
+// an outage rather than getting a 500 for everything. Errors that fit no
+// category, and a nil error, give 500.
+func StatusForError(err error) int {
+	var validation *model.ValidationErrors
+	switch {
+	case err == nil:
+		return http.StatusInternalServerError
+	case errors.As(err, &validation),
+		errors.Is(err, github.ErrInvalidRepositoryURL),
+		errors.Is(err, ErrUnknownLanguage):
+		return http.StatusBadRequest
+	// Checked before the status sentinels, since a rate-limited 403 is also unauthorized
+	case errors.Is(err, github.ErrRateLimited), errors.Is(err, ErrInsufficientQuota):
+		return http.StatusTooManyRequests
+	case errors.Is(err, github.ErrNotFound),
+		errors.Is(err, github.ErrEmptyRepository),
+		errors.Is(err, github.ErrUnprocessable):
+		return http.StatusNotFound
+	case errors.Is(err, github.ErrUnavailableForLegalReasons):
+		return http.StatusUnavailableForLegalReasons
+	case errors.Is(err, ErrCrawlTooLarge), errors.Is(err, ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, github.ErrTransferStalled):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, github.ErrAuthNotConfigured):
+		return http.StatusServiceUnavailable
+	}
+
+	// Anything else GitHub answered with, such as a 5xx or rejected
+	// credentials, is an upstream failure
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) || errors.Is(err, github.ErrServerError) ||
+		errors.Is(err, github.ErrUnauthorized) || errors.Is(err, github.ErrCorruptResponse) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestStatusForError(t *testing.T) {
+	invalid := &model.ValidationErrors{}
+	invalid.Add("repo_url", "is required")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"validation errors", invalid, http.StatusBadRequest},
+		{"invalid repository URL", fmt.Errorf("parse: %w", github.ErrInvalidRepositoryURL), http.StatusBadRequest},
+		{"unknown language", fmt.Errorf("%w: klingon", ErrUnknownLanguage), http.StatusBadRequest},
+		{"repository not found", &github.RepoAccessError{Owner: "o", Repo: "r", Ref: "main", Err: &github.APIError{StatusCode: 404}}, http.StatusNotFound},
+		{"empty repository", fmt.Errorf("tree: %w", &github.APIError{StatusCode: 409}), http.StatusNotFound},
+		{"unknown ref", fmt.Errorf("tree: %w", &github.APIError{StatusCode: 422}), http.StatusNotFound},
+		{"unavailable for legal reasons", &github.APIError{StatusCode: 451}, http.StatusUnavailableForLegalReasons},
+		{"rate limited 403", fmt.Errorf("tree: %w", &github.APIError{StatusCode: 403, RateLimited: true}), http.StatusTooManyRequests},
+		{"rate limited 429", &github.APIError{StatusCode: 429, RateLimited: true}, http.StatusTooManyRequests},
+		{"insufficient quota", fmt.Errorf("%w: needs 500", ErrInsufficientQuota), http.StatusTooManyRequests},
+		{"crawl too large", fmt.Errorf("%w: 9000 files", ErrCrawlTooLarge), http.StatusUnprocessableEntity},
+		{"idempotency key reused", fmt.Errorf("%w: %q", ErrIdempotencyKeyReused, "k"), http.StatusUnprocessableEntity},
+		{"deadline", fmt.Errorf("failed to get repository tree: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"stalled transfer", fmt.Errorf("read: %w", github.ErrTransferStalled), http.StatusGatewayTimeout},
+		{"no credentials", github.ErrAuthNotConfigured, http.StatusServiceUnavailable},
+		{"GitHub server error", fmt.Errorf("tree: %w", &github.APIError{StatusCode: 502}), http.StatusBadGateway},
+		{"rejected credentials", &github.APIError{StatusCode: 401}, http.StatusBadGateway},
+		{"other GitHub status", &github.APIError{StatusCode: 400}, http.StatusBadGateway},
+		{"corrupt response", fmt.Errorf("decode: %w", github.ErrCorruptResponse), http.StatusBadGateway},
+		{"anything else", errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, StatusForError(tt.err))
+		})
+	}
+}
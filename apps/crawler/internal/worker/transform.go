@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"bytes"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+)
+
+// Transform rewrites the content of a fetched file. Transforms run after the
+// binary and encoding checks, so they only ever see valid UTF-8, and must
+// return valid UTF-8. They return a new slice rather than modifying content.
+type Transform func(content []byte) []byte
+
+// utf8BOM is the byte order mark some Windows editors put at the start of
+// UTF-8 files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// builtinTransforms maps the CONTENT_TRANSFORMS names to their transforms
+var builtinTransforms = map[string]Transform{
+	config.TransformStripBOM:               stripBOM,
+	config.TransformNormalizeEOL:           normalizeEOL,
+	config.TransformTrimTrailingWhitespace: trimTrailingWhitespace,
+}
+
+// newTransforms returns the transforms for names in order; the config has
+// already rejected unknown names
+func newTransforms(names []string) []Transform {
+	var transforms []Transform
+	for _, name := range names {
+		if transform, ok := builtinTransforms[name]; ok {
+			transforms = append(transforms, transform)
+		}
+	}
+	return transforms
+}
+
+// stripBOM drops a leading UTF-8 byte order mark
+func stripBOM(content []byte) []byte {
+	return bytes.TrimPrefix(content, utf8BOM)
+}
+
+// normalizeEOL turns CRLF and lone CR line endings into LF
+func normalizeEOL(content []byte) []byte {
+	if bytes.IndexByte(content, '\r') < 0 {
+		return content
+	}
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(content, []byte("\r"), []byte("\n"))
+}
+
+// trimTrailingWhitespace drops spaces and tabs at the end of every line,
+// leaving the line endings themselves alone
+func trimTrailingWhitespace(content []byte) []byte {
+	out := make([]byte, 0, len(content))
+	for len(content) > 0 {
+		line, rest, found := bytes.Cut(content, []byte("\n"))
+		ending := ""
+		if found {
+			ending = "\n"
+		}
+		if trimmed, ok := bytes.CutSuffix(line, []byte("\r")); ok {
+			line, ending = trimmed, "\r"+ending
+		}
+		out = append(out, bytes.TrimRight(line, " \t")...)
+		out = append(out, ending...)
+		content = rest
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/github"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestBuiltinTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		content   string
+		expected  string
+	}{
+		{name: "strip bom", transform: stripBOM, content: "\ufeffpackage main\n", expected: "package main\n"},
+		{name: "strip bom only at the start", transform: stripBOM, content: "a\ufeffb", expected: "a\ufeffb"},
+		{name: "normalize crlf", transform: normalizeEOL, content: "a\r\nb\r\n", expected: "a\nb\n"},
+		{name: "normalize lone cr", transform: normalizeEOL, content: "a\rb\r\nc", expected: "a\nb\nc"},
+		{name: "normalize nothing to do", transform: normalizeEOL, content: "a\nb", expected: "a\nb"},
+		{name: "trim trailing whitespace", transform: trimTrailingWhitespace, content: "a  \n\tb\t\n  \nc ", expected: "a\n\tb\n\nc"},
+		{name: "trim keeps crlf", transform: trimTrailingWhitespace, content: "a \r\nb\t\r\n", expected: "a\r\nb\r\n"},
+		{name: "trim empty", transform: trimTrailingWhitespace, content: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(tt.transform([]byte(tt.content))))
+		})
+	}
+}
+
+func TestCheckContentAppliesTransformsInOrder(t *testing.T) {
+	cfg := &config.Config{
+		MaxFileSize:       1024,
+		ContentTransforms: []string{config.TransformStripBOM, config.TransformNormalizeEOL, config.TransformTrimTrailingWhitespace},
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), &github.Client{})
+
+	task := model.WorkerTask{Path: "main.go", Owner: "owner", Repo: "repo"}
+	result := pool.checkContent(context.Background(), 1, task, []byte("\ufeffpackage main  \r\n\r\nfunc main() {}\r\n"), model.FileResult{Path: "main.go"})
+
+	require.NoError(t, result.Error)
+	assert.Equal(t, "package main\n\nfunc main() {}\n", string(result.Content))
+	assert.Equal(t, len(result.Content), result.Size)
+
+	// Without transforms the content is passed through untouched
+	pool = NewPool(&config.Config{MaxFileSize: 1024}, metrics.NewForTesting(), &github.Client{})
+	result = pool.checkContent(context.Background(), 1, task, []byte("a \r\n"), model.FileResult{Path: "main.go"})
+	assert.Equal(t, "a \r\n", string(result.Content))
+}
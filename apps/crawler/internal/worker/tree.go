@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+// maxTreeWarnings caps the warnings a crawl reports about malformed tree
+// entries; the rest are only counted
+const maxTreeWarnings = 20
+
+// treeWarnings collects anomalies in a repository tree
+type treeWarnings struct {
+	warnings []string
+	dropped  int
+}
+
+// check validates a tree entry, recording a warning for anything GitHub
+// shouldn't have sent, and reports whether the crawl should skip it. Blobs
+// without a SHA are still crawled by path; entries without a path or of an
+// unknown type are skipped.
+func (w *treeWarnings) check(entry model.TreeEntry) (skip bool) {
+	var warning string
+	switch {
+	case entry.Path == "":
+		warning, skip = fmt.Sprintf("skipped %s entry %q without a path", entry.Type, entry.SHA), true
+	case entry.Type != "blob" && entry.Type != "tree" && entry.Type != "commit":
+		warning, skip = fmt.Sprintf("skipped %s: unknown tree entry type %q", entry.Path, entry.Type), true
+	case entry.Type == "blob" && entry.SHA == "":
+		warning = fmt.Sprintf("%s: blob has no SHA", entry.Path)
+	default:
+		return false
+	}
+
+	if len(w.warnings) < maxTreeWarnings {
+		w.warnings = append(w.warnings, warning)
+	} else {
+		w.dropped++
+	}
+	return skip
+}
+
+// list returns the warnings, ending with a count of those past the cap
+func (w *treeWarnings) list() []string {
+	if w.dropped > 0 {
+		return append(slices.Clip(w.warnings), fmt.Sprintf("%d more malformed tree entries", w.dropped))
+	}
+	return w.warnings
+}
+
+// dirMatchesPathFilter reports whether a directory belongs in the tree of a
+// crawl limited to filters: it lies under one, or leads down to one
+func dirMatchesPathFilter(dir string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if strings.HasPrefix(dir, filter) || strings.HasPrefix(filter, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// treeBuilder nests flat tree entries by path
+type treeBuilder struct {
+	node     model.TreeNode
+	children map[string]*treeBuilder
+}
+
+// buildTree nests flat tree entries into a hierarchy. Directories a truncated
+// tree left out are filled in from their files' paths.
+func buildTree(entries []model.TreeEntry) []model.TreeNode {
+	root := &treeBuilder{children: make(map[string]*treeBuilder)}
+	for _, entry := range entries {
+		parent := root.dir(path.Dir(entry.Path))
+		name := path.Base(entry.Path)
+		child, ok := parent.children[name]
+		if !ok {
+			child = &treeBuilder{}
+			parent.children[name] = child
+		}
+		child.node = model.TreeNode{Name: name, Path: entry.Path, Type: entry.Type, SHA: entry.SHA, Size: entry.Size}
+		if entry.Type == "tree" && child.children == nil {
+			child.children = make(map[string]*treeBuilder)
+		}
+	}
+	return root.build()
+}
+
+// dir returns the builder for a directory path, creating it and any missing
+// parents
+func (b *treeBuilder) dir(dir string) *treeBuilder {
+	if dir == "." || dir == "" {
+		return b
+	}
+	parent := b.dir(path.Dir(dir))
+	name := path.Base(dir)
+	child, ok := parent.children[name]
+	if !ok {
+		child = &treeBuilder{node: model.TreeNode{Name: name, Path: dir, Type: "tree"}}
+		parent.children[name] = child
+	}
+	if child.children == nil {
+		child.children = make(map[string]*treeBuilder)
+	}
+	return child
+}
+
+// build returns the builder's children as nodes, directories first and then
+// files, each by name
+func (b *treeBuilder) build() []model.TreeNode {
+	if len(b.children) == 0 {
+		return nil
+	}
+	nodes := make([]model.TreeNode, 0, len(b.children))
+	for _, child := range b.children {
+		node := child.node
+		node.Children = child.build()
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b model.TreeNode) int {
+		if aDir, bDir := a.Type == "tree", b.Type == "tree"; aDir != bDir {
+			if aDir {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return nodes
+}
@@ -0,0 +1,146 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattwyk/autodocs/apps/crawler/internal/config"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/metrics"
+	"github.com/sattwyk/autodocs/apps/crawler/internal/model"
+)
+
+func TestBuildTree(t *testing.T) {
+	tree := buildTree([]model.TreeEntry{
+		{Path: "src", Type: "tree", SHA: "t1"},
+		{Path: "README.md", Type: "blob", SHA: "b1", Size: 10},
+		{Path: "src/main.go", Type: "blob", SHA: "b2", Size: 20},
+		{Path: "docs", Type: "tree", SHA: "t2"},
+		{Path: "src/api", Type: "tree", SHA: "t3"},
+		// A truncated tree may list a file without its directory
+		{Path: "lib/util/strings.go", Type: "blob", SHA: "b3", Size: 30},
+	})
+
+	assert.Equal(t, []model.TreeNode{
+		{Name: "docs", Path: "docs", Type: "tree", SHA: "t2"},
+		{Name: "lib", Path: "lib", Type: "tree", Children: []model.TreeNode{
+			{Name: "util", Path: "lib/util", Type: "tree", Children: []model.TreeNode{
+				{Name: "strings.go", Path: "lib/util/strings.go", Type: "blob", SHA: "b3", Size: 30},
+			}},
+		}},
+		{Name: "src", Path: "src", Type: "tree", SHA: "t1", Children: []model.TreeNode{
+			{Name: "api", Path: "src/api", Type: "tree", SHA: "t3"},
+			{Name: "main.go", Path: "src/main.go", Type: "blob", SHA: "b2", Size: 20},
+		}},
+		{Name: "README.md", Path: "README.md", Type: "blob", SHA: "b1", Size: 10},
+	}, tree)
+
+	assert.Nil(t, buildTree(nil))
+}
+
+func TestDirMatchesPathFilter(t *testing.T) {
+	filters := []string{"src/api/", "docs"}
+	assert.True(t, dirMatchesPathFilter("src", filters), "leads down to a filter")
+	assert.True(t, dirMatchesPathFilter("src/api/v1", filters))
+	assert.True(t, dirMatchesPathFilter("docs", filters))
+	assert.False(t, dirMatchesPathFilter("src/web", filters))
+	assert.False(t, dirMatchesPathFilter("lib", filters))
+	assert.True(t, dirMatchesPathFilter("lib", nil))
+}
+
+func TestCrawlRepositoryIncludeTree(t *testing.T) {
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: "assets", Type: "tree", SHA: "t1"},
+				{Path: "assets/logo.bin", Type: "blob", SHA: "b1", Size: 9},
+				{Path: "cmd", Type: "tree", SHA: "t2"},
+				{Path: "cmd/main.go", Type: "blob", SHA: "b2", Size: 9},
+				{Path: "vendor", Type: "commit", SHA: "c1"},
+			},
+		},
+		contents: map[string][]byte{"cmd/main.go": []byte("package c")},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+		EnableArchiveCrawl:   true,
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{IncludeTree: true})
+	require.NoError(t, err, "the tree is fetched rather than the archive")
+
+	assert.Equal(t, []model.TreeNode{
+		{Name: "assets", Path: "assets", Type: "tree", SHA: "t1"},
+		{Name: "cmd", Path: "cmd", Type: "tree", SHA: "t2", Children: []model.TreeNode{
+			{Name: "main.go", Path: "cmd/main.go", Type: "blob", SHA: "b2", Size: 9},
+		}},
+	}, response.Tree, "filtered files are left out but their directories stay")
+	require.Len(t, response.Files, 1)
+
+	response, err = pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{PathFilter: []string{"cmd/"}})
+	require.NoError(t, err)
+	assert.Nil(t, response.Tree, "only returned on request")
+}
+
+func TestTreeWarnings(t *testing.T) {
+	var warnings treeWarnings
+	assert.False(t, warnings.check(model.TreeEntry{Path: "main.go", Type: "blob", SHA: "a1"}))
+	assert.False(t, warnings.check(model.TreeEntry{Path: "lib", Type: "commit", SHA: "c1"}))
+	assert.Nil(t, warnings.list())
+
+	assert.False(t, warnings.check(model.TreeEntry{Path: "nosha.go", Type: "blob"}), "still crawled by path")
+	assert.True(t, warnings.check(model.TreeEntry{Path: "link", Type: "symlink", SHA: "s1"}))
+	assert.True(t, warnings.check(model.TreeEntry{Type: "blob", SHA: "b1"}))
+	assert.Equal(t, []string{
+		"nosha.go: blob has no SHA",
+		`skipped link: unknown tree entry type "symlink"`,
+		`skipped blob entry "b1" without a path`,
+	}, warnings.list())
+
+	for range maxTreeWarnings + 2 {
+		warnings.check(model.TreeEntry{Path: "x", Type: "weird"})
+	}
+	list := warnings.list()
+	assert.Len(t, list, maxTreeWarnings+1)
+	assert.Equal(t, "5 more malformed tree entries", list[maxTreeWarnings])
+}
+
+func TestCrawlRepositoryReportsMalformedEntries(t *testing.T) {
+	fetcher := &fakeFetcher{
+		tree: &model.GitHubTreeResponse{
+			SHA: "root123",
+			Tree: []model.TreeEntry{
+				{Path: "main.go", Type: "blob", SHA: "a1", Size: 9},
+				{Path: "util.go", Type: "blob", Size: 9},
+				{Path: "odd.go", Type: "symlink", SHA: "s1"},
+			},
+		},
+		contents: map[string][]byte{"main.go": []byte("package a"), "util.go": []byte("package b")},
+	}
+	cfg := &config.Config{
+		MaxWorkers:           1,
+		MaxConcurrentFetches: 10,
+		MaxFileSize:          1024,
+		FetchTimeoutMS:       1000,
+		AllowedExtensions:    []string{".go"},
+	}
+	pool := NewPool(cfg, metrics.NewForTesting(), fetcher)
+	require.NoError(t, pool.Start(context.Background()))
+	defer pool.Stop()
+
+	response, err := pool.CrawlRepository(context.Background(), "owner", "repo", "main", CrawlOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"util.go: blob has no SHA", `skipped odd.go: unknown tree entry type "symlink"`}, response.Warnings)
+	assert.Len(t, response.Files, 2)
+	assert.Equal(t, 2, response.TreeFiles)
+}